@@ -0,0 +1,127 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// Action is a step run on the loaded page before its content is captured,
+// see CrawlOptions.PreActions. It is one of Fill, Click and WaitFor.
+type Action interface {
+	// String describes the action in error messages
+	String() string
+	run(page *rod.Page) error
+	selector() string
+}
+
+// Fill types Value into the input or textarea matching Selector, replacing
+// what it holds
+type Fill struct {
+	Selector string
+	Value    string
+}
+
+// Click clicks the element matching Selector, e.g. a form's submit button
+type Click struct {
+	Selector string
+}
+
+// WaitFor waits until an element matching Selector exists, e.g. after a
+// login redirects to a dashboard
+type WaitFor struct {
+	Selector string
+}
+
+// String describes f without its value, which may be a password
+func (f Fill) String() string { return fmt.Sprintf("fill %q", f.Selector) }
+
+func (c Click) String() string { return fmt.Sprintf("click %q", c.Selector) }
+
+func (w WaitFor) String() string { return fmt.Sprintf("wait for %q", w.Selector) }
+
+func (f Fill) selector() string    { return f.Selector }
+func (c Click) selector() string   { return c.Selector }
+func (w WaitFor) selector() string { return w.Selector }
+
+func (f Fill) run(page *rod.Page) error {
+	el, err := page.Element(f.Selector)
+	if err != nil {
+		return err
+	}
+	if err := el.SelectAllText(); err != nil {
+		return err
+	}
+	return el.Input(f.Value)
+}
+
+func (c Click) run(page *rod.Page) error {
+	el, err := page.Element(c.Selector)
+	if err != nil {
+		return err
+	}
+	return el.Click(proto.InputMouseButtonLeft, 1)
+}
+
+func (w WaitFor) run(page *rod.Page) error {
+	_, err := page.Element(w.Selector)
+	return err
+}
+
+// ActionError reports a PreActions step that failed. It aborts the fetch
+// without retrying.
+type ActionError struct {
+	Index  int    // Position of the action in PreActions
+	Action Action // The action that failed
+	Err    error
+}
+
+func (e *ActionError) Error() string {
+	return fmt.Sprintf("pre-action %d (%s) failed: %v", e.Index+1, e.Action, e.Err)
+}
+
+func (e *ActionError) Unwrap() error {
+	return e.Err
+}
+
+// validateActions rejects missing actions and bad selectors
+func validateActions(actions []Action) error {
+	for i, action := range actions {
+		if action == nil {
+			return fmt.Errorf("pre-action %d is nil", i+1)
+		}
+		if err := validateSelector(action.selector()); err != nil {
+			return fmt.Errorf("pre-action %d (%s): %w", i+1, action, err)
+		}
+	}
+	return nil
+}
+
+// runActions runs opts.PreActions on page in order, giving each
+// SelectorTimeout to find its element
+func runActions(ctx context.Context, page *rod.Page, opts CrawlOptions) error {
+	for i, action := range opts.PreActions {
+		acting := page.Timeout(opts.SelectorTimeout)
+		err := action.run(acting)
+		acting.CancelTimeout()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return &ActionError{Index: i, Action: action, Err: actionCause(err, opts.SelectorTimeout)}
+		}
+	}
+	return nil
+}
+
+// actionCause explains a timeout as the element not being ready in time
+func actionCause(err error, timeout time.Duration) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("no usable matching element within %v", timeout)
+	}
+	return err
+}
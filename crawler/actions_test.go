@@ -0,0 +1,105 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateActions(t *testing.T) {
+	tests := []struct {
+		name    string
+		actions []Action
+		wantErr bool
+	}{
+		{"none", nil, false},
+		{"login", []Action{Fill{"#user", "me"}, Fill{"#password", "secret"}, Click{"button[type=submit]"}, WaitFor{".dashboard"}}, false},
+		{"nil action", []Action{Click{"#go"}, nil}, true},
+		{"empty selector", []Action{WaitFor{" "}}, true},
+		{"invalid selector", []Action{Fill{"input[name=", "me"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateActions(tt.actions); (err != nil) != tt.wantErr {
+				t.Errorf("validateActions = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestActionErrorHidesFillValue(t *testing.T) {
+	err := &ActionError{Index: 1, Action: Fill{"#password", "secret"}, Err: errors.New("element not found")}
+	msg := err.Error()
+	if strings.Contains(msg, "secret") {
+		t.Fatalf("ActionError = %q, want the filled value hidden", msg)
+	}
+	if !strings.Contains(msg, "pre-action 2") || !strings.Contains(msg, "#password") {
+		t.Fatalf("ActionError = %q, want the step and its selector", msg)
+	}
+}
+
+// serveLogin serves a login form whose submit button shows a dashboard when
+// the right credentials are filled in
+func serveLogin(t *testing.T) string {
+	return serveHTML(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><body>
+<form id="login">
+<input id="user"><input id="password" type="password" value="placeholder">
+<button type="button" id="submit">Log in</button>
+</form>
+<script>
+document.getElementById("submit").addEventListener("click", () => {
+	const ok = document.getElementById("user").value === "me" && document.getElementById("password").value === "secret"
+	setTimeout(() => {
+		document.getElementById("login").remove()
+		const p = document.createElement("p")
+		p.className = ok ? "dashboard" : "denied"
+		p.textContent = ok ? "Welcome to your dashboard" : "Access denied"
+		document.body.appendChild(p)
+	}, 200)
+})
+</script>
+</body></html>`))
+	}).URL
+}
+
+func TestPreActionsLogin(t *testing.T) {
+	requireBrowser(t)
+	srv := serveLogin(t)
+
+	opts := localOptions()
+	opts.PreActions = []Action{
+		Fill{Selector: "#user", Value: "me"},
+		Fill{Selector: "#password", Value: "secret"},
+		Click{Selector: "#submit"},
+		WaitFor{Selector: ".dashboard"},
+	}
+	page, err := FetchPageWithOptions(context.Background(), srv, "", opts)
+	if err != nil {
+		t.Fatalf("FetchPageWithOptions: %v", err)
+	}
+	if !strings.Contains(page, "Welcome to your dashboard") {
+		t.Fatalf("page was captured before logging in:\n%s", page)
+	}
+}
+
+func TestPreActionsMissingElement(t *testing.T) {
+	requireBrowser(t)
+	srv := serveLogin(t)
+
+	opts := localOptions()
+	opts.SelectorTimeout = time.Second
+	opts.PreActions = []Action{
+		Fill{Selector: "#user", Value: "me"},
+		Click{Selector: "#no-such-button"},
+	}
+	_, err := FetchPageWithOptions(context.Background(), srv, "", opts)
+	var actionErr *ActionError
+	if !errors.As(err, &actionErr) || actionErr.Index != 1 {
+		t.Fatalf("FetchPageWithOptions = %v, want the click to fail", err)
+	}
+}
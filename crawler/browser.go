@@ -0,0 +1,77 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/launcher"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// withBrowserPool creates a pool for a whole batch unless opts already
+// carries one or proxies are configured (each proxy gets its own browser).
+// The returned func closes whatever was created.
+func withBrowserPool(ctx context.Context, opts CrawlOptions) (CrawlOptions, func()) {
+	if opts.BrowserPool != nil || opts.ProxyPool != nil || len(LoadProxies()) > 0 {
+		return opts, func() {}
+	}
+
+	pool, err := NewBrowserPool(opts.MaxBrowsers, opts.concurrency())
+	if err != nil {
+		opts.logger().Warn("Could not launch browser pool, falling back to one browser per URL", "error", err)
+		return opts, func() {}
+	}
+	opts.BrowserPool = pool
+	return opts, func() { pool.Close() }
+}
+
+// openPage opens a blank tab and returns a func that releases it. Pages come
+// from opts.BrowserPool when set; otherwise a browser is launched just for
+// this page, sending its traffic through proxy if it is a network proxy, or
+// proxy is connected to if it is a remote browser.
+func openPage(ctx context.Context, proxy string, opts CrawlOptions) (*rod.Page, func(), error) {
+	if opts.BrowserPool != nil && proxy == "" {
+		pooled, err := opts.BrowserPool.get(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		return pooled.Context(ctx), func() { opts.BrowserPool.Put(pooled) }, nil
+	}
+
+	browser := rod.New().Context(ctx)
+	cleanup := func() {}
+	switch {
+	case isRemoteBrowser(proxy):
+		browser = browser.ControlURL(proxy)
+	case isNetworkProxy(proxy):
+		server, err := proxyServer(proxy)
+		if err != nil {
+			return nil, nil, err
+		}
+		l := launcher.New().Context(ctx).Proxy(server)
+		controlURL, err := l.Launch()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to launch browser for proxy %s: %w", redactProxy(proxy), err)
+		}
+		browser = browser.ControlURL(controlURL)
+		cleanup = l.Cleanup
+	case proxy != "":
+		return nil, nil, fmt.Errorf("unsupported proxy %s", redactProxy(proxy))
+	}
+	if err := browser.Connect(); err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("failed to connect to browser: %w", err)
+	}
+	release := func() {
+		browser.Close()
+		cleanup()
+	}
+
+	page, err := browser.Page(proto.TargetCreateTarget{})
+	if err != nil {
+		release()
+		return nil, nil, fmt.Errorf("failed to open page: %w", err)
+	}
+	return page, release, nil
+}
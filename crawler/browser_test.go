@@ -0,0 +1,39 @@
+package crawler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-rod/rod/lib/launcher"
+	"golang.org/x/time/rate"
+)
+
+// requireBrowser skips tests and benchmarks that need Chrome where it isn't
+// installed
+func requireBrowser(tb testing.TB) {
+	tb.Helper()
+	if _, found := launcher.LookPath(); !found {
+		tb.Skip("Chrome not found")
+	}
+}
+
+// serveHTML starts a local server answering every request with handler,
+// closed when the test ends
+func serveHTML(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// localOptions returns options for crawling the test servers on 127.0.0.1,
+// without robots.txt checks or rate limits
+func localOptions() CrawlOptions {
+	return CrawlOptions{
+		AllowedHosts: []string{"127.0.0.1"},
+		IgnoreRobots: true,
+		RateLimiter:  NewHostRateLimiter(rate.Inf, 1),
+		MaxRetries:   1,
+	}
+}
@@ -0,0 +1,119 @@
+package crawler
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// captureScreenshot takes a full-page screenshot in the configured format
+func captureScreenshot(page *rod.Page, opts CrawlOptions) ([]byte, error) {
+	req := &proto.PageCaptureScreenshot{Format: proto.PageCaptureScreenshotFormatPng}
+	switch strings.ToLower(opts.ScreenshotFormat) {
+	case "", "png":
+	case "jpeg", "jpg":
+		req.Format = proto.PageCaptureScreenshotFormatJpeg
+		if opts.ScreenshotQuality > 0 {
+			quality := opts.ScreenshotQuality
+			req.Quality = &quality
+		}
+	default:
+		return nil, fmt.Errorf("unsupported screenshot format %q", opts.ScreenshotFormat)
+	}
+
+	data, err := page.Screenshot(true, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to capture screenshot: %w", err)
+	}
+	return data, nil
+}
+
+// captureMHTML archives the page with its resources as a single MHTML
+// document
+func captureMHTML(page *rod.Page) ([]byte, error) {
+	res, err := proto.PageCaptureSnapshot{Format: proto.PageCaptureSnapshotFormatMhtml}.Call(page)
+	if err != nil {
+		return nil, fmt.Errorf("failed to capture MHTML: %w", err)
+	}
+	return []byte(res.Data), nil
+}
+
+// screenshotFileType returns the extension screenshots are saved with
+func screenshotFileType(opts CrawlOptions) string {
+	switch strings.ToLower(opts.ScreenshotFormat) {
+	case "jpeg", "jpg":
+		return "jpg"
+	}
+	return "png"
+}
+
+// PDFOptions controls how pages are rendered to PDF
+type PDFOptions struct {
+	// PaperSize is a named size: "letter" (default), "legal", "a3", "a4" or
+	// "a5". PaperWidth and PaperHeight override it when both are set.
+	PaperSize   string
+	PaperWidth  float64 // Paper width in inches
+	PaperHeight float64 // Paper height in inches
+	Landscape   bool
+	// PrintBackground includes background graphics and colors
+	PrintBackground bool
+	// Scale of the rendering, between 0.1 and 2. Zero means 1.
+	Scale float64
+}
+
+// paperSizes maps named paper sizes to their width and height in inches
+var paperSizes = map[string][2]float64{
+	"letter": {8.5, 11},
+	"legal":  {8.5, 14},
+	"a3":     {11.69, 16.54},
+	"a4":     {8.27, 11.69},
+	"a5":     {5.83, 8.27},
+}
+
+// validate checks the paper size and scale
+func (o PDFOptions) validate() error {
+	if _, ok := paperSizes[strings.ToLower(o.PaperSize)]; o.PaperSize != "" && !ok {
+		return fmt.Errorf("unknown PDF paper size %q", o.PaperSize)
+	}
+	if o.PaperWidth < 0 || o.PaperHeight < 0 {
+		return fmt.Errorf("PDF paper dimensions must not be negative")
+	}
+	if o.Scale != 0 && (o.Scale < 0.1 || o.Scale > 2) {
+		return fmt.Errorf("PDF scale must be between 0.1 and 2")
+	}
+	return nil
+}
+
+// capturePDF renders the loaded page to PDF via CDP Page.printToPDF
+func capturePDF(page *rod.Page, opts PDFOptions) ([]byte, error) {
+	req := &proto.PagePrintToPDF{
+		Landscape:       opts.Landscape,
+		PrintBackground: opts.PrintBackground,
+	}
+	if size, ok := paperSizes[strings.ToLower(opts.PaperSize)]; ok {
+		req.PaperWidth, req.PaperHeight = &size[0], &size[1]
+	}
+	if opts.PaperWidth > 0 && opts.PaperHeight > 0 {
+		width, height := opts.PaperWidth, opts.PaperHeight
+		req.PaperWidth, req.PaperHeight = &width, &height
+	}
+	if opts.Scale != 0 {
+		scale := opts.Scale
+		req.Scale = &scale
+	}
+
+	stream, err := page.PDF(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render PDF: %w", err)
+	}
+	defer stream.Close()
+
+	data, err := io.ReadAll(stream)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PDF: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,52 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMHTMLArchive(t *testing.T) {
+	requireBrowser(t)
+
+	srv := serveHTML(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/style.css":
+			w.Header().Set("Content-Type", "text/css")
+			w.Write([]byte("p { color: teal }"))
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><head><link rel="stylesheet" href="/style.css"></head><body><p>Archived</p></body></html>`))
+		}
+	})
+
+	opts := localOptions()
+	opts.MHTML = true
+	result, err := CrawlURLWithOptions(context.Background(), srv.URL, "", t.TempDir(), opts)
+	if err != nil {
+		t.Fatalf("CrawlURLWithOptions: %v", err)
+	}
+	if filepath.Ext(result.MHTMLPath) != ".mhtml" {
+		t.Fatalf("MHTML saved as %q, want a .mhtml file", result.MHTMLPath)
+	}
+	data, err := os.ReadFile(result.MHTMLPath)
+	if err != nil {
+		t.Fatalf("reading MHTML: %v", err)
+	}
+	// Chrome's archives open with its own From header, then the MIME
+	// header declaring the boundary the page and its resources are split on
+	header, _, _ := bytes.Cut(data, []byte("\r\n\r\n"))
+	for _, want := range []string{"MIME-Version: 1.0", "Content-Type: multipart/related;", "boundary="} {
+		if !bytes.Contains(header, []byte(want)) {
+			t.Errorf("MHTML header is missing %q:\n%s", want, header)
+		}
+	}
+	for _, want := range []string{"Archived", "color: teal"} {
+		if !bytes.Contains(data, []byte(want)) {
+			t.Errorf("MHTML archive is missing %q", want)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package crawler
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+
+	"golang.org/x/net/html/charset"
+)
+
+// Charset declarations in a document's <head>
+var (
+	metaCharsetPattern  = regexp.MustCompile(`(?i)(<meta\s[^>]*?charset\s*=\s*["']?)[-\w:.]+`)
+	utf8DeclaredPattern = regexp.MustCompile(`(?i)^utf-?8$`)
+)
+
+// DecodeHTML returns an HTML document fetched as raw bytes as UTF-8, for
+// callers that fetch pages themselves before extracting them. The encoding,
+// e.g. Shift_JIS, GBK or ISO-8859-1, is taken from contentType, the
+// Content-Type header, then from a BOM or <meta charset> in body, falling
+// back to a guess.
+func DecodeHTML(body []byte, contentType string) (string, error) {
+	reader, err := charset.NewReader(bytes.NewReader(body), contentType)
+	if err != nil {
+		return "", fmt.Errorf("failed to detect charset: %v", err)
+	}
+	decoded, err := io.ReadAll(reader)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode HTML: %v", err)
+	}
+	return string(decoded), nil
+}
+
+// declareUTF8 rewrites the charset declared by <meta> tags in htmlStr to
+// UTF-8. The browser decodes documents itself, so the HTML it serializes is
+// always UTF-8, but it keeps the original declaration, which would make a
+// saved Shift_JIS page show up as mojibake.
+func declareUTF8(htmlStr string) string {
+	return metaCharsetPattern.ReplaceAllStringFunc(htmlStr, func(match string) string {
+		prefix := metaCharsetPattern.FindStringSubmatch(match)[1]
+		if utf8DeclaredPattern.MatchString(match[len(prefix):]) {
+			return match
+		}
+		return prefix + "utf-8"
+	})
+}
@@ -0,0 +1,58 @@
+package crawler
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding/japanese"
+)
+
+func TestDecodeHTMLShiftJIS(t *testing.T) {
+	const text = "日本語のページです"
+	encode := func(t *testing.T, s string) []byte {
+		t.Helper()
+		encoded, err := japanese.ShiftJIS.NewEncoder().String(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return []byte(encoded)
+	}
+
+	tests := []struct {
+		name        string
+		html        string
+		contentType string
+	}{
+		{"meta charset", `<html><head><meta charset="Shift_JIS"></head><body><p>` + text + `</p></body></html>`, ""},
+		{"meta http-equiv", `<html><head><meta http-equiv="Content-Type" content="text/html; charset=shift_jis"></head><body><p>` + text + `</p></body></html>`, "text/html"},
+		{"content type only", `<html><body><p>` + text + `</p></body></html>`, "text/html; charset=Shift_JIS"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoded, err := DecodeHTML(encode(t, tt.html), tt.contentType)
+			if err != nil {
+				t.Fatalf("DecodeHTML: %v", err)
+			}
+			if !strings.Contains(decoded, "<p>"+text+"</p>") {
+				t.Fatalf("DecodeHTML = %q, want it to contain %q", decoded, text)
+			}
+		})
+	}
+}
+
+func TestDeclareUTF8(t *testing.T) {
+	tests := []struct {
+		html string
+		want string
+	}{
+		{`<meta charset="Shift_JIS">`, `<meta charset="utf-8">`},
+		{`<meta http-equiv="Content-Type" content="text/html; charset=EUC-JP">`, `<meta http-equiv="Content-Type" content="text/html; charset=utf-8">`},
+		{`<meta charset=UTF-8>`, `<meta charset=UTF-8>`},
+		{`<p>charset=Shift_JIS</p>`, `<p>charset=Shift_JIS</p>`},
+	}
+	for _, tt := range tests {
+		if got := declareUTF8(tt.html); got != tt.want {
+			t.Errorf("declareUTF8(%q) = %q, want %q", tt.html, got, tt.want)
+		}
+	}
+}
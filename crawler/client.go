@@ -0,0 +1,122 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ErrCrawlerClosed is returned by the methods of a Crawler after Close
+var ErrCrawlerClosed = errors.New("crawler is closed")
+
+// Crawler crawls with the same options across calls, keeping one browser
+// pool open between them, and owns what the options hold: Close shuts down
+// the browser pool and closes the Streamer, such as a storage.KafkaWriter,
+// the WARC writer and the DedupStore and VisitedStore if they have a Close
+// method. A Crawler is safe for concurrent use.
+type Crawler struct {
+	opts CrawlOptions
+
+	// mu is held shared by crawls and exclusively by Close, so Close waits
+	// for the crawls in progress
+	mu       sync.RWMutex
+	closed   bool
+	poolOnce sync.Once
+}
+
+// New creates a Crawler writing to opts.OutputDir. Its browser pool is
+// launched by the first crawl, unless opts.BrowserPool is set or proxies
+// are used. Close it when done.
+func New(opts CrawlOptions) *Crawler {
+	return &Crawler{opts: opts}
+}
+
+// Crawl fetches, converts and saves url like CrawlURLWithOptions
+func (c *Crawler) Crawl(url string) (CrawlResult, error) {
+	return c.CrawlCtx(context.Background(), url)
+}
+
+// CrawlCtx is like Crawl but stops once ctx is cancelled
+func (c *Crawler) CrawlCtx(ctx context.Context, url string) (CrawlResult, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.closed {
+		return CrawlResult{URL: url, Error: ErrCrawlerClosed}, ErrCrawlerClosed
+	}
+	opts := c.options()
+	return CrawlURLWithOptions(ctx, url, "", opts.OutputDir, opts)
+}
+
+// CrawlAll crawls urls concurrently like CrawlURLsWithOptions, returning a
+// result per URL in the same order
+func (c *Crawler) CrawlAll(urls []string) []CrawlResult {
+	return c.CrawlAllCtx(context.Background(), urls)
+}
+
+// CrawlAllCtx is like CrawlAll but stops once ctx is cancelled
+func (c *Crawler) CrawlAllCtx(ctx context.Context, urls []string) []CrawlResult {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.closed {
+		results := make([]CrawlResult, len(urls))
+		for i, url := range urls {
+			results[i] = CrawlResult{URL: url, Error: ErrCrawlerClosed}
+		}
+		return results
+	}
+	opts := c.options()
+	return CrawlURLsWithOptions(ctx, urls, opts.OutputDir, opts)
+}
+
+// Close waits for the crawls in progress, then shuts down the browser pool
+// and closes the sinks and stores of the options, flushing what they
+// buffer. It returns their errors joined. Closing twice does nothing.
+func (c *Crawler) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+
+	var errs []error
+	if c.opts.BrowserPool != nil {
+		if err := c.opts.BrowserPool.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("error closing browser pool: %w", err))
+		}
+	}
+	if c.opts.Streamer != nil {
+		if err := c.opts.Streamer.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("error closing streamer: %w", err))
+		}
+	}
+	if c.opts.WARC != nil {
+		if err := c.opts.WARC.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("error closing WARC writer: %w", err))
+		}
+	}
+	if closer, ok := c.opts.DedupStore.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("error closing dedup store: %w", err))
+		}
+	}
+	if closer, ok := c.opts.VisitedStore.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("error closing visited store: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// options returns the options to crawl with, launching the browser pool on
+// first use. It must be called with mu held.
+func (c *Crawler) options() CrawlOptions {
+	c.poolOnce.Do(func() {
+		// The pool outlives the calls, so it isn't tied to their contexts.
+		// Close shuts it down as opts.BrowserPool.
+		c.opts, _ = withBrowserPool(context.Background(), c.opts)
+	})
+	return c.opts
+}
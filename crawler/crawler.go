@@ -2,122 +2,132 @@ package crawler
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"math/rand"
 	"net"
+	"net/http"
 	"net/url"
-	"os"
 	"pathik/storage"
+	"runtime/debug"
 	"strings"
 	"sync"
 	"time"
 
-	md "github.com/JohannesKaufmann/html-to-markdown"
 	"github.com/go-rod/rod"
-	"github.com/go-shiori/go-readability"
-	"golang.org/x/time/rate"
 )
 
 // Configuration parameters
 var (
-	// Rate limiter to prevent DOS attacks - default 1 request per second
-	rateLimiter = rate.NewLimiter(rate.Limit(1), 3) // 1 req/sec with burst of 3
-
 	userAgents = []string{ // User-agents for rotation
 		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
 		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
 		"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
 	}
-	maxRetries            = 3                // Number of retries for failed fetches
-	retryDelay            = 2 * time.Second  // Delay between retries
-	maxConcurrent         = 5                // Max concurrent crawls
-	minContentLength      = 5000             // Min HTML length to assume page is complete
-	stabilityCheckTimeout = 3 * time.Second  // Timeout for dynamic content stability wait
-	maxContentLength      = 20 * 1024 * 1024 // 20 MB max content size
+	maxRetries            = 3               // Number of retries for failed fetches
+	retryDelay            = 2 * time.Second // Default delay between retries
+	maxConcurrent         = 5               // Default max concurrent crawls
+	minContentLength      = 5000            // Min HTML length to assume page is complete
+	stabilityCheckTimeout = 3 * time.Second // Default timeout for dynamic content stability wait
 )
 
-// LoadProxies loads proxies from environment variables
-func LoadProxies() []string {
-	// Check environment variable for proxy list
-	proxyEnv := strings.TrimSpace(os.Getenv("PATHIK_PROXIES"))
-	if proxyEnv == "" {
-		return []string{}
-	}
-
-	// Split by commas
-	proxies := strings.Split(proxyEnv, ",")
+// ErrNavigationTimeout is returned when a page doesn't finish loading within
+// CrawlOptions.NavigationTimeout
+var ErrNavigationTimeout = errors.New("navigation timed out")
 
-	// Validate proxy URLs
-	var validProxies []string
-	for _, p := range proxies {
-		if strings.HasPrefix(p, "ws://") || strings.HasPrefix(p, "wss://") {
-			validProxies = append(validProxies, strings.TrimSpace(p))
-		} else {
-			log.Printf("Warning: Invalid proxy format for %s, must start with ws:// or wss://", p)
-		}
-	}
+// ErrPrivateAddress is returned when a page turns out to be served from a
+// private address even though its host resolved to public ones when it was
+// validated, as in a DNS rebinding attack, or after a redirect
+var ErrPrivateAddress = errors.New("served from a private address")
 
-	return validProxies
-}
+// ErrNotModified is returned when a conditional fetch is answered with 304
+// Not Modified, so the stored copy of the page is still current
+var ErrNotModified = errors.New("not modified")
 
-// getRandomProxy returns a random proxy from the loaded list
-func getRandomProxy() string {
-	proxies := LoadProxies()
-	if len(proxies) == 0 {
-		return ""
-	}
-	return proxies[rand.Intn(len(proxies))]
-}
+// ErrBudgetExceeded is wrapped by the errors of the URLs a batch crawl
+// didn't get to or didn't finish within CrawlOptions.TotalTimeout
+var ErrBudgetExceeded = errors.New("crawl time budget exceeded")
 
 // getRandomUserAgent returns a random user-agent from the list
 func getRandomUserAgent() string {
 	return userAgents[rand.Intn(len(userAgents))]
 }
 
+// pickUserAgent returns the pinned user-agent of opts, or a random one from
+// its rotation pool, falling back to the emulated device's and then to the
+// default list
+func pickUserAgent(opts CrawlOptions) string {
+	if opts.UserAgent != "" {
+		return opts.UserAgent
+	}
+	if len(opts.UserAgents) > 0 {
+		return opts.UserAgents[rand.Intn(len(opts.UserAgents))]
+	}
+	if opts.Device != nil && opts.Device.UserAgent != "" {
+		return opts.Device.UserAgent
+	}
+	return getRandomUserAgent()
+}
+
 // isPrivateIP checks if an IP address is private
 func isPrivateIP(ipStr string) bool {
 	ip := net.ParseIP(ipStr)
 	if ip == nil {
 		return false
 	}
-
-	// Get the IPv4 representation
-	ipv4 := ip.To4()
-	if ipv4 == nil {
-		// Not an IPv4 address
-		return false
+	if ip.IsUnspecified() {
+		return true
 	}
-
-	// Check for private IP ranges
-	privateRanges := []struct {
-		start net.IP
-		end   net.IP
-	}{
-		{net.ParseIP("10.0.0.0").To4(), net.ParseIP("10.255.255.255").To4()},
-		{net.ParseIP("172.16.0.0").To4(), net.ParseIP("172.31.255.255").To4()},
-		{net.ParseIP("192.168.0.0").To4(), net.ParseIP("192.168.255.255").To4()},
-		{net.ParseIP("127.0.0.0").To4(), net.ParseIP("127.255.255.255").To4()},
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return true
+		}
 	}
+	return false
+}
 
-	for _, r := range privateRanges {
-		if r.start == nil || r.end == nil {
-			continue
-		}
+// privateNetworks are the address blocks crawls must not reach. IPv4-mapped
+// IPv6 addresses such as ::ffff:10.0.0.1 match the IPv4 blocks.
+var privateNetworks = mustParseCIDRs(
+	"0.0.0.0/8",      // "This" network, which reaches the local host
+	"10.0.0.0/8",     // Private
+	"100.64.0.0/10",  // Carrier-grade NAT
+	"127.0.0.0/8",    // Loopback
+	"169.254.0.0/16", // Link-local, including cloud metadata endpoints
+	"172.16.0.0/12",  // Private
+	"192.168.0.0/16", // Private
+	"::1/128",        // IPv6 loopback
+	"fc00::/7",       // IPv6 unique local
+	"fe80::/10",      // IPv6 link-local
+	"ff02::/16",      // IPv6 link-local multicast
+)
 
-		if ipv4[0] == r.start[0] &&
-			ipv4[1] >= r.start[1] &&
-			ipv4[1] <= r.end[1] {
-			return true
+// mustParseCIDRs parses CIDR blocks, panicking on invalid ones
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(fmt.Sprintf("invalid CIDR %q: %v", cidr, err))
 		}
+		networks[i] = network
 	}
-
-	return false
+	return networks
 }
 
-// ValidateURL checks if a URL is safe to crawl
+// ValidateURL checks if a URL is safe to crawl. The browser resolves the
+// host again when it connects, so as SSRF hardening crawls also check the
+// address each document was actually served from; see ErrPrivateAddress.
 func ValidateURL(rawURL string) error {
+	return ValidateURLWithOptions(rawURL, CrawlOptions{})
+}
+
+// ValidateURLWithOptions is like ValidateURL but lets opts permit private
+// networks or specific hosts, and reports DNS problems to opts.Logger
+func ValidateURLWithOptions(rawURL string, opts CrawlOptions) error {
 	parsedURL, err := url.Parse(rawURL)
 	if err != nil {
 		return fmt.Errorf("invalid URL format: %v", err)
@@ -128,6 +138,12 @@ func ValidateURL(rawURL string) error {
 		return fmt.Errorf("only HTTP and HTTPS schemes are allowed")
 	}
 
+	// Trusted internal crawls may opt out of the private network checks
+	if opts.AllowPrivateNetworks || opts.allowsHost(parsedURL.Hostname()) {
+		return nil
+	}
+	logger := opts.logger()
+
 	// Some URLs might not need IP resolution (e.g., localhost)
 	if parsedURL.Hostname() == "localhost" || parsedURL.Hostname() == "127.0.0.1" {
 		return fmt.Errorf("localhost access is restricted for security")
@@ -138,13 +154,13 @@ func ValidateURL(rawURL string) error {
 	ips, err := net.LookupIP(host)
 	if err != nil {
 		// If we can't resolve the hostname, allow it (might be temporary DNS issue)
-		log.Printf("Warning: Could not resolve hostname %s: %v", host, err)
+		logger.Warn("Could not resolve hostname", "host", host, "error", err)
 		return nil
 	}
 
 	// No IPs found
 	if len(ips) == 0 {
-		log.Printf("Warning: No IPs found for hostname %s", host)
+		logger.Warn("No IPs found for hostname", "host", host)
 		return nil
 	}
 
@@ -158,101 +174,426 @@ func ValidateURL(rawURL string) error {
 	return nil
 }
 
+// checkPeerAddresses re-validates the addresses the browser connected to
+// for the main document and its redirects, which ValidateURL's own DNS
+// lookup can't vouch for. Unknown addresses, e.g. cached responses, pass.
+func checkPeerAddresses(peers []peerAddress, opts CrawlOptions) error {
+	if opts.AllowPrivateNetworks {
+		return nil
+	}
+	for _, peer := range peers {
+		if peer.IP == "" || opts.allowsHost(hostOf(peer.URL)) {
+			continue
+		}
+		// CDP reports IPv6 addresses in brackets
+		if isPrivateIP(strings.Trim(peer.IP, "[]")) {
+			return fmt.Errorf("%s: %w %s", peer.URL, ErrPrivateAddress, peer.IP)
+		}
+	}
+	return nil
+}
+
 // FetchPage retrieves HTML from a URL with retries and smart dynamic content handling
 func FetchPage(url string, proxy string) (string, error) {
-	// Validate URL before fetching
-	if err := ValidateURL(url); err != nil {
+	return FetchPageCtx(context.Background(), url, proxy)
+}
+
+// FetchPageCtx is like FetchPage but aborts the rate-limit wait, the browser
+// navigation and any pending retries once ctx is cancelled
+func FetchPageCtx(ctx context.Context, url string, proxy string) (string, error) {
+	return FetchPageWithOptions(ctx, url, proxy, CrawlOptions{})
+}
+
+// FetchPageWithOptions is like FetchPageCtx but applies the given options
+func FetchPageWithOptions(ctx context.Context, url string, proxy string, opts CrawlOptions) (string, error) {
+	capture, err := fetchCapture(ctx, url, proxy, opts, validators{})
+	if err != nil {
 		return "", err
 	}
+	return capture.HTML, nil
+}
+
+// PageResponse is a fetched page along with the validators of its response
+type PageResponse struct {
+	HTML         string
+	ETag         string // ETag header, if any
+	LastModified string // Last-Modified header, if any
+}
+
+// FetchPageWithResponse is like FetchPageWithOptions but also returns the
+// response's validators. With opts.DedupStore it fetches conditionally: the
+// validators stored for url are sent as If-None-Match and If-Modified-Since,
+// a 304 response returns ErrNotModified, and the validators of any other
+// response are stored for the next fetch.
+func FetchPageWithResponse(ctx context.Context, url string, proxy string, opts CrawlOptions) (*PageResponse, error) {
+	var record storage.DedupRecord
+	if opts.DedupStore != nil {
+		var err error
+		if record, _, err = opts.DedupStore.Get(ctx, url); err != nil {
+			return nil, fmt.Errorf("error reading dedup record of %s: %w", url, err)
+		}
+	}
 
-	// Apply rate limiting
-	if err := rateLimiter.Wait(context.Background()); err != nil {
-		return "", fmt.Errorf("rate limit error: %v", err)
+	capture, err := fetchCapture(ctx, url, proxy, opts, validators{ETag: record.ETag, LastModified: record.LastModified})
+	if err != nil {
+		return nil, err
 	}
 
-	for attempt := 0; attempt < maxRetries; attempt++ {
-		browser := rod.New()
-		if proxy != "" {
-			browser = browser.ControlURL(proxy)
+	if opts.DedupStore != nil {
+		// The content hash is left to crawls, which save the content
+		record.ETag = capture.ETag
+		record.LastModified = capture.LastModified
+		record.CrawledAt = time.Now().UTC()
+		if err := opts.DedupStore.Put(ctx, url, record); err != nil {
+			return nil, fmt.Errorf("error saving dedup record of %s: %w", url, err)
 		}
-		browser = browser.MustConnect()
-		defer browser.MustClose()
+	}
+	return &PageResponse{HTML: capture.HTML, ETag: capture.ETag, LastModified: capture.LastModified}, nil
+}
 
-		page := browser.MustPage(url)
-		page.MustEval(`() => { navigator.userAgent = "` + getRandomUserAgent() + `" }`)
-		page.MustWaitLoad() // Wait for initial page load
+// validators are the ETag and Last-Modified of a stored copy of a page, sent
+// with a fetch so the server can answer 304 Not Modified. Empty ones aren't
+// sent.
+type validators struct {
+	ETag         string
+	LastModified string
+}
 
-		// Get initial HTML
-		html, err := page.HTML()
-		if err != nil {
-			log.Printf("Attempt %d failed to get HTML for %s: %v", attempt+1, url, err)
-			time.Sleep(retryDelay)
-			continue
+// headers returns the conditional request headers for v
+func (v validators) headers() map[string]string {
+	headers := make(map[string]string)
+	if v.ETag != "" {
+		headers["If-None-Match"] = v.ETag
+	}
+	if v.LastModified != "" {
+		headers["If-Modified-Since"] = v.LastModified
+	}
+	return headers
+}
+
+// pageCapture holds everything collected from a page while it was open
+type pageCapture struct {
+	HTML       string                 // Rendered HTML of the page
+	Selected   []string               // Matches of CrawlOptions.Selector
+	Selections map[string][]string    // Matches of CrawlOptions.Selectors by name
+	Fields     map[string]interface{} // Record scraped with CrawlOptions.ExtractSchema
+	Screenshot []byte                 // Full-page screenshot when requested
+	PDF        []byte                 // PDF rendering when requested
+	MHTML      []byte                 // MHTML archive when requested
+	Resources  []capturedResource     // Resources the page loaded when requested
+	HAR        []byte                 // HAR of the page's network activity when requested
+	Metrics    *PageMetrics           // Performance metrics when requested
+	Exchange   *warcExchange          // Main document response for CrawlOptions.WARC
+	EvalResult json.RawMessage        // Result of CrawlOptions.EvalJS as JSON
+
+	ETag            string // ETag header of the main document, if any
+	LastModified    string // Last-Modified header of the main document, if any
+	ContentLanguage string // Content-Language header of the main document, if any
+
+	RedirectChain []string // URLs the main document was redirected through
+	Truncated     bool     // Whether HTML was cut to CrawlOptions.MaxContentBytes
+}
+
+// fetchCapture validates, rate limits and fetches url with retries, sending
+// cond with the request for the page
+func fetchCapture(ctx context.Context, url string, proxy string, opts CrawlOptions, cond validators) (*pageCapture, error) {
+	opts = opts.withDefaults()
+
+	// Validate URL and options before fetching
+	if err := ValidateURLWithOptions(url, opts); err != nil {
+		return nil, err
+	}
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	if err := validateCookies(url, opts.Cookies); err != nil {
+		return nil, err
+	}
+
+	// Honor robots.txt unless told otherwise
+	if err := checkRobots(ctx, url, proxy, opts); err != nil {
+		return nil, err
+	}
+
+	// Apply per-host rate limiting to prevent DOS attacks
+	if err := waitForRateLimit(ctx, url, opts); err != nil {
+		return nil, fmt.Errorf("rate limit error: %w", err)
+	}
+
+	// Without an explicit proxy each attempt takes one from the pool, so a
+	// retry after a proxy failure goes through a healthy one
+	pooled := proxy == "" && opts.ProxyPool != nil
+	fetchErr := &FetchError{URL: url}
+	for fetchErr.Attempts < opts.MaxRetries {
+		fetchErr.Attempts++
+		attemptProxy := proxy
+		if pooled {
+			attemptProxy = opts.ProxyPool.Get(hostOf(url))
+		}
+		capture, err := fetchAttempt(ctx, url, attemptProxy, opts, cond)
+		if err == nil || errors.Is(err, ErrNotModified) {
+			if pooled {
+				opts.ProxyPool.MarkSucceeded(attemptProxy)
+			}
+			return capture, err
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
 		}
+		fetchErr.Err = err
+		fetchErr.StatusCode, fetchErr.Retryable = classifyError(err)
+		// An HTTP response means the proxy itself worked. Otherwise the retry
+		// moves the host off its sticky proxy, even before that's benched.
+		if pooled && fetchErr.StatusCode == 0 && fetchErr.Retryable {
+			opts.ProxyPool.MarkFailed(attemptProxy)
+			opts.ProxyPool.Release(hostOf(url))
+		}
+		opts.logger().Warn("Fetch attempt failed", "url", url, "attempt", fetchErr.Attempts, "error", err)
 
-		// Check content length limit
-		if len(html) > maxContentLength {
-			log.Printf("Content length exceeds limit (%d > %d bytes), truncating",
-				len(html), maxContentLength)
-			html = html[:maxContentLength]
+		// Permanent failures such as a 404 won't go away on retry
+		if !fetchErr.Retryable {
+			break
+		}
+		if fetchErr.Attempts < opts.MaxRetries {
+			if err := sleepCtx(ctx, retryWait(opts, fetchErr.Attempts, err)); err != nil {
+				return nil, err
+			}
 		}
+	}
+	return nil, fetchErr
+}
+
+// fetchAttempt loads url once and captures its content
+func fetchAttempt(ctx context.Context, url string, proxy string, opts CrawlOptions, cond validators) (*pageCapture, error) {
+	page, release, err := openPage(ctx, proxy, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	// Request interception has to be in place before navigation starts
+	var resources *resourceCollector
+	if opts.CaptureResources {
+		resources = newResourceCollector(opts.logger())
+	}
+	navigations := newNavigationGuard(url, opts)
+	stopInterceptor, err := startInterceptor(ctx, page, url, proxy, opts, cond, resources, navigations)
+	if err != nil {
+		return nil, err
+	}
+	defer stopInterceptor()
+
+	if err := preparePage(page, url, opts); err != nil {
+		return nil, err
+	}
+	// Record the document response to catch HTTP errors
+	responses, stopTracking := trackDocumentResponse(ctx, page)
+	defer stopTracking()
+
+	var har *harRecorder
+	if opts.HAR {
+		var stopHAR func()
+		har, stopHAR = recordHAR(ctx, page, url)
+		defer stopHAR()
+	}
+
+	waiter := startContentWait(ctx, page, opts)
+	defer waiter.stop()
 
-		// If HTML is long enough, assume it's complete and return
-		if len(html) >= minContentLength {
-			return html, nil
+	if err := navigate(ctx, page, url, opts.NavigationTimeout); err != nil {
+		// A refused redirect fails the navigation, the guard knows why
+		if refused := navigations.failure(); refused != nil {
+			return nil, refused
+		}
+		return nil, err
+	}
+	// Browsers that don't tell the interceptor about redirects are held to
+	// the limit once the page is loaded
+	chain := responses.redirectChain()
+	if len(chain) > 0 {
+		if err := checkRedirectCount(len(chain)-1, opts.MaxRedirects); err != nil {
+			return nil, err
+		}
+	}
+	// Behind a network proxy the peer is the proxy itself, which does the
+	// resolving, so only ValidateURL's own checks apply
+	if !isNetworkProxy(proxy) {
+		if err := checkPeerAddresses(responses.peerAddresses(), opts); err != nil {
+			return nil, err
 		}
+	}
+	// The page rendered from a 304 is empty, the stored copy is current
+	if resp := responses.response(); resp != nil && resp.StatusCode == http.StatusNotModified {
+		return nil, ErrNotModified
+	}
+	if err := checkResponse(responses.response()); err != nil {
+		return nil, err
+	}
+	if err := runActions(ctx, page, opts); err != nil {
+		return nil, err
+	}
+	if err := autoScroll(ctx, page, url, opts); err != nil {
+		return nil, err
+	}
 
-		// HTML is short; wait for dynamic content
-		err = page.WaitStable(stabilityCheckTimeout)
-		if err != nil {
-			log.Printf("Stability timeout for %s after %v; using current HTML", url, stabilityCheckTimeout)
+	html, err := waiter.wait(ctx, page, url)
+	if err != nil {
+		return nil, err
+	}
+	// PreActions or the page's own scripts may have tried to navigate
+	// somewhere refused, leaving an error page behind
+	if refused := navigations.failure(); refused != nil {
+		return nil, refused
+	}
+	html, truncated := truncateHTML(html, opts)
+	capture := &pageCapture{
+		HTML:      declareUTF8(html),
+		Truncated: truncated,
+		Resources: resources.list(),
+
+		RedirectChain: chain,
+	}
+	if resp := responses.response(); resp != nil {
+		capture.ETag = resp.Header.Get("ETag")
+		capture.LastModified = resp.Header.Get("Last-Modified")
+		capture.ContentLanguage = resp.Header.Get("Content-Language")
+	}
+
+	// Read the timings before a screenshot scrolls in lazy content
+	if opts.CollectMetrics {
+		if capture.Metrics, err = collectMetrics(page); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Screenshot {
+		if capture.Screenshot, err = captureScreenshot(page, opts); err != nil {
+			return nil, err
+		}
+	}
+	if opts.PDF {
+		if capture.PDF, err = capturePDF(page, opts.PDFOptions); err != nil {
+			return nil, err
+		}
+	}
+	if opts.MHTML {
+		if capture.MHTML, err = captureMHTML(page); err != nil {
+			return nil, err
 		}
+	}
+	if resp := responses.response(); resp != nil && opts.WARC != nil {
+		if capture.Exchange, err = captureExchange(page, resp); err != nil {
+			return nil, err
+		}
+	}
+	if har != nil {
+		if capture.HAR, err = har.encode(); err != nil {
+			return nil, fmt.Errorf("failed to encode HAR: %w", err)
+		}
+	}
 
-		// Get final HTML after stability check
-		html, err = page.HTML()
-		if err == nil {
-			// Check content length limit again
-			if len(html) > maxContentLength {
-				log.Printf("Content length exceeds limit (%d > %d bytes), truncating",
-					len(html), maxContentLength)
-				html = html[:maxContentLength]
-			}
-			return html, nil
+	if opts.EvalJS != "" {
+		if capture.EvalResult, err = evalPage(ctx, page, opts); err != nil {
+			return nil, err
 		}
-		log.Printf("Attempt %d failed for %s: %v", attempt+1, url, err)
-		time.Sleep(retryDelay)
 	}
-	return "", fmt.Errorf("failed to fetch %s after %d attempts", url, maxRetries)
+	// Run selector extraction while the page is still open
+	if err := captureSelections(page, opts, capture); err != nil {
+		return nil, err
+	}
+	return capture, nil
 }
 
-// ExtractHTMLContent extracts main content HTML using Readability
-func ExtractHTMLContent(htmlStr, urlStr string) (string, error) {
-	parsedURL, err := url.Parse(urlStr)
+// navigate opens url and waits for the initial load, giving up after timeout
+// when it is non-zero
+func navigate(ctx context.Context, page *rod.Page, url string, timeout time.Duration) error {
+	loading := page
+	if timeout > 0 {
+		loading = page.Timeout(timeout)
+		defer loading.CancelTimeout()
+	}
+
+	err := loading.Navigate(url)
+	if err == nil {
+		err = loading.WaitLoad() // Wait for initial page load
+	}
+	if err == nil {
+		return nil
+	}
+	if timeout > 0 && ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %s did not load within %v", ErrNavigationTimeout, url, timeout)
+	}
+	return fmt.Errorf("failed to load page: %w", err)
+}
+
+// waitForContent returns the page HTML, waiting up to timeout for dynamic
+// content to settle when the initial document looks incomplete
+func waitForContent(ctx context.Context, page *rod.Page, url string, timeout time.Duration, logger *slog.Logger) (string, error) {
+	// Get initial HTML
+	html, err := page.HTML()
 	if err != nil {
-		return "", fmt.Errorf("failed to parse URL %s: %v", urlStr, err)
+		return "", fmt.Errorf("failed to get HTML: %w", err)
 	}
-	article, err := readability.FromReader(strings.NewReader(htmlStr), parsedURL)
+
+	// If HTML is long enough, assume it's complete and return
+	if len(html) >= minContentLength {
+		return html, nil
+	}
+
+	// HTML is short; wait for dynamic content
+	err = page.WaitStable(timeout)
 	if err != nil {
-		return "", fmt.Errorf("failed to extract content from %s: %v", urlStr, err)
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		logger.Warn("Stability timeout; using current HTML", "url", url, "timeout", timeout)
+	}
+
+	// Get final HTML after stability check
+	html, err = page.HTML()
+	if err != nil {
+		return "", fmt.Errorf("failed to get HTML: %w", err)
+	}
+	return html, nil
+}
+
+// truncateHTML enforces opts.MaxContentBytes, with its default applied, and
+// reports whether it cut html
+func truncateHTML(html string, opts CrawlOptions) (string, bool) {
+	limit := opts.MaxContentBytes
+	if limit <= 0 || len(html) <= limit {
+		return html, false
 	}
-	return article.Content, nil
+	opts.logger().Warn("Content length exceeds limit, truncating", "length", len(html), "limit", limit)
+	return string(storage.TruncateUTF8([]byte(html), limit)), true
+}
+
+// sleepCtx waits for d or until ctx is cancelled
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// ExtractHTMLContent extracts main content HTML using Readability
+func ExtractHTMLContent(htmlStr, urlStr string) (string, error) {
+	return ExtractHTMLContentWithOptions(htmlStr, urlStr, ReadabilityOptions{})
 }
 
 // ConvertToMarkdown converts HTML content to Markdown
 func ConvertToMarkdown(htmlStr string) (string, error) {
-	converter := md.NewConverter("", true, nil)
-	markdown, err := converter.ConvertString(htmlStr)
-	if err != nil {
-		return "", fmt.Errorf("failed to convert HTML to Markdown: %v", err)
-	}
-	return markdown, nil
+	return ConvertToMarkdownWithOptions(htmlStr, MarkdownOptions{})
 }
 
 // GetDomainName generates a unique filename from the URL
 func GetDomainName(pageURL string) string {
 	parsedURL, err := url.Parse(pageURL)
 	if err != nil {
-		log.Printf("Error parsing URL %s: %v", pageURL, err)
+		slog.Warn("Could not parse URL", "url", pageURL, "error", err)
 		return "unknown"
 	}
 	domain := strings.ReplaceAll(parsedURL.Hostname(), ".", "_")
@@ -274,7 +615,7 @@ func saveToMarkdownFile(content, url string) error {
 	if err != nil {
 		return fmt.Errorf("failed to save file %s: %v", filename, err)
 	}
-	fmt.Printf("✅ Saved to %s\n", filename)
+	slog.Info("Saved file", "path", filename)
 	return nil
 }
 
@@ -288,12 +629,50 @@ func saveToHTMLFile(content, url string) error {
 	if err != nil {
 		return fmt.Errorf("failed to save HTML file %s: %v", filename, err)
 	}
-	fmt.Printf("✅ Saved raw HTML to %s\n", filename)
+	slog.Info("Saved raw HTML", "path", filename)
 	return nil
 }
 
+// CrawlResult describes the outcome of crawling a single URL
+type CrawlResult struct {
+	URL           string        // URL that was crawled
+	HTMLPath      string        // Path of the saved raw HTML file
+	MarkdownPath  string        // Path of the saved Markdown file
+	TextPath      string        // Path of the saved plain text file
+	Error         error         // First error encountered, nil on success
+	FetchDuration time.Duration // Time spent fetching the page
+	ContentLength int           // Length of the fetched HTML in bytes
+
+	Selections     map[string][]string    // Matches of CrawlOptions.Selectors by name
+	SelectionsPath string                 // Path of the saved selections JSON file
+	Fields         map[string]interface{} // Record scraped with CrawlOptions.ExtractSchema, a string or []string per field
+	ScreenshotPath string                 // Path of the saved screenshot
+	PDFPath        string                 // Path of the saved PDF
+	MHTMLPath      string                 // Path of the saved MHTML archive
+	ResourcePaths  []string               // Paths of the saved resources when CrawlOptions.CaptureResources is set
+	HARPath        string                 // Path of the saved HAR file
+	Skipped        bool                   // Whether the page wasn't saved because it was visited before, its files already exist or its language is skipped
+	Language       string                 // BCP 47 code of the page's language, empty if unknown
+	Changed        bool                   // Whether new content was saved, false if CrawlOptions.DedupStore found it unchanged
+	Metadata       *PageMeta              // Page metadata when CrawlOptions.Metadata is set
+	Metrics        *PageMetrics           // Performance metrics when CrawlOptions.CollectMetrics is set
+	Links          []Link                 // Outbound links when CrawlOptions.Links is set
+	EvalResult     json.RawMessage        // Result of CrawlOptions.EvalJS as JSON
+	RedirectChain  []string               // URLs the page was redirected through, from the crawled URL to the final one; nil without redirects
+	Truncated      bool                   // Whether the fetched HTML or a saved text output was cut to CrawlOptions.MaxContentBytes
+
+	// The outputs themselves, only kept by in-memory crawls such as
+	// CrawlToMemory
+	HTML       string // Rendered HTML, if HTML was requested
+	Markdown   string // Markdown, if Markdown was requested
+	Text       string // Plain text, if text was requested
+	Screenshot []byte // Screenshot, if CrawlOptions.Screenshot is set
+	PDF        []byte // PDF, if CrawlOptions.PDF is set
+	MHTML      []byte // MHTML archive, if CrawlOptions.MHTML is set
+}
+
 // CrawlURL processes a single URL
-func CrawlURL(url string, proxy string, sem chan struct{}, wg *sync.WaitGroup, outputDir string) error {
+func CrawlURL(url string, proxy string, sem chan struct{}, wg *sync.WaitGroup, outputDir string) (CrawlResult, error) {
 	// Handle semaphore and waitgroup if provided
 	if sem != nil && wg != nil {
 		defer func() {
@@ -302,61 +681,516 @@ func CrawlURL(url string, proxy string, sem chan struct{}, wg *sync.WaitGroup, o
 		}()
 	}
 
+	return crawlURL(context.Background(), url, proxy, outputDir, CrawlOptions{})
+}
+
+// CrawlURLWithOptions fetches, converts and saves a single URL using opts
+func CrawlURLWithOptions(ctx context.Context, url string, proxy string, outputDir string, opts CrawlOptions) (CrawlResult, error) {
+	return crawlURL(ctx, url, proxy, outputDir, opts)
+}
+
+// crawlURL fetches, converts and saves a single URL
+func crawlURL(ctx context.Context, url string, proxy string, outputDir string, opts CrawlOptions) (CrawlResult, error) {
+	result, _, err := crawlPage(ctx, url, proxy, outputDir, opts)
+	return result, err
+}
+
+// crawlPage is crawlURL but also returns the fetched HTML for link discovery
+func crawlPage(ctx context.Context, url string, proxy string, outputDir string, opts CrawlOptions) (result CrawlResult, html string, err error) {
+	result = CrawlResult{URL: url}
+	var visited bool // Whether opts.VisitedStore had url already
+	fail := func(err error) (CrawlResult, string, error) {
+		result.Error = err
+		return result, html, err
+	}
+	// Report whatever result is returned, failed or not. A panic, e.g. in a
+	// dependency, only fails this page rather than a whole batch.
+	defer func() {
+		if r := recover(); r != nil {
+			opts.logger().Error("Recovered from panic", "url", url, "panic", r, "stack", string(debug.Stack()))
+			err = fmt.Errorf("error crawling %s: panic: %v", url, r)
+			result.Error = err
+		}
+		// Remember the page is done so a resumed crawl skips it
+		if err == nil && opts.VisitedStore != nil && !visited {
+			if markErr := opts.VisitedStore.Mark(ctx, url); markErr != nil {
+				err = fmt.Errorf("error marking %s visited: %w", url, markErr)
+				result.Error = err
+			}
+		}
+		// Say why the crawl was cut short, e.g. ErrBudgetExceeded
+		if err != nil && ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+			if cause := context.Cause(ctx); cause != ctx.Err() && !errors.Is(err, cause) {
+				err = fmt.Errorf("%w: %w", err, cause)
+				result.Error = err
+			}
+		}
+		reportResult(result, opts)
+	}()
+
+	// Every output goes through the same backend, on disk by default
+	backend := opts.Storage
+	if backend == nil {
+		backend = storage.NewLocalBackend(outputDir)
+	}
+	saveOpts := storage.SaveOptions{
+		Compress:         opts.Compress,
+		FilenameTemplate: opts.FilenameTemplate,
+		OverwritePolicy:  opts.OverwritePolicy,
+		Upload:           opts.Upload,
+		MaxContentBytes:  opts.MaxContentBytes,
+		Logger:           opts.Logger,
+	}
+	save := func(data []byte, fileType string) (string, error) {
+		if saveOpts.Truncates(fileType, len(data)) {
+			result.Truncated = true
+		}
+		return storage.SaveWithOptions(ctx, backend, data, url, fileType, saveOpts)
+	}
+	// In-memory crawls keep the outputs in the result instead
+	if opts.inMemory {
+		save = func(data []byte, fileType string) (string, error) {
+			return "", nil
+		}
+	}
+
+	// Don't fetch pages an interrupted run already finished
+	if opts.VisitedStore != nil {
+		visited, err = opts.VisitedStore.Has(ctx, url)
+		if err != nil {
+			return fail(fmt.Errorf("error checking whether %s was visited: %w", url, err))
+		}
+		if visited {
+			opts.logger().Info("Skipping page, already visited", "url", url)
+			result.Skipped = true
+			return result, html, nil
+		}
+	}
+
+	// Don't fetch pages whose outputs would all be kept anyway
+	if opts.OverwritePolicy == storage.Skip {
+		skipped, err := existingOutputs(ctx, backend, url, opts, saveOpts, &result)
+		if err != nil {
+			return fail(fmt.Errorf("error checking existing files for %s: %w", url, err))
+		}
+		if skipped {
+			opts.logger().Info("Skipping page, already saved", "url", url)
+			return result, html, nil
+		}
+	}
+
+	// Don't fetch pages whose validators say they haven't changed. Records
+	// without a hash come from FetchPageWithResponse, which saves nothing.
+	var record storage.DedupRecord
+	var seen bool
+	var cond validators
+	if opts.DedupStore != nil {
+		var err error
+		record, seen, err = opts.DedupStore.Get(ctx, url)
+		if err != nil {
+			return fail(fmt.Errorf("error reading dedup record of %s: %w", url, err))
+		}
+		seen = seen && record.Hash != ""
+		if seen {
+			cond = validators{ETag: record.ETag, LastModified: record.LastModified}
+		}
+		if seen && proxy == "" {
+			unchanged, err := unchangedSince(ctx, url, record, opts)
+			if err != nil {
+				// The full fetch below decides
+				opts.logger().Warn("Could not check whether page changed", "url", url, "error", err)
+			}
+			if unchanged {
+				opts.logger().Info("Skipping page, unchanged since last crawl", "url", url)
+				return result, html, nil
+			}
+		}
+	}
+
 	if proxy == "" {
-		fmt.Printf("Fetching %s without proxy...\n", url)
+		opts.logger().Info("Fetching page", "url", url)
 	} else {
-		fmt.Printf("Fetching %s with proxy %s...\n", url, proxy)
+		opts.logger().Info("Fetching page", "url", url, "proxy", redactProxy(proxy))
 	}
 
 	// Fetch page content
-	html, err := FetchPage(url, proxy)
+	start := time.Now()
+	capture, err := fetchCapture(ctx, url, proxy, opts, cond)
+	result.FetchDuration = time.Since(start)
+	if errors.Is(err, ErrNotModified) {
+		opts.logger().Info("Page not modified since last crawl", "url", url)
+		return result, html, nil
+	}
 	if err != nil {
-		log.Printf("Error fetching %s: %v", url, err)
-		return err
+		return fail(fmt.Errorf("error fetching %s: %w", url, err))
+	}
+	html = capture.HTML
+	result.ContentLength = len(html)
+	result.Metrics = capture.Metrics
+	result.Fields = capture.Fields
+	result.EvalResult = capture.EvalResult
+	result.RedirectChain = capture.RedirectChain
+	result.Truncated = capture.Truncated
+
+	// Archive every fetch, changed or not
+	if capture.Exchange != nil {
+		if err := opts.WARC.write(url, capture.Exchange); err != nil {
+			return fail(fmt.Errorf("error archiving %s: %w", url, err))
+		}
+	}
+
+	// Pages whose content hashes the same as last time aren't saved again
+	newRecord := storage.DedupRecord{
+		Hash:         storage.ContentHash([]byte(html)),
+		ETag:         capture.ETag,
+		LastModified: capture.LastModified,
+		CrawledAt:    time.Now().UTC(),
+	}
+	if seen && record.Hash == newRecord.Hash {
+		// Still remember the current validators for the next check
+		if err := opts.DedupStore.Put(ctx, url, newRecord); err != nil {
+			return fail(fmt.Errorf("error saving dedup record of %s: %w", url, err))
+		}
+		opts.logger().Info("Page unchanged since last crawl", "url", url)
+		return result, html, nil
+	}
+
+	// Pages in unwanted languages are dropped before anything is saved
+	result.Language = DetectLanguage(html, capture.ContentLanguage)
+	for _, skip := range opts.SkipLanguages {
+		if languageMatches(result.Language, skip) {
+			opts.logger().Info("Skipping page in skipped language", "url", url, "language", result.Language)
+			result.Skipped = true
+			return result, html, nil
+		}
+	}
+
+	// Save the page's resources, pointing the saved HTML at the copies
+	savedHTML := html
+	if len(capture.Resources) > 0 && !opts.inMemory {
+		result.ResourcePaths, savedHTML, err = saveResources(ctx, backend, url, html, capture.Resources, saveOpts)
+		if err != nil {
+			return fail(fmt.Errorf("error saving resources of %s: %w", url, err))
+		}
 	}
 
 	// Save raw HTML
-	_, err = storage.SaveToLocalFile(html, url, "html", outputDir)
-	if err != nil {
-		log.Printf("Error saving raw HTML for %s: %v", url, err)
-		return err
+	if opts.wants(storage.HTMLContent) {
+		result.HTMLPath, err = save([]byte(savedHTML), "html")
+		if err != nil {
+			return fail(fmt.Errorf("error saving raw HTML for %s: %w", url, err))
+		}
 	}
 
-	// Extract main content
-	contentHTML, err := ExtractHTMLContent(html, url)
-	if err != nil {
-		log.Printf("Error extracting content from %s: %v", url, err)
-		return err
+	// Save screenshot
+	if capture.Screenshot != nil {
+		result.ScreenshotPath, err = save(capture.Screenshot, screenshotFileType(opts))
+		if err != nil {
+			return fail(fmt.Errorf("error saving screenshot for %s: %w", url, err))
+		}
 	}
 
-	// Convert to Markdown
-	markdown, err := ConvertToMarkdown(contentHTML)
-	if err != nil {
-		log.Printf("Error converting %s to Markdown: %v", url, err)
-		return err
+	// Save PDF
+	if capture.PDF != nil {
+		result.PDFPath, err = save(capture.PDF, "pdf")
+		if err != nil {
+			return fail(fmt.Errorf("error saving PDF for %s: %w", url, err))
+		}
 	}
 
-	// Save to file
-	_, err = storage.SaveToLocalFile(markdown, url, "md", outputDir)
-	if err != nil {
-		log.Printf("Error saving %s: %v", url, err)
-		return err
+	// Save the MHTML archive
+	if capture.MHTML != nil {
+		result.MHTMLPath, err = save(capture.MHTML, "mhtml")
+		if err != nil {
+			return fail(fmt.Errorf("error saving MHTML for %s: %w", url, err))
+		}
 	}
 
-	return nil
+	// Save the network activity
+	if capture.HAR != nil {
+		result.HARPath, err = save(capture.HAR, "har")
+		if err != nil {
+			return fail(fmt.Errorf("error saving HAR for %s: %w", url, err))
+		}
+	}
+
+	// Save named selector matches
+	if capture.Selections != nil {
+		result.Selections = capture.Selections
+		data, err := json.MarshalIndent(capture.Selections, "", "  ")
+		if err != nil {
+			return fail(fmt.Errorf("error encoding selections for %s: %w", url, err))
+		}
+		result.SelectionsPath, err = save(data, "json")
+		if err != nil {
+			return fail(fmt.Errorf("error saving selections for %s: %w", url, err))
+		}
+	}
+
+	// Markdown and plain text are built from the selected nodes, from
+	// Readability's main content or, with RawHTMLOnly, from the whole page
+	var markdown, text string
+	if opts.wants(storage.MarkdownContent) || opts.wants(storage.TextContent) {
+		contentHTML := html
+		if capture.Selected != nil {
+			contentHTML = strings.Join(capture.Selected, "\n")
+		} else if !opts.RawHTMLOnly {
+			contentHTML, err = ExtractHTMLContentWithOptions(html, url, opts.Readability)
+			if err != nil {
+				return fail(fmt.Errorf("error extracting content from %s: %w", url, err))
+			}
+		}
+
+		if opts.wants(storage.MarkdownContent) {
+			if capture.Selected != nil {
+				markdown, err = selectedMarkdown(capture, url, opts)
+			} else {
+				markdown, err = ConvertToMarkdownWithOptions(contentHTML, opts.Markdown.forPage(url))
+			}
+			if err != nil {
+				return fail(fmt.Errorf("error converting %s to Markdown: %w", url, err))
+			}
+		}
+		if opts.wants(storage.TextContent) {
+			text, err = ExtractPlainText(contentHTML)
+			if err != nil {
+				return fail(fmt.Errorf("error extracting text from %s: %w", url, err))
+			}
+		}
+	}
+
+	// Collect outbound links
+	if opts.Links {
+		result.Links, err = ExtractLinks(html, url)
+		if err != nil {
+			return fail(fmt.Errorf("error extracting links from %s: %w", url, err))
+		}
+	}
+
+	// Extract metadata, optionally as frontmatter
+	if opts.Metadata || opts.Frontmatter {
+		meta, err := ExtractMetadata(html, url)
+		if err != nil {
+			return fail(fmt.Errorf("error extracting metadata from %s: %w", url, err))
+		}
+		result.Metadata = &meta
+		if opts.Frontmatter {
+			markdown = meta.Frontmatter() + markdown
+		}
+	}
+
+	// Save Markdown
+	if opts.wants(storage.MarkdownContent) {
+		result.MarkdownPath, err = save([]byte(markdown), "md")
+		if err != nil {
+			return fail(fmt.Errorf("error saving %s: %w", url, err))
+		}
+	}
+
+	// Save plain text
+	if opts.wants(storage.TextContent) {
+		result.TextPath, err = save([]byte(text), "txt")
+		if err != nil {
+			return fail(fmt.Errorf("error saving text of %s: %w", url, err))
+		}
+	}
+
+	if opts.inMemory {
+		if opts.wants(storage.HTMLContent) {
+			result.HTML = html
+		}
+		result.Markdown = markdown
+		result.Text = text
+		result.Screenshot = capture.Screenshot
+		result.PDF = capture.PDF
+		result.MHTML = capture.MHTML
+	}
+
+	// Stream the page to the message system
+	if opts.Streamer != nil {
+		if err := streamPage(opts, url, html, markdown, result.Metadata); err != nil {
+			return fail(fmt.Errorf("error streaming %s: %w", url, err))
+		}
+	}
+
+	// Remember the content only once it's stored, so failures are retried
+	if opts.DedupStore != nil {
+		if err := opts.DedupStore.Put(ctx, url, newRecord); err != nil {
+			return fail(fmt.Errorf("error saving dedup record of %s: %w", url, err))
+		}
+	}
+
+	result.Changed = true
+	return result, html, nil
 }
 
-// CrawlURLs crawls multiple URLs concurrently
-func CrawlURLs(urls []string, outputDir string) {
-	sem := make(chan struct{}, maxConcurrent)
+// streamPage sends the requested HTML and Markdown of url to opts.Streamer,
+// along with meta if it was extracted and the Streamer takes it
+func streamPage(opts CrawlOptions, url, html, markdown string, meta *PageMeta) error {
+	var types []storage.ContentType
+	for _, t := range []storage.ContentType{storage.HTMLContent, storage.MarkdownContent} {
+		if opts.wants(t) {
+			types = append(types, t)
+		}
+	}
+	// An empty list would mean both to the Streamer
+	if len(types) == 0 {
+		return nil
+	}
+	if streamer, ok := opts.Streamer.(storage.MetadataStreamer); ok && meta != nil {
+		metadata, err := json.Marshal(meta)
+		if err != nil {
+			return fmt.Errorf("error encoding metadata: %w", err)
+		}
+		return streamer.StreamWithMetadata(url, html, markdown, opts.SessionID, metadata, types...)
+	}
+	return opts.Streamer.Stream(url, html, markdown, opts.SessionID, types...)
+}
+
+// existingOutputs reports true when every requested output of url is
+// already stored in backend, filling in result's paths to them
+func existingOutputs(ctx context.Context, backend storage.StorageBackend, url string, opts CrawlOptions, saveOpts storage.SaveOptions, result *CrawlResult) (bool, error) {
+	found := *result
+	outputs := []struct {
+		contentType storage.ContentType
+		fileType    string
+		path        *string
+	}{
+		{storage.HTMLContent, "html", &found.HTMLPath},
+		{storage.MarkdownContent, "md", &found.MarkdownPath},
+		{storage.TextContent, "txt", &found.TextPath},
+	}
+	for _, output := range outputs {
+		if !opts.wants(output.contentType) {
+			continue
+		}
+		path, exists, err := storage.Existing(ctx, backend, url, output.fileType, saveOpts)
+		if err != nil || !exists {
+			return false, err
+		}
+		*output.path = path
+	}
+
+	found.Skipped = true
+	*result = found
+	return true, nil
+}
+
+// CrawlURLs crawls multiple URLs concurrently and returns one result per URL,
+// in the same order as the input slice. A failed URL doesn't stop the others;
+// its result carries the error, and ResultErrors joins them all. URLs are
+// crawled in the form NormalizeURL gives them, and only once: URLs that
+// normalize to the same one share its result.
+func CrawlURLs(urls []string, outputDir string) []CrawlResult {
+	return CrawlURLsCtx(context.Background(), urls, outputDir)
+}
+
+// CrawlURLsCtx is like CrawlURLs but stops launching new crawls and aborts
+// in-flight fetches once ctx is cancelled. The results of URLs that never
+// started wrap ctx.Err(); files for already-completed URLs are kept.
+func CrawlURLsCtx(ctx context.Context, urls []string, outputDir string) []CrawlResult {
+	return CrawlURLsWithOptions(ctx, urls, outputDir, CrawlOptions{})
+}
+
+// CrawlURLsWithOptions is like CrawlURLsCtx but applies the given options to
+// every URL. With opts.TotalTimeout, the results of URLs that didn't finish
+// in time wrap ErrBudgetExceeded.
+func CrawlURLsWithOptions(ctx context.Context, urls []string, outputDir string, opts CrawlOptions) []CrawlResult {
+	ctx, cancel := withBudget(ctx, opts)
+	defer cancel()
+	opts, closePool := withBrowserPool(ctx, opts)
+	defer closePool()
+
+	unique, positions := normalizeBatch(urls, opts)
+	crawled, _ := crawlBatch(ctx, unique, outputDir, opts)
+	results := make([]CrawlResult, len(urls))
+	for i, pos := range positions {
+		results[i] = crawled[pos]
+	}
+	return results
+}
+
+// ResultErrors joins the errors of the failed results, each of which names
+// its URL. It returns nil if every URL succeeded.
+func ResultErrors(results []CrawlResult) error {
+	var errs []error
+	for _, result := range results {
+		if result.Error != nil {
+			errs = append(errs, result.Error)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// withBudget bounds ctx by opts.TotalTimeout, if set, with ErrBudgetExceeded
+// as the cause
+func withBudget(ctx context.Context, opts CrawlOptions) (context.Context, context.CancelFunc) {
+	if opts.TotalTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeoutCause(ctx, opts.TotalTimeout, ErrBudgetExceeded)
+}
+
+// withProxyPool returns opts with a ProxyPool rotating through the
+// configured proxies with failover, unless it has one or none are configured
+func (opts CrawlOptions) withProxyPool() CrawlOptions {
+	if opts.ProxyPool == nil {
+		if proxies := LoadProxies(); len(proxies) > 0 {
+			opts.ProxyPool = NewProxyPool(proxies, ProxyPoolOptions{})
+		}
+	}
+	return opts
+}
+
+// crawlBatch crawls urls concurrently and returns each page's result and
+// HTML, index-aligned with urls
+func crawlBatch(ctx context.Context, urls []string, outputDir string, opts CrawlOptions) ([]CrawlResult, []string) {
+	opts = opts.withProxyPool()
+
+	sem := make(chan struct{}, opts.concurrency())
 	var wg sync.WaitGroup
+	results := make([]CrawlResult, len(urls))
+	pages := make([]string, len(urls))
 
-	for _, url := range urls {
-		wg.Add(1)
-		sem <- struct{}{} // Acquire semaphore
-		go CrawlURL(url, getRandomProxy(), sem, &wg, outputDir)
+	// Progress callbacks run one at a time, in the order URLs finish
+	var progressMu sync.Mutex
+	done := 0
+	progress := func(result CrawlResult) {
+		if opts.OnProgress == nil {
+			return
+		}
+		progressMu.Lock()
+		defer progressMu.Unlock()
+		done++
+		opts.OnProgress(done, len(urls), result)
+	}
+
+	for i, url := range urls {
+		// Acquire semaphore unless the crawl has been cancelled. select picks
+		// at random when both are ready, so a cancelled crawl also gives the
+		// slot back rather than starting the page.
+		select {
+		case sem <- struct{}{}:
+			if ctx.Err() == nil {
+				wg.Add(1)
+				go func(i int, url string) {
+					defer func() {
+						<-sem
+						wg.Done()
+					}()
+					results[i], pages[i], _ = crawlPage(ctx, url, "", outputDir, opts)
+					progress(results[i])
+				}(i, url)
+				continue
+			}
+			<-sem
+		case <-ctx.Done():
+		}
+		results[i] = CrawlResult{URL: url, Error: fmt.Errorf("error crawling %s: %w", url, context.Cause(ctx))}
+		reportResult(results[i], opts)
+		progress(results[i])
 	}
 
 	wg.Wait()
-	fmt.Println("Crawling complete!")
+	return results, pages
 }
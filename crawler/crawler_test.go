@@ -0,0 +1,325 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"pathik/storage"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestTruncateHTML(t *testing.T) {
+	tests := []struct {
+		name      string
+		html      string
+		limit     int
+		want      string
+		truncated bool
+	}{
+		{"unlimited", strings.Repeat("x", 100), storage.NoContentLimit, strings.Repeat("x", 100), false},
+		{"at limit", "<p>hi</p>", 9, "<p>hi</p>", false},
+		{"over limit", "<p>hi</p>", 5, "<p>hi", true},
+		{"inside character", "<p>日本", 5, "<p>", true},
+		{"after character", "<p>日本", 6, "<p>日", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, truncated := truncateHTML(tt.html, CrawlOptions{MaxContentBytes: tt.limit})
+			if got != tt.want || truncated != tt.truncated {
+				t.Errorf("truncateHTML(%q, %d) = %q, %v, want %q, %v", tt.html, tt.limit, got, truncated, tt.want, tt.truncated)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("truncateHTML(%q, %d) = %q, not valid UTF-8", tt.html, tt.limit, got)
+			}
+		})
+	}
+}
+
+func TestTruncateHTMLDefaultLimit(t *testing.T) {
+	// FetchPage, CrawlURL and CrawlURLs crawl with the zero options
+	opts := CrawlOptions{}.withDefaults()
+	html := strings.Repeat("x", storage.DefaultMaxContentBytes+1)
+	got, truncated := truncateHTML(html, opts)
+	if !truncated || len(got) != storage.DefaultMaxContentBytes {
+		t.Fatalf("truncateHTML kept %d bytes, truncated %v; want %d, true", len(got), truncated, storage.DefaultMaxContentBytes)
+	}
+}
+
+func TestIsPrivateIPv6(t *testing.T) {
+	tests := []struct {
+		ip      string
+		private bool
+	}{
+		{"::1", true},
+		{"::", true},
+		{"fc00::1", true},
+		{"fd12:3456:789a::1", true},
+		{"fe80::1", true},
+		{"febf::1", true},
+		{"ff02::1", true},
+		{"::ffff:10.0.0.1", true},
+		{"::ffff:127.0.0.1", true},
+		{"::ffff:169.254.169.254", true},
+		{"2001:4860:4860::8888", false},
+		{"2606:4700:4700::1111", false},
+		{"fec0::1", false},
+		{"ff0e::1", false},
+		{"::ffff:8.8.8.8", false},
+	}
+	for _, tt := range tests {
+		if got := isPrivateIP(tt.ip); got != tt.private {
+			t.Errorf("isPrivateIP(%q) = %v, want %v", tt.ip, got, tt.private)
+		}
+	}
+}
+
+func TestCheckPeerAddressesIPv6(t *testing.T) {
+	tests := []struct {
+		name string
+		ip   string
+		err  bool
+	}{
+		{"bracketed loopback", "[::1]", true},
+		{"bracketed unique local", "[fd00::5]", true},
+		{"bracketed public", "[2001:4860:4860::8888]", false},
+		{"unknown", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkPeerAddresses([]peerAddress{{URL: "https://example.com/", IP: tt.ip}}, CrawlOptions{})
+			if got := errors.Is(err, ErrPrivateAddress); got != tt.err {
+				t.Errorf("checkPeerAddresses(%q) = %v, want private %v", tt.ip, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestCheckPeerAddressesRebinding(t *testing.T) {
+	// rebind.example resolved to a public address when ValidateURL looked it
+	// up, then to a private one by the time the browser connected
+	tests := []struct {
+		name  string
+		peers []peerAddress
+		opts  CrawlOptions
+		err   bool
+	}{
+		{"public", []peerAddress{{URL: "https://rebind.example/", IP: "93.184.216.34"}}, CrawlOptions{}, false},
+		{"rebound to private", []peerAddress{{URL: "https://rebind.example/", IP: "10.0.0.5"}}, CrawlOptions{}, true},
+		{"rebound to metadata", []peerAddress{{URL: "https://rebind.example/", IP: "169.254.169.254"}}, CrawlOptions{}, true},
+		{"private redirect hop", []peerAddress{
+			{URL: "https://rebind.example/", IP: "93.184.216.34"},
+			{URL: "https://rebind.example/next", IP: "127.0.0.1"},
+			{URL: "https://example.com/", IP: "93.184.216.34"},
+		}, CrawlOptions{}, true},
+		{"allowed host", []peerAddress{{URL: "https://rebind.example/", IP: "10.0.0.5"}}, CrawlOptions{AllowedHosts: []string{"rebind.example"}}, false},
+		{"other host allowed", []peerAddress{{URL: "https://rebind.example/", IP: "10.0.0.5"}}, CrawlOptions{AllowedHosts: []string{"example.com"}}, true},
+		{"private networks allowed", []peerAddress{{URL: "https://rebind.example/", IP: "10.0.0.5"}}, CrawlOptions{AllowPrivateNetworks: true}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkPeerAddresses(tt.peers, tt.opts)
+			if got := errors.Is(err, ErrPrivateAddress); got != tt.err {
+				t.Errorf("checkPeerAddresses = %v, want private %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestIsPrivateIPv4(t *testing.T) {
+	tests := []struct {
+		ip      string
+		private bool
+	}{
+		{"0.0.0.0", true},
+		{"0.1.2.3", true},
+		{"10.0.0.1", true},
+		{"10.255.255.255", true},
+		{"100.64.0.1", true},
+		{"100.127.255.255", true},
+		{"127.0.0.1", true},
+		{"127.1.2.3", true},
+		{"169.254.169.254", true},
+		{"172.16.0.1", true},
+		{"172.31.255.255", true},
+		{"192.168.1.1", true},
+		// Neighbours of the private blocks, which string comparisons got wrong
+		{"9.255.255.255", false},
+		{"11.0.0.1", false},
+		{"100.63.255.255", false},
+		{"100.128.0.1", false},
+		{"172.15.255.255", false},
+		{"172.32.0.1", false},
+		{"172.100.0.1", false},
+		{"192.167.255.255", false},
+		{"192.169.0.1", false},
+		{"8.8.8.8", false},
+		{"not an ip", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := isPrivateIP(tt.ip); got != tt.private {
+			t.Errorf("isPrivateIP(%q) = %v, want %v", tt.ip, got, tt.private)
+		}
+	}
+}
+
+func TestValidateURLWithOptions(t *testing.T) {
+	tests := []struct {
+		name  string
+		url   string
+		opts  CrawlOptions
+		valid bool
+	}{
+		{"public address", "https://8.8.8.8/", CrawlOptions{}, true},
+		{"private address", "http://10.0.0.1/", CrawlOptions{}, false},
+		{"metadata endpoint", "http://169.254.169.254/latest/meta-data/", CrawlOptions{}, false},
+		{"loopback", "http://127.0.0.1:8080/", CrawlOptions{}, false},
+		{"localhost", "http://localhost/", CrawlOptions{}, false},
+		{"IPv6 loopback", "http://[::1]/", CrawlOptions{}, false},
+		{"file scheme", "file:///etc/passwd", CrawlOptions{}, false},
+		{"ftp scheme", "ftp://example.com/", CrawlOptions{}, false},
+		{"malformed", "http://[::1", CrawlOptions{}, false},
+		{"private networks allowed", "http://10.0.0.1/", CrawlOptions{AllowPrivateNetworks: true}, true},
+		{"host allowed", "http://10.0.0.1/", CrawlOptions{AllowedHosts: []string{"10.0.0.1"}}, true},
+		{"other host allowed", "http://10.0.0.2/", CrawlOptions{AllowedHosts: []string{"10.0.0.1"}}, false},
+		{"scheme checked when allowed", "file:///etc/passwd", CrawlOptions{AllowPrivateNetworks: true}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateURLWithOptions(tt.url, tt.opts)
+			if (err == nil) != tt.valid {
+				t.Errorf("ValidateURLWithOptions(%q) = %v, want valid %v", tt.url, err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestCrawlBatchCancelled(t *testing.T) {
+	errStopped := errors.New("stopped")
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(errStopped)
+
+	urls := []string{"https://example.com/a", "https://example.com/b", "https://example.com/c"}
+	var progressed int
+	opts := CrawlOptions{
+		MaxConcurrent: 1,
+		OnProgress:    func(done, total int, _ CrawlResult) { progressed = done },
+	}
+	results, _ := crawlBatch(ctx, urls, t.TempDir(), opts)
+	for i, result := range results {
+		if result.URL != urls[i] || !errors.Is(result.Error, errStopped) {
+			t.Errorf("result %d = %s, %v; want %s failed with the cancel cause", i, result.URL, result.Error, urls[i])
+		}
+	}
+	if progressed != len(urls) {
+		t.Errorf("progress reported %d URLs, want %d", progressed, len(urls))
+	}
+}
+
+func TestCrawlBatchResumesFromVisitedStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "visited.txt")
+	visited := []string{"https://example.com/a", "https://example.com/b"}
+
+	// An interrupted run finished these pages
+	store, err := storage.NewFileVisitedStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, url := range visited {
+		if err := store.Mark(ctx, url); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.Close()
+
+	store, err = storage.NewFileVisitedStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	// The unvisited URL is fetched, and fails validation without a browser
+	unvisited := "http://localhost/c"
+	results, _ := crawlBatch(ctx, append(visited, unvisited), t.TempDir(), CrawlOptions{VisitedStore: store})
+
+	for _, result := range results[:2] {
+		if !result.Skipped || result.Error != nil {
+			t.Errorf("%s: skipped %v, error %v; want skipped as visited", result.URL, result.Skipped, result.Error)
+		}
+	}
+	if results[2].Skipped || results[2].Error == nil {
+		t.Errorf("%s: skipped %v, error %v; want it fetched", unvisited, results[2].Skipped, results[2].Error)
+	}
+	if has, _ := store.Has(ctx, unvisited); has {
+		t.Errorf("failed %s was marked visited", unvisited)
+	}
+}
+
+// panickingVisitedStore reports every URL visited, except that it panics
+// for panicURL, like a crawl step hitting a bug would
+type panickingVisitedStore struct {
+	panicURL string
+}
+
+func (s panickingVisitedStore) Has(ctx context.Context, url string) (bool, error) {
+	if url == s.panicURL {
+		panic("store bug")
+	}
+	return true, nil
+}
+
+func (s panickingVisitedStore) Mark(ctx context.Context, url string) error {
+	return nil
+}
+
+func TestCrawlBatchRecoversFromPanic(t *testing.T) {
+	urls := []string{"https://example.com/a", "https://example.com/panic", "https://example.com/c"}
+	var reported []CrawlResult
+	opts := CrawlOptions{
+		VisitedStore: panickingVisitedStore{panicURL: urls[1]},
+		OnProgress:   func(done, total int, current CrawlResult) { reported = append(reported, current) },
+		Logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	results, _ := crawlBatch(context.Background(), urls, t.TempDir(), opts)
+
+	if err := results[1].Error; err == nil || !strings.Contains(err.Error(), "panic: store bug") {
+		t.Errorf("%s: error %v, want the recovered panic", urls[1], err)
+	}
+	for _, i := range []int{0, 2} {
+		if !results[i].Skipped || results[i].Error != nil {
+			t.Errorf("%s: skipped %v, error %v; want it to complete", urls[i], results[i].Skipped, results[i].Error)
+		}
+	}
+	if len(reported) != len(urls) {
+		t.Errorf("progress reported %d URLs, want %d", len(reported), len(urls))
+	}
+}
+
+func TestNavigationTimeout(t *testing.T) {
+	requireBrowser(t)
+
+	srv := serveHTML(t, func(w http.ResponseWriter, r *http.Request) {
+		// Hang until the browser gives up
+		select {
+		case <-r.Context().Done():
+		case <-time.After(10 * time.Second):
+		}
+	})
+
+	opts := localOptions()
+	opts.NavigationTimeout = 500 * time.Millisecond
+	start := time.Now()
+	_, err := FetchPageWithOptions(context.Background(), srv.URL, "", opts)
+	if !errors.Is(err, ErrNavigationTimeout) {
+		t.Fatalf("FetchPageWithOptions = %v, want ErrNavigationTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("gave up after %v, want about the navigation timeout", elapsed)
+	}
+}
@@ -0,0 +1,90 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// maxDecompressedSize caps what DecompressResponse inflates a body to, so a
+// small compressed body can't exhaust memory
+const maxDecompressedSize = 100 * 1024 * 1024 // 100 MB
+
+// DecompressResponse decodes an HTTP response body sent with the given
+// Content-Encoding: "gzip", "deflate" or "br", or a comma-separated list of
+// them in the order they were applied. An empty or "identity" encoding
+// returns body unchanged. Bodies that inflate beyond 100 MB are rejected.
+func DecompressResponse(body []byte, encoding string) ([]byte, error) {
+	codings := strings.Split(encoding, ",")
+	// The last coding listed was applied last, so it comes off first
+	for i := len(codings) - 1; i >= 0; i-- {
+		coding := strings.ToLower(strings.TrimSpace(codings[i]))
+		var err error
+		switch coding {
+		case "", "identity":
+			continue
+		case "gzip", "x-gzip":
+			body, err = inflate(body, func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) })
+		case "deflate":
+			body, err = inflateDeflate(body)
+		case "br":
+			body, err = inflate(body, func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil })
+		default:
+			return nil, fmt.Errorf("unsupported content encoding %q", coding)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error decoding %s body: %w", coding, err)
+		}
+	}
+	return body, nil
+}
+
+// inflateDeflate decodes a "deflate" body, which should be zlib-wrapped but
+// is sent as raw DEFLATE by some servers
+func inflateDeflate(body []byte) ([]byte, error) {
+	data, err := inflate(body, func(r io.Reader) (io.Reader, error) { return zlib.NewReader(r) })
+	if err == zlib.ErrHeader {
+		return inflate(body, func(r io.Reader) (io.Reader, error) { return flate.NewReader(r), nil })
+	}
+	return data, err
+}
+
+// inflate reads body through the decompressor newReader makes, up to
+// maxDecompressedSize
+func inflate(body []byte, newReader func(io.Reader) (io.Reader, error)) ([]byte, error) {
+	r, err := newReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if closer, ok := r.(io.Closer); ok {
+		defer closer.Close()
+	}
+	data, err := io.ReadAll(io.LimitReader(r, maxDecompressedSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxDecompressedSize {
+		return nil, fmt.Errorf("body exceeds %d bytes decompressed", maxDecompressedSize)
+	}
+	return data, nil
+}
+
+// decodeCapturedBody returns a body read from the browser decoded. The
+// browser usually hands bodies over decoded already, with the original
+// Content-Encoding still in the headers, so a body that doesn't decode is
+// taken as it is.
+func decodeCapturedBody(body []byte, encoding string) []byte {
+	if encoding == "" {
+		return body
+	}
+	if decoded, err := DecompressResponse(body, encoding); err == nil {
+		return decoded
+	}
+	return body
+}
@@ -0,0 +1,106 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+// compress encodes data with the writer newWriter makes
+func compress(t *testing.T, data []byte, newWriter func(io.Writer) io.WriteCloser) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := newWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func gzipWriter(w io.Writer) io.WriteCloser   { return gzip.NewWriter(w) }
+func zlibWriter(w io.Writer) io.WriteCloser   { return zlib.NewWriter(w) }
+func brotliWriter(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) }
+func rawFlateWriter(w io.Writer) io.WriteCloser {
+	fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+	return fw
+}
+
+func TestDecompressResponse(t *testing.T) {
+	page := []byte(strings.Repeat("<p>Hello, compressed world</p>\n", 100))
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+	}{
+		{"identity", "identity", page},
+		{"no encoding", "", page},
+		{"gzip", "gzip", compress(t, page, gzipWriter)},
+		{"x-gzip", "x-gzip", compress(t, page, gzipWriter)},
+		{"case and spaces", " GZip ", compress(t, page, gzipWriter)},
+		{"zlib deflate", "deflate", compress(t, page, zlibWriter)},
+		{"raw deflate", "deflate", compress(t, page, rawFlateWriter)},
+		{"brotli", "br", compress(t, page, brotliWriter)},
+		// Listed in the order applied: gzip first, then br
+		{"stacked", "gzip, br", compress(t, compress(t, page, gzipWriter), brotliWriter)},
+		{"stacked with identity", "deflate, identity, gzip", compress(t, compress(t, page, zlibWriter), gzipWriter)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecompressResponse(tt.body, tt.encoding)
+			if err != nil {
+				t.Fatalf("DecompressResponse(%q): %v", tt.encoding, err)
+			}
+			if !bytes.Equal(got, page) {
+				t.Fatalf("DecompressResponse(%q) = %d bytes, want the %d byte page", tt.encoding, len(got), len(page))
+			}
+		})
+	}
+}
+
+func TestDecompressResponseErrors(t *testing.T) {
+	page := []byte("<p>page</p>")
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+	}{
+		{"unsupported", "compress", page},
+		{"not gzip", "gzip", page},
+		{"truncated gzip", "gzip", compress(t, page, gzipWriter)[:10]},
+		{"wrong stack order", "br, gzip", compress(t, compress(t, page, gzipWriter), brotliWriter)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecompressResponse(tt.body, tt.encoding); err == nil {
+				t.Fatalf("DecompressResponse(%q) succeeded, want an error", tt.encoding)
+			}
+		})
+	}
+}
+
+func TestDecompressResponseLimit(t *testing.T) {
+	bomb := compress(t, make([]byte, maxDecompressedSize+1), gzipWriter)
+	if _, err := DecompressResponse(bomb, "gzip"); err == nil {
+		t.Fatal("DecompressResponse inflated past the limit")
+	}
+}
+
+func TestDecodeCapturedBody(t *testing.T) {
+	page := []byte("<p>page</p>")
+	// The browser usually hands the body over decoded already
+	if got := decodeCapturedBody(page, "gzip"); !bytes.Equal(got, page) {
+		t.Errorf("decodeCapturedBody of a decoded body = %q, want it unchanged", got)
+	}
+	if got := decodeCapturedBody(compress(t, page, gzipWriter), "gzip"); !bytes.Equal(got, page) {
+		t.Errorf("decodeCapturedBody of a gzipped body = %q, want %q", got, page)
+	}
+}
@@ -0,0 +1,86 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"pathik/storage"
+)
+
+// dedupCheckTimeout bounds the HEAD request that checks a page's validators
+const dedupCheckTimeout = 10 * time.Second
+
+// dedupClient returns the client making the HEAD requests checking whether
+// pages changed. It connects only to addresses opts allows, checked as it
+// connects, and never follows redirects: they would carry opts.Headers and
+// BasicAuth to other hosts. A redirect counts as a change, so the browser
+// fetch, which checks every hop, decides; one to a rejected URL fails.
+func dedupClient(opts CrawlOptions) *http.Client {
+	checkRedirect := checkHTTPRedirect(opts)
+	return &http.Client{
+		Timeout: dedupCheckTimeout,
+		Transport: &http.Transport{
+			DialContext:       guardedDial(opts),
+			DisableKeepAlives: true, // The transport is used once
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if err := checkRedirect(req, via); err != nil {
+				return err
+			}
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// unchangedSince reports whether the page at url still has the ETag or
+// Last-Modified header recorded in record, checked with a HEAD request
+// instead of loading it in a browser. Pages without recorded validators, and
+// crawls through proxies, which the request would bypass, are never
+// considered unchanged here.
+func unchangedSince(ctx context.Context, url string, record storage.DedupRecord, opts CrawlOptions) (bool, error) {
+	if record.ETag == "" && record.LastModified == "" {
+		return false, nil
+	}
+	if opts.ProxyPool != nil || len(LoadProxies()) > 0 {
+		return false, nil
+	}
+
+	// The HEAD request is held to the same rules as a fetch
+	opts = opts.withDefaults()
+	if err := ValidateURLWithOptions(url, opts); err != nil {
+		return false, err
+	}
+	if err := checkRobots(ctx, url, "", opts); err != nil {
+		return false, err
+	}
+	if err := waitForRateLimit(ctx, url, opts); err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("User-Agent", pickUserAgent(opts))
+	for name, value := range opts.Headers {
+		req.Header.Set(name, value)
+	}
+	if opts.BasicAuth != nil {
+		req.SetBasicAuth(opts.BasicAuth.Username, opts.BasicAuth.Password)
+	}
+
+	resp, err := dedupClient(opts).Do(req)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return false, nil
+	}
+
+	if record.ETag != "" {
+		return resp.Header.Get("ETag") == record.ETag, nil
+	}
+	return resp.Header.Get("Last-Modified") == record.LastModified, nil
+}
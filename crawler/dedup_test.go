@@ -0,0 +1,95 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"pathik/storage"
+)
+
+func TestDedupClientRejectsPrivateAddress(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+	}))
+	defer srv.Close()
+	// localhost resolves to the loopback address the server listens on
+	localURL := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+
+	tests := []struct {
+		name    string
+		opts    CrawlOptions
+		url     string
+		private bool
+	}{
+		{"private address", CrawlOptions{}, localURL, true},
+		{"private IP", CrawlOptions{}, srv.URL, true},
+		{"private networks allowed", CrawlOptions{AllowPrivateNetworks: true}, localURL, false},
+		{"host allowed", CrawlOptions{AllowedHosts: []string{"localhost"}}, localURL, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := dedupClient(tt.opts).Head(tt.url)
+			if tt.private {
+				if !errors.Is(err, ErrPrivateAddress) {
+					t.Fatalf("HEAD %s = %v, want ErrPrivateAddress", tt.url, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("HEAD %s: %v", tt.url, err)
+			}
+			resp.Body.Close()
+		})
+	}
+}
+
+func TestDedupClientRedirects(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/private":
+			http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+		case "/moved":
+			http.Redirect(w, r, "/new", http.StatusFound)
+		}
+	}))
+	defer srv.Close()
+	client := dedupClient(CrawlOptions{AllowedHosts: []string{"127.0.0.1"}})
+
+	// A redirect to a rejected URL fails
+	if _, err := client.Head(srv.URL + "/private"); !errors.Is(err, ErrNavigationRejected) {
+		t.Fatalf("HEAD redirecting to a metadata endpoint = %v, want ErrNavigationRejected", err)
+	}
+	// Others aren't followed
+	resp, err := client.Head(srv.URL + "/moved")
+	if err != nil {
+		t.Fatalf("HEAD: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("status %d, want the redirect itself", resp.StatusCode)
+	}
+}
+
+func TestUnchangedSinceRejectsPrivateHost(t *testing.T) {
+	requested := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = true
+		w.Header().Set("ETag", `"v1"`)
+	}))
+	defer srv.Close()
+	localURL := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+
+	record := storage.DedupRecord{ETag: `"v1"`}
+	opts := CrawlOptions{IgnoreRobots: true, Headers: map[string]string{"Authorization": "Bearer secret"}}
+	unchanged, err := unchangedSince(context.Background(), localURL, record, opts)
+	if err == nil || unchanged {
+		t.Fatalf("unchangedSince = %v, %v; want an error", unchanged, err)
+	}
+	if requested {
+		t.Fatal("the HEAD request reached the private host")
+	}
+}
@@ -0,0 +1,103 @@
+package crawler
+
+import (
+	"fmt"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/devices"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// Default desktop screen, used without CrawlOptions.Device
+const (
+	defaultViewportWidth  = 1920
+	defaultViewportHeight = 1080
+)
+
+// desktopDevice is the device pages get without CrawlOptions.Device
+var desktopDevice = Viewport{Width: defaultViewportWidth, Height: defaultViewportHeight}.Device()
+
+// Viewport describes a screen size, for CrawlOptions.Viewport or for
+// devices go-rod has no preset for
+type Viewport struct {
+	Width  int
+	Height int
+	// Mobile emulates a phone or tablet, including touch support, so sites
+	// serve their mobile layout
+	Mobile bool
+}
+
+// Device returns a device with this screen, for CrawlOptions.Device
+func (v Viewport) Device() devices.Device {
+	device := devices.Device{
+		Title: fmt.Sprintf("%dx%d", v.Width, v.Height),
+		Screen: devices.Screen{
+			DevicePixelRatio: 1,
+			Horizontal:       devices.ScreenSize{Width: v.Width, Height: v.Height},
+			Vertical:         devices.ScreenSize{Width: v.Width, Height: v.Height},
+		},
+	}
+	if v.Mobile {
+		device.Capabilities = []string{"mobile", "touch"}
+	}
+	return device
+}
+
+// device returns the device pages are emulated as
+func (opts CrawlOptions) device() devices.Device {
+	if opts.Device != nil {
+		return *opts.Device
+	}
+	return desktopDevice
+}
+
+// viewport returns the screen metrics to emulate for device, resized to
+// Viewport where it is set. Nil clears the emulation.
+func (opts CrawlOptions) viewport(device devices.Device) *proto.EmulationSetDeviceMetricsOverride {
+	metrics := device.MetricsEmulation()
+	if metrics == nil {
+		return nil
+	}
+	if opts.Viewport.Width > 0 {
+		metrics.Width = opts.Viewport.Width
+	}
+	if opts.Viewport.Height > 0 {
+		metrics.Height = opts.Viewport.Height
+	}
+	if opts.Viewport.Mobile {
+		metrics.Mobile = true
+	}
+	return metrics
+}
+
+// emulate applies the device and viewport of opts to page
+func emulate(page *rod.Page, opts CrawlOptions) error {
+	device := opts.device()
+	if err := page.SetViewport(opts.viewport(device)); err != nil {
+		return fmt.Errorf("failed to set viewport: %w", err)
+	}
+	touch := device.TouchEmulation()
+	if opts.Viewport.Mobile {
+		touch.Enabled = true
+	}
+	if err := touch.Call(page); err != nil {
+		return fmt.Errorf("failed to emulate touch: %w", err)
+	}
+	return nil
+}
+
+// validateDevice rejects devices without a usable screen
+func validateDevice(device *devices.Device) error {
+	if device == nil || device.IsClear() {
+		return nil
+	}
+	for _, size := range []devices.ScreenSize{device.Screen.Horizontal, device.Screen.Vertical} {
+		if size.Width <= 0 || size.Height <= 0 {
+			return fmt.Errorf("device screen dimensions must be positive")
+		}
+	}
+	if device.Screen.DevicePixelRatio < 0 {
+		return fmt.Errorf("device pixel ratio must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-rod/rod/lib/devices"
+)
+
+func TestViewportMetrics(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   CrawlOptions
+		width  int
+		height int
+		mobile bool
+	}{
+		{"desktop", CrawlOptions{}, defaultViewportWidth, defaultViewportHeight, false},
+		{"preset", CrawlOptions{Device: &devices.IPhoneX}, 375, 812, true},
+		{"custom", CrawlOptions{Device: customDevice(Viewport{Width: 360, Height: 640, Mobile: true})}, 360, 640, true},
+		{"resized desktop", CrawlOptions{Viewport: Viewport{Width: 800}}, 800, defaultViewportHeight, false},
+		{"resized preset", CrawlOptions{Device: &devices.IPhoneX, Viewport: Viewport{Height: 600}}, 375, 600, true},
+		{"mobile viewport", CrawlOptions{Viewport: Viewport{Width: 400, Height: 700, Mobile: true}}, 400, 700, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics := tt.opts.viewport(tt.opts.device())
+			if metrics == nil {
+				t.Fatal("viewport = nil, want metrics")
+			}
+			if metrics.Width != tt.width || metrics.Height != tt.height || metrics.Mobile != tt.mobile {
+				t.Errorf("viewport = %dx%d mobile %v, want %dx%d mobile %v", metrics.Width, metrics.Height, metrics.Mobile, tt.width, tt.height, tt.mobile)
+			}
+		})
+	}
+}
+
+func TestValidateDevice(t *testing.T) {
+	tests := []struct {
+		name    string
+		device  *devices.Device
+		wantErr bool
+	}{
+		{"none", nil, false},
+		{"preset", &devices.IPhoneX, false},
+		{"cleared", &devices.Clear, false},
+		{"custom", customDevice(Viewport{Width: 360, Height: 640}), false},
+		{"zero width", customDevice(Viewport{Height: 640}), true},
+		{"negative height", customDevice(Viewport{Width: 360, Height: -1}), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateDevice(tt.device); (err != nil) != tt.wantErr {
+				t.Errorf("validateDevice = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDeviceEmulation(t *testing.T) {
+	requireBrowser(t)
+
+	srv := serveHTML(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><meta name="viewport" content="width=device-width"></head><body>
+<p id="screen"></p>
+<script>document.getElementById("screen").textContent = "viewport " + innerWidth + "x" + innerHeight + " touch " + (navigator.maxTouchPoints > 0)</script>
+</body></html>`))
+	})
+
+	tests := []struct {
+		name   string
+		device *devices.Device
+		want   string
+	}{
+		{"desktop", nil, "viewport 1920x1080 touch false"},
+		{"preset", &devices.IPhoneX, "viewport 375x812 touch true"},
+		{"custom", customDevice(Viewport{Width: 360, Height: 640, Mobile: true}), "viewport 360x640 touch true"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := localOptions()
+			opts.Device = tt.device
+			page, err := FetchPageWithOptions(context.Background(), srv.URL, "", opts)
+			if err != nil {
+				t.Fatalf("FetchPageWithOptions: %v", err)
+			}
+			if !strings.Contains(page, tt.want) {
+				t.Fatalf("page does not report %q:\n%s", tt.want, page)
+			}
+		})
+	}
+}
+
+// customDevice returns the device for a custom screen
+func customDevice(v Viewport) *devices.Device {
+	device := v.Device()
+	return &device
+}
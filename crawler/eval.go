@@ -0,0 +1,37 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/go-rod/rod"
+)
+
+// evalPage runs opts.EvalJS in page and returns its result as JSON. It gets
+// SelectorTimeout to finish, like a PreAction.
+func evalPage(ctx context.Context, page *rod.Page, opts CrawlOptions) (json.RawMessage, error) {
+	evaluating := page.Timeout(opts.SelectorTimeout)
+	defer evaluating.CancelTimeout()
+
+	res, err := evaluating.Eval(opts.EvalJS)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, fmt.Errorf("EvalJS did not finish within %v", opts.SelectorTimeout)
+		}
+		return nil, fmt.Errorf("error evaluating EvalJS: %w", err)
+	}
+	// undefined comes back without a value
+	if res.Value.Nil() {
+		return json.RawMessage("null"), nil
+	}
+	data, err := json.Marshal(res.Value)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding EvalJS result: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,70 @@
+package crawler
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestValidateEvalJS(t *testing.T) {
+	tests := []struct {
+		name    string
+		js      string
+		wantErr bool
+	}{
+		{"not set", "", false},
+		{"function", "() => window.__INITIAL_STATE__", false},
+		{"blank", " \n\t", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := (CrawlOptions{EvalJS: tt.js}).validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEvalJS(t *testing.T) {
+	requireBrowser(t)
+
+	srv := serveHTML(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><body><p>Store</p>
+<script>window.__INITIAL_STATE__ = {user: "ada", items: [1, 2, 3]}</script>
+</body></html>`))
+	})
+
+	tests := []struct {
+		name    string
+		js      string
+		want    string // Empty when no result is kept
+		wantErr string
+	}{
+		{"not set", "", "", ""},
+		{"data store", "() => window.__INITIAL_STATE__", `{"items":[1,2,3],"user":"ada"}`, ""},
+		{"computed", "() => document.querySelectorAll('p').length * 2", "2", ""},
+		{"promise", "() => new Promise(resolve => setTimeout(() => resolve('later'), 100))", `"later"`, ""},
+		{"undefined", "() => undefined", "null", ""},
+		{"throws", "() => { throw new Error('boom') }", "", "error evaluating EvalJS"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := localOptions()
+			opts.EvalJS = tt.js
+			result, err := CrawlToMemory(srv.URL, opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("CrawlToMemory = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CrawlToMemory: %v", err)
+			}
+			if got := string(result.EvalResult); got != tt.want {
+				t.Errorf("EvalResult = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package crawler
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/go-shiori/go-readability"
+)
+
+// ReadabilityOptions tunes how Readability picks a page's main content. The
+// zero value uses go-readability's defaults.
+type ReadabilityOptions struct {
+	// CharThreshold is the number of characters an article must have for
+	// Readability to accept it rather than retry with looser rules. Lower it
+	// for short pages that lose content. Zero means 500.
+	CharThreshold int
+	// NTopCandidates is how many top-scoring nodes are compared when picking
+	// the main content. Zero means 5.
+	NTopCandidates int
+	// MaxElemsToParse rejects pages with more elements. Zero means no limit.
+	MaxElemsToParse int
+	// KeepClasses keeps class attributes on the extracted HTML instead of
+	// stripping all but ClassesToPreserve
+	KeepClasses bool
+	// ClassesToPreserve are kept even when KeepClasses is false, in addition
+	// to Readability's own "page" class
+	ClassesToPreserve []string
+	// DisableJSONLD ignores JSON-LD metadata when reading the title, byline
+	// and so on
+	DisableJSONLD bool
+}
+
+// validate rejects negative limits
+func (o ReadabilityOptions) validate() error {
+	if o.CharThreshold < 0 || o.NTopCandidates < 0 || o.MaxElemsToParse < 0 {
+		return fmt.Errorf("readability limits must not be negative")
+	}
+	return nil
+}
+
+// parser returns a Readability parser configured by o
+func (o ReadabilityOptions) parser() readability.Parser {
+	parser := readability.NewParser()
+	if o.CharThreshold > 0 {
+		parser.CharThresholds = o.CharThreshold
+	}
+	if o.NTopCandidates > 0 {
+		parser.NTopCandidates = o.NTopCandidates
+	}
+	parser.MaxElemsToParse = o.MaxElemsToParse
+	parser.KeepClasses = o.KeepClasses
+	parser.ClassesToPreserve = append(parser.ClassesToPreserve, o.ClassesToPreserve...)
+	parser.DisableJSONLD = o.DisableJSONLD
+	return parser
+}
+
+// ExtractHTMLContentWithOptions is like ExtractHTMLContent but tunes
+// Readability with opts
+func ExtractHTMLContentWithOptions(htmlStr, urlStr string, opts ReadabilityOptions) (string, error) {
+	parsedURL, err := url.Parse(urlStr)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse URL %s: %v", urlStr, err)
+	}
+	parser := opts.parser()
+	article, err := parser.Parse(strings.NewReader(htmlStr), parsedURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to extract content from %s: %v", urlStr, err)
+	}
+	return article.Content, nil
+}
@@ -0,0 +1,416 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// HAR 1.2 document, see http://www.softwareishard.com/blog/har-12-spec/.
+// Sizes and timings that aren't known are -1, as the spec asks.
+type harLog struct {
+	Log struct {
+		Version string     `json:"version"`
+		Creator harCreator `json:"creator"`
+		Pages   []harPage  `json:"pages"`
+		Entries []harEntry `json:"entries"`
+	} `json:"log"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harPage struct {
+	StartedDateTime time.Time `json:"startedDateTime"`
+	ID              string    `json:"id"`
+	Title           string    `json:"title"`
+	PageTimings     struct {
+		OnContentLoad float64 `json:"onContentLoad"`
+		OnLoad        float64 `json:"onLoad"`
+	} `json:"pageTimings"`
+}
+
+type harEntry struct {
+	Pageref         string      `json:"pageref"`
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	ServerIPAddress string      `json:"serverIPAddress,omitempty"`
+	Error           string      `json:"_error,omitempty"` // Why the request failed, Chrome's extension
+	TransferSize    float64     `json:"_transferSize"`    // Bytes received including headers, Chrome's extension
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+}
+
+type harTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+// harPageID is the id of the one page in each HAR file
+const harPageID = "page_1"
+
+// harRecorder records the network activity of a page from CDP events
+type harRecorder struct {
+	mu      sync.Mutex
+	pageURL string
+	started time.Time             // Wall time of the first request
+	start   proto.MonotonicTime   // Timestamp of the first request
+	entries []*harRecord          // In the order requests were sent
+	pending map[string]*harRecord // Entries still loading, by request ID
+	page    map[string]float64    // Page event offsets from start, in ms
+}
+
+// harRecord is an entry along with what's needed to finish it
+type harRecord struct {
+	entry   harEntry
+	sent    proto.MonotonicTime          // When the request was sent
+	timing  *proto.NetworkResourceTiming // Connection timing, if known
+	decoded int                          // Decoded body bytes received
+	encoded int                          // Body bytes received on the wire
+}
+
+// recordHAR starts recording page's network activity and returns the
+// recorder and a func that stops it. It must run before navigating to
+// pageURL.
+func recordHAR(ctx context.Context, page *rod.Page, pageURL string) (*harRecorder, func()) {
+	r := &harRecorder{
+		pageURL: pageURL,
+		pending: make(map[string]*harRecord),
+		page:    make(map[string]float64),
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	wait := page.Context(ctx).EachEvent(
+		r.requestWillBeSent,
+		r.responseReceived,
+		r.dataReceived,
+		r.loadingFinished,
+		r.loadingFailed,
+		func(e *proto.PageDomContentEventFired) { r.pageEvent("onContentLoad", e.Timestamp) },
+		func(e *proto.PageLoadEventFired) { r.pageEvent("onLoad", e.Timestamp) },
+	)
+	go wait()
+	return r, cancel
+}
+
+func (r *harRecorder) requestWillBeSent(e *proto.NetworkRequestWillBeSent) {
+	if strings.HasPrefix(e.Request.URL, "data:") {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id := string(e.RequestID)
+	// A redirect reuses the request ID; the hop it ends becomes an entry
+	if prev := r.pending[id]; prev != nil && e.RedirectResponse != nil {
+		prev.setResponse(e.RedirectResponse)
+		prev.finish(e.Timestamp)
+		delete(r.pending, id)
+	}
+	if r.started.IsZero() {
+		r.started = e.WallTime.Time()
+		r.start = e.Timestamp
+	}
+
+	rec := &harRecord{sent: e.Timestamp}
+	rec.entry = harEntry{
+		Pageref:         harPageID,
+		StartedDateTime: e.WallTime.Time(),
+		Request: harRequest{
+			Method:      e.Request.Method,
+			URL:         e.Request.URL + e.Request.URLFragment,
+			HTTPVersion: "HTTP/1.1",
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(e.Request.Headers),
+			QueryString: harQuery(e.Request.URL),
+			HeadersSize: -1,
+			BodySize:    len(e.Request.PostData),
+		},
+		Response: harResponse{
+			Cookies:     []harNameValue{},
+			Headers:     []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+		Timings: harTimings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1},
+	}
+	if e.Request.HasPostData {
+		rec.entry.Request.PostData = &harPostData{
+			MimeType: harHeader(e.Request.Headers, "Content-Type"),
+			Text:     e.Request.PostData,
+		}
+	}
+	r.entries = append(r.entries, rec)
+	r.pending[id] = rec
+}
+
+func (r *harRecorder) responseReceived(e *proto.NetworkResponseReceived) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if rec := r.pending[string(e.RequestID)]; rec != nil {
+		rec.setResponse(e.Response)
+	}
+}
+
+func (r *harRecorder) dataReceived(e *proto.NetworkDataReceived) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if rec := r.pending[string(e.RequestID)]; rec != nil {
+		rec.decoded += e.DataLength
+		rec.encoded += e.EncodedDataLength
+	}
+}
+
+func (r *harRecorder) loadingFinished(e *proto.NetworkLoadingFinished) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if rec := r.pending[string(e.RequestID)]; rec != nil {
+		rec.entry.TransferSize = e.EncodedDataLength
+		rec.finish(e.Timestamp)
+		delete(r.pending, string(e.RequestID))
+	}
+}
+
+func (r *harRecorder) loadingFailed(e *proto.NetworkLoadingFailed) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if rec := r.pending[string(e.RequestID)]; rec != nil {
+		rec.entry.Error = e.ErrorText
+		rec.finish(e.Timestamp)
+		delete(r.pending, string(e.RequestID))
+	}
+}
+
+func (r *harRecorder) pageEvent(name string, timestamp proto.MonotonicTime) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, seen := r.page[name]; !seen && r.start > 0 {
+		r.page[name] = float64(timestamp-r.start) * 1000
+	}
+}
+
+// setResponse fills in the entry's response from resp
+func (rec *harRecord) setResponse(resp *proto.NetworkResponse) {
+	rec.entry.Response.Status = resp.Status
+	rec.entry.Response.StatusText = resp.StatusText
+	rec.entry.Response.HTTPVersion = harHTTPVersion(resp.Protocol)
+	rec.entry.Request.HTTPVersion = rec.entry.Response.HTTPVersion
+	rec.entry.Response.Headers = harHeaders(resp.Headers)
+	rec.entry.Response.Content.MimeType = resp.MIMEType
+	rec.entry.Response.RedirectURL = harHeader(resp.Headers, "Location")
+	if resp.RequestHeaders != nil {
+		// What was actually sent, including headers the browser added
+		rec.entry.Request.Headers = harHeaders(resp.RequestHeaders)
+	}
+	rec.entry.ServerIPAddress = resp.RemoteIPAddress
+	rec.timing = resp.Timing
+}
+
+// finish completes the entry's sizes and timings once it ended at end
+func (rec *harRecord) finish(end proto.MonotonicTime) {
+	e := &rec.entry
+	e.Response.Content.Size = rec.decoded
+	if e.Response.Status != 0 {
+		e.Response.BodySize = rec.encoded
+	}
+
+	total := float64(end-rec.sent) * 1000
+	t := rec.timing
+	if t == nil {
+		// Served without touching the network, e.g. from the cache
+		e.Timings.Send = 0
+		e.Timings.Wait = total
+		e.Timings.Receive = 0
+		e.Time = total
+		return
+	}
+
+	// Timing offsets are in ms from RequestTime, -1 when a phase didn't happen
+	e.Timings.Blocked = firstNonNegative(t.DNSStart, t.ConnectStart, t.SendStart)
+	if t.DNSStart >= 0 {
+		e.Timings.DNS = t.DNSEnd - t.DNSStart
+	}
+	if t.ConnectStart >= 0 {
+		e.Timings.Connect = t.ConnectEnd - t.ConnectStart
+	}
+	if t.SslStart >= 0 {
+		e.Timings.SSL = t.SslEnd - t.SslStart
+	}
+	e.Timings.Send = t.SendEnd - t.SendStart
+	e.Timings.Wait = t.ReceiveHeadersEnd - t.SendEnd
+	finished := (float64(end) - t.RequestTime) * 1000
+	e.Timings.Receive = max(finished-t.ReceiveHeadersEnd, 0)
+
+	// SSL is already part of connect
+	e.Time = e.Timings.Send + e.Timings.Wait + e.Timings.Receive
+	for _, phase := range []float64{e.Timings.Blocked, e.Timings.DNS, e.Timings.Connect} {
+		if phase > 0 {
+			e.Time += phase
+		}
+	}
+}
+
+// encode returns the HAR document of everything recorded so far. Requests
+// still loading are included without a response.
+func (r *harRecorder) encode() ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var har harLog
+	har.Log.Version = "1.2"
+	har.Log.Creator = harCreator{Name: "pathik", Version: buildVersion()}
+
+	page := harPage{StartedDateTime: r.started, ID: harPageID, Title: r.pageURL}
+	page.PageTimings.OnContentLoad = -1
+	page.PageTimings.OnLoad = -1
+	if ms, ok := r.page["onContentLoad"]; ok {
+		page.PageTimings.OnContentLoad = ms
+	}
+	if ms, ok := r.page["onLoad"]; ok {
+		page.PageTimings.OnLoad = ms
+	}
+	har.Log.Pages = []harPage{page}
+
+	har.Log.Entries = make([]harEntry, 0, len(r.entries))
+	for _, rec := range r.entries {
+		har.Log.Entries = append(har.Log.Entries, rec.entry)
+	}
+	sort.SliceStable(har.Log.Entries, func(i, j int) bool {
+		return har.Log.Entries[i].StartedDateTime.Before(har.Log.Entries[j].StartedDateTime)
+	})
+	return json.MarshalIndent(har, "", "  ")
+}
+
+// harHeaders converts CDP headers to HAR name/value pairs, sorted by name
+func harHeaders(headers proto.NetworkHeaders) []harNameValue {
+	pairs := make([]harNameValue, 0, len(headers))
+	for name, value := range headers {
+		// Repeated headers arrive joined by newlines
+		for _, v := range strings.Split(value.Str(), "\n") {
+			pairs = append(pairs, harNameValue{Name: name, Value: v})
+		}
+	}
+	sort.SliceStable(pairs, func(i, j int) bool { return pairs[i].Name < pairs[j].Name })
+	return pairs
+}
+
+// harHeader returns the value of the named header in any case, as HTTP/2
+// sends them in lower case
+func harHeader(headers proto.NetworkHeaders, name string) string {
+	for k, v := range headers {
+		if strings.EqualFold(k, name) {
+			return v.Str()
+		}
+	}
+	return ""
+}
+
+// harQuery returns the query parameters of rawURL
+func harQuery(rawURL string) []harNameValue {
+	pairs := []harNameValue{}
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return pairs
+	}
+	for _, param := range strings.Split(parsed.RawQuery, "&") {
+		if param == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(param, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if unescaped, err := url.QueryUnescape(value); err == nil {
+			value = unescaped
+		}
+		pairs = append(pairs, harNameValue{Name: name, Value: value})
+	}
+	return pairs
+}
+
+// harHTTPVersion names a CDP protocol such as "h2" the way HAR does
+func harHTTPVersion(protocol string) string {
+	switch strings.ToLower(protocol) {
+	case "h2":
+		return "HTTP/2"
+	case "h3", "h3-29":
+		return "HTTP/3"
+	case "":
+		return "HTTP/1.1"
+	}
+	return strings.ToUpper(protocol)
+}
+
+// firstNonNegative returns the first of values that is at least zero, or -1
+func firstNonNegative(values ...float64) float64 {
+	for _, v := range values {
+		if v >= 0 {
+			return v
+		}
+	}
+	return -1
+}
+
+// buildVersion returns the version of the module this binary was built
+// from, "dev" for a local build
+func buildVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return "dev"
+}
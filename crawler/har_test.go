@@ -0,0 +1,154 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// networkHeaders decodes CDP headers from JSON
+func networkHeaders(t *testing.T, raw string) proto.NetworkHeaders {
+	t.Helper()
+	var headers proto.NetworkHeaders
+	if err := json.Unmarshal([]byte(raw), &headers); err != nil {
+		t.Fatal(err)
+	}
+	return headers
+}
+
+func TestHARRecorder(t *testing.T) {
+	r := &harRecorder{
+		pageURL: "http://example.com/",
+		pending: make(map[string]*harRecord),
+		page:    make(map[string]float64),
+	}
+
+	// http://example.com/ redirects to https://example.com/?q=a%20b, which
+	// loads a stylesheet that fails
+	r.requestWillBeSent(&proto.NetworkRequestWillBeSent{
+		RequestID: "1",
+		Request:   &proto.NetworkRequest{Method: "GET", URL: "http://example.com/"},
+		Timestamp: 100,
+		WallTime:  1700000000,
+	})
+	r.requestWillBeSent(&proto.NetworkRequestWillBeSent{
+		RequestID: "1",
+		Request:   &proto.NetworkRequest{Method: "GET", URL: "https://example.com/?q=a%20b"},
+		RedirectResponse: &proto.NetworkResponse{
+			Status:     301,
+			StatusText: "Moved Permanently",
+			Headers:    networkHeaders(t, `{"location": "https://example.com/?q=a%20b"}`),
+		},
+		Timestamp: 100.1,
+		WallTime:  1700000000.1,
+	})
+	r.responseReceived(&proto.NetworkResponseReceived{
+		RequestID: "1",
+		Response: &proto.NetworkResponse{
+			Status:          200,
+			StatusText:      "OK",
+			Protocol:        "h2",
+			MIMEType:        "text/html",
+			Headers:         networkHeaders(t, `{"content-type": "text/html"}`),
+			RemoteIPAddress: "93.184.216.34",
+			Timing: &proto.NetworkResourceTiming{
+				RequestTime:       100.1,
+				DNSStart:          -1,
+				DNSEnd:            -1,
+				ConnectStart:      -1,
+				ConnectEnd:        -1,
+				SslStart:          -1,
+				SslEnd:            -1,
+				SendStart:         1,
+				SendEnd:           2,
+				ReceiveHeadersEnd: 52,
+			},
+		},
+	})
+	r.dataReceived(&proto.NetworkDataReceived{RequestID: "1", DataLength: 1000, EncodedDataLength: 400})
+	r.pageEvent("onContentLoad", 100.3)
+	r.loadingFinished(&proto.NetworkLoadingFinished{RequestID: "1", Timestamp: 100.2, EncodedDataLength: 500})
+	r.requestWillBeSent(&proto.NetworkRequestWillBeSent{
+		RequestID: "2",
+		Request:   &proto.NetworkRequest{Method: "GET", URL: "https://example.com/style.css"},
+		Timestamp: 100.25,
+		WallTime:  1700000000.25,
+	})
+	r.loadingFailed(&proto.NetworkLoadingFailed{RequestID: "2", Timestamp: 100.3, ErrorText: "net::ERR_FAILED"})
+
+	data, err := r.encode()
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	var har harLog
+	if err := json.Unmarshal(data, &har); err != nil {
+		t.Fatalf("HAR is not valid JSON: %v", err)
+	}
+
+	if har.Log.Version != "1.2" || len(har.Log.Pages) != 1 {
+		t.Fatalf("HAR version %q with %d pages, want 1.2 with 1", har.Log.Version, len(har.Log.Pages))
+	}
+	if got := har.Log.Pages[0].PageTimings; got.OnContentLoad < 299 || got.OnContentLoad > 301 || got.OnLoad != -1 {
+		t.Errorf("page timings = %+v, want onContentLoad 300ms and no onLoad", got)
+	}
+	if len(har.Log.Entries) != 3 {
+		t.Fatalf("HAR has %d entries, want the redirect, the document and the stylesheet", len(har.Log.Entries))
+	}
+
+	redirect, document, failed := har.Log.Entries[0], har.Log.Entries[1], har.Log.Entries[2]
+	if redirect.Response.Status != 301 || redirect.Response.RedirectURL != "https://example.com/?q=a%20b" {
+		t.Errorf("redirect entry = %+v, want a 301 to the document", redirect.Response)
+	}
+	if document.Request.URL != "https://example.com/?q=a%20b" || document.Response.Status != 200 {
+		t.Errorf("document entry = %s %d, want the final 200", document.Request.URL, document.Response.Status)
+	}
+	if len(document.Request.QueryString) != 1 || document.Request.QueryString[0] != (harNameValue{Name: "q", Value: "a b"}) {
+		t.Errorf("document query = %v, want q=a b", document.Request.QueryString)
+	}
+	if document.Response.HTTPVersion != "HTTP/2" || document.ServerIPAddress != "93.184.216.34" {
+		t.Errorf("document entry served over %s from %s, want HTTP/2 from 93.184.216.34", document.Response.HTTPVersion, document.ServerIPAddress)
+	}
+	if document.Response.Content.Size != 1000 || document.Response.BodySize != 400 || document.TransferSize != 500 {
+		t.Errorf("document sizes = content %d, body %d, transfer %v; want 1000, 400, 500", document.Response.Content.Size, document.Response.BodySize, document.TransferSize)
+	}
+	if document.Timings.Send != 1 || document.Timings.Wait != 50 || document.Timings.DNS != -1 {
+		t.Errorf("document timings = %+v, want send 1, wait 50 and no DNS", document.Timings)
+	}
+	if failed.Error != "net::ERR_FAILED" || failed.Response.Status != 0 {
+		t.Errorf("failed entry = %+v, want the error without a response", failed)
+	}
+}
+
+func TestHARFile(t *testing.T) {
+	requireBrowser(t)
+
+	srv := serveHTML(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html><body><p>Recorded</p></body></html>"))
+	})
+
+	opts := localOptions()
+	opts.HAR = true
+	result, err := CrawlURLWithOptions(context.Background(), srv.URL, "", t.TempDir(), opts)
+	if err != nil {
+		t.Fatalf("CrawlURLWithOptions: %v", err)
+	}
+	data, err := os.ReadFile(result.HARPath)
+	if err != nil {
+		t.Fatalf("reading HAR: %v", err)
+	}
+	var har harLog
+	if err := json.Unmarshal(data, &har); err != nil {
+		t.Fatalf("HAR is not valid JSON: %v", err)
+	}
+	for _, entry := range har.Log.Entries {
+		if entry.Request.URL == srv.URL+"/" && entry.Response.Status == http.StatusOK {
+			return
+		}
+	}
+	t.Fatalf("HAR has no 200 entry for %s:\n%s", srv.URL, data)
+}
@@ -0,0 +1,256 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// blockableResourceTypes are the resource types BlockResourceTypes accepts,
+// keyed by their lower-case name. The main document can never be blocked.
+var blockableResourceTypes = map[string]proto.NetworkResourceType{
+	"stylesheet":  proto.NetworkResourceTypeStylesheet,
+	"image":       proto.NetworkResourceTypeImage,
+	"media":       proto.NetworkResourceTypeMedia,
+	"font":        proto.NetworkResourceTypeFont,
+	"script":      proto.NetworkResourceTypeScript,
+	"texttrack":   proto.NetworkResourceTypeTextTrack,
+	"xhr":         proto.NetworkResourceTypeXHR,
+	"fetch":       proto.NetworkResourceTypeFetch,
+	"prefetch":    proto.NetworkResourceTypePrefetch,
+	"eventsource": proto.NetworkResourceTypeEventSource,
+	"websocket":   proto.NetworkResourceTypeWebSocket,
+	"manifest":    proto.NetworkResourceTypeManifest,
+	"ping":        proto.NetworkResourceTypePing,
+	"other":       proto.NetworkResourceTypeOther,
+}
+
+// interceptor pauses the page's requests through the CDP Fetch domain so
+// per-request policies can be applied before they reach the network
+type interceptor struct {
+	page       *rod.Page
+	pageURL    string // The crawled URL
+	targetHost string // Host (with port) of the crawled URL
+	blocked    map[proto.NetworkResourceType]bool
+	basicAuth  *BasicAuth
+	proxyAuth  *BasicAuth        // Credentials for the network proxy, if it needs them
+	headers    map[string]string // Extra headers for requests to targetHost
+	// conditional are the conditional headers for the request of pageURL
+	// itself, not its redirects or subresources
+	conditional map[string]string
+	resources   *resourceCollector // Receives responses when resources are captured
+	navigations *navigationGuard   // Checks the navigations of every frame
+}
+
+// validateResourceTypes rejects unknown names in BlockResourceTypes
+func validateResourceTypes(types []string) error {
+	for _, t := range types {
+		if _, ok := blockableResourceTypes[strings.ToLower(t)]; !ok {
+			return fmt.Errorf("unknown or unblockable resource type %q", t)
+		}
+	}
+	return nil
+}
+
+// startInterceptor enables request interception on page when opts, the
+// credentials of proxy, cond, resources or navigations need it and returns
+// a func that stops it. Responses are passed to resources when it is
+// non-nil, the navigations of every frame to navigations. It must run before
+// navigating to pageURL.
+func startInterceptor(ctx context.Context, page *rod.Page, pageURL string, proxy string, opts CrawlOptions, cond validators, resources *resourceCollector, navigations *navigationGuard) (func(), error) {
+	auth := proxyAuth(proxy)
+	conditional := cond.headers()
+	// Checking navigations only takes pausing documents
+	documentsOnly := len(opts.BlockResourceTypes) == 0 && opts.BasicAuth == nil && len(opts.Headers) == 0 && auth == nil &&
+		len(conditional) == 0 && resources == nil
+	if documentsOnly && navigations == nil {
+		return func() {}, nil
+	}
+
+	i := &interceptor{
+		page:        page,
+		pageURL:     pageURL,
+		blocked:     make(map[proto.NetworkResourceType]bool),
+		basicAuth:   opts.BasicAuth,
+		proxyAuth:   auth,
+		headers:     opts.Headers,
+		conditional: conditional,
+		resources:   resources,
+		navigations: navigations,
+	}
+	if parsedURL, err := url.Parse(pageURL); err == nil {
+		i.targetHost = strings.ToLower(parsedURL.Host)
+	}
+	for _, t := range opts.BlockResourceTypes {
+		i.blocked[blockableResourceTypes[strings.ToLower(t)]] = true
+	}
+
+	// Subscribe first: EachEvent enables the Fetch domain with defaults,
+	// which the explicit enable below then overrides
+	ctx, cancel := context.WithCancel(ctx)
+	wait := page.Context(ctx).EachEvent(
+		func(e *proto.FetchRequestPaused) {
+			go i.handleRequest(e)
+		},
+		func(e *proto.FetchAuthRequired) {
+			go i.handleAuth(e)
+		},
+	)
+	patterns := []*proto.FetchRequestPattern{{URLPattern: "*", RequestStage: proto.FetchRequestStageRequest}}
+	if documentsOnly {
+		patterns[0].ResourceType = proto.NetworkResourceTypeDocument
+	}
+	if resources != nil {
+		patterns = append(patterns, &proto.FetchRequestPattern{URLPattern: "*", RequestStage: proto.FetchRequestStageResponse})
+	}
+	err := proto.FetchEnable{
+		Patterns:           patterns,
+		HandleAuthRequests: i.basicAuth != nil || i.proxyAuth != nil,
+	}.Call(page)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to enable request interception: %w", err)
+	}
+	go wait()
+
+	return func() {
+		cancel()
+		_ = proto.FetchDisable{}.Call(page)
+	}, nil
+}
+
+// handleRequest aborts blocked resource types and refused navigations and
+// lets everything else through. Paused responses are captured and passed on
+// unchanged.
+func (i *interceptor) handleRequest(e *proto.FetchRequestPaused) {
+	if e.ResponseStatusCode != nil || e.ResponseErrorReason != "" {
+		i.resources.add(i.page, e, i.pageURL)
+		_ = proto.FetchContinueResponse{RequestID: e.RequestID}.Call(i.page)
+		return
+	}
+
+	// rod's launcher turns site isolation off, so iframes load in the page's
+	// target and are paused here too
+	refused := false
+	if i.navigations != nil && e.ResourceType == proto.NetworkResourceTypeDocument {
+		if e.FrameID == i.page.FrameID {
+			refused = i.navigations.check(e.Request.URL, e.RedirectedRequestID != "") != nil
+		} else {
+			refused = i.navigations.checkFrame(e.Request.URL) != nil
+		}
+	}
+	if refused || i.blocked[e.ResourceType] {
+		_ = proto.FetchFailRequest{
+			RequestID:   e.RequestID,
+			ErrorReason: proto.NetworkErrorReasonBlockedByClient,
+		}.Call(i.page)
+		return
+	}
+
+	continueReq := proto.FetchContinueRequest{RequestID: e.RequestID}
+	if extra := i.extraHeaders(e); len(extra) > 0 {
+		continueReq.Headers = mergeHeaders(e.Request.Headers, extra)
+	}
+	_ = continueReq.Call(i.page)
+}
+
+// extraHeaders returns the headers to add to a paused request: the custom
+// headers for requests to the crawled URL's exact host, so they never leak
+// to third parties, and the conditional headers for the page itself
+func (i *interceptor) extraHeaders(e *proto.FetchRequestPaused) map[string]string {
+	extra := make(map[string]string)
+	if i.isTargetHost(e.Request.URL) {
+		for name, value := range i.headers {
+			extra[name] = value
+		}
+	}
+	if e.ResourceType == proto.NetworkResourceTypeDocument && sameDocument(e.Request.URL, i.pageURL) {
+		for name, value := range i.conditional {
+			extra[name] = value
+		}
+	}
+	return extra
+}
+
+// isTargetHost reports whether rawURL points at the crawled URL's exact host
+func (i *interceptor) isTargetHost(rawURL string) bool {
+	requestURL, err := url.Parse(rawURL)
+	return err == nil && strings.ToLower(requestURL.Host) == i.targetHost
+}
+
+// sameDocument reports whether two URLs load the same document, ignoring
+// fragments and the normalization browsers apply such as adding a "/" path
+func sameDocument(a, b string) bool {
+	normalize := func(rawURL string) string {
+		parsed, err := url.Parse(rawURL)
+		if err != nil {
+			return rawURL
+		}
+		parsed.Fragment = ""
+		parsed.Host = strings.ToLower(parsed.Host)
+		if parsed.Path == "" {
+			parsed.Path = "/"
+		}
+		return parsed.String()
+	}
+	return normalize(a) == normalize(b)
+}
+
+// mergeHeaders returns the request's headers with extra added, replacing any
+// existing header of the same name
+func mergeHeaders(original proto.NetworkHeaders, extra map[string]string) []*proto.FetchHeaderEntry {
+	entries := make([]*proto.FetchHeaderEntry, 0, len(original)+len(extra))
+	for name, value := range original {
+		if _, overridden := lookupHeader(extra, name); !overridden {
+			entries = append(entries, &proto.FetchHeaderEntry{Name: name, Value: value.Str()})
+		}
+	}
+	for name, value := range extra {
+		entries = append(entries, &proto.FetchHeaderEntry{Name: name, Value: value})
+	}
+	return entries
+}
+
+// lookupHeader finds a header by case-insensitive name
+func lookupHeader(headers map[string]string, name string) (string, bool) {
+	for k, v := range headers {
+		if strings.EqualFold(k, name) {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// handleAuth answers HTTP authentication challenges
+func (i *interceptor) handleAuth(e *proto.FetchAuthRequired) {
+	_ = proto.FetchContinueWithAuth{
+		RequestID:             e.RequestID,
+		AuthChallengeResponse: i.authResponse(e),
+	}.Call(i.page)
+}
+
+// authResponse decides how to answer an authentication challenge. Basic
+// Auth credentials are only ever given to the exact host of the crawled
+// URL, so a redirect to another host can't harvest them. Proxy challenges
+// come from the proxy the browser was launched with and get its
+// credentials.
+func (i *interceptor) authResponse(e *proto.FetchAuthRequired) *proto.FetchAuthChallengeResponse {
+	var auth *BasicAuth
+	if e.AuthChallenge.Source == proto.FetchAuthChallengeSourceProxy {
+		auth = i.proxyAuth
+	} else if i.isTargetHost(e.Request.URL) {
+		auth = i.basicAuth
+	}
+	if auth == nil {
+		return &proto.FetchAuthChallengeResponse{Response: proto.FetchAuthChallengeResponseResponseCancelAuth}
+	}
+	return &proto.FetchAuthChallengeResponse{
+		Response: proto.FetchAuthChallengeResponseResponseProvideCredentials,
+		Username: auth.Username,
+		Password: auth.Password,
+	}
+}
@@ -0,0 +1,141 @@
+package crawler
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/go-rod/rod/lib/proto"
+)
+
+func TestAuthResponse(t *testing.T) {
+	i := &interceptor{
+		targetHost: "example.com",
+		basicAuth:  &BasicAuth{Username: "user", Password: "secret"},
+		proxyAuth:  &BasicAuth{Username: "proxy", Password: "proxy-secret"},
+	}
+	challenge := func(rawURL string, source proto.FetchAuthChallengeSource) *proto.FetchAuthRequired {
+		return &proto.FetchAuthRequired{
+			Request:       &proto.NetworkRequest{URL: rawURL},
+			AuthChallenge: &proto.FetchAuthChallenge{Source: source},
+		}
+	}
+	tests := []struct {
+		name     string
+		event    *proto.FetchAuthRequired
+		username string // Empty when the challenge is cancelled
+	}{
+		{"target host", challenge("https://example.com/private", proto.FetchAuthChallengeSourceServer), "user"},
+		{"target host in other case", challenge("https://EXAMPLE.com/private", proto.FetchAuthChallengeSourceServer), "user"},
+		{"other host", challenge("https://evil.example/", proto.FetchAuthChallengeSourceServer), ""},
+		{"subdomain", challenge("https://api.example.com/", proto.FetchAuthChallengeSourceServer), ""},
+		{"other port", challenge("https://example.com:8443/", proto.FetchAuthChallengeSourceServer), ""},
+		{"lookalike suffix", challenge("https://example.com.evil.example/", proto.FetchAuthChallengeSourceServer), ""},
+		{"proxy", challenge("https://evil.example/", proto.FetchAuthChallengeSourceProxy), "proxy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := i.authResponse(tt.event)
+			if tt.username == "" {
+				if resp.Response != proto.FetchAuthChallengeResponseResponseCancelAuth || resp.Username != "" {
+					t.Fatalf("authResponse = %+v, want the challenge cancelled", resp)
+				}
+				return
+			}
+			if resp.Response != proto.FetchAuthChallengeResponseResponseProvideCredentials || resp.Username != tt.username {
+				t.Fatalf("authResponse = %+v, want the credentials of %s", resp, tt.username)
+			}
+		})
+	}
+}
+
+func TestAuthResponseWithoutCredentials(t *testing.T) {
+	i := &interceptor{targetHost: "example.com"}
+	for _, source := range []proto.FetchAuthChallengeSource{proto.FetchAuthChallengeSourceServer, proto.FetchAuthChallengeSourceProxy} {
+		resp := i.authResponse(&proto.FetchAuthRequired{
+			Request:       &proto.NetworkRequest{URL: "https://example.com/"},
+			AuthChallenge: &proto.FetchAuthChallenge{Source: source},
+		})
+		if resp.Response != proto.FetchAuthChallengeResponseResponseCancelAuth {
+			t.Errorf("authResponse for a %s challenge = %+v, want it cancelled", source, resp)
+		}
+	}
+}
+
+func TestExtraHeaders(t *testing.T) {
+	i := &interceptor{
+		pageURL:     "https://example.com/page",
+		targetHost:  "example.com",
+		headers:     map[string]string{"X-Api-Key": "secret"},
+		conditional: map[string]string{"If-None-Match": `"v1"`},
+	}
+	request := func(rawURL string, typ proto.NetworkResourceType) *proto.FetchRequestPaused {
+		return &proto.FetchRequestPaused{Request: &proto.NetworkRequest{URL: rawURL}, ResourceType: typ}
+	}
+	tests := []struct {
+		name  string
+		event *proto.FetchRequestPaused
+		want  []string
+	}{
+		{"page itself", request("https://example.com/page#top", proto.NetworkResourceTypeDocument), []string{"If-None-Match", "X-Api-Key"}},
+		{"subresource on target host", request("https://example.com/app.js", proto.NetworkResourceTypeScript), []string{"X-Api-Key"}},
+		{"other page on target host", request("https://example.com/other", proto.NetworkResourceTypeDocument), []string{"X-Api-Key"}},
+		{"third party", request("https://cdn.example.net/app.js", proto.NetworkResourceTypeScript), nil},
+		{"subdomain", request("https://api.example.com/data", proto.NetworkResourceTypeXHR), nil},
+		{"other port", request("https://example.com:8443/data", proto.NetworkResourceTypeXHR), nil},
+		{"lookalike suffix", request("https://example.com.evil.example/", proto.NetworkResourceTypeDocument), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var names []string
+			for name := range i.extraHeaders(tt.event) {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("extraHeaders(%s) = %v, want %v", tt.event.Request.URL, names, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeHeaders(t *testing.T) {
+	var original proto.NetworkHeaders
+	if err := json.Unmarshal([]byte(`{"Accept": "text/html", "user-agent": "browser"}`), &original); err != nil {
+		t.Fatal(err)
+	}
+	merged := make(map[string]string)
+	for _, entry := range mergeHeaders(original, map[string]string{"User-Agent": "custom", "X-Api-Key": "secret"}) {
+		if _, dup := merged[entry.Name]; dup {
+			t.Fatalf("header %s sent twice", entry.Name)
+		}
+		merged[entry.Name] = entry.Value
+	}
+	want := map[string]string{"Accept": "text/html", "User-Agent": "custom", "X-Api-Key": "secret"}
+	if !reflect.DeepEqual(merged, want) {
+		t.Fatalf("mergeHeaders = %v, want %v", merged, want)
+	}
+}
+
+func TestValidateResourceTypes(t *testing.T) {
+	tests := []struct {
+		name  string
+		types []string
+		valid bool
+	}{
+		{"none", nil, true},
+		{"text crawl", []string{"image", "stylesheet", "font", "media"}, true},
+		{"any case", []string{"Image", "STYLESHEET"}, true},
+		{"main document", []string{"document"}, false},
+		{"unknown", []string{"images"}, false},
+		{"one bad entry", []string{"image", "video"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateResourceTypes(tt.types); (err == nil) != tt.valid {
+				t.Errorf("validateResourceTypes(%q) = %v, want valid %v", tt.types, err, tt.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package crawler
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/text/language"
+)
+
+// maxLanguageSample is the number of letters the text-based guess looks at
+const maxLanguageSample = 4000
+
+// scriptLanguages maps scripts used by essentially one language to it.
+// Kana is checked before Han so Japanese isn't taken for Chinese.
+var scriptLanguages = []struct {
+	script *unicode.RangeTable
+	lang   string
+}{
+	{unicode.Hiragana, "ja"},
+	{unicode.Katakana, "ja"},
+	{unicode.Hangul, "ko"},
+	{unicode.Han, "zh"},
+	{unicode.Thai, "th"},
+	{unicode.Greek, "el"},
+	{unicode.Hebrew, "he"},
+	{unicode.Arabic, "ar"},
+	{unicode.Devanagari, "hi"},
+	{unicode.Cyrillic, "ru"},
+}
+
+// stopWords are frequent words that tell Latin-script languages apart
+var stopWords = map[string][]string{
+	"en": {"the", "and", "of", "to", "is", "in", "that", "it", "for", "with", "was", "are"},
+	"es": {"el", "la", "de", "que", "y", "en", "los", "las", "es", "por", "una", "del"},
+	"fr": {"le", "la", "les", "de", "et", "est", "des", "une", "que", "pour", "dans", "du"},
+	"de": {"der", "die", "und", "das", "ist", "nicht", "ein", "zu", "mit", "den", "von", "sie"},
+	"pt": {"o", "de", "que", "e", "do", "da", "em", "não", "os", "uma", "para", "com"},
+	"it": {"il", "di", "che", "e", "la", "per", "non", "un", "sono", "della", "gli", "è"},
+	"nl": {"de", "het", "een", "en", "van", "is", "dat", "niet", "op", "te", "zijn", "voor"},
+}
+
+// DetectLanguage returns the BCP 47 code of a page's language, e.g. "en" or
+// "ja-JP", taken from its <html lang>, else from its Content-Language header
+// contentLanguage, else guessed from its text. It returns "" if the language
+// can't be told.
+func DetectLanguage(htmlStr, contentLanguage string) string {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(htmlStr))
+	if err != nil {
+		return ""
+	}
+	if lang, ok := doc.Find("html").First().Attr("lang"); ok {
+		if tag := normalizeLanguage(lang); tag != "" {
+			return tag
+		}
+	}
+	// The header may list several languages; the first is the main one
+	if first, _, _ := strings.Cut(contentLanguage, ","); first != "" {
+		if tag := normalizeLanguage(first); tag != "" {
+			return tag
+		}
+	}
+
+	doc.Find("script, style, noscript, template").Remove()
+	return guessLanguage(doc.Find("body").Text())
+}
+
+// normalizeLanguage returns the canonical form of a language tag, or "" if
+// it isn't one
+func normalizeLanguage(lang string) string {
+	lang = strings.ReplaceAll(strings.TrimSpace(lang), "_", "-")
+	if lang == "" {
+		return ""
+	}
+	tag, err := language.Parse(lang)
+	if err != nil || tag == language.Und {
+		return ""
+	}
+	return tag.String()
+}
+
+// guessLanguage guesses the language of text from its script or, for Latin
+// text, from its most frequent words
+func guessLanguage(text string) string {
+	counts := make(map[string]int)
+	letters, latin := 0, 0
+	for _, r := range text {
+		if letters >= maxLanguageSample {
+			break
+		}
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		if unicode.Is(unicode.Latin, r) {
+			latin++
+			continue
+		}
+		for _, s := range scriptLanguages {
+			if unicode.Is(s.script, r) {
+				counts[s.lang]++
+				break
+			}
+		}
+	}
+	if letters == 0 {
+		return ""
+	}
+
+	// Japanese mixes kana with plenty of Han
+	if counts["ja"] > 0 && counts["ja"]+counts["zh"] > letters/3 {
+		return "ja"
+	}
+	best, bestCount := "", 0
+	for lang, count := range counts {
+		if count > bestCount {
+			best, bestCount = lang, count
+		}
+	}
+	if bestCount > latin {
+		return best
+	}
+	return guessLatinLanguage(text)
+}
+
+// guessLatinLanguage picks the language whose stop words are most frequent in
+// text, or "" if none clearly stands out
+func guessLatinLanguage(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	if len(words) > maxLanguageSample/4 {
+		words = words[:maxLanguageSample/4]
+	}
+	frequency := make(map[string]int, len(words))
+	for _, word := range words {
+		frequency[word]++
+	}
+
+	best, bestScore, runnerUp := "", 0, 0
+	for lang, stops := range stopWords {
+		score := 0
+		for _, stop := range stops {
+			score += frequency[stop]
+		}
+		if score > bestScore {
+			best, bestScore, runnerUp = lang, score, bestScore
+		} else if score > runnerUp {
+			runnerUp = score
+		}
+	}
+	// Too little evidence, or too close a call between related languages
+	if bestScore < 3 || bestScore*4 < runnerUp*5 {
+		return ""
+	}
+	return best
+}
+
+// languageMatches reports whether lang is skip or one of its regional forms,
+// so "en" matches "en-GB"
+func languageMatches(lang, skip string) bool {
+	lang, skip = strings.ToLower(lang), strings.ToLower(normalizeLanguage(skip))
+	if lang == "" || skip == "" {
+		return false
+	}
+	return lang == skip || strings.HasPrefix(lang, skip+"-")
+}
@@ -0,0 +1,51 @@
+package crawler
+
+import "testing"
+
+func TestDetectLanguage(t *testing.T) {
+	const english = "The crawler fetches the page and converts it to Markdown. It is fast, and the output is clean for the people who read it."
+	const japanese = "このクローラーはページを取得して、マークダウンに変換します。出力はきれいで読みやすいです。"
+
+	tests := []struct {
+		name            string
+		html            string
+		contentLanguage string
+		want            string
+	}{
+		{"english text", "<html><body><p>" + english + "</p></body></html>", "", "en"},
+		{"japanese text", "<html><body><p>" + japanese + "</p></body></html>", "", "ja"},
+		{"html lang", `<html lang="ja_JP"><body><p>` + english + "</p></body></html>", "", "ja-JP"},
+		{"content language", "<html><body><p>" + japanese + "</p></body></html>", "en-GB, fr", "en-GB"},
+		{"invalid html lang", `<html lang="not a tag"><body><p>` + japanese + "</p></body></html>", "", "ja"},
+		{"scripts ignored", "<html><body><script>var the = 1; for (the of that) {}</script><p>" + japanese + "</p></body></html>", "", "ja"},
+		{"empty", "", "", ""},
+		{"no letters", "<html><body><p>123 456 !!!</p></body></html>", "", ""},
+		{"too short", "<html><body><p>Hello world</p></body></html>", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectLanguage(tt.html, tt.contentLanguage); got != tt.want {
+				t.Errorf("DetectLanguage = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLanguageMatches(t *testing.T) {
+	tests := []struct {
+		lang, skip string
+		want       bool
+	}{
+		{"en", "en", true},
+		{"en-GB", "en", true},
+		{"en", "en-GB", false},
+		{"eng", "en", false},
+		{"", "en", false},
+		{"en", "", false},
+	}
+	for _, tt := range tests {
+		if got := languageMatches(tt.lang, tt.skip); got != tt.want {
+			t.Errorf("languageMatches(%q, %q) = %v, want %v", tt.lang, tt.skip, got, tt.want)
+		}
+	}
+}
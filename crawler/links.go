@@ -0,0 +1,70 @@
+package crawler
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Link is an outbound link of a page
+type Link struct {
+	Href string `json:"href"`          // Absolute URL without its fragment
+	Text string `json:"text"`          // Anchor text with whitespace collapsed
+	Rel  string `json:"rel,omitempty"` // rel attribute, e.g. "nofollow"
+}
+
+// ExtractLinks returns the http(s) links of the anchors in htmlStr, resolved
+// against baseURL or the page's <base href>. Links such as javascript: and
+// mailto: and fragment-only links are skipped, fragments are dropped and each
+// URL is returned once, with the text of its first anchor.
+func ExtractLinks(htmlStr, baseURL string) ([]Link, error) {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse URL %s: %v", baseURL, err)
+	}
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(htmlStr))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML of %s: %v", baseURL, err)
+	}
+
+	// A <base href> changes what relative links resolve against
+	if href, ok := doc.Find("base[href]").First().Attr("href"); ok {
+		if ref, err := url.Parse(strings.TrimSpace(href)); err == nil {
+			base = base.ResolveReference(ref)
+		}
+	}
+
+	seen := make(map[string]bool)
+	var links []Link
+	doc.Find("a[href]").Each(func(_ int, s *goquery.Selection) {
+		href, _ := s.Attr("href")
+		href = strings.TrimSpace(href)
+		if href == "" || strings.HasPrefix(href, "#") {
+			return
+		}
+		ref, err := url.Parse(href)
+		if err != nil {
+			return
+		}
+		link := base.ResolveReference(ref)
+		if link.Scheme != "http" && link.Scheme != "https" {
+			return
+		}
+		link.Fragment = ""
+		link.RawFragment = ""
+		if seen[link.String()] {
+			return
+		}
+		seen[link.String()] = true
+
+		rel, _ := s.Attr("rel")
+		links = append(links, Link{
+			Href: link.String(),
+			Text: strings.Join(strings.Fields(s.Text()), " "),
+			Rel:  strings.TrimSpace(rel),
+		})
+	})
+	return links, nil
+}
@@ -0,0 +1,85 @@
+package crawler
+
+import (
+	"fmt"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+	"golang.org/x/text/language"
+)
+
+// Geolocation is a position reported to the page's geolocation API
+type Geolocation struct {
+	Latitude  float64 // Degrees, from -90 to 90
+	Longitude float64 // Degrees, from -180 to 180
+	Accuracy  float64 // Meters. Zero means 1.
+}
+
+// validate rejects coordinates off the globe
+func (g *Geolocation) validate() error {
+	if g == nil {
+		return nil
+	}
+	if g.Latitude < -90 || g.Latitude > 90 || g.Longitude < -180 || g.Longitude > 180 {
+		return fmt.Errorf("geolocation %v,%v is out of range", g.Latitude, g.Longitude)
+	}
+	if g.Accuracy < 0 {
+		return fmt.Errorf("geolocation accuracy must not be negative")
+	}
+	return nil
+}
+
+// acceptLanguage returns the Accept-Language header a browser set to
+// Locale would send, e.g. "de-DE,de;q=0.9", falling back to the emulated
+// device's
+func (opts CrawlOptions) acceptLanguage() string {
+	if opts.Locale == "" {
+		if opts.Device != nil {
+			return opts.Device.AcceptLanguage
+		}
+		return ""
+	}
+	tag := normalizeLanguage(opts.Locale)
+	base, _ := language.Make(tag).Base()
+	if base.String() == tag {
+		return tag
+	}
+	return tag + "," + base.String() + ";q=0.9"
+}
+
+// emulateLocale applies the locale, timezone and geolocation of opts to page
+func emulateLocale(page *rod.Page, opts CrawlOptions) error {
+	if opts.Locale != "" {
+		if err := (proto.EmulationSetLocaleOverride{Locale: opts.Locale}).Call(page); err != nil {
+			return fmt.Errorf("failed to set locale: %w", err)
+		}
+	}
+	if opts.TimezoneID != "" {
+		if err := (proto.EmulationSetTimezoneOverride{TimezoneID: opts.TimezoneID}).Call(page); err != nil {
+			return fmt.Errorf("failed to set timezone: %w", err)
+		}
+	}
+	if g := opts.Geolocation; g != nil {
+		// Without the permission the page's position requests are denied
+		err := proto.BrowserGrantPermissions{
+			Permissions:      []proto.BrowserPermissionType{proto.BrowserPermissionTypeGeolocation},
+			BrowserContextID: page.Browser().BrowserContextID,
+		}.Call(page)
+		if err != nil {
+			return fmt.Errorf("failed to grant geolocation permission: %w", err)
+		}
+		accuracy := g.Accuracy
+		if accuracy == 0 {
+			accuracy = 1
+		}
+		err = proto.EmulationSetGeolocationOverride{
+			Latitude:  &g.Latitude,
+			Longitude: &g.Longitude,
+			Accuracy:  &accuracy,
+		}.Call(page)
+		if err != nil {
+			return fmt.Errorf("failed to set geolocation: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package crawler
+
+import (
+	"context"
+	"html"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-rod/rod/lib/devices"
+)
+
+func TestAcceptLanguage(t *testing.T) {
+	tests := []struct {
+		name string
+		opts CrawlOptions
+		want string
+	}{
+		{"none", CrawlOptions{}, ""},
+		{"region", CrawlOptions{Locale: "de-DE"}, "de-DE,de;q=0.9"},
+		{"underscore", CrawlOptions{Locale: "pt_BR"}, "pt-BR,pt;q=0.9"},
+		{"language only", CrawlOptions{Locale: "fr"}, "fr"},
+		{"device", CrawlOptions{Device: &devices.IPhoneX}, "en"},
+		{"locale over device", CrawlOptions{Locale: "ja-JP", Device: &devices.IPhoneX}, "ja-JP,ja;q=0.9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.opts.acceptLanguage(); got != tt.want {
+				t.Errorf("acceptLanguage = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateLocaleAndGeolocation(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    CrawlOptions
+		wantErr bool
+	}{
+		{"none", CrawlOptions{}, false},
+		{"locale", CrawlOptions{Locale: "de-DE"}, false},
+		{"invalid locale", CrawlOptions{Locale: "not a locale"}, true},
+		{"geolocation", CrawlOptions{Geolocation: &Geolocation{Latitude: 52.52, Longitude: 13.405, Accuracy: 10}}, false},
+		{"poles and date line", CrawlOptions{Geolocation: &Geolocation{Latitude: -90, Longitude: 180}}, false},
+		{"latitude out of range", CrawlOptions{Geolocation: &Geolocation{Latitude: 91}}, true},
+		{"longitude out of range", CrawlOptions{Geolocation: &Geolocation{Longitude: -181}}, true},
+		{"negative accuracy", CrawlOptions{Geolocation: &Geolocation{Accuracy: -1}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.opts.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLocaleEmulation(t *testing.T) {
+	requireBrowser(t)
+
+	srv := serveHTML(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><body>
+<p>header ` + html.EscapeString(r.Header.Get("Accept-Language")) + `</p>
+<p id="locale"></p>
+<script>document.getElementById("locale").textContent = "language " + navigator.language + " timezone " + Intl.DateTimeFormat().resolvedOptions().timeZone</script>
+</body></html>`))
+	})
+
+	opts := localOptions()
+	opts.Locale = "de-DE"
+	opts.TimezoneID = "Europe/Berlin"
+	page, err := FetchPageWithOptions(context.Background(), srv.URL, "", opts)
+	if err != nil {
+		t.Fatalf("FetchPageWithOptions: %v", err)
+	}
+	for _, want := range []string{"header de-DE,de;q=0.9", "language de-DE timezone Europe/Berlin"} {
+		if !strings.Contains(page, want) {
+			t.Errorf("page does not report %q:\n%s", want, page)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package crawler
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	md "github.com/JohannesKaufmann/html-to-markdown"
+	"github.com/JohannesKaufmann/html-to-markdown/plugin"
+	"github.com/PuerkitoBio/goquery"
+)
+
+// MarkdownOptions controls the HTML to Markdown conversion. The zero value
+// converts to CommonMark with inline links, which crawls resolve against the
+// page's URL.
+type MarkdownOptions struct {
+	// GFM enables GitHub Flavored Markdown tables, task lists and
+	// strikethrough
+	GFM bool
+	// LinkStyle is "inlined" (default) or "referenced"
+	LinkStyle string
+	// LinkReferenceStyle is "full" (default), "collapsed" or "shortcut" and
+	// only applies to referenced links
+	LinkReferenceStyle string
+	// BaseURL, if set, resolves relative href and src attributes to
+	// absolute URLs, e.g. "https://example.com/docs/"
+	BaseURL string
+	// RelativeLinks leaves relative links in crawled pages as they are
+	// instead of resolving them against the page's URL. BaseURL still applies.
+	RelativeLinks bool
+}
+
+// validate checks the link styles and base URL
+func (o MarkdownOptions) validate() error {
+	switch o.LinkStyle {
+	case "", "inlined", "referenced":
+	default:
+		return fmt.Errorf("unknown Markdown link style %q", o.LinkStyle)
+	}
+	switch o.LinkReferenceStyle {
+	case "", "full", "collapsed", "shortcut":
+	default:
+		return fmt.Errorf("unknown Markdown link reference style %q", o.LinkReferenceStyle)
+	}
+	if o.BaseURL != "" {
+		base, err := url.Parse(o.BaseURL)
+		if err != nil || !base.IsAbs() {
+			return fmt.Errorf("Markdown base URL %q must be an absolute URL", o.BaseURL)
+		}
+	}
+	return nil
+}
+
+// forPage returns o with BaseURL defaulting to pageURL, unless RelativeLinks
+// is set
+func (o MarkdownOptions) forPage(pageURL string) MarkdownOptions {
+	if !o.RelativeLinks && o.BaseURL == "" {
+		o.BaseURL = pageURL
+	}
+	return o
+}
+
+// ConvertToMarkdownWithBase is like ConvertToMarkdown but resolves relative
+// href and src attributes against baseURL, so /about on https://site.com
+// becomes https://site.com/about
+func ConvertToMarkdownWithBase(htmlStr, baseURL string) (string, error) {
+	return ConvertToMarkdownWithOptions(htmlStr, MarkdownOptions{BaseURL: baseURL})
+}
+
+// ConvertToMarkdownWithOptions is like ConvertToMarkdown but applies opts
+func ConvertToMarkdownWithOptions(htmlStr string, opts MarkdownOptions) (string, error) {
+	if err := opts.validate(); err != nil {
+		return "", err
+	}
+
+	options := &md.Options{
+		LinkStyle:          opts.LinkStyle,
+		LinkReferenceStyle: opts.LinkReferenceStyle,
+	}
+	domain := ""
+	if opts.BaseURL != "" {
+		base, _ := url.Parse(opts.BaseURL)
+		domain = base.Host
+		options.GetAbsoluteURL = func(_ *goquery.Selection, rawURL, _ string) string {
+			return resolveMarkdownURL(base, rawURL)
+		}
+	}
+
+	converter := md.NewConverter(domain, true, options)
+	if opts.GFM {
+		converter.Use(plugin.GitHubFlavored())
+	}
+	markdown, err := converter.ConvertString(htmlStr)
+	if err != nil {
+		return "", fmt.Errorf("failed to convert HTML to Markdown: %v", err)
+	}
+	return markdown, nil
+}
+
+// resolveMarkdownURL resolves rawURL against base, leaving fragments, data
+// URIs and unparsable URLs as they are
+func resolveMarkdownURL(base *url.URL, rawURL string) string {
+	if strings.HasPrefix(rawURL, "#") {
+		return rawURL
+	}
+	ref, err := url.Parse(rawURL)
+	if err != nil || ref.Scheme == "data" {
+		return rawURL
+	}
+	return base.ResolveReference(ref).String()
+}
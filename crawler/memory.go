@@ -0,0 +1,69 @@
+package crawler
+
+import (
+	"context"
+
+	"pathik/storage"
+)
+
+// CrawlToMemory fetches and converts url like CrawlURLWithOptions, but
+// returns the outputs in the result's HTML, Markdown, Text, Screenshot, PDF
+// and MHTML fields instead of saving them anywhere. The options about stored
+// files, opts.Storage, OverwritePolicy, DedupStore, VisitedStore,
+// CaptureResources and HAR, don't apply; opts.Streamer, if set, still
+// receives the page.
+func CrawlToMemory(url string, opts CrawlOptions) (CrawlResult, error) {
+	return CrawlToMemoryCtx(context.Background(), url, opts)
+}
+
+// CrawlToMemoryCtx is like CrawlToMemory but stops once ctx is cancelled
+func CrawlToMemoryCtx(ctx context.Context, url string, opts CrawlOptions) (CrawlResult, error) {
+	result, _, err := crawlPage(ctx, url, "", "", opts.forMemory())
+	return result, err
+}
+
+// CrawlAllToMemory is the batch form of CrawlToMemory. It crawls urls
+// concurrently and returns their results keyed by URL, each carrying its own
+// error. The returned error joins those errors, so it is nil only if every
+// URL succeeded.
+func CrawlAllToMemory(urls []string, opts CrawlOptions) (map[string]CrawlResult, error) {
+	return CrawlAllToMemoryCtx(context.Background(), urls, opts)
+}
+
+// CrawlAllToMemoryCtx is like CrawlAllToMemory but stops once ctx is
+// cancelled. The results of URLs that never started wrap ctx.Err().
+func CrawlAllToMemoryCtx(ctx context.Context, urls []string, opts CrawlOptions) (map[string]CrawlResult, error) {
+	// Crawl every URL once even if it's listed twice
+	seen := make(map[string]bool, len(urls))
+	var unique []string
+	for _, url := range urls {
+		if !seen[url] {
+			seen[url] = true
+			unique = append(unique, url)
+		}
+	}
+
+	ctx, cancel := withBudget(ctx, opts)
+	defer cancel()
+	opts, closePool := withBrowserPool(ctx, opts.forMemory())
+	defer closePool()
+
+	results, _ := crawlBatch(ctx, unique, "", opts)
+	byURL := make(map[string]CrawlResult, len(results))
+	for _, result := range results {
+		byURL[result.URL] = result
+	}
+	return byURL, ResultErrors(results)
+}
+
+// forMemory returns a copy of opts for an in-memory crawl
+func (opts CrawlOptions) forMemory() CrawlOptions {
+	opts.inMemory = true
+	opts.Storage = nil
+	opts.OverwritePolicy = storage.Overwrite
+	opts.DedupStore = nil
+	opts.VisitedStore = nil
+	opts.CaptureResources = false
+	opts.HAR = false
+	return opts
+}
@@ -0,0 +1,118 @@
+package crawler
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/go-shiori/go-readability"
+)
+
+// PageMeta is the structured metadata of a page
+type PageMeta struct {
+	Title         string `json:"title,omitempty"`
+	Description   string `json:"description,omitempty"`
+	CanonicalURL  string `json:"canonical_url,omitempty"`
+	OGTitle       string `json:"og_title,omitempty"`
+	OGImage       string `json:"og_image,omitempty"`
+	Author        string `json:"author,omitempty"`
+	PublishedTime string `json:"published_time,omitempty"` // As the page states it, usually RFC 3339
+	Language      string `json:"language,omitempty"`
+}
+
+// ExtractMetadata reads a page's metadata from its <title>, <meta> tags and
+// <link rel=canonical>, filling gaps with what Readability infers, e.g. a
+// byline from the article body. URLs are resolved against urlStr.
+func ExtractMetadata(htmlStr, urlStr string) (PageMeta, error) {
+	pageURL, err := url.Parse(urlStr)
+	if err != nil {
+		return PageMeta{}, fmt.Errorf("failed to parse URL %s: %v", urlStr, err)
+	}
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(htmlStr))
+	if err != nil {
+		return PageMeta{}, fmt.Errorf("failed to parse HTML of %s: %v", urlStr, err)
+	}
+
+	meta := func(attr, key string) string {
+		content, _ := doc.Find(fmt.Sprintf("meta[%s=%q]", attr, key)).First().Attr("content")
+		return strings.TrimSpace(content)
+	}
+	canonical, _ := doc.Find(`link[rel="canonical"]`).First().Attr("href")
+	lang, _ := doc.Find("html").First().Attr("lang")
+
+	result := PageMeta{
+		Title:         strings.TrimSpace(doc.Find("title").First().Text()),
+		Description:   firstNonEmpty(meta("name", "description"), meta("property", "og:description")),
+		CanonicalURL:  resolveURL(pageURL, canonical),
+		OGTitle:       meta("property", "og:title"),
+		OGImage:       resolveURL(pageURL, meta("property", "og:image")),
+		Author:        firstNonEmpty(meta("name", "author"), meta("property", "article:author")),
+		PublishedTime: meta("property", "article:published_time"),
+		Language:      strings.TrimSpace(lang),
+	}
+
+	// Readability also looks at JSON-LD and the article body
+	article, err := readability.FromReader(strings.NewReader(htmlStr), pageURL)
+	if err == nil {
+		result.Title = firstNonEmpty(result.Title, article.Title)
+		result.Description = firstNonEmpty(result.Description, article.Excerpt)
+		result.OGImage = firstNonEmpty(result.OGImage, article.Image)
+		result.Author = firstNonEmpty(result.Author, article.Byline)
+		result.Language = firstNonEmpty(result.Language, article.Language)
+		if result.PublishedTime == "" && article.PublishedTime != nil {
+			result.PublishedTime = article.PublishedTime.Format(time.RFC3339)
+		}
+	}
+	return result, nil
+}
+
+// Frontmatter renders meta as a YAML frontmatter block for Markdown files.
+// Empty fields are left out.
+func (m PageMeta) Frontmatter() string {
+	var b strings.Builder
+	b.WriteString("---\n")
+	for _, field := range []struct{ key, value string }{
+		{"title", m.Title},
+		{"description", m.Description},
+		{"canonical_url", m.CanonicalURL},
+		{"og_title", m.OGTitle},
+		{"og_image", m.OGImage},
+		{"author", m.Author},
+		{"published_time", m.PublishedTime},
+		{"language", m.Language},
+	} {
+		if field.value != "" {
+			// Double-quoted JSON strings are valid YAML scalars
+			fmt.Fprintf(&b, "%s: %s\n", field.key, strconv.Quote(field.value))
+		}
+	}
+	b.WriteString("---\n\n")
+	return b.String()
+}
+
+// resolveURL resolves ref against base, returning "" for an empty or
+// invalid ref
+func resolveURL(base *url.URL, ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return ""
+	}
+	parsed, err := url.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	return base.ResolveReference(parsed).String()
+}
+
+// firstNonEmpty returns the first of values that isn't blank
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if strings.TrimSpace(value) != "" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
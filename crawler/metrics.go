@@ -0,0 +1,71 @@
+package crawler
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-rod/rod"
+)
+
+// PageMetrics are performance figures of a page load, taken from the
+// browser's Navigation and Paint Timing APIs. Times are measured from the
+// start of the navigation; zero means the event didn't happen before the
+// page was captured.
+type PageMetrics struct {
+	TimeToFirstByte      time.Duration // Until the first byte of the document arrived
+	DOMContentLoaded     time.Duration // Until the DOMContentLoaded event finished
+	Load                 time.Duration // Until the load event finished
+	FirstPaint           time.Duration // Until anything was painted
+	FirstContentfulPaint time.Duration // Until text or an image was painted
+	TransferSize         int64         // Bytes received for the document and its resources, headers included
+	Requests             int           // Number of resources loaded besides the document
+}
+
+// metricsJS reads the navigation and paint timings, in milliseconds, and
+// sums up transfer sizes. Cross-origin resources without Timing-Allow-Origin
+// report a transfer size of zero.
+const metricsJS = `() => {
+	const nav = performance.getEntriesByType('navigation')[0] || {}
+	const paint = name => (performance.getEntriesByName(name)[0] || {}).startTime || 0
+	const resources = performance.getEntriesByType('resource')
+	return {
+		ttfb: nav.responseStart || 0,
+		domContentLoaded: nav.domContentLoadedEventEnd || 0,
+		load: nav.loadEventEnd || 0,
+		firstPaint: paint('first-paint'),
+		firstContentfulPaint: paint('first-contentful-paint'),
+		transferSize: resources.reduce((sum, r) => sum + (r.transferSize || 0), nav.transferSize || 0),
+		requests: resources.length,
+	}
+}`
+
+// collectMetrics reads the performance metrics of the page loaded in page
+func collectMetrics(page *rod.Page) (*PageMetrics, error) {
+	res, err := page.Eval(metricsJS)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read performance metrics: %w", err)
+	}
+	var raw struct {
+		TTFB                 float64 `json:"ttfb"`
+		DOMContentLoaded     float64 `json:"domContentLoaded"`
+		Load                 float64 `json:"load"`
+		FirstPaint           float64 `json:"firstPaint"`
+		FirstContentfulPaint float64 `json:"firstContentfulPaint"`
+		TransferSize         float64 `json:"transferSize"`
+		Requests             int     `json:"requests"`
+	}
+	if err := res.Value.Unmarshal(&raw); err != nil {
+		return nil, fmt.Errorf("failed to decode performance metrics: %w", err)
+	}
+
+	ms := func(v float64) time.Duration { return time.Duration(v * float64(time.Millisecond)) }
+	return &PageMetrics{
+		TimeToFirstByte:      ms(raw.TTFB),
+		DOMContentLoaded:     ms(raw.DOMContentLoaded),
+		Load:                 ms(raw.Load),
+		FirstPaint:           ms(raw.FirstPaint),
+		FirstContentfulPaint: ms(raw.FirstContentfulPaint),
+		TransferSize:         int64(raw.TransferSize),
+		Requests:             raw.Requests,
+	}, nil
+}
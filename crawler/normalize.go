@@ -0,0 +1,104 @@
+package crawler
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// defaultPorts are the ports NormalizeURL drops for each scheme
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// NormalizeOptions controls the optional rules of NormalizeURLWithOptions
+type NormalizeOptions struct {
+	// SortQuery orders query parameters by name, for sites that ignore
+	// their order
+	SortQuery bool
+	// StripTrailingSlash removes a trailing "/" from paths other than the
+	// root, for sites that serve /docs and /docs/ alike
+	StripTrailingSlash bool
+}
+
+// NormalizeURL returns the canonical form of an absolute URL, so that
+// variants of one address such as "http://A.com", "http://a.com:80/" and
+// "http://a.com/#top" all become "http://a.com/". It lowercases the scheme
+// and host, drops default ports, fragments and empty queries, and gives an
+// empty path the root "/".
+func NormalizeURL(raw string) (string, error) {
+	return NormalizeURLWithOptions(raw, NormalizeOptions{})
+}
+
+// NormalizeURLWithOptions is like NormalizeURL but also applies opts
+func NormalizeURLWithOptions(raw string, opts NormalizeOptions) (string, error) {
+	parsed, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", fmt.Errorf("invalid URL format: %v", err)
+	}
+	if parsed.Scheme == "" || parsed.Host == "" {
+		return "", fmt.Errorf("URL %q is not absolute", raw)
+	}
+
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+	host := strings.ToLower(parsed.Hostname())
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]" // IPv6
+	}
+	if port := parsed.Port(); port != "" && port != defaultPorts[parsed.Scheme] {
+		host += ":" + port
+	}
+	parsed.Host = host
+
+	parsed.Fragment = ""
+	parsed.RawFragment = ""
+	parsed.ForceQuery = false
+	if parsed.Path == "" {
+		parsed.Path = "/"
+		parsed.RawPath = ""
+	}
+	if opts.StripTrailingSlash && parsed.Path != "/" && strings.HasSuffix(parsed.Path, "/") {
+		parsed.Path = strings.TrimRight(parsed.Path, "/")
+		parsed.RawPath = strings.TrimRight(parsed.RawPath, "/")
+		if parsed.Path == "" {
+			parsed.Path = "/"
+		}
+	}
+	if opts.SortQuery && parsed.RawQuery != "" {
+		// Sort the raw parameters so their encoding is kept as it is
+		params := strings.Split(parsed.RawQuery, "&")
+		sort.SliceStable(params, func(i, j int) bool {
+			nameI, _, _ := strings.Cut(params[i], "=")
+			nameJ, _, _ := strings.Cut(params[j], "=")
+			return nameI < nameJ
+		})
+		parsed.RawQuery = strings.Join(params, "&")
+	}
+	return parsed.String(), nil
+}
+
+// normalizeBatch normalizes urls with opts.Normalize and drops duplicates.
+// It returns the URLs to crawl and, for each input URL, the index of the
+// URL crawled for it. URLs that don't normalize are kept as they are for
+// the crawl to report.
+func normalizeBatch(urls []string, opts CrawlOptions) ([]string, []int) {
+	var unique []string
+	index := make(map[string]int, len(urls))
+	positions := make([]int, len(urls))
+	for i, raw := range urls {
+		normalized, err := NormalizeURLWithOptions(raw, opts.Normalize)
+		if err != nil {
+			normalized = raw
+		}
+		pos, seen := index[normalized]
+		if !seen {
+			pos = len(unique)
+			index[normalized] = pos
+			unique = append(unique, normalized)
+		}
+		positions[i] = pos
+	}
+	return unique, positions
+}
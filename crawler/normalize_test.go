@@ -0,0 +1,75 @@
+package crawler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeURLWithOptions(t *testing.T) {
+	sorted := NormalizeOptions{SortQuery: true}
+	stripped := NormalizeOptions{StripTrailingSlash: true}
+	tests := []struct {
+		name string
+		raw  string
+		opts NormalizeOptions
+		want string
+	}{
+		{"lowercases scheme and host", "HTTP://Example.COM/Path", NormalizeOptions{}, "http://example.com/Path"},
+		{"drops http default port", "http://example.com:80/", NormalizeOptions{}, "http://example.com/"},
+		{"drops https default port", "https://example.com:443/a", NormalizeOptions{}, "https://example.com/a"},
+		{"keeps other ports", "http://example.com:8080/", NormalizeOptions{}, "http://example.com:8080/"},
+		{"keeps https port on http", "http://example.com:443/", NormalizeOptions{}, "http://example.com:443/"},
+		{"adds root path", "http://example.com", NormalizeOptions{}, "http://example.com/"},
+		{"drops fragment", "http://example.com/#top", NormalizeOptions{}, "http://example.com/"},
+		{"drops empty query", "http://example.com/?", NormalizeOptions{}, "http://example.com/"},
+		{"trims spaces", "  http://example.com/a  ", NormalizeOptions{}, "http://example.com/a"},
+		{"IPv6 host", "http://[FE80::1]:80/", NormalizeOptions{}, "http://[fe80::1]/"},
+		{"IPv6 host with port", "http://[::1]:8080/", NormalizeOptions{}, "http://[::1]:8080/"},
+		{"keeps query order by default", "http://example.com/?b=2&a=1", NormalizeOptions{}, "http://example.com/?b=2&a=1"},
+		{"sorts query", "http://example.com/?b=2&a=1&c", sorted, "http://example.com/?a=1&b=2&c"},
+		{"sorts stably", "http://example.com/?a=2&a=1", sorted, "http://example.com/?a=2&a=1"},
+		{"keeps query encoding", "http://example.com/?q=a%20b&p=%2F", sorted, "http://example.com/?p=%2F&q=a%20b"},
+		{"keeps trailing slash by default", "http://example.com/docs/", NormalizeOptions{}, "http://example.com/docs/"},
+		{"strips trailing slash", "http://example.com/docs/", stripped, "http://example.com/docs"},
+		{"strips repeated slashes", "http://example.com/docs//", stripped, "http://example.com/docs"},
+		{"keeps root slash", "http://example.com/", stripped, "http://example.com/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeURLWithOptions(tt.raw, tt.opts)
+			if err != nil {
+				t.Fatalf("NormalizeURLWithOptions(%q): %v", tt.raw, err)
+			}
+			if got != tt.want {
+				t.Errorf("NormalizeURLWithOptions(%q) = %q, want %q", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeURLRejectsRelative(t *testing.T) {
+	for _, raw := range []string{"/path", "example.com/path", "", "http://[::1"} {
+		if got, err := NormalizeURL(raw); err == nil {
+			t.Errorf("NormalizeURL(%q) = %q, want an error", raw, got)
+		}
+	}
+}
+
+func TestNormalizeBatch(t *testing.T) {
+	urls := []string{
+		"http://Example.com",
+		"http://example.com:80/#top",
+		"not a url",
+		"http://example.com/other",
+		"http://example.com/",
+	}
+	unique, positions := normalizeBatch(urls, CrawlOptions{})
+
+	wantUnique := []string{"http://example.com/", "not a url", "http://example.com/other"}
+	if !reflect.DeepEqual(unique, wantUnique) {
+		t.Errorf("unique = %q, want %q", unique, wantUnique)
+	}
+	if want := []int{0, 0, 1, 2, 0}; !reflect.DeepEqual(positions, want) {
+		t.Errorf("positions = %v, want %v", positions, want)
+	}
+}
@@ -0,0 +1,484 @@
+package crawler
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"pathik/storage"
+	"strings"
+	"time"
+
+	"github.com/go-rod/rod/lib/devices"
+	"golang.org/x/time/rate"
+)
+
+// Default option values
+const (
+	defaultRateLimit = rate.Limit(1) // 1 request per second per host
+	defaultBurst     = 3             // Burst of 3 requests per host
+
+	defaultSelectorTimeout = 10 * time.Second // Wait for WaitForSelector elements
+	defaultMaxRedirects    = 10               // HTTP redirects followed per page
+)
+
+// CrawlOptions configures a crawl. The zero value uses the package defaults.
+type CrawlOptions struct {
+	// RateLimit is the number of requests per second allowed against a single
+	// host. Zero means the default of 1 req/sec; use rate.Inf to disable.
+	RateLimit rate.Limit
+	// Burst is the maximum burst size of the per-host limiter. Zero means 3.
+	Burst int
+	// RateLimiter, if set, replaces the package-wide per-host registry. Its
+	// own rates apply and RateLimit/Burst are ignored.
+	RateLimiter *HostRateLimiter
+	// IgnoreRobots skips robots.txt checks, for crawling sites you own
+	IgnoreRobots bool
+	// AllowPrivateNetworks permits crawling localhost and private, loopback
+	// and link-local addresses, for trusted internal tools. Off by default
+	// to protect against SSRF.
+	AllowPrivateNetworks bool
+	// AllowedHosts permits these host names, e.g. "wiki.internal", even if
+	// they resolve to private addresses
+	AllowedHosts []string
+	// RobotsChecker, if set, replaces the package-wide robots.txt cache
+	RobotsChecker *RobotsChecker
+
+	// Storage, if set, receives every output file instead of the output
+	// directory, e.g. an S3 bucket. Saved paths in results are then the keys.
+	Storage storage.StorageBackend
+	// Compress gzips the saved HTML, Markdown and JSON, e.g. page.html.gz
+	Compress bool
+	// FilenameTemplate names saved files with a text/template, e.g.
+	// "{{.Domain}}_{{.Timestamp}}.{{.Ext}}". See storage.FilenameFields.
+	FilenameTemplate string
+	// OverwritePolicy decides what happens to files from an earlier crawl
+	// saved under the same name. With storage.Skip, a URL whose requested
+	// outputs, see ContentTypes, all exist already isn't fetched at all.
+	OverwritePolicy storage.OverwritePolicy
+	// Upload sets server-side encryption, Cache-Control and user metadata
+	// on the objects Storage saves to a bucket. Every object also records
+	// its page URL and crawl time; see storage.MetadataOriginalURL.
+	Upload storage.UploadOptions
+	// Streamer, if set, also receives the HTML and Markdown of every page,
+	// as far as ContentTypes asks for them, e.g. a storage.KafkaWriter.
+	// With Metadata set, a storage.MetadataStreamer such as a
+	// storage.JSONLSink receives the page metadata too.
+	Streamer storage.Streamer
+	// SessionID is sent with every page given to Streamer
+	SessionID string
+	// DedupStore, if set, remembers a hash of every page's HTML along with
+	// its ETag and Last-Modified headers. Pages that hash the same on a
+	// later crawl aren't saved or streamed again. Pages whose headers are
+	// unchanged, or that the server answers with 304 Not Modified to a
+	// conditional request, aren't even fetched, so CrawlSite can't follow
+	// their links. See CrawlResult.Changed.
+	DedupStore storage.DedupStore
+	// OnProgress, if set, is called as each URL of a batch crawl such as
+	// CrawlURLsWithOptions finishes, failed or not, with the number of URLs
+	// done so far out of the batch's total. CrawlSite reports each depth as
+	// a batch of its own. Calls never overlap, so the callback needs no
+	// locking, but the crawl waits for it: a slow callback slows the whole
+	// batch down, so hand long work such as network pushes off to another
+	// goroutine.
+	OnProgress func(done, total int, current CrawlResult)
+	// VisitedStore, if set, records every URL crawled without error, and
+	// URLs it already has are skipped, so a crawl interrupted part way can
+	// be resumed by running it again with the same store, e.g. a
+	// storage.FileVisitedStore. CrawlSite doesn't follow the links of
+	// skipped pages.
+	VisitedStore storage.VisitedStore
+	// JSONOutput writes a line of JSON per crawled URL, see CrawlSummary
+	JSONOutput bool
+	// OutputWriter receives the JSON summaries. Nil means stdout.
+	OutputWriter io.Writer
+	// Logger receives diagnostic output such as fetch progress, retries and
+	// saved files. Nil means slog.Default(), which writes to stderr through
+	// the standard log package.
+	Logger *slog.Logger
+	// OutputDir is where entry points without an explicit directory argument,
+	// such as CrawlSite, write their files
+	OutputDir string
+	// SameHostOnly restricts CrawlSite to the seed's exact host instead of
+	// its registered domain
+	SameHostOnly bool
+	// Normalize enables the optional rules of the URL normalization batch
+	// crawls such as CrawlURLs, and CrawlSite's frontier, apply before
+	// dropping duplicate URLs
+	Normalize NormalizeOptions
+	// URLFilter, if set, must return true for a discovered link to be crawled
+	URLFilter func(string) bool
+	// MaxPages caps the number of pages CrawlSite crawls, the seed included.
+	// Links found once it is reached aren't followed; see
+	// SiteResult.Truncated. Zero means no cap.
+	MaxPages int
+
+	// Since makes CrawlSitemap skip entries whose <lastmod> is older
+	Since time.Time
+	// MaxURLs caps the number of URLs CrawlSitemap enumerates. Zero means no cap.
+	MaxURLs int
+
+	// Selector, if set, limits the Markdown output to the elements matching
+	// this CSS selector, bypassing Readability
+	Selector string
+	// Selectors maps names to CSS selectors whose matches are saved as a JSON
+	// map of name to matches alongside the other outputs
+	Selectors map[string]string
+	// ExtractSchema maps field names to CSS selectors to scrape a record
+	// into CrawlResult.Fields: the text of the first match, or of every
+	// match as a list for names ending in "[]", e.g. "titles[]"
+	ExtractSchema map[string]string
+	// SelectorType is the language of Selector, Selectors and
+	// ExtractSchema: CSSSelector (default) or XPathSelector. The
+	// WaitForSelector options always take CSS.
+	SelectorType SelectorType
+	// SelectText extracts the text of matched elements instead of their HTML
+	SelectText bool
+	// Readability tunes the main content extraction used without Selector
+	Readability ReadabilityOptions
+	// RawHTMLOnly converts the whole page to Markdown instead of
+	// Readability's main content, for sites the extractor mangles
+	RawHTMLOnly bool
+	// Markdown controls the HTML to Markdown conversion, e.g. GFM tables
+	Markdown MarkdownOptions
+	// ContentTypes picks the outputs saved for each page among
+	// storage.HTMLContent, storage.MarkdownContent and storage.TextContent,
+	// the plain text of the main content. Empty means HTML and Markdown.
+	ContentTypes []storage.ContentType
+
+	// Metadata extracts the page's title, description, OpenGraph tags and
+	// so on into CrawlResult.Metadata
+	Metadata bool
+	// Frontmatter prepends the metadata to the Markdown file as YAML
+	// frontmatter. It implies Metadata.
+	Frontmatter bool
+	// Links collects the page's outbound links into CrawlResult.Links
+	Links bool
+	// SkipLanguages drops pages in these languages, e.g. "ja", before they
+	// are saved or streamed. A language also matches its regional forms
+	// such as "ja-JP". See CrawlResult.Language.
+	SkipLanguages []string
+
+	// WaitForSelector delays capturing the page until an element matching
+	// this CSS selector exists, for SPAs that render after an XHR
+	WaitForSelector string
+	// WaitForSelectorHidden delays capturing the page until no element
+	// matching this CSS selector is visible, e.g. a loading spinner
+	WaitForSelectorHidden string
+	// SelectorTimeout bounds the waits above. Zero means 10s.
+	SelectorTimeout time.Duration
+	// WaitStrategy decides when the page is ready to be captured. The zero
+	// value is WaitContentLength.
+	WaitStrategy WaitStrategy
+	// PreActions run in order once the page has loaded, before it is
+	// captured, e.g. to log in through a form: Fill the username and
+	// password, Click submit, then WaitFor the dashboard. Each gets
+	// SelectorTimeout to find its element; a failure aborts the fetch with
+	// an ActionError.
+	PreActions []Action
+	// AutoScroll scrolls infinite-scroll pages to load all their content
+	// before they are captured, after PreActions
+	AutoScroll AutoScrollOptions
+	// EvalJS, if set, is a JavaScript function run in the page once it is
+	// ready to be captured, whose result, awaited if it is a Promise, is
+	// kept as JSON in CrawlResult.EvalResult, e.g. to read a SPA's data
+	// store with "() => window.__INITIAL_STATE__". It gets SelectorTimeout
+	// to finish.
+	//
+	// The script runs with the page's own privileges: it can read the
+	// page's cookies and storage, send requests as the page and change
+	// what is captured after it. Only set it from trusted configuration,
+	// never from input such as a request to a service built on pathik.
+	// Its result comes from the page, which may have replaced the globals
+	// it reads, so treat it as untrusted data.
+	EvalJS string
+
+	// MaxConcurrent is the number of URLs a batch crawl such as CrawlURLs
+	// fetches at once, e.g. more for a robust CDN and 1 for a fragile site.
+	// Zero means 5. RateLimit still applies per host.
+	MaxConcurrent int
+	// BrowserPool, if set, supplies the pages for every fetch without a
+	// proxy instead of launching a browser per URL. Batch entry points such
+	// as CrawlURLs create one automatically when it is nil.
+	BrowserPool *BrowserPool
+	// MaxBrowsers is the number of browsers in an automatically created
+	// pool. Zero means one.
+	MaxBrowsers int
+	// ProxyPool, if set, supplies the proxy of every fetch without an
+	// explicit one and fails over to another proxy when one stops working.
+	// Batch entry points such as CrawlURLs create one from LoadProxies when
+	// it is nil.
+	ProxyPool *ProxyPool
+
+	// BlockResourceTypes aborts requests for these resource types, e.g.
+	// "image", "stylesheet", "font" or "media", to speed up text crawls
+	BlockResourceTypes []string
+
+	// Screenshot saves a full-page screenshot next to the HTML and Markdown
+	Screenshot bool
+	// ScreenshotFormat is "png" (default) or "jpeg"
+	ScreenshotFormat string
+	// ScreenshotQuality is the JPEG quality from 0 to 100
+	ScreenshotQuality int
+
+	// PDF renders the loaded page to a PDF saved next to the other outputs
+	PDF bool
+	// PDFOptions controls paper size, orientation and background printing
+	PDFOptions PDFOptions
+	// MHTML archives the loaded page with its stylesheets, images and
+	// frames as a single .mhtml file that browsers open offline
+	MHTML bool
+
+	// CollectMetrics measures the page load into CrawlResult.Metrics, e.g.
+	// to monitor a site's performance across repeated crawls
+	CollectMetrics bool
+	// HAR saves the page's network activity as a HAR file next to the other
+	// outputs: every request and response with headers, status, timings
+	// and sizes, for performance debugging in browser dev tools
+	HAR bool
+	// WARC, if set, archives the response each page was fetched with, and
+	// the request for it, in the WARC files it writes
+	WARC *WARCWriter
+	// CaptureResources saves the stylesheets, scripts, images and other
+	// resources the page loads into a directory next to its HTML, named
+	// like the HTML file with "_files" in place of the extension. The saved
+	// HTML, and the url() and @import references of saved stylesheets,
+	// refer to the copies, so the page renders offline. Resources beyond
+	// 100 MB per page, or that can't be saved, keep referring to the
+	// original.
+	CaptureResources bool
+
+	// Cookies are set on the page before navigation, e.g. session cookies
+	// for authenticated crawls. Each cookie's domain must match the URL.
+	Cookies []Cookie
+	// BasicAuth answers HTTP Basic Auth challenges from the crawled URL's
+	// exact host. Other hosts, e.g. after a redirect, never receive them.
+	BasicAuth *BasicAuth
+	// Headers are added to every request for the crawled URL's host,
+	// including the main document. Requests to other hosts, such as third
+	// party assets, don't receive them so tokens can't leak.
+	Headers map[string]string
+
+	// Device emulates a device's screen, touch support and user agent, e.g.
+	// &devices.IPhoneX from go-rod's lib/devices, or a custom screen from
+	// Viewport.Device. Nil means a desktop screen. UserAgent and UserAgents
+	// take precedence over the device's user agent.
+	Device *devices.Device
+	// Viewport sets the size of the browser window, which screenshots and
+	// sites that lazy-load by viewport depend on. Zero dimensions keep the
+	// device's, or 1920x1080 without Device.
+	Viewport Viewport
+
+	// Locale, e.g. "de-DE", is presented to sites through navigator.language,
+	// Intl formatting and the Accept-Language header, for region-aware sites.
+	// Empty keeps the browser's.
+	Locale string
+	// TimezoneID is an IANA time zone such as "Europe/Berlin" the page's
+	// clock runs in. Empty keeps the browser's.
+	TimezoneID string
+	// Geolocation, if set, is the position the geolocation API reports,
+	// which pages are allowed to request
+	Geolocation *Geolocation
+
+	// UserAgent pins the User-Agent sent with every request
+	UserAgent string
+	// UserAgents replaces the default rotation pool when UserAgent is empty
+	UserAgents []string
+
+	// NavigationTimeout bounds navigation and the initial page load of each
+	// attempt. Zero means no timeout.
+	NavigationTimeout time.Duration
+	// MaxContentBytes is the size fetched HTML, and the text outputs saved
+	// from it, are cut to; see CrawlResult.Truncated. Zero means
+	// storage.DefaultMaxContentBytes. storage.NoContentLimit, or any negative
+	// value, means no limit, for trusted sites only.
+	MaxContentBytes int
+	// MaxRedirects is the number of HTTP redirects followed per page, see
+	// CrawlResult.RedirectChain. A page redirecting more fails with
+	// ErrTooManyRedirects. Zero means 10. Every redirect target, like any
+	// other URL the page navigates to, is checked like the crawled URL
+	// before the browser connects to it, so it can't lead to a private
+	// address; see ErrNavigationRejected.
+	MaxRedirects int
+	// StabilityTimeout bounds the wait for dynamic content to settle, either
+	// the DOM or, with WaitNetworkIdle, the network. Zero means 3s.
+	StabilityTimeout time.Duration
+	// RetryDelay is the pause between failed attempts. Zero means 2s.
+	RetryDelay time.Duration
+	// RetryBackoff, if set, grows the pause between attempts exponentially
+	// instead of keeping it at RetryDelay. A Retry-After header on a 429 or
+	// 503 response takes precedence when it asks for a longer wait.
+	RetryBackoff *RetryBackoff
+	// MaxRetries is the total number of attempts per URL. Zero means 3.
+	MaxRetries int
+	// TotalTimeout caps the wall-clock time of a whole batch crawl such as
+	// CrawlURLsWithOptions, CrawlSite or CrawlSitemap. Once it passes no new
+	// URLs are started and in-flight ones are aborted; their results wrap
+	// ErrBudgetExceeded while completed ones are kept. Zero means no cap.
+	TotalTimeout time.Duration
+
+	// inMemory keeps the outputs in CrawlResult instead of saving them
+	inMemory bool
+}
+
+// withDefaults returns a copy of opts with zero values replaced by defaults
+func (opts CrawlOptions) withDefaults() CrawlOptions {
+	if opts.RateLimit == 0 {
+		opts.RateLimit = defaultRateLimit
+	}
+	if opts.Burst <= 0 {
+		opts.Burst = defaultBurst
+	}
+	if opts.StabilityTimeout == 0 {
+		opts.StabilityTimeout = stabilityCheckTimeout
+	}
+	if opts.RetryDelay == 0 {
+		opts.RetryDelay = retryDelay
+	}
+	if opts.MaxRetries == 0 {
+		opts.MaxRetries = maxRetries
+	}
+	if opts.SelectorTimeout == 0 {
+		opts.SelectorTimeout = defaultSelectorTimeout
+	}
+	if opts.MaxRedirects == 0 {
+		opts.MaxRedirects = defaultMaxRedirects
+	}
+	if opts.MaxContentBytes == 0 {
+		opts.MaxContentBytes = storage.DefaultMaxContentBytes
+	}
+	return opts
+}
+
+// concurrency returns the number of URLs batch crawls fetch at once
+func (opts CrawlOptions) concurrency() int {
+	if opts.MaxConcurrent > 0 {
+		return opts.MaxConcurrent
+	}
+	return maxConcurrent
+}
+
+// allowsHost reports whether host is in AllowedHosts
+func (opts CrawlOptions) allowsHost(host string) bool {
+	if host == "" {
+		return false
+	}
+	for _, allowed := range opts.AllowedHosts {
+		if strings.EqualFold(strings.TrimSuffix(allowed, "."), strings.TrimSuffix(host, ".")) {
+			return true
+		}
+	}
+	return false
+}
+
+// wants reports whether contentType is among the outputs to save
+func (opts CrawlOptions) wants(contentType storage.ContentType) bool {
+	if len(opts.ContentTypes) == 0 {
+		return contentType == storage.HTMLContent || contentType == storage.MarkdownContent
+	}
+	for _, t := range opts.ContentTypes {
+		if t == contentType {
+			return true
+		}
+	}
+	return false
+}
+
+// logger returns the logger diagnostics go to
+func (opts CrawlOptions) logger() *slog.Logger {
+	if opts.Logger != nil {
+		return opts.Logger
+	}
+	return slog.Default()
+}
+
+// validate rejects invalid options before any browser is launched
+func (opts CrawlOptions) validate() error {
+	if err := validateSelectors(opts); err != nil {
+		return err
+	}
+	if err := validateResourceTypes(opts.BlockResourceTypes); err != nil {
+		return err
+	}
+	if err := validateActions(opts.PreActions); err != nil {
+		return err
+	}
+	if opts.EvalJS != "" && strings.TrimSpace(opts.EvalJS) == "" {
+		return fmt.Errorf("EvalJS is blank")
+	}
+	if err := validateDevice(opts.Device); err != nil {
+		return err
+	}
+	if opts.Viewport.Width < 0 || opts.Viewport.Height < 0 {
+		return fmt.Errorf("viewport dimensions must not be negative")
+	}
+	if opts.Locale != "" && normalizeLanguage(opts.Locale) == "" {
+		return fmt.Errorf("invalid locale %q", opts.Locale)
+	}
+	if err := opts.Geolocation.validate(); err != nil {
+		return err
+	}
+	switch strings.ToLower(opts.ScreenshotFormat) {
+	case "", "png", "jpeg", "jpg":
+	default:
+		return fmt.Errorf("unsupported screenshot format %q", opts.ScreenshotFormat)
+	}
+	if opts.ScreenshotQuality < 0 || opts.ScreenshotQuality > 100 {
+		return fmt.Errorf("screenshot quality must be between 0 and 100")
+	}
+	for _, t := range opts.ContentTypes {
+		switch t {
+		case storage.HTMLContent, storage.MarkdownContent, storage.TextContent:
+		default:
+			return fmt.Errorf("unknown content type %q", t)
+		}
+	}
+	for _, lang := range opts.SkipLanguages {
+		if normalizeLanguage(lang) == "" {
+			return fmt.Errorf("invalid language %q", lang)
+		}
+	}
+	if err := opts.Markdown.validate(); err != nil {
+		return err
+	}
+	if err := opts.Readability.validate(); err != nil {
+		return err
+	}
+	if err := opts.PDFOptions.validate(); err != nil {
+		return err
+	}
+	if err := opts.AutoScroll.validate(); err != nil {
+		return err
+	}
+	if opts.NavigationTimeout < 0 || opts.StabilityTimeout < 0 || opts.RetryDelay < 0 ||
+		opts.SelectorTimeout < 0 || opts.TotalTimeout < 0 {
+		return fmt.Errorf("timeouts and delays must not be negative")
+	}
+	if opts.MaxRetries < 0 {
+		return fmt.Errorf("max retries must not be negative")
+	}
+	if opts.MaxRedirects < 0 {
+		return fmt.Errorf("max redirects must not be negative")
+	}
+	if opts.MaxConcurrent < 0 {
+		return fmt.Errorf("max concurrent must not be negative")
+	}
+	if opts.MaxPages < 0 {
+		return fmt.Errorf("max pages must not be negative")
+	}
+	if err := opts.RetryBackoff.validate(); err != nil {
+		return err
+	}
+	if err := opts.WaitStrategy.validate(opts); err != nil {
+		return err
+	}
+	if err := storage.ValidateFilenameTemplate(opts.FilenameTemplate); err != nil {
+		return err
+	}
+	if err := opts.OverwritePolicy.Validate(); err != nil {
+		return err
+	}
+	if err := opts.Upload.Validate(); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package crawler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWithDefaultsTimeouts(t *testing.T) {
+	opts := CrawlOptions{}.withDefaults()
+	if opts.StabilityTimeout != 3*time.Second || opts.RetryDelay != 2*time.Second {
+		t.Errorf("default stability timeout %v, retry delay %v; want 3s and 2s", opts.StabilityTimeout, opts.RetryDelay)
+	}
+	// No navigation timeout unless asked for, as before it was configurable
+	if opts.NavigationTimeout != 0 {
+		t.Errorf("default navigation timeout %v, want none", opts.NavigationTimeout)
+	}
+
+	opts = CrawlOptions{NavigationTimeout: time.Second, StabilityTimeout: 500 * time.Millisecond, RetryDelay: time.Millisecond}.withDefaults()
+	if opts.NavigationTimeout != time.Second || opts.StabilityTimeout != 500*time.Millisecond || opts.RetryDelay != time.Millisecond {
+		t.Errorf("withDefaults changed configured timeouts: %v, %v, %v", opts.NavigationTimeout, opts.StabilityTimeout, opts.RetryDelay)
+	}
+}
+
+func TestValidateTimeouts(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    CrawlOptions
+		wantErr bool
+	}{
+		{"zero", CrawlOptions{}, false},
+		{"positive", CrawlOptions{NavigationTimeout: time.Second, StabilityTimeout: time.Second, RetryDelay: time.Second}, false},
+		{"negative navigation timeout", CrawlOptions{NavigationTimeout: -time.Second}, true},
+		{"negative stability timeout", CrawlOptions{StabilityTimeout: -time.Second}, true},
+		{"negative retry delay", CrawlOptions{RetryDelay: -time.Second}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.opts.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
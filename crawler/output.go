@@ -0,0 +1,97 @@
+package crawler
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	"pathik/storage"
+)
+
+// Statuses reported in a CrawlSummary
+const (
+	StatusOK        = "ok"
+	StatusSkipped   = "skipped"
+	StatusUnchanged = "unchanged"
+	StatusError     = "error"
+)
+
+// CrawlSummary is the machine-readable form of a CrawlResult, written as a
+// line of JSON per URL when CrawlOptions.JSONOutput is set
+type CrawlSummary struct {
+	URL          string `json:"url"`
+	HTMLPath     string `json:"html_path"`
+	MarkdownPath string `json:"md_path"`
+	TextPath     string `json:"text_path,omitempty"`
+	Status       string `json:"status"` // StatusOK, StatusSkipped, StatusUnchanged or StatusError
+	Bytes        int    `json:"bytes"`  // Length of the fetched HTML
+	DurationMS   int64  `json:"duration_ms"`
+	Truncated    bool   `json:"truncated,omitempty"` // Whether content was cut to CrawlOptions.MaxContentBytes
+	Error        string `json:"error,omitempty"`
+}
+
+// Summary returns the machine-readable form of r
+func (r CrawlResult) Summary() CrawlSummary {
+	summary := CrawlSummary{
+		URL:          r.URL,
+		HTMLPath:     r.HTMLPath,
+		MarkdownPath: r.MarkdownPath,
+		TextPath:     r.TextPath,
+		Status:       StatusOK,
+		Bytes:        r.ContentLength,
+		DurationMS:   r.FetchDuration.Milliseconds(),
+		Truncated:    r.Truncated,
+	}
+	if r.Skipped {
+		summary.Status = StatusSkipped
+	} else if !r.Changed {
+		summary.Status = StatusUnchanged
+	}
+	if r.Error != nil {
+		summary.Status = StatusError
+		summary.Error = r.Error.Error()
+	}
+	return summary
+}
+
+// PageRecord returns r as a row for a storage.SQLiteSink, e.g. to record
+// failed URLs from OnProgress. Its content is only set by in-memory
+// crawls; rows keep their stored content when it is missing.
+func (r CrawlResult) PageRecord() storage.PageRecord {
+	return storage.PageRecord{
+		URL:      r.URL,
+		HTML:     r.HTML,
+		Markdown: r.Markdown,
+		Status:   r.Summary().Status,
+	}
+}
+
+// outputMu keeps summaries from concurrent crawls on separate lines
+var outputMu sync.Mutex
+
+// reportResult writes result's summary to the output writer in JSON mode
+func reportResult(result CrawlResult, opts CrawlOptions) {
+	if !opts.JSONOutput {
+		return
+	}
+	line, err := json.Marshal(result.Summary())
+	if err != nil {
+		opts.logger().Error("Could not encode summary", "url", result.URL, "error", err)
+		return
+	}
+
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	if _, err := opts.outputWriter().Write(append(line, '\n')); err != nil {
+		opts.logger().Error("Could not write summary", "url", result.URL, "error", err)
+	}
+}
+
+// outputWriter is where JSON summaries go, stdout by default
+func (opts CrawlOptions) outputWriter() io.Writer {
+	if opts.OutputWriter != nil {
+		return opts.OutputWriter
+	}
+	return os.Stdout
+}
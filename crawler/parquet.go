@@ -0,0 +1,257 @@
+package crawler
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress/zstd"
+)
+
+// Columns of the files ParquetSink writes
+const (
+	ParquetURL       = "url"        // URL that was crawled
+	ParquetDomain    = "domain"     // Host name of the URL
+	ParquetStatus    = "status"     // Status of the result's Summary
+	ParquetError     = "error"      // Error message, null on success
+	ParquetBytes     = "bytes"      // ContentLength of the result
+	ParquetMarkdown  = "markdown"   // Markdown of the page
+	ParquetCrawledAt = "crawled_at" // When the result was added
+)
+
+// parquetColumns are the types of all columns
+var parquetColumns = map[string]parquet.Node{
+	ParquetURL:       parquet.String(),
+	ParquetDomain:    parquet.String(),
+	ParquetStatus:    parquet.String(),
+	ParquetError:     parquet.Optional(parquet.String()),
+	ParquetBytes:     parquet.Int(64),
+	ParquetMarkdown:  parquet.String(),
+	ParquetCrawledAt: parquet.Timestamp(parquet.Millisecond),
+}
+
+// Parquet file rotation defaults
+const (
+	defaultParquetMaxRows  = 100000
+	defaultParquetMaxBytes = 256 * 1024 * 1024 // 256 MB of uncompressed row data
+)
+
+// ParquetOptions controls the files ParquetSink writes
+type ParquetOptions struct {
+	// Dir is the directory files are written to. Empty means the current
+	// directory.
+	Dir string
+	// Prefix starts the file names, followed by the time the sink was
+	// created and a sequence number, e.g. crawl-20250102T150405-00001.parquet.
+	// Empty means "crawl".
+	Prefix string
+	// MaxRows starts a new file once a file holds this many rows. Zero
+	// means 100000.
+	MaxRows int
+	// MaxBytes starts a new file once the rows of a file add up to this
+	// many bytes before compression. Zero means 256 MB.
+	MaxBytes int64
+	// Columns picks the columns written, e.g. all but ParquetMarkdown to
+	// leave out the content. Nil means all of them.
+	Columns []string
+}
+
+// ParquetSink batches crawl results into Parquet files for analytics, one
+// row per result. It is safe for concurrent use, e.g. from OnProgress.
+type ParquetSink struct {
+	mu      sync.Mutex
+	opts    ParquetOptions
+	schema  *parquet.Schema
+	columns map[string]bool
+	started string // Creation time in file names
+
+	file   *os.File
+	writer *parquet.Writer
+	rows   int
+	bytes  int64
+	files  []string
+}
+
+// NewParquetSink creates a sink writing files as opts says. Close it to
+// complete the last file.
+func NewParquetSink(opts ParquetOptions) (*ParquetSink, error) {
+	if opts.MaxRows < 0 || opts.MaxBytes < 0 {
+		return nil, fmt.Errorf("parquet file limits must not be negative")
+	}
+	if opts.Prefix == "" {
+		opts.Prefix = "crawl"
+	}
+	if strings.ContainsAny(opts.Prefix, `/\`) {
+		return nil, fmt.Errorf("invalid parquet file prefix %q", opts.Prefix)
+	}
+	if opts.Dir == "" {
+		opts.Dir = "."
+	}
+	if opts.MaxRows == 0 {
+		opts.MaxRows = defaultParquetMaxRows
+	}
+	if opts.MaxBytes == 0 {
+		opts.MaxBytes = defaultParquetMaxBytes
+	}
+
+	names := opts.Columns
+	if names == nil {
+		names = []string{ParquetURL, ParquetDomain, ParquetStatus, ParquetError, ParquetBytes, ParquetMarkdown, ParquetCrawledAt}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no parquet columns selected")
+	}
+	group := make(parquet.Group, len(names))
+	columns := make(map[string]bool, len(names))
+	for _, name := range names {
+		node, ok := parquetColumns[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown parquet column %q", name)
+		}
+		group[name] = node
+		columns[name] = true
+	}
+
+	return &ParquetSink{
+		opts:    opts,
+		schema:  parquet.NewSchema("crawl_result", group),
+		columns: columns,
+		started: time.Now().UTC().Format("20060102T150405"),
+	}, nil
+}
+
+// Add writes a row for result. The Markdown is result.Markdown, as kept by
+// in-memory crawls, or else read from result.MarkdownPath when that is a
+// local file.
+func (s *ParquetSink) Add(result CrawlResult) error {
+	row := make(map[string]any, len(s.columns))
+	size := int64(len(result.URL))
+	for name := range s.columns {
+		switch name {
+		case ParquetURL:
+			row[name] = result.URL
+		case ParquetDomain:
+			row[name] = hostOf(result.URL)
+		case ParquetStatus:
+			row[name] = result.Summary().Status
+		case ParquetError:
+			if result.Error != nil {
+				row[name] = result.Error.Error()
+				size += int64(len(result.Error.Error()))
+			} else {
+				row[name] = nil
+			}
+		case ParquetBytes:
+			row[name] = int64(result.ContentLength)
+		case ParquetMarkdown:
+			markdown, err := resultMarkdown(result)
+			if err != nil {
+				return fmt.Errorf("error reading markdown of %s: %w", result.URL, err)
+			}
+			row[name] = markdown
+			size += int64(len(markdown))
+		case ParquetCrawledAt:
+			row[name] = time.Now()
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.writer == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+	if err := s.writer.Write(row); err != nil {
+		return fmt.Errorf("error writing parquet row for %s: %w", result.URL, err)
+	}
+	s.rows++
+	s.bytes += size
+	if s.rows >= s.opts.MaxRows || s.bytes >= s.opts.MaxBytes {
+		return s.rotate()
+	}
+	return nil
+}
+
+// Files returns the paths of the files written so far, including the one
+// still open
+func (s *ParquetSink) Files() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.files...)
+}
+
+// Close completes the open file
+func (s *ParquetSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rotate()
+}
+
+// open starts the next file
+func (s *ParquetSink) open() error {
+	name := fmt.Sprintf("%s-%s-%05d.parquet", s.opts.Prefix, s.started, len(s.files)+1)
+	path := filepath.Join(s.opts.Dir, name)
+	// Never overwrite the files of another sink
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create parquet file %s: %v", path, err)
+	}
+	s.file = file
+	s.writer = parquet.NewWriter(file, s.schema, parquet.Compression(&zstd.Codec{}))
+	s.files = append(s.files, path)
+	return nil
+}
+
+// rotate completes the open file, if any, so the next row starts a new one
+func (s *ParquetSink) rotate() error {
+	if s.writer == nil {
+		return nil
+	}
+	err := s.writer.Close()
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+	path := s.file.Name()
+	s.writer, s.file, s.rows, s.bytes = nil, nil, 0, 0
+	if err != nil {
+		return fmt.Errorf("failed to write parquet file %s: %v", path, err)
+	}
+	return nil
+}
+
+// resultMarkdown returns the Markdown of result, reading its file if it
+// wasn't kept in memory. Paths that aren't local files, such as bucket
+// keys, give no Markdown.
+func resultMarkdown(result CrawlResult) (string, error) {
+	if result.Markdown != "" || result.MarkdownPath == "" {
+		return result.Markdown, nil
+	}
+	file, err := os.Open(result.MarkdownPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if strings.HasSuffix(result.MarkdownPath, ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return "", err
+		}
+		defer gz.Close()
+		reader = gz
+	}
+	markdown, err := io.ReadAll(reader)
+	return string(markdown), err
+}
@@ -0,0 +1,170 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// ErrPoolClosed is returned by BrowserPool.Get after Close
+var ErrPoolClosed = errors.New("browser pool is closed")
+
+// BrowserPool keeps a fixed set of launched browsers and hands out pages on
+// them, avoiding a Chrome cold start per URL. Every page lives in its own
+// incognito context, which is thrown away when the page is returned, so
+// cookies, local storage, IndexedDB, caches and service workers never leak
+// between crawls.
+type BrowserPool struct {
+	mu       sync.Mutex
+	browsers []*rod.Browser
+	contexts map[proto.TargetTargetID]*rod.Browser // Incognito context of each page
+	next     int                                   // Browser the next page is created on
+	closed   bool
+
+	idle  chan *rod.Page // Fresh pages ready for use
+	slots chan struct{}  // One token per page that may exist
+	done  chan struct{}  // Closed by Close to wake waiters
+}
+
+// NewBrowserPool launches browsers browsers and allows up to maxPages pages
+// across them, created lazily as they are requested
+func NewBrowserPool(browsers, maxPages int) (*BrowserPool, error) {
+	if browsers <= 0 {
+		browsers = 1
+	}
+	if maxPages <= 0 {
+		maxPages = maxConcurrent
+	}
+
+	pool := &BrowserPool{
+		contexts: make(map[proto.TargetTargetID]*rod.Browser),
+		idle:     make(chan *rod.Page, maxPages),
+		slots:    make(chan struct{}, maxPages),
+		done:     make(chan struct{}),
+	}
+	for i := 0; i < browsers; i++ {
+		browser := rod.New()
+		if err := browser.Connect(); err != nil {
+			pool.Close()
+			return nil, fmt.Errorf("failed to launch browser %d of pool: %w", i+1, err)
+		}
+		pool.browsers = append(pool.browsers, browser)
+	}
+	return pool, nil
+}
+
+// Get returns an idle page, creating one if the pool has room, and blocks
+// until a page is returned with Put otherwise
+func (p *BrowserPool) Get() (*rod.Page, error) {
+	return p.get(context.Background())
+}
+
+// get is Get but gives up when ctx is cancelled
+func (p *BrowserPool) get(ctx context.Context) (*rod.Page, error) {
+	// Prefer reusing an idle page over creating a new one
+	select {
+	case page := <-p.idle:
+		return page, nil
+	default:
+	}
+
+	select {
+	case page := <-p.idle:
+		return page, nil
+	case p.slots <- struct{}{}:
+		page, err := p.newPage()
+		if err != nil {
+			<-p.slots
+			return nil, err
+		}
+		return page, nil
+	case <-p.done:
+		return nil, ErrPoolClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// newPage opens a blank page in a fresh incognito context, spreading pages
+// round-robin across the pool's browsers
+func (p *BrowserPool) newPage() (*rod.Page, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, ErrPoolClosed
+	}
+	browser := p.browsers[p.next%len(p.browsers)]
+	p.next++
+	p.mu.Unlock()
+
+	incognito, err := browser.Incognito()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create browser context: %w", err)
+	}
+	page, err := incognito.Page(proto.TargetCreateTarget{})
+	if err != nil {
+		incognito.Close()
+		return nil, fmt.Errorf("failed to open page: %w", err)
+	}
+
+	p.mu.Lock()
+	p.contexts[page.TargetID] = incognito
+	p.mu.Unlock()
+	return page, nil
+}
+
+// Put closes page along with everything the crawl left in its context and
+// makes a fresh page in a new context available in its place. Clearing a
+// used context instead would miss state kept per origin, such as the
+// storage of the frames and redirects the crawl went through.
+func (p *BrowserPool) Put(page *rod.Page) {
+	p.mu.Lock()
+	incognito, ok := p.contexts[page.TargetID]
+	delete(p.contexts, page.TargetID)
+	p.mu.Unlock()
+	if !ok {
+		return
+	}
+	incognito.Close()
+
+	fresh, err := p.newPage()
+	if err != nil {
+		// The slot is free for get to try again
+		<-p.slots
+		return
+	}
+	p.idle <- fresh
+}
+
+// Close closes every page and browser of the pool. Pages still checked out
+// are closed with their browser.
+func (p *BrowserPool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.done)
+	contexts := p.contexts
+	p.contexts = make(map[proto.TargetTargetID]*rod.Browser)
+	browsers := p.browsers
+	p.mu.Unlock()
+
+	var errs []error
+	for _, incognito := range contexts {
+		if err := incognito.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, browser := range browsers {
+		if err := browser.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
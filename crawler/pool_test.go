@@ -0,0 +1,69 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/time/rate"
+)
+
+// benchmarkPages is the number of pages each benchmark iteration crawls
+const benchmarkPages = 10
+
+// BenchmarkCrawlURLs compares a batch crawled through a shared browser pool
+// with one launching a browser per URL. It needs Chrome installed; compare
+// the ms/page of the two with
+//
+//	go test -run '^$' -bench CrawlURLs -benchtime 5x ./crawler
+//
+// No numbers are recorded here yet: the tree was last benchmarked on a
+// machine without Chrome, where both sub-benchmarks skip. Add the results,
+// with the Chrome version and machine they came from, when they are run.
+func BenchmarkCrawlURLs(b *testing.B) {
+	requireBrowser(b)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "<html><head><title>Page</title></head><body><h1>%s</h1><p>Benchmark page.</p></body></html>", r.URL.Path)
+	}))
+	defer server.Close()
+
+	urls := make([]string, benchmarkPages)
+	for i := range urls {
+		urls[i] = fmt.Sprintf("%s/page/%d", server.URL, i)
+	}
+	opts := CrawlOptions{
+		AllowedHosts: []string{"127.0.0.1"},
+		IgnoreRobots: true,
+		RateLimiter:  NewHostRateLimiter(rate.Inf, 1),
+		inMemory:     true,
+	}
+	crawl := func(b *testing.B, opts CrawlOptions) {
+		for i := 0; i < b.N; i++ {
+			results, _ := crawlBatch(context.Background(), urls, "", opts)
+			for _, result := range results {
+				if result.Error != nil {
+					b.Fatalf("crawl of %s failed: %v", result.URL, result.Error)
+				}
+			}
+		}
+		b.ReportMetric(float64(b.Elapsed().Milliseconds())/float64(b.N*benchmarkPages), "ms/page")
+	}
+
+	b.Run("pooled", func(b *testing.B) {
+		pool, err := NewBrowserPool(1, 0)
+		if err != nil {
+			b.Fatalf("NewBrowserPool: %v", err)
+		}
+		defer pool.Close()
+		pooled := opts
+		pooled.BrowserPool = pool
+		b.ResetTimer()
+		crawl(b, pooled)
+	})
+	b.Run("per-url", func(b *testing.B) {
+		crawl(b, opts)
+	})
+}
@@ -0,0 +1,174 @@
+package crawler
+
+import (
+	"sync"
+	"time"
+)
+
+// Default proxy pool settings
+const (
+	defaultProxyMaxFailures = 3           // Consecutive failures before a proxy is benched
+	defaultProxyCooldown    = time.Minute // How long a benched proxy is skipped
+)
+
+// ProxyPoolOptions configures a ProxyPool. The zero value uses the defaults.
+type ProxyPoolOptions struct {
+	// MaxFailures is the number of consecutive failed fetches after which a
+	// proxy is considered unhealthy. Zero means 3.
+	MaxFailures int
+	// Cooldown is how long an unhealthy proxy is skipped before it's tried
+	// again. Zero means one minute.
+	Cooldown time.Duration
+	// StickyHosts keeps sending each host through the same proxy for as long
+	// as it stays healthy, e.g. for sites that tie sessions to an IP. A
+	// network error fetching the host through it moves the host to another.
+	StickyHosts bool
+}
+
+// ProxyPool rotates fetches across a set of proxies, skipping the ones that
+// keep failing. Fetches record their outcome so that, within a fetch's
+// retries, a dead proxy is swapped for a healthy one.
+type ProxyPool struct {
+	mu      sync.Mutex
+	proxies []string
+	health  map[string]*proxyHealth
+	sticky  map[string]string // Proxy assigned to each host with StickyHosts
+	next    int               // Index of the proxy the next rotation starts at
+	opts    ProxyPoolOptions
+}
+
+// proxyHealth tracks the recent failures of a proxy
+type proxyHealth struct {
+	failures    int       // Consecutive failed fetches
+	benchedTill time.Time // Zero while the proxy is healthy
+}
+
+// NewProxyPool creates a pool rotating across proxies, which take the same
+// forms as the entries LoadProxies returns
+func NewProxyPool(proxies []string, opts ProxyPoolOptions) *ProxyPool {
+	if opts.MaxFailures <= 0 {
+		opts.MaxFailures = defaultProxyMaxFailures
+	}
+	if opts.Cooldown <= 0 {
+		opts.Cooldown = defaultProxyCooldown
+	}
+
+	pool := &ProxyPool{
+		health: make(map[string]*proxyHealth),
+		sticky: make(map[string]string),
+		opts:   opts,
+	}
+	for _, proxy := range proxies {
+		if _, ok := pool.health[proxy]; ok {
+			continue
+		}
+		pool.proxies = append(pool.proxies, proxy)
+		pool.health[proxy] = &proxyHealth{}
+	}
+	return pool
+}
+
+// Get returns the proxy to fetch from host through: its sticky proxy if
+// it's healthy, the next healthy proxy in rotation otherwise. If every proxy
+// is unhealthy the one benched longest ago is returned, so fetches never
+// silently go out without a proxy. Get returns "" for an empty pool.
+func (p *ProxyPool) Get(host string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.proxies) == 0 {
+		return ""
+	}
+	now := time.Now()
+	if p.opts.StickyHosts {
+		if proxy, ok := p.sticky[host]; ok && p.healthy(proxy, now) {
+			return proxy
+		}
+	}
+
+	proxy := ""
+	for i := 0; i < len(p.proxies); i++ {
+		candidate := p.proxies[(p.next+i)%len(p.proxies)]
+		if p.healthy(candidate, now) {
+			proxy = candidate
+			p.next = (p.next + i + 1) % len(p.proxies)
+			break
+		}
+	}
+	if proxy == "" {
+		proxy = p.leastRecentlyBenched()
+	}
+
+	if p.opts.StickyHosts {
+		p.sticky[host] = proxy
+	}
+	return proxy
+}
+
+// MarkFailed records a failed fetch through proxy. After MaxFailures in a
+// row the proxy is skipped for Cooldown.
+func (p *ProxyPool) MarkFailed(proxy string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	health, ok := p.health[proxy]
+	if !ok {
+		return
+	}
+	health.failures++
+	if health.failures >= p.opts.MaxFailures {
+		health.benchedTill = time.Now().Add(p.opts.Cooldown)
+	}
+}
+
+// Release drops the sticky proxy of host, so its next Get takes the next
+// healthy proxy in rotation. It does nothing without StickyHosts.
+func (p *ProxyPool) Release(host string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.sticky, host)
+}
+
+// MarkSucceeded records a successful fetch through proxy, which makes it
+// healthy again
+func (p *ProxyPool) MarkSucceeded(proxy string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if health, ok := p.health[proxy]; ok {
+		*health = proxyHealth{}
+	}
+}
+
+// Healthy returns the proxies that aren't currently skipped
+func (p *ProxyPool) Healthy() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var healthy []string
+	now := time.Now()
+	for _, proxy := range p.proxies {
+		if p.healthy(proxy, now) {
+			healthy = append(healthy, proxy)
+		}
+	}
+	return healthy
+}
+
+// healthy reports whether proxy is outside its cooldown. p.mu must be held.
+func (p *ProxyPool) healthy(proxy string, now time.Time) bool {
+	return !now.Before(p.health[proxy].benchedTill)
+}
+
+// leastRecentlyBenched returns the proxy whose cooldown ends first. p.mu
+// must be held.
+func (p *ProxyPool) leastRecentlyBenched() string {
+	best := p.proxies[0]
+	for _, proxy := range p.proxies[1:] {
+		if p.health[proxy].benchedTill.Before(p.health[best].benchedTill) {
+			best = proxy
+		}
+	}
+	return best
+}
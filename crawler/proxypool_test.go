@@ -0,0 +1,48 @@
+package crawler
+
+import "testing"
+
+func TestProxyPoolStickyHosts(t *testing.T) {
+	pool := NewProxyPool([]string{"http://a:8080", "http://b:8080"}, ProxyPoolOptions{StickyHosts: true})
+
+	first := pool.Get("example.com")
+	if got := pool.Get("example.com"); got != first {
+		t.Fatalf("Get = %q, want the sticky proxy %q", got, first)
+	}
+
+	// A single failure doesn't bench the proxy, but releasing the host moves
+	// it to the next one
+	pool.MarkFailed(first)
+	pool.Release("example.com")
+	second := pool.Get("example.com")
+	if second == first {
+		t.Fatalf("Get after Release = %q, want another proxy", second)
+	}
+	if got := pool.Get("example.com"); got != second {
+		t.Fatalf("Get = %q, want the new sticky proxy %q", got, second)
+	}
+}
+
+func TestProxyPoolBenchesFailingProxy(t *testing.T) {
+	pool := NewProxyPool([]string{"http://a:8080", "http://b:8080"}, ProxyPoolOptions{MaxFailures: 2})
+
+	pool.MarkFailed("http://a:8080")
+	if got := len(pool.Healthy()); got != 2 {
+		t.Fatalf("%d healthy proxies after one failure, want 2", got)
+	}
+	pool.MarkFailed("http://a:8080")
+	healthy := pool.Healthy()
+	if len(healthy) != 1 || healthy[0] != "http://b:8080" {
+		t.Fatalf("Healthy = %v, want only http://b:8080", healthy)
+	}
+	for i := 0; i < 3; i++ {
+		if got := pool.Get("example.com"); got != "http://b:8080" {
+			t.Fatalf("Get = %q, want the healthy proxy", got)
+		}
+	}
+
+	pool.MarkSucceeded("http://a:8080")
+	if got := len(pool.Healthy()); got != 2 {
+		t.Fatalf("%d healthy proxies after a success, want 2", got)
+	}
+}
@@ -0,0 +1,105 @@
+package crawler
+
+import (
+	"context"
+	"net/url"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// HostRateLimiter hands out one token bucket per host so that crawls against
+// different domains are throttled independently of each other
+type HostRateLimiter struct {
+	mu        sync.Mutex
+	limit     rate.Limit
+	burst     int
+	limiters  map[string]*rate.Limiter
+	overrides map[string]bool // Hosts whose rate was set with SetHostRate
+}
+
+// defaultHostRateLimiter is used when CrawlOptions.RateLimiter is nil
+var defaultHostRateLimiter = NewHostRateLimiter(defaultRateLimit, defaultBurst)
+
+// NewHostRateLimiter creates a registry that lazily creates a limiter with
+// rate r and the given burst for every host it sees
+func NewHostRateLimiter(r rate.Limit, burst int) *HostRateLimiter {
+	return &HostRateLimiter{
+		limit:     r,
+		burst:     burst,
+		limiters:  make(map[string]*rate.Limiter),
+		overrides: make(map[string]bool),
+	}
+}
+
+// SetHostRate gives host its own rate and burst, e.g. a gentler rate for a
+// fragile domain. It takes precedence over the registry's default rate.
+func (h *HostRateLimiter) SetHostRate(host string, r rate.Limit, burst int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.overrides[host] = true
+	if limiter, ok := h.limiters[host]; ok {
+		limiter.SetLimit(r)
+		limiter.SetBurst(burst)
+		return
+	}
+	h.limiters[host] = rate.NewLimiter(r, burst)
+}
+
+// Limiter returns the limiter for host, creating it on first use
+func (h *HostRateLimiter) Limiter(host string) *rate.Limiter {
+	return h.limiterFor(host, h.limit, h.burst)
+}
+
+// Wait blocks until the host of rawURL may be requested again or ctx is done
+func (h *HostRateLimiter) Wait(ctx context.Context, rawURL string) error {
+	return h.Limiter(hostOf(rawURL)).Wait(ctx)
+}
+
+// limiterFor returns the limiter for host. Hosts without an explicit
+// SetHostRate override are created with, or updated to, limit and burst.
+func (h *HostRateLimiter) limiterFor(host string, limit rate.Limit, burst int) *rate.Limiter {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	limiter, ok := h.limiters[host]
+	if !ok {
+		limiter = rate.NewLimiter(limit, burst)
+		h.limiters[host] = limiter
+		return limiter
+	}
+	if h.overrides[host] {
+		return limiter
+	}
+	if limiter.Limit() != limit {
+		limiter.SetLimit(limit)
+	}
+	if limiter.Burst() != burst {
+		limiter.SetBurst(burst)
+	}
+	return limiter
+}
+
+// SetHostRate overrides the rate for host in the default registry used when
+// CrawlOptions.RateLimiter is not set
+func SetHostRate(host string, r rate.Limit, burst int) {
+	defaultHostRateLimiter.SetHostRate(host, r, burst)
+}
+
+// waitForRateLimit applies the rate limiting configured in opts to rawURL
+func waitForRateLimit(ctx context.Context, rawURL string, opts CrawlOptions) error {
+	if opts.RateLimiter != nil {
+		return opts.RateLimiter.Wait(ctx, rawURL)
+	}
+	return defaultHostRateLimiter.limiterFor(hostOf(rawURL), opts.RateLimit, opts.Burst).Wait(ctx)
+}
+
+// hostOf returns the hostname of rawURL, or rawURL itself if it can't be parsed
+func hostOf(rawURL string) string {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return parsedURL.Hostname()
+}
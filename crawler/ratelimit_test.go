@@ -0,0 +1,88 @@
+package crawler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestHostRateLimiterPerHost(t *testing.T) {
+	h := NewHostRateLimiter(rate.Limit(2), 1)
+
+	a := h.Limiter("a.example")
+	if a != h.Limiter("a.example") {
+		t.Fatal("Limiter returned a new limiter for the same host")
+	}
+	b := h.Limiter("b.example")
+	if a == b {
+		t.Fatal("hosts share a limiter")
+	}
+	if a.Limit() != 2 || a.Burst() != 1 {
+		t.Fatalf("limiter = %v/%d, want the registry's 2/1", a.Limit(), a.Burst())
+	}
+
+	// Using up one host's bucket leaves the other's alone
+	if !a.Allow() {
+		t.Fatal("first request to a.example throttled")
+	}
+	if a.Allow() {
+		t.Fatal("second request to a.example allowed within the burst")
+	}
+	if !b.Allow() {
+		t.Fatal("b.example throttled by a.example's requests")
+	}
+}
+
+func TestHostRateLimiterOverride(t *testing.T) {
+	h := NewHostRateLimiter(rate.Limit(2), 1)
+	h.Limiter("fragile.example")
+	h.SetHostRate("fragile.example", rate.Every(10*time.Second), 3)
+	h.SetHostRate("new.example", rate.Limit(5), 2)
+
+	tests := []struct {
+		host  string
+		limit rate.Limit
+		burst int
+	}{
+		{"fragile.example", rate.Every(10 * time.Second), 3},
+		{"new.example", 5, 2},
+		{"other.example", 2, 1},
+	}
+	for _, tt := range tests {
+		// Per-crawl options don't replace an explicit override
+		l := h.limiterFor(tt.host, rate.Limit(2), 1)
+		if l.Limit() != tt.limit || l.Burst() != tt.burst {
+			t.Errorf("%s limiter = %v/%d, want %v/%d", tt.host, l.Limit(), l.Burst(), tt.limit, tt.burst)
+		}
+	}
+}
+
+func TestHostRateLimiterFollowsOptions(t *testing.T) {
+	h := NewHostRateLimiter(rate.Limit(1), 1)
+	h.limiterFor("a.example", rate.Limit(1), 1)
+
+	l := h.limiterFor("a.example", rate.Limit(10), 4)
+	if l.Limit() != 10 || l.Burst() != 4 {
+		t.Fatalf("limiter = %v/%d, want it updated to 10/4", l.Limit(), l.Burst())
+	}
+}
+
+func TestHostRateLimiterWait(t *testing.T) {
+	h := NewHostRateLimiter(rate.Every(time.Hour), 1)
+	ctx := context.Background()
+	if err := h.Wait(ctx, "https://a.example/1"); err != nil {
+		t.Fatalf("first Wait: %v", err)
+	}
+
+	// The next token is an hour away, past the deadline
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := h.Wait(ctx, "https://a.example/2"); err == nil {
+		t.Fatal("second Wait returned before the host's next token")
+	}
+	if err := h.Wait(ctx, "https://b.example/"); err != nil {
+		t.Fatalf("Wait for another host: %v", err)
+	}
+}
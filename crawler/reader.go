@@ -0,0 +1,117 @@
+package crawler
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// urlListMaxLine is the longest line read from a URL list
+const urlListMaxLine = 1024 * 1024
+
+// urlListEntry is a non-blank, non-comment line of a URL list
+type urlListEntry struct {
+	url string
+	err error // Why the line isn't a crawlable URL, nil if it is
+}
+
+// ReadURLs reads a URL list with one URL per line, such as a file or a
+// pipe. Blank lines and lines starting with "#" are skipped. It returns the
+// well-formed HTTP(S) URLs in order and an error naming every malformed
+// line, so callers can report them and go on with the rest.
+func ReadURLs(r io.Reader) ([]string, error) {
+	entries, err := readURLList(r)
+	var urls []string
+	var errs []error
+	for _, entry := range entries {
+		if entry.err != nil {
+			errs = append(errs, entry.err)
+			continue
+		}
+		urls = append(urls, entry.url)
+	}
+	if err != nil {
+		errs = append(errs, err)
+	}
+	return urls, errors.Join(errs...)
+}
+
+// CrawlFromReader crawls the URLs listed in r, one per line, into
+// opts.OutputDir. Blank lines and lines starting with "#" are skipped. It
+// returns a result per remaining line in order; malformed lines aren't
+// crawled and their results carry an error naming the line. A failure to
+// read r is reported as a last result without a URL.
+func CrawlFromReader(r io.Reader, opts CrawlOptions) []CrawlResult {
+	return CrawlFromReaderCtx(context.Background(), r, opts)
+}
+
+// CrawlFromReaderCtx is like CrawlFromReader but stops once ctx is cancelled
+func CrawlFromReaderCtx(ctx context.Context, r io.Reader, opts CrawlOptions) []CrawlResult {
+	entries, readErr := readURLList(r)
+
+	var urls []string
+	var positions []int
+	results := make([]CrawlResult, len(entries))
+	for i, entry := range entries {
+		if entry.err != nil {
+			opts.logger().Warn("Skipping malformed URL list line", "error", entry.err)
+			results[i] = CrawlResult{URL: entry.url, Error: entry.err}
+			continue
+		}
+		urls = append(urls, entry.url)
+		positions = append(positions, i)
+	}
+
+	if len(urls) > 0 {
+		for i, result := range CrawlURLsWithOptions(ctx, urls, opts.OutputDir, opts) {
+			results[positions[i]] = result
+		}
+	}
+	if readErr != nil {
+		opts.logger().Error("Failed to read URL list", "error", readErr)
+		results = append(results, CrawlResult{Error: readErr})
+	}
+	return results
+}
+
+// readURLList splits r into entries, checking that each is an absolute
+// HTTP(S) URL. Whether the URL is safe to crawl is left to the crawl.
+func readURLList(r io.Reader) ([]urlListEntry, error) {
+	var entries []urlListEntry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), urlListMaxLine)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		entry := urlListEntry{url: text}
+		if err := checkListURL(text); err != nil {
+			entry.err = fmt.Errorf("line %d: %w", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return entries, fmt.Errorf("error reading URL list: %w", err)
+	}
+	return entries, nil
+}
+
+// checkListURL rejects lines that aren't absolute HTTP(S) URLs
+func checkListURL(rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL format: %v", err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return fmt.Errorf("invalid URL %q: only HTTP and HTTPS schemes are allowed", rawURL)
+	}
+	if parsed.Host == "" {
+		return fmt.Errorf("invalid URL %q: missing host", rawURL)
+	}
+	return nil
+}
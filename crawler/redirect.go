@@ -0,0 +1,145 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// dialTimeout bounds connecting to a host outside the browser
+const dialTimeout = 30 * time.Second
+
+// ErrTooManyRedirects is returned when a page redirects more often than
+// CrawlOptions.MaxRedirects allows
+var ErrTooManyRedirects = errors.New("too many redirects")
+
+// ErrNavigationRejected is returned when a page redirects or navigates,
+// e.g. through a script or a meta refresh, to a URL ValidateURLWithOptions
+// rejects, such as a cloud metadata endpoint on a private address
+var ErrNavigationRejected = errors.New("navigation rejected")
+
+// navigationGuard checks the navigations of a page's frames, HTTP redirects
+// included, before the browser follows them
+type navigationGuard struct {
+	pageURL string // The crawled URL, which was validated already
+	opts    CrawlOptions
+
+	mu        sync.Mutex
+	redirects int   // HTTP redirects seen so far
+	err       error // Why a navigation was refused, nil if none was
+}
+
+// newNavigationGuard creates a guard for the crawl of pageURL enforcing
+// opts.MaxRedirects and the URL checks of opts
+func newNavigationGuard(pageURL string, opts CrawlOptions) *navigationGuard {
+	return &navigationGuard{pageURL: pageURL, opts: opts}
+}
+
+// check decides whether the main frame may load target, through an HTTP
+// redirect when redirect is true. The checks run before the browser
+// connects, so a page can't reach a private address even once.
+func (g *navigationGuard) check(target string, redirect bool) error {
+	var err error
+	if redirect {
+		g.mu.Lock()
+		g.redirects++
+		err = checkRedirectCount(g.redirects, g.opts.MaxRedirects)
+		g.mu.Unlock()
+	}
+	if err == nil && !sameDocument(target, g.pageURL) {
+		if validateErr := ValidateURLWithOptions(target, g.opts); validateErr != nil {
+			err = fmt.Errorf("%w to %s: %w", ErrNavigationRejected, target, validateErr)
+		}
+	}
+	if err != nil {
+		g.mu.Lock()
+		if g.err == nil {
+			g.err = err
+		}
+		g.mu.Unlock()
+	}
+	return err
+}
+
+// checkFrame decides whether a subframe, such as an iframe, may load
+// target. A refused frame is left empty rather than failing the page, and
+// its redirects don't count towards the page's.
+func (g *navigationGuard) checkFrame(target string) error {
+	if sameDocument(target, g.pageURL) {
+		return nil
+	}
+	if err := ValidateURLWithOptions(target, g.opts); err != nil {
+		g.opts.logger().Warn("Blocked frame navigation", "page", g.pageURL, "url", target, "error", err)
+		return fmt.Errorf("%w to %s: %w", ErrNavigationRejected, target, err)
+	}
+	return nil
+}
+
+// failure returns why a navigation was refused, nil if none was
+func (g *navigationGuard) failure() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.err
+}
+
+// checkRedirectCount rejects more than max redirects
+func checkRedirectCount(count, max int) error {
+	if count > max {
+		return fmt.Errorf("%w: more than %d", ErrTooManyRedirects, max)
+	}
+	return nil
+}
+
+// checkHTTPRedirect returns the CheckRedirect of the HTTP clients fetching
+// outside the browser, such as for sitemaps and robots.txt. Like
+// navigationGuard it limits redirects to opts.MaxRedirects and validates
+// each hop, which Go's client would otherwise follow anywhere, private
+// addresses included.
+func checkHTTPRedirect(opts CrawlOptions) func(*http.Request, []*http.Request) error {
+	max := opts.MaxRedirects
+	if max == 0 {
+		max = defaultMaxRedirects
+	}
+	return func(req *http.Request, via []*http.Request) error {
+		if err := checkRedirectCount(len(via), max); err != nil {
+			return err
+		}
+		target := req.URL.String()
+		if err := ValidateURLWithOptions(target, opts); err != nil {
+			return fmt.Errorf("%w to %s: %w", ErrNavigationRejected, target, err)
+		}
+		return nil
+	}
+}
+
+// guardedDial returns the DialContext of the HTTP clients fetching outside
+// the browser. It checks the address each connection actually goes to,
+// like checkPeerAddresses does for the browser, so a host can't pass
+// ValidateURLWithOptions's lookup and then resolve to a private address.
+func guardedDial(opts CrawlOptions) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		dialer := &net.Dialer{Timeout: dialTimeout}
+		if !opts.AllowPrivateNetworks && !opts.allowsHost(host) {
+			dialer.Control = func(_, address string, _ syscall.RawConn) error {
+				ip, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if isPrivateIP(ip) {
+					return fmt.Errorf("%s: %w %s", host, ErrPrivateAddress, ip)
+				}
+				return nil
+			}
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}
+}
@@ -0,0 +1,119 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestNavigationGuardRejectsPrivateRedirect(t *testing.T) {
+	guard := newNavigationGuard("https://example.com/", CrawlOptions{MaxRedirects: 10})
+
+	err := guard.check("http://169.254.169.254/latest/meta-data/", true)
+	if !errors.Is(err, ErrNavigationRejected) {
+		t.Fatalf("check error = %v, want ErrNavigationRejected", err)
+	}
+	if !errors.Is(guard.failure(), ErrNavigationRejected) {
+		t.Fatalf("failure() = %v, want the refused redirect", guard.failure())
+	}
+}
+
+func TestNavigationGuardAllowsPrivateRedirectWhenAllowed(t *testing.T) {
+	guard := newNavigationGuard("https://example.com/", CrawlOptions{MaxRedirects: 10, AllowedHosts: []string{"10.0.0.1"}})
+
+	if err := guard.check("http://10.0.0.1/", true); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	if guard.failure() != nil {
+		t.Fatalf("failure() = %v, want nil", guard.failure())
+	}
+}
+
+func TestNavigationGuardCountsRedirects(t *testing.T) {
+	guard := newNavigationGuard("https://example.com/", CrawlOptions{MaxRedirects: 1, AllowedHosts: []string{"10.0.0.1"}})
+
+	if err := guard.check("http://10.0.0.1/a", true); err != nil {
+		t.Fatalf("first redirect: %v", err)
+	}
+	if err := guard.check("http://10.0.0.1/b", true); !errors.Is(err, ErrTooManyRedirects) {
+		t.Fatalf("second redirect error = %v, want ErrTooManyRedirects", err)
+	}
+}
+
+func TestNavigationGuardChecksFrames(t *testing.T) {
+	guard := newNavigationGuard("https://example.com/", CrawlOptions{MaxRedirects: 1})
+
+	tests := []struct {
+		name    string
+		target  string
+		refused bool
+	}{
+		{"metadata endpoint", "http://169.254.169.254/latest/meta-data/", true},
+		{"loopback", "http://127.0.0.1:8080/admin", true},
+		{"private network", "http://10.1.2.3/", true},
+		{"non-http scheme", "file:///etc/passwd", true},
+		{"the page itself", "https://example.com/#frame", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := guard.checkFrame(tt.target)
+			if refused := errors.Is(err, ErrNavigationRejected); refused != tt.refused {
+				t.Errorf("checkFrame(%q) = %v, want refused %v", tt.target, err, tt.refused)
+			}
+		})
+	}
+	// Refused frames leave the page alone
+	if guard.failure() != nil {
+		t.Fatalf("failure() = %v after frame checks, want nil", guard.failure())
+	}
+}
+
+func TestCheckHTTPRedirect(t *testing.T) {
+	check := checkHTTPRedirect(CrawlOptions{MaxRedirects: 2})
+	request := func(rawURL string) *http.Request {
+		u, _ := url.Parse(rawURL)
+		return &http.Request{URL: u}
+	}
+
+	if err := check(request("http://169.254.169.254/"), make([]*http.Request, 1)); !errors.Is(err, ErrNavigationRejected) {
+		t.Errorf("redirect to metadata endpoint: error = %v, want ErrNavigationRejected", err)
+	}
+	if err := check(request("http://10.0.0.1/"), make([]*http.Request, 3)); !errors.Is(err, ErrTooManyRedirects) {
+		t.Errorf("third redirect: error = %v, want ErrTooManyRedirects", err)
+	}
+}
+
+func TestGuardedDialChecksConnectedAddress(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	// localhost is checked at connect time, whatever it resolved to when
+	// the URL was validated
+	tests := []struct {
+		name string
+		opts CrawlOptions
+		err  bool
+	}{
+		{"default", CrawlOptions{}, true},
+		{"allowed host", CrawlOptions{AllowedHosts: []string{"localhost"}}, false},
+		{"private networks allowed", CrawlOptions{AllowPrivateNetworks: true}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := guardedDial(tt.opts)(context.Background(), "tcp", net.JoinHostPort("localhost", port))
+			if conn != nil {
+				conn.Close()
+			}
+			if got := errors.Is(err, ErrPrivateAddress); got != tt.err {
+				t.Errorf("guardedDial = %v, want private %v", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,301 @@
+package crawler
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"pathik/storage"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/go-rod/rod/lib/proto"
+	"golang.org/x/net/html"
+)
+
+// maxPageResourceBytes caps the total size of the resources captured for a
+// page; resources arriving once it's reached are left out
+const maxPageResourceBytes = 100 * 1024 * 1024 // 100 MB
+
+// resourceAttributes are the attributes whose URLs are pointed at saved
+// resources. srcset is handled separately as it lists several.
+var resourceAttributes = []string{"src", "href", "poster"}
+
+// cssURLPattern matches the url() references of CSS, quoted or not
+var cssURLPattern = regexp.MustCompile(`url\(\s*(?:"([^"]*)"|'([^']*)'|([^'")\s]*))\s*\)`)
+
+// cssImportPattern matches @import rules given a bare string, e.g.
+// @import "theme.css"; the url() form is matched by cssURLPattern
+var cssImportPattern = regexp.MustCompile(`@import\s+(?:"([^"]*)"|'([^']*)')`)
+
+// capturedResource is a response the page received for one of its resources
+type capturedResource struct {
+	URL         string
+	ContentType string
+	Body        []byte
+}
+
+// resourceCollector gathers the resources of a page as their responses
+// arrive, from several goroutines, up to maxPageResourceBytes in total
+type resourceCollector struct {
+	logger *slog.Logger
+
+	mu        sync.Mutex
+	resources []capturedResource
+	size      int  // Total size of resources
+	full      bool // Whether a resource was left out for the size cap
+}
+
+// newResourceCollector creates a collector reporting to logger
+func newResourceCollector(logger *slog.Logger) *resourceCollector {
+	return &resourceCollector{logger: logger}
+}
+
+// add records the response paused in e, read through page. Only successful
+// responses are kept; the main document is captured on its own.
+func (c *resourceCollector) add(page proto.Client, e *proto.FetchRequestPaused, pageURL string) {
+	if c == nil || e.ResponseStatusCode == nil || *e.ResponseStatusCode != http.StatusOK {
+		return
+	}
+	if e.ResourceType == proto.NetworkResourceTypeDocument && sameDocument(e.Request.URL, pageURL) {
+		return
+	}
+	body, err := proto.FetchGetResponseBody{RequestID: e.RequestID}.Call(page)
+	if err != nil {
+		return // e.g. a streamed media response
+	}
+	data := []byte(body.Body)
+	if body.Base64Encoded {
+		if data, err = base64.StdEncoding.DecodeString(body.Body); err != nil {
+			return
+		}
+	}
+
+	resource := capturedResource{URL: e.Request.URL}
+	var encoding string
+	for _, h := range e.ResponseHeaders {
+		switch {
+		case strings.EqualFold(h.Name, "Content-Type"):
+			resource.ContentType = h.Value
+		case strings.EqualFold(h.Name, "Content-Encoding"):
+			encoding = h.Value
+		}
+	}
+	resource.Body = decodeCapturedBody(data, encoding)
+	c.store(resource, pageURL)
+}
+
+// store keeps resource unless it would take the page's resources past
+// maxPageResourceBytes
+func (c *resourceCollector) store(resource capturedResource, pageURL string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.size+len(resource.Body) > maxPageResourceBytes {
+		if !c.full {
+			c.full = true
+			c.logger.Warn("Page resources exceed size limit, skipping the rest", "url", pageURL, "limit", maxPageResourceBytes)
+		}
+		return
+	}
+	c.size += len(resource.Body)
+	c.resources = append(c.resources, resource)
+}
+
+// list returns the resources collected so far
+func (c *resourceCollector) list() []capturedResource {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]capturedResource(nil), c.resources...)
+}
+
+// saveResources saves resources to the page's resource directory and
+// returns their paths along with htmlStr pointing at the saved copies.
+// Stylesheets are pointed at the saved copies of what they reference too.
+// A resource that can't be saved, e.g. because its path conflicts with
+// another's, is logged and left out; the page refers to the original.
+func saveResources(ctx context.Context, backend storage.StorageBackend, pageURL, htmlStr string, resources []capturedResource, opts storage.SaveOptions) ([]string, string, error) {
+	dir, err := storage.ResourceDir(pageURL, opts)
+	if err != nil {
+		return nil, "", err
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	// Give every resource its key first, so stylesheets can refer to
+	// resources saved after them
+	var unique []capturedResource
+	local := make(map[string]string, len(resources))
+	owners := make(map[string]string, len(resources)) // URL each key is taken by
+	for _, r := range resources {
+		if _, done := local[r.URL]; done {
+			continue
+		}
+		key := storage.ResourceKey(dir, r.URL)
+		if owner, taken := owners[key]; taken {
+			logger.Warn("Skipping resource, path taken by another", "url", r.URL, "path", key, "other", owner)
+			continue
+		}
+		owners[key] = r.URL
+		local[r.URL] = key
+		unique = append(unique, r)
+	}
+	// Stylesheets go last, once what they refer to is known to be saved
+	sort.SliceStable(unique, func(i, j int) bool {
+		return !isStylesheet(unique[i]) && isStylesheet(unique[j])
+	})
+
+	paths := make([]string, 0, len(unique))
+	for _, r := range unique {
+		key := local[r.URL]
+		body := r.Body
+		if isStylesheet(r) {
+			body = []byte(rewriteStylesheet(string(body), r.URL, key, local))
+		}
+		saved, err := storage.SaveResource(ctx, backend, key, body, r.ContentType, opts)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, "", ctx.Err()
+			}
+			// e.g. a file standing where another resource needs a directory
+			logger.Warn("Skipping resource that could not be saved", "url", r.URL, "path", key, "error", err)
+			delete(local, r.URL)
+			continue
+		}
+		paths = append(paths, saved)
+	}
+
+	rewritten, err := rewriteResourceRefs(htmlStr, pageURL, local)
+	if err != nil {
+		return nil, "", err
+	}
+	return paths, rewritten, nil
+}
+
+// isStylesheet reports whether r is CSS, by its Content-Type or, without
+// one, its extension
+func isStylesheet(r capturedResource) bool {
+	if r.ContentType != "" {
+		return strings.HasPrefix(strings.ToLower(strings.TrimSpace(r.ContentType)), "text/css")
+	}
+	parsed, err := url.Parse(r.URL)
+	return err == nil && strings.EqualFold(path.Ext(parsed.Path), ".css")
+}
+
+// rewriteStylesheet points the url() and @import references of css,
+// fetched from cssURL and saved under key, at the saved copies in local,
+// relative to the stylesheet's own location
+func rewriteStylesheet(css, cssURL, key string, local map[string]string) string {
+	base, err := url.Parse(cssURL)
+	if err != nil {
+		return css
+	}
+	return rewriteCSSRefs(css, base, func(target string) string {
+		rel, err := filepath.Rel(filepath.FromSlash(path.Dir(key)), filepath.FromSlash(target))
+		if err != nil {
+			return target
+		}
+		return filepath.ToSlash(rel)
+	}, local)
+}
+
+// rewriteCSSRefs points the url() and @import references of css, resolved
+// against base, that are in local at their saved copies, using relative to
+// turn a saved copy's key into the path to refer to it by
+func rewriteCSSRefs(css string, base *url.URL, relative func(key string) string, local map[string]string) string {
+	replace := func(pattern *regexp.Regexp, format string) {
+		css = pattern.ReplaceAllStringFunc(css, func(match string) string {
+			// Only the group of the quoting used is set
+			ref := strings.Join(pattern.FindStringSubmatch(match)[1:], "")
+			resolved, err := base.Parse(strings.TrimSpace(ref))
+			if err != nil {
+				return match
+			}
+			resolved.Fragment = ""
+			key, ok := local[resolved.String()]
+			if !ok {
+				return match
+			}
+			return fmt.Sprintf(format, relative(key))
+		})
+	}
+	replace(cssURLPattern, `url("%s")`)
+	replace(cssImportPattern, `@import "%s"`)
+	return css
+}
+
+// rewriteResourceRefs points the references of htmlStr to resources in
+// local, by absolute URL, at the relative paths they map to
+func rewriteResourceRefs(htmlStr, pageURL string, local map[string]string) (string, error) {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid page URL %s: %w", pageURL, err)
+	}
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(htmlStr))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse HTML: %w", err)
+	}
+
+	localPath := func(ref string) (string, bool) {
+		resolved, err := base.Parse(strings.TrimSpace(ref))
+		if err != nil {
+			return "", false
+		}
+		resolved.Fragment = ""
+		path, ok := local[resolved.String()]
+		return path, ok
+	}
+
+	for _, attr := range resourceAttributes {
+		doc.Find("[" + attr + "]").Each(func(_ int, s *goquery.Selection) {
+			if path, ok := localPath(s.AttrOr(attr, "")); ok {
+				s.SetAttr(attr, path)
+			}
+		})
+	}
+	// Inline CSS refers to resources relative to the page, like the HTML
+	unchanged := func(key string) string { return key }
+	doc.Find("style").Each(func(_ int, s *goquery.Selection) {
+		// Edit the raw text nodes, as SetText would escape the CSS
+		for _, node := range s.Nodes {
+			for child := node.FirstChild; child != nil; child = child.NextSibling {
+				if child.Type == html.TextNode {
+					child.Data = rewriteCSSRefs(child.Data, base, unchanged, local)
+				}
+			}
+		}
+	})
+	doc.Find("[style]").Each(func(_ int, s *goquery.Selection) {
+		s.SetAttr("style", rewriteCSSRefs(s.AttrOr("style", ""), base, unchanged, local))
+	})
+	doc.Find("[srcset]").Each(func(_ int, s *goquery.Selection) {
+		candidates := strings.Split(s.AttrOr("srcset", ""), ",")
+		changed := false
+		for i, candidate := range candidates {
+			fields := strings.Fields(candidate)
+			if len(fields) == 0 {
+				continue
+			}
+			if path, ok := localPath(fields[0]); ok {
+				fields[0] = path
+				candidates[i] = strings.Join(fields, " ")
+				changed = true
+			}
+		}
+		if changed {
+			s.SetAttr("srcset", strings.Join(candidates, ","))
+		}
+	})
+	return doc.Html()
+}
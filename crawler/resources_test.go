@@ -0,0 +1,118 @@
+package crawler
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"pathik/storage"
+	"strings"
+	"testing"
+)
+
+func TestRewriteStylesheet(t *testing.T) {
+	local := map[string]string{
+		"https://cdn.example.com/img/bg.png":    "page_files/cdn.example.com/img/bg.png",
+		"https://cdn.example.com/css/theme.css": "page_files/cdn.example.com/css/theme.css",
+		"https://fonts.example.net/a.woff2":     "page_files/fonts.example.net/a.woff2",
+	}
+	css := `@import "theme.css";
+@import url('https://cdn.example.com/css/theme.css');
+body { background: url(../img/bg.png) }
+.a { background: url( "/img/bg.png#x" ) }
+@font-face { src: url('https://fonts.example.net/a.woff2') format("woff2") }
+.b { background: url(data:image/png;base64,AAAA) }
+.c { background: url(missing.png) }`
+
+	got := rewriteStylesheet(css, "https://cdn.example.com/css/site.css", "page_files/cdn.example.com/css/site.css", local)
+	want := `@import "theme.css";
+@import url("theme.css");
+body { background: url("../img/bg.png") }
+.a { background: url("../img/bg.png") }
+@font-face { src: url("../../fonts.example.net/a.woff2") format("woff2") }
+.b { background: url(data:image/png;base64,AAAA) }
+.c { background: url(missing.png) }`
+	if got != want {
+		t.Fatalf("rewriteStylesheet =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRewriteResourceRefsInlineCSS(t *testing.T) {
+	local := map[string]string{"https://example.com/bg.png": "page_files/example.com/bg.png"}
+	html := `<html><head><style>body { background: url(/bg.png) }</style></head>` +
+		`<body><div style="background: url('bg.png')"></div><img src="bg.png"></body></html>`
+
+	got, err := rewriteResourceRefs(html, "https://example.com/page", local)
+	if err != nil {
+		t.Fatalf("rewriteResourceRefs: %v", err)
+	}
+	for _, want := range []string{
+		`body { background: url("page_files/example.com/bg.png") }`,
+		`style="background: url(&#34;page_files/example.com/bg.png&#34;)"`,
+		`src="page_files/example.com/bg.png"`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("rewritten HTML lacks %s:\n%s", want, got)
+		}
+	}
+}
+
+func TestSaveResourcesSkipsConflicts(t *testing.T) {
+	dir := t.TempDir()
+	backend := storage.NewLocalBackend(dir)
+	opts := storage.SaveOptions{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	resources := []capturedResource{
+		// A file where the next resource needs a directory
+		{URL: "https://cdn.example.com/assets", ContentType: "text/plain", Body: []byte("file")},
+		{URL: "https://cdn.example.com/assets/logo.png", ContentType: "image/png", Body: []byte("png")},
+		// Different URLs with the same sanitized key
+		{URL: "https://cdn.example.com/a%20b.js", ContentType: "text/javascript", Body: []byte("first")},
+		{URL: "https://cdn.example.com/a_b.js", ContentType: "text/javascript", Body: []byte("second")},
+		{URL: "https://cdn.example.com/site.css", ContentType: "text/css", Body: []byte("body { background: url(assets/logo.png) }")},
+	}
+	html := `<img src="https://cdn.example.com/assets/logo.png"><script src="https://cdn.example.com/a_b.js"></script>`
+
+	paths, rewritten, err := saveResources(context.Background(), backend, "https://example.com/", html, resources, opts)
+	if err != nil {
+		t.Fatalf("saveResources: %v", err)
+	}
+	if len(paths) != 3 {
+		t.Fatalf("saved %d resources, want 3 with the two conflicting ones skipped: %v", len(paths), paths)
+	}
+	// Skipped resources keep their original URLs
+	for _, want := range []string{`src="https://cdn.example.com/assets/logo.png"`, `src="https://cdn.example.com/a_b.js"`} {
+		if !strings.Contains(rewritten, want) {
+			t.Errorf("rewritten HTML lacks %s:\n%s", want, rewritten)
+		}
+	}
+	for _, p := range paths {
+		if filepath.Base(p) != "site.css" {
+			continue
+		}
+		css, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(css) != "body { background: url(assets/logo.png) }" {
+			t.Errorf("stylesheet = %q, want its reference to the unsaved logo kept", css)
+		}
+	}
+}
+
+func TestResourceCollectorSizeCap(t *testing.T) {
+	c := newResourceCollector(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	half := make([]byte, maxPageResourceBytes/2)
+	c.store(capturedResource{URL: "https://example.com/a", Body: half}, "https://example.com/")
+	c.store(capturedResource{URL: "https://example.com/b", Body: half}, "https://example.com/")
+	c.store(capturedResource{URL: "https://example.com/c", Body: []byte("x")}, "https://example.com/")
+	c.store(capturedResource{URL: "https://example.com/d"}, "https://example.com/")
+
+	var urls []string
+	for _, r := range c.list() {
+		urls = append(urls, r.URL)
+	}
+	if strings.Join(urls, " ") != "https://example.com/a https://example.com/b https://example.com/d" {
+		t.Fatalf("kept %v, want the resources within the cap", urls)
+	}
+}
@@ -0,0 +1,145 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// documentResponse is the HTTP response that delivered the main document
+type documentResponse struct {
+	StatusCode int         // HTTP status code
+	Header     http.Header // Response headers
+	URL        string      // URL the document was served from
+	RemoteIP   string      // Address the browser connected to, if known
+	StatusText string      // Reason phrase, empty over HTTP/2
+	Received   time.Time   // When the response headers arrived
+
+	RequestID proto.NetworkRequestID // CDP ID of the request, for its body
+	Request   documentRequest        // Request the response answered
+}
+
+// documentRequest is the request the browser sent for the main document
+type documentRequest struct {
+	Method string
+	URL    string
+	Header http.Header // Headers as the browser reported them
+}
+
+// responseTracker records the main document's response while a page loads
+type responseTracker struct {
+	mu   sync.Mutex
+	resp *documentResponse
+	// requests are the latest requests of the main frame's documents; a
+	// redirect reuses the ID of the request it answers
+	requests map[proto.NetworkRequestID]documentRequest
+	// peers are the addresses the main document and its redirects came from
+	peers []peerAddress
+	// chain are the URLs of the main document's HTTP redirects, from the
+	// first URL that redirected to the last target
+	chain []string
+}
+
+// peerAddress is an address the browser connected to for a URL
+type peerAddress struct {
+	URL string
+	IP  string
+}
+
+// trackDocumentResponse starts recording the responses of page's main frame
+// documents and returns the tracker and a func that stops it. It must run
+// before navigating.
+func trackDocumentResponse(ctx context.Context, page *rod.Page) (*responseTracker, func()) {
+	t := &responseTracker{requests: make(map[proto.NetworkRequestID]documentRequest)}
+	ctx, cancel := context.WithCancel(ctx)
+	wait := page.Context(ctx).EachEvent(func(e *proto.NetworkResponseReceived) {
+		if e.Type == proto.NetworkResourceTypeDocument && e.FrameID == page.FrameID {
+			t.responseReceived(e)
+		}
+	}, func(e *proto.NetworkRequestWillBeSent) {
+		if e.Type == proto.NetworkResourceTypeDocument && e.FrameID == page.FrameID {
+			t.requestSent(e)
+		}
+	})
+	go wait()
+	return t, cancel
+}
+
+// responseReceived records a response of the main frame's document
+func (t *responseTracker) responseReceived(e *proto.NetworkResponseReceived) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.resp = &documentResponse{
+		StatusCode: e.Response.Status,
+		Header:     cdpHeader(e.Response.Headers),
+		URL:        e.Response.URL,
+		RemoteIP:   e.Response.RemoteIPAddress,
+		StatusText: e.Response.StatusText,
+		Received:   time.Now(),
+		RequestID:  e.RequestID,
+		Request:    t.requests[e.RequestID],
+	}
+	t.peers = append(t.peers, peerAddress{URL: e.Response.URL, IP: e.Response.RemoteIPAddress})
+}
+
+// requestSent records a request of the main frame's document, along with
+// the redirect that led to it, if any
+func (t *responseTracker) requestSent(e *proto.NetworkRequestWillBeSent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.requests[e.RequestID] = documentRequest{
+		Method: e.Request.Method,
+		URL:    e.Request.URL,
+		Header: cdpHeader(e.Request.Headers),
+	}
+	// Redirect hops only show up as the response of the next request
+	if e.RedirectResponse != nil {
+		t.peers = append(t.peers, peerAddress{URL: e.RedirectResponse.URL, IP: e.RedirectResponse.RemoteIPAddress})
+		if len(t.chain) == 0 {
+			t.chain = append(t.chain, e.RedirectResponse.URL)
+		}
+		t.chain = append(t.chain, e.Request.URL)
+	}
+}
+
+// response returns the latest main document response, or nil if none has
+// been received
+func (t *responseTracker) response() *documentResponse {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.resp
+}
+
+// peerAddresses returns the addresses the main document and its redirects
+// were served from
+func (t *responseTracker) peerAddresses() []peerAddress {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]peerAddress(nil), t.peers...)
+}
+
+// cdpHeader converts headers reported by the browser. Repeated headers,
+// such as Set-Cookie, come joined by newlines and are split up again.
+func cdpHeader(headers proto.NetworkHeaders) http.Header {
+	header := make(http.Header, len(headers))
+	for name, value := range headers {
+		for _, v := range strings.Split(value.Str(), "\n") {
+			header.Add(name, v)
+		}
+	}
+	return header
+}
+
+// redirectChain returns the URLs the main document was redirected through,
+// starting with the URL that redirected first and ending with the final
+// one, or nil if it wasn't redirected
+func (t *responseTracker) redirectChain() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]string(nil), t.chain...)
+}
@@ -0,0 +1,65 @@
+package crawler
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// redirectHop is the event for a request the browser sends after being
+// redirected from the URL from
+func redirectHop(from, to, ip string) *proto.NetworkRequestWillBeSent {
+	return &proto.NetworkRequestWillBeSent{
+		RequestID:        "1",
+		Request:          &proto.NetworkRequest{Method: "GET", URL: to},
+		RedirectResponse: &proto.NetworkResponse{URL: from, Status: 301, RemoteIPAddress: ip},
+	}
+}
+
+func TestResponseTrackerRedirectChain(t *testing.T) {
+	tracker := &responseTracker{requests: make(map[proto.NetworkRequestID]documentRequest)}
+	tracker.requestSent(&proto.NetworkRequestWillBeSent{RequestID: "1", Request: &proto.NetworkRequest{Method: "GET", URL: "http://example.com/"}})
+	if chain := tracker.redirectChain(); chain != nil {
+		t.Fatalf("redirectChain before any redirect = %v, want nil", chain)
+	}
+
+	tracker.requestSent(redirectHop("http://example.com/", "https://example.com/", "93.184.216.34"))
+	tracker.requestSent(redirectHop("https://example.com/", "https://www.example.com/", "93.184.216.34"))
+	tracker.responseReceived(&proto.NetworkResponseReceived{
+		RequestID: "1",
+		Response:  &proto.NetworkResponse{URL: "https://www.example.com/", Status: 200, RemoteIPAddress: "93.184.216.35"},
+	})
+
+	wantChain := []string{"http://example.com/", "https://example.com/", "https://www.example.com/"}
+	if chain := tracker.redirectChain(); !reflect.DeepEqual(chain, wantChain) {
+		t.Fatalf("redirectChain = %v, want %v", chain, wantChain)
+	}
+	if err := checkRedirectCount(len(wantChain)-1, 2); err != nil {
+		t.Fatalf("2 redirects with a limit of 2: %v", err)
+	}
+	if err := checkRedirectCount(len(wantChain)-1, 1); !errors.Is(err, ErrTooManyRedirects) {
+		t.Fatalf("2 redirects with a limit of 1: error = %v, want ErrTooManyRedirects", err)
+	}
+
+	resp := tracker.response()
+	if resp.URL != "https://www.example.com/" || resp.StatusCode != 200 || resp.Request.URL != "https://www.example.com/" {
+		t.Fatalf("response = %+v, want the final 200 with its request", resp)
+	}
+	// Every hop's address is checked, not only the final one
+	if peers := tracker.peerAddresses(); len(peers) != 3 {
+		t.Fatalf("peerAddresses = %v, want the two redirects and the final response", peers)
+	}
+}
+
+func TestResponseTrackerRedirectChainIsCopied(t *testing.T) {
+	tracker := &responseTracker{requests: make(map[proto.NetworkRequestID]documentRequest)}
+	tracker.requestSent(redirectHop("http://a.example/", "http://b.example/", ""))
+
+	chain := tracker.redirectChain()
+	chain[0] = "changed"
+	if tracker.redirectChain()[0] != "http://a.example/" {
+		t.Fatal("redirectChain returned the tracker's own slice")
+	}
+}
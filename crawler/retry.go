@@ -0,0 +1,202 @@
+package crawler
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-rod/rod"
+)
+
+// Retry timing limits
+const (
+	defaultMaxBackoff = 30 * time.Second // Default cap on a single backoff delay
+	maxRetryAfter     = 5 * time.Minute  // Longest Retry-After that is honored
+)
+
+// RetryBackoff spaces retries out exponentially: retry n waits
+// Base * 2^(n-1) plus a random fraction of that, capped at Max
+type RetryBackoff struct {
+	// Base is the delay before the first retry. Zero means
+	// CrawlOptions.RetryDelay.
+	Base time.Duration
+	// Max caps any single delay. Zero means 30s.
+	Max time.Duration
+	// Jitter is the largest random fraction of the delay added to it, from
+	// 0 to 1, so clients retrying together spread out
+	Jitter float64
+}
+
+// validate rejects negative durations and out of range jitter
+func (b *RetryBackoff) validate() error {
+	if b == nil {
+		return nil
+	}
+	if b.Base < 0 || b.Max < 0 {
+		return fmt.Errorf("retry backoff durations must not be negative")
+	}
+	if b.Jitter < 0 || b.Jitter > 1 {
+		return fmt.Errorf("retry backoff jitter must be between 0 and 1")
+	}
+	return nil
+}
+
+// delay returns the wait before retry number attempt, counting from 1
+func (b *RetryBackoff) delay(attempt int, base time.Duration) time.Duration {
+	if b.Base > 0 {
+		base = b.Base
+	}
+	max := b.Max
+	if max == 0 {
+		max = defaultMaxBackoff
+	}
+
+	d := base
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if b.Jitter > 0 {
+		d += time.Duration(rand.Float64() * b.Jitter * float64(d))
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// statusError reports a main document response with an HTTP error status
+type statusError struct {
+	StatusCode int
+	RetryAfter time.Duration // Delay requested by the server, zero if none
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("server responded with status %d", e.StatusCode)
+}
+
+// checkResponse turns error responses into a statusError, carrying the
+// server's Retry-After delay for throttling responses
+func checkResponse(resp *documentResponse) error {
+	if resp == nil || resp.StatusCode < 400 {
+		return nil
+	}
+	err := &statusError{StatusCode: resp.StatusCode}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		err.RetryAfter, _ = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	}
+	return err
+}
+
+// permanentNavigationErrors are the Chrome network errors that retrying
+// can't fix
+var permanentNavigationErrors = map[string]bool{
+	"net::ERR_NAME_NOT_RESOLVED":        true,
+	"net::ERR_INVALID_URL":              true,
+	"net::ERR_UNKNOWN_URL_SCHEME":       true,
+	"net::ERR_DISALLOWED_URL_SCHEME":    true,
+	"net::ERR_UNSAFE_PORT":              true,
+	"net::ERR_BLOCKED_BY_CLIENT":        true,
+	"net::ERR_BLOCKED_BY_ADMINISTRATOR": true,
+}
+
+// FetchError is returned when a page couldn't be fetched, either because
+// every attempt failed or because the failure was permanent
+type FetchError struct {
+	URL        string // URL that was fetched
+	StatusCode int    // HTTP status of the last response, zero if none
+	Retryable  bool   // Whether the last failure was transient
+	Attempts   int    // Number of attempts made
+	Err        error  // Error of the last attempt
+}
+
+func (e *FetchError) Error() string {
+	if e.Attempts == 1 {
+		return fmt.Sprintf("failed to fetch %s: %v", e.URL, e.Err)
+	}
+	return fmt.Sprintf("failed to fetch %s after %d attempts: %v", e.URL, e.Attempts, e.Err)
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// classifyError returns the HTTP status behind err, if any, and whether
+// another attempt could succeed. Timeouts, 5xx, 408, 429 and connection
+// errors are transient; DNS failures and other 4xx responses are not.
+func classifyError(err error) (statusCode int, retryable bool) {
+	var se *statusError
+	if errors.As(err, &se) {
+		switch {
+		case se.StatusCode == http.StatusRequestTimeout, se.StatusCode == http.StatusTooManyRequests:
+			return se.StatusCode, true
+		case se.StatusCode < 500:
+			return se.StatusCode, false
+		}
+		return se.StatusCode, true
+	}
+
+	// Retrying could hit a rebound address again
+	if errors.Is(err, ErrPrivateAddress) {
+		return 0, false
+	}
+	// Following the redirects again would end the same way
+	if errors.Is(err, ErrTooManyRedirects) || errors.Is(err, ErrNavigationRejected) {
+		return 0, false
+	}
+	// The page doesn't have the form the actions expect
+	var actionErr *ActionError
+	if errors.As(err, &actionErr) {
+		return 0, false
+	}
+
+	var navErr *rod.NavigationError
+	if errors.As(err, &navErr) && permanentNavigationErrors[navErr.Reason] {
+		return 0, false
+	}
+	return 0, true
+}
+
+// parseRetryAfter parses a Retry-After value given either in seconds or as
+// an HTTP date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if d := date.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// retryWait returns how long to wait before retry number attempt after err
+func retryWait(opts CrawlOptions, attempt int, err error) time.Duration {
+	wait := opts.RetryDelay
+	if opts.RetryBackoff != nil {
+		wait = opts.RetryBackoff.delay(attempt, opts.RetryDelay)
+	}
+
+	// The server knows best when it will accept requests again
+	var se *statusError
+	if errors.As(err, &se) && se.RetryAfter > wait {
+		wait = se.RetryAfter
+		if wait > maxRetryAfter {
+			wait = maxRetryAfter
+		}
+	}
+	return wait
+}
@@ -0,0 +1,183 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-rod/rod"
+)
+
+func TestRetryBackoffDelay(t *testing.T) {
+	tests := []struct {
+		name    string
+		backoff RetryBackoff
+		attempt int
+		base    time.Duration
+		want    time.Duration
+	}{
+		{"first retry waits base", RetryBackoff{}, 1, time.Second, time.Second},
+		{"doubles", RetryBackoff{}, 2, time.Second, 2 * time.Second},
+		{"doubles again", RetryBackoff{}, 4, time.Second, 8 * time.Second},
+		{"own base", RetryBackoff{Base: 100 * time.Millisecond}, 3, time.Second, 400 * time.Millisecond},
+		{"default cap", RetryBackoff{}, 10, time.Second, defaultMaxBackoff},
+		{"own cap", RetryBackoff{Max: 5 * time.Second}, 4, time.Second, 5 * time.Second},
+		{"large attempt doesn't overflow", RetryBackoff{}, 100, time.Second, defaultMaxBackoff},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.backoff.delay(tt.attempt, tt.base); got != tt.want {
+				t.Errorf("delay(%d, %v) = %v, want %v", tt.attempt, tt.base, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryBackoffJitter(t *testing.T) {
+	backoff := RetryBackoff{Base: time.Second, Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		d := backoff.delay(2, 0)
+		if d < 2*time.Second || d > 3*time.Second {
+			t.Fatalf("delay with jitter 0.5 = %v, want between 2s and 3s", d)
+		}
+	}
+	capped := RetryBackoff{Base: time.Second, Max: 2 * time.Second, Jitter: 1}
+	for i := 0; i < 100; i++ {
+		if d := capped.delay(2, 0); d > 2*time.Second {
+			t.Fatalf("delay with jitter = %v, over the 2s cap", d)
+		}
+	}
+}
+
+func TestRetryBackoffValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		backoff *RetryBackoff
+		valid   bool
+	}{
+		{"nil", nil, true},
+		{"zero", &RetryBackoff{}, true},
+		{"full jitter", &RetryBackoff{Jitter: 1}, true},
+		{"negative base", &RetryBackoff{Base: -time.Second}, false},
+		{"negative max", &RetryBackoff{Max: -time.Second}, false},
+		{"negative jitter", &RetryBackoff{Jitter: -0.1}, false},
+		{"jitter over 1", &RetryBackoff{Jitter: 1.5}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.backoff.validate(); (err == nil) != tt.valid {
+				t.Errorf("validate() = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"seconds", "120", 2 * time.Minute, true},
+		{"zero seconds", "0", 0, true},
+		{"spaces", " 5 ", 5 * time.Second, true},
+		{"negative seconds", "-5", 0, false},
+		{"future date", now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second, true},
+		{"past date", now.Add(-time.Hour).Format(http.TimeFormat), 0, true},
+		{"empty", "", 0, false},
+		{"garbage", "soon", 0, false},
+		{"fractional", "1.5", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseRetryAfter(tt.value, now)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("parseRetryAfter(%q) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestRetryWait(t *testing.T) {
+	throttled := &statusError{StatusCode: http.StatusTooManyRequests, RetryAfter: 10 * time.Second}
+	tests := []struct {
+		name    string
+		opts    CrawlOptions
+		attempt int
+		err     error
+		want    time.Duration
+	}{
+		{"fixed delay", CrawlOptions{RetryDelay: time.Second}, 3, nil, time.Second},
+		{"backoff", CrawlOptions{RetryDelay: time.Second, RetryBackoff: &RetryBackoff{}}, 3, nil, 4 * time.Second},
+		{"longer Retry-After wins", CrawlOptions{RetryDelay: time.Second}, 1, throttled, 10 * time.Second},
+		{"shorter Retry-After loses", CrawlOptions{RetryDelay: time.Minute}, 1, throttled, time.Minute},
+		{"Retry-After capped", CrawlOptions{RetryDelay: time.Second}, 1, &statusError{StatusCode: 503, RetryAfter: time.Hour}, maxRetryAfter},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryWait(tt.opts, tt.attempt, tt.err); got != tt.want {
+				t.Errorf("retryWait = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckResponseRetryAfter(t *testing.T) {
+	resp := &documentResponse{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"30"}}}
+	se, ok := checkResponse(resp).(*statusError)
+	if !ok || se.RetryAfter != 30*time.Second {
+		t.Fatalf("checkResponse = %#v, want a 429 statusError waiting 30s", checkResponse(resp))
+	}
+	if err := checkResponse(&documentResponse{StatusCode: http.StatusOK}); err != nil {
+		t.Fatalf("checkResponse(200) = %v, want nil", err)
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		status    int
+		retryable bool
+	}{
+		{"500", &statusError{StatusCode: 500}, 500, true},
+		{"503", &statusError{StatusCode: 503}, 503, true},
+		{"408", &statusError{StatusCode: 408}, 408, true},
+		{"429", &statusError{StatusCode: 429}, 429, true},
+		{"404", &statusError{StatusCode: 404}, 404, false},
+		{"403", &statusError{StatusCode: 403}, 403, false},
+		{"wrapped status", fmt.Errorf("error loading page: %w", &statusError{StatusCode: 502}), 502, true},
+		{"timeout", context.DeadlineExceeded, 0, true},
+		{"connection reset", &rod.NavigationError{Reason: "net::ERR_CONNECTION_RESET"}, 0, true},
+		{"DNS failure", &rod.NavigationError{Reason: "net::ERR_NAME_NOT_RESOLVED"}, 0, false},
+		{"blocked by client", fmt.Errorf("navigate: %w", &rod.NavigationError{Reason: "net::ERR_BLOCKED_BY_CLIENT"}), 0, false},
+		{"private address", fmt.Errorf("https://a.example/: %w 10.0.0.1", ErrPrivateAddress), 0, false},
+		{"too many redirects", fmt.Errorf("%w: more than 10", ErrTooManyRedirects), 0, false},
+		{"refused navigation", fmt.Errorf("%w to http://10.0.0.1/", ErrNavigationRejected), 0, false},
+		{"failed action", &ActionError{Err: errors.New("no such element")}, 0, false},
+		{"unknown", errors.New("something broke"), 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, retryable := classifyError(tt.err)
+			if status != tt.status || retryable != tt.retryable {
+				t.Errorf("classifyError(%v) = %d, %v, want %d, %v", tt.err, status, retryable, tt.status, tt.retryable)
+			}
+		})
+	}
+}
+
+func TestFetchErrorUnwraps(t *testing.T) {
+	err := &FetchError{URL: "https://example.com/", Attempts: 3, Err: fmt.Errorf("%w: more than 10", ErrTooManyRedirects)}
+	if !errors.Is(err, ErrTooManyRedirects) {
+		t.Fatalf("errors.Is(%v, ErrTooManyRedirects) = false", err)
+	}
+	if want := "failed to fetch https://example.com/ after 3 attempts: too many redirects: more than 10"; err.Error() != want {
+		t.Fatalf("Error() = %q, want %q", err.Error(), want)
+	}
+}
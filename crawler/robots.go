@@ -0,0 +1,390 @@
+package crawler
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// ErrDisallowedByRobots is returned when robots.txt forbids crawling a URL
+var ErrDisallowedByRobots = errors.New("disallowed by robots.txt")
+
+// ErrRobotsUnavailable is returned when a host's robots.txt can't be
+// fetched because of a network error, so whether a URL may be crawled is
+// unknown for now
+var ErrRobotsUnavailable = errors.New("robots.txt unavailable")
+
+const (
+	robotsUserAgent  = "pathik"         // Product token matched against User-agent groups
+	robotsDefaultTTL = time.Hour        // How long a fetched robots.txt is trusted
+	robotsMaxSize    = 500 * 1024       // RFC 9309 requires parsing at least 500 KiB
+	robotsTimeout    = 10 * time.Second // Timeout for fetching robots.txt
+	robotsAttempts   = 2                // Tries before a network error is given up on
+	robotsRetryWait  = time.Second      // Wait between the tries
+)
+
+// defaultRobotsChecker is used when CrawlOptions.RobotsChecker is nil
+var defaultRobotsChecker = NewRobotsChecker(robotsDefaultTTL)
+
+// RobotsChecker fetches, parses and caches robots.txt files per host
+type RobotsChecker struct {
+	mu     sync.Mutex
+	ttl    time.Duration
+	cache  map[string]*robotsRules
+	client *http.Client
+}
+
+// robotsRules is the parsed group of a robots.txt that applies to us
+type robotsRules struct {
+	rules      []robotsRule
+	crawlDelay time.Duration
+	fetchedAt  time.Time
+}
+
+// robotsRule is a single Allow or Disallow line
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+// NewRobotsChecker creates a checker that caches each host's robots.txt for ttl
+func NewRobotsChecker(ttl time.Duration) *RobotsChecker {
+	if ttl <= 0 {
+		ttl = robotsDefaultTTL
+	}
+	return &RobotsChecker{
+		ttl:    ttl,
+		cache:  make(map[string]*robotsRules),
+		client: &http.Client{Timeout: robotsTimeout},
+	}
+}
+
+// Allowed reports whether robots.txt permits crawling rawURL
+func (c *RobotsChecker) Allowed(ctx context.Context, rawURL string) (bool, error) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return false, fmt.Errorf("invalid URL format: %v", err)
+	}
+	rules, err := c.rulesFor(ctx, parsedURL, "", CrawlOptions{})
+	if err != nil {
+		return false, err
+	}
+	return rules.allowed(robotsPath(parsedURL)), nil
+}
+
+// CrawlDelay returns the Crawl-delay robots.txt requests for the host of rawURL
+func (c *RobotsChecker) CrawlDelay(ctx context.Context, rawURL string) (time.Duration, error) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return 0, fmt.Errorf("invalid URL format: %v", err)
+	}
+	rules, err := c.rulesFor(ctx, parsedURL, "", CrawlOptions{})
+	if err != nil {
+		return 0, err
+	}
+	return rules.crawlDelay, nil
+}
+
+// rulesFor returns the cached rules for the URL's host, fetching them
+// through proxy, or opts.ProxyPool without one, if missing or expired. When
+// the host can't be reached, expired rules are kept until it can be.
+func (c *RobotsChecker) rulesFor(ctx context.Context, u *url.URL, proxy string, opts CrawlOptions) (*robotsRules, error) {
+	key := u.Scheme + "://" + u.Host
+
+	c.mu.Lock()
+	cached, ok := c.cache[key]
+	c.mu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < c.ttl {
+		return cached, nil
+	}
+
+	if proxy == "" && opts.ProxyPool != nil {
+		proxy = opts.ProxyPool.Get(u.Host)
+	}
+	rules, err := c.fetch(ctx, key+"/robots.txt", proxy, opts)
+	if errors.Is(err, ErrRobotsUnavailable) && ok {
+		opts.logger().Warn("Using expired robots.txt", "url", key+"/robots.txt", "error", err)
+		return cached, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.cache[key] = rules
+	c.mu.Unlock()
+	return rules, nil
+}
+
+// fetch downloads and parses a robots.txt through proxy following RFC 9309:
+// a missing file (4xx) allows everything while a server error (5xx)
+// disallows everything. A network error is temporary, so it's retried and
+// then returned as ErrRobotsUnavailable rather than cached.
+func (c *RobotsChecker) fetch(ctx context.Context, robotsURL string, proxy string, opts CrawlOptions) (*robotsRules, error) {
+	logger := opts.logger()
+	disallowAll := &robotsRules{
+		rules:     []robotsRule{{allow: false, pattern: "/"}},
+		fetchedAt: time.Now(),
+	}
+
+	client := c.clientFor(proxy, opts)
+	var resp *http.Response
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, robotsURL, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create robots.txt request: %v", err)
+		}
+		req.Header.Set("User-Agent", robotsUserAgent)
+
+		resp, err = client.Do(req)
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		// A redirect to a rejected URL won't change on retry
+		if errors.Is(err, ErrNavigationRejected) || errors.Is(err, ErrTooManyRedirects) {
+			return nil, fmt.Errorf("failed to fetch %s: %w", robotsURL, err)
+		}
+		if attempt == robotsAttempts {
+			return nil, fmt.Errorf("%w: %s: %v", ErrRobotsUnavailable, robotsURL, err)
+		}
+		logger.Warn("Could not fetch robots.txt, retrying", "url", robotsURL, "error", err)
+		if err := sleepCtx(ctx, robotsRetryWait); err != nil {
+			return nil, err
+		}
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 500:
+		logger.Warn("robots.txt returned a server error", "url", robotsURL, "status", resp.StatusCode)
+		return disallowAll, nil
+	case resp.StatusCode >= 400:
+		return &robotsRules{fetchedAt: time.Now()}, nil
+	}
+
+	rules := parseRobots(io.LimitReader(resp.Body, robotsMaxSize), robotsUserAgent)
+	rules.fetchedAt = time.Now()
+	return rules, nil
+}
+
+// clientFor returns the client fetching robots.txt files through proxy,
+// which validates every redirect with the URL checks of opts. HTTP(S) and
+// SOCKS5 proxies are used; remote browsers and SOCKS4 proxies, which Go's
+// client can't speak, fetch from this machine.
+func (c *RobotsChecker) clientFor(proxy string, opts CrawlOptions) *http.Client {
+	client := *c.client
+	client.CheckRedirect = checkHTTPRedirect(opts)
+	if transport := proxyTransport(proxy); transport != nil {
+		client.Transport = transport
+	}
+	return &client
+}
+
+// parseRobots extracts the rules of the group matching agent's product token,
+// in any case, falling back to the "*" group. Multiple groups for the same
+// agent are merged.
+func parseRobots(r io.Reader, agent string) *robotsRules {
+	type group struct {
+		agents     []string
+		rules      []robotsRule
+		crawlDelay time.Duration
+	}
+
+	var groups []*group
+	var current *group
+	inRules := false
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			// A user-agent line after rules starts a new group
+			if current == nil || inRules {
+				current = &group{}
+				groups = append(groups, current)
+				inRules = false
+			}
+			// An empty token names no crawler, so it mustn't match ours
+			if token := robotsProductToken(value); token != "" {
+				current.agents = append(current.agents, token)
+			}
+		case "allow", "disallow":
+			if current == nil {
+				continue
+			}
+			inRules = true
+			if value == "" {
+				continue // An empty rule matches nothing
+			}
+			current.rules = append(current.rules, robotsRule{allow: key == "allow", pattern: value})
+		case "crawl-delay":
+			if current == nil {
+				continue
+			}
+			inRules = true
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+				current.crawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		}
+	}
+
+	agent = robotsProductToken(agent)
+	merge := func(match func(string) bool) *robotsRules {
+		var rules *robotsRules
+		for _, g := range groups {
+			for _, a := range g.agents {
+				if match(a) {
+					if rules == nil {
+						rules = &robotsRules{}
+					}
+					rules.rules = append(rules.rules, g.rules...)
+					if g.crawlDelay > rules.crawlDelay {
+						rules.crawlDelay = g.crawlDelay
+					}
+					break
+				}
+			}
+		}
+		return rules
+	}
+
+	if rules := merge(func(a string) bool { return a != "*" && a == agent }); rules != nil {
+		return rules
+	}
+	if rules := merge(func(a string) bool { return a == "*" }); rules != nil {
+		return rules
+	}
+	return &robotsRules{}
+}
+
+// robotsProductToken returns the lower-cased product token of a user agent
+// or User-agent value, e.g. "pathik" for "Pathik/1.0 (+https://...)", which
+// groups are matched on
+func robotsProductToken(agent string) string {
+	token, _, _ := strings.Cut(strings.TrimSpace(agent), "/")
+	if fields := strings.Fields(token); len(fields) > 0 {
+		return strings.ToLower(fields[0])
+	}
+	return ""
+}
+
+// allowed applies the longest-match rule; on a tie Allow wins
+func (r *robotsRules) allowed(path string) bool {
+	allow := true
+	longest := -1
+	for _, rule := range r.rules {
+		if !robotsPatternMatch(rule.pattern, path) {
+			continue
+		}
+		if len(rule.pattern) > longest || (len(rule.pattern) == longest && rule.allow) {
+			longest = len(rule.pattern)
+			allow = rule.allow
+		}
+	}
+	return allow
+}
+
+// robotsPatternMatch matches a robots.txt path pattern supporting the "*"
+// wildcard and the "$" end anchor
+func robotsPatternMatch(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	rest := path[len(parts[0]):]
+	if len(parts) == 1 {
+		return !anchored || rest == ""
+	}
+
+	// Match middle parts left to right, leaving the last for the anchor check
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(rest, part)
+		if i < 0 {
+			return false
+		}
+		rest = rest[i+len(part):]
+	}
+	last := parts[len(parts)-1]
+	if anchored {
+		return strings.HasSuffix(rest, last)
+	}
+	return strings.Contains(rest, last)
+}
+
+// robotsPath returns the path and query robots.txt rules are matched against
+func robotsPath(u *url.URL) string {
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	return path
+}
+
+// checkRobots returns ErrDisallowedByRobots if robots.txt blocks rawURL and
+// slows the host's rate limiter down to any requested Crawl-delay. robots.txt
+// is fetched through proxy, if set, like the page.
+func checkRobots(ctx context.Context, rawURL string, proxy string, opts CrawlOptions) error {
+	if opts.IgnoreRobots {
+		return nil
+	}
+	checker := opts.RobotsChecker
+	if checker == nil {
+		checker = defaultRobotsChecker
+	}
+
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL format: %v", err)
+	}
+	rules, err := checker.rulesFor(ctx, parsedURL, proxy, opts)
+	if err != nil {
+		return err
+	}
+	if !rules.allowed(robotsPath(parsedURL)) {
+		return fmt.Errorf("%s: %w", rawURL, ErrDisallowedByRobots)
+	}
+
+	delay := rules.crawlDelay
+	if delay <= 0 {
+		return nil
+	}
+	limiter := opts.RateLimiter
+	if limiter == nil {
+		limiter = defaultHostRateLimiter
+	}
+	host := hostOf(rawURL)
+	if rate.Every(delay) < limiter.Limiter(host).Limit() {
+		limiter.SetHostRate(host, rate.Every(delay), 1)
+	}
+	return nil
+}
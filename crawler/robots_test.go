@@ -0,0 +1,149 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRobotsNetworkErrorIsTemporary(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	unreachable, _ := url.Parse(server.URL + "/page")
+	server.Close()
+
+	checker := NewRobotsChecker(time.Hour)
+	_, err := checker.rulesFor(context.Background(), unreachable, "", CrawlOptions{})
+	if !errors.Is(err, ErrRobotsUnavailable) {
+		t.Fatalf("rulesFor error = %v, want ErrRobotsUnavailable", err)
+	}
+	if len(checker.cache) != 0 {
+		t.Fatalf("unreachable robots.txt was cached: %v", checker.cache)
+	}
+}
+
+func TestRobotsKeepsExpiredRulesWhileUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	unreachable, _ := url.Parse(server.URL + "/page")
+	server.Close()
+
+	checker := NewRobotsChecker(time.Hour)
+	expired := &robotsRules{
+		rules:     []robotsRule{{allow: false, pattern: "/private"}},
+		fetchedAt: time.Now().Add(-2 * time.Hour),
+	}
+	checker.cache[unreachable.Scheme+"://"+unreachable.Host] = expired
+
+	rules, err := checker.rulesFor(context.Background(), unreachable, "", CrawlOptions{})
+	if err != nil {
+		t.Fatalf("rulesFor: %v", err)
+	}
+	if rules != expired {
+		t.Fatalf("rulesFor = %+v, want the expired rules", rules)
+	}
+}
+
+func TestRobotsServerErrorDisallowsAll(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL + "/page")
+
+	rules, err := NewRobotsChecker(time.Hour).rulesFor(context.Background(), u, "", CrawlOptions{})
+	if err != nil {
+		t.Fatalf("rulesFor: %v", err)
+	}
+	if rules.allowed("/page") {
+		t.Fatal("5xx robots.txt allowed /page, want everything disallowed")
+	}
+}
+
+func TestRobotsRejectsPrivateRedirect(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://169.254.169.254/robots.txt", http.StatusFound)
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL + "/page")
+
+	_, err := NewRobotsChecker(time.Hour).rulesFor(context.Background(), u, "", CrawlOptions{})
+	if !errors.Is(err, ErrNavigationRejected) {
+		t.Fatalf("rulesFor error = %v, want ErrNavigationRejected", err)
+	}
+}
+
+func TestRobotsFetchesThroughProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+	}))
+	defer proxy.Close()
+	u, _ := url.Parse("http://example.invalid/private/page")
+
+	pool := NewProxyPool([]string{proxy.URL}, ProxyPoolOptions{})
+	rules, err := NewRobotsChecker(time.Hour).rulesFor(context.Background(), u, "", CrawlOptions{ProxyPool: pool})
+	if err != nil {
+		t.Fatalf("rulesFor: %v", err)
+	}
+	if proxied != "http://example.invalid/robots.txt" {
+		t.Fatalf("proxy got %q, want the robots.txt URL", proxied)
+	}
+	if rules.allowed("/private/page") {
+		t.Fatal("/private/page allowed, want the proxied rules applied")
+	}
+}
+
+func TestParseRobotsAgentMatching(t *testing.T) {
+	tests := []struct {
+		name    string
+		robots  string
+		allowed bool // Whether pathik may fetch /private
+	}{
+		{"own group", "User-agent: pathik\nDisallow: /private", false},
+		{"own group in other case", "User-agent: Pathik\nDisallow: /private", false},
+		{"own group with version", "User-agent: pathik/2.0\nDisallow: /private", false},
+		{"own group over wildcard", "User-agent: *\nDisallow: /\n\nUser-agent: pathik\nAllow: /", true},
+		{"wildcard", "User-agent: *\nDisallow: /private", false},
+		{"other crawler", "User-agent: googlebot\nDisallow: /private", true},
+		// Tokens that are part of ours don't name it
+		{"substring of ours", "User-agent: path\nDisallow: /private", true},
+		{"one letter", "User-agent: p\nDisallow: /private", true},
+		// A malformed group with no token must not apply to every crawler
+		{"empty agent", "User-agent:\nDisallow: /private", true},
+		{"empty agent before wildcard", "User-agent:\nDisallow: /private\n\nUser-agent: *\nAllow: /", true},
+		{"empty agent in own group", "User-agent:\nUser-agent: pathik\nDisallow: /private", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := parseRobots(strings.NewReader(tt.robots), robotsUserAgent)
+			if got := rules.allowed("/private"); got != tt.allowed {
+				t.Errorf("allowed(/private) = %v, want %v", got, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestRobotsProductToken(t *testing.T) {
+	tests := []struct {
+		agent string
+		want  string
+	}{
+		{"pathik", "pathik"},
+		{"Pathik/1.0 (+https://example.com/bot)", "pathik"},
+		{"  Googlebot  ", "googlebot"},
+		{"*", "*"},
+		{"", ""},
+		{"   ", ""},
+		{"/1.0", ""},
+	}
+	for _, tt := range tests {
+		if got := robotsProductToken(tt.agent); got != tt.want {
+			t.Errorf("robotsProductToken(%q) = %q, want %q", tt.agent, got, tt.want)
+		}
+	}
+}
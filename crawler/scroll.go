@@ -0,0 +1,82 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-rod/rod"
+)
+
+// Auto-scroll defaults
+const (
+	defaultMaxScrolls  = 20
+	defaultScrollDelay = time.Second
+)
+
+// AutoScrollOptions controls scrolling through infinite-scroll pages, which
+// only load more content as the reader nears the bottom
+type AutoScrollOptions struct {
+	// Enabled scrolls to the bottom of the page repeatedly before it is
+	// captured, until no new content loads
+	Enabled bool
+	// MaxScrolls caps the number of scrolls. Zero means 20.
+	MaxScrolls int
+	// Delay is the wait for new content after each scroll. Zero means 1s.
+	Delay time.Duration
+}
+
+// validate rejects negative limits
+func (o AutoScrollOptions) validate() error {
+	if o.MaxScrolls < 0 {
+		return fmt.Errorf("max scrolls must not be negative")
+	}
+	if o.Delay < 0 {
+		return fmt.Errorf("scroll delay must not be negative")
+	}
+	return nil
+}
+
+// scrollToBottomJS scrolls to the bottom of the page and returns its height
+const scrollToBottomJS = `() => {
+	const el = document.scrollingElement || document.documentElement
+	window.scrollTo(0, el.scrollHeight)
+	return el.scrollHeight
+}`
+
+// autoScroll scrolls page to the bottom until its height stops growing or
+// MaxScrolls is reached
+func autoScroll(ctx context.Context, page *rod.Page, url string, opts CrawlOptions) error {
+	if !opts.AutoScroll.Enabled {
+		return nil
+	}
+	maxScrolls := opts.AutoScroll.MaxScrolls
+	if maxScrolls == 0 {
+		maxScrolls = defaultMaxScrolls
+	}
+	delay := opts.AutoScroll.Delay
+	if delay == 0 {
+		delay = defaultScrollDelay
+	}
+
+	height := -1
+	for scrolls := 0; scrolls < maxScrolls; scrolls++ {
+		res, err := page.Eval(scrollToBottomJS)
+		if err != nil {
+			return fmt.Errorf("failed to scroll: %w", err)
+		}
+		// The height when scrolling again only grows if the last scroll
+		// loaded more content
+		newHeight := res.Value.Int()
+		if newHeight == height {
+			opts.logger().Debug("Reached end of page", "url", url, "scrolls", scrolls)
+			return nil
+		}
+		height = newHeight
+		if err := sleepCtx(ctx, delay); err != nil {
+			return err
+		}
+	}
+	opts.logger().Debug("Stopped scrolling after max scrolls", "url", url, "scrolls", maxScrolls)
+	return nil
+}
@@ -0,0 +1,83 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAutoScrollOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    AutoScrollOptions
+		wantErr bool
+	}{
+		{"defaults", AutoScrollOptions{Enabled: true}, false},
+		{"set", AutoScrollOptions{Enabled: true, MaxScrolls: 5, Delay: time.Second}, false},
+		{"negative max scrolls", AutoScrollOptions{Enabled: true, MaxScrolls: -1}, true},
+		{"negative delay", AutoScrollOptions{Enabled: true, Delay: -time.Second}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.opts.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAutoScroll(t *testing.T) {
+	requireBrowser(t)
+
+	// Each scroll to the bottom loads another screenful of items, up to 5
+	srv := serveHTML(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><body><div id="feed"></div>
+<script>
+let batches = 0
+function load() {
+	batches++
+	for (let i = 0; i < 5; i++) {
+		const item = document.createElement("div")
+		item.style.height = "400px"
+		item.textContent = "item " + batches + "." + i
+		document.getElementById("feed").appendChild(item)
+	}
+}
+load()
+window.addEventListener("scroll", () => {
+	if (batches < 5 && innerHeight + scrollY >= document.body.scrollHeight - 10) load()
+})
+</script>
+</body></html>`))
+	})
+
+	tests := []struct {
+		name       string
+		scroll     AutoScrollOptions
+		want       string
+		wantAbsent string
+	}{
+		{"disabled", AutoScrollOptions{}, "item 1.4", "item 2.0"},
+		{"until the end", AutoScrollOptions{Enabled: true, Delay: 200 * time.Millisecond}, "item 5.4", ""},
+		{"max scrolls", AutoScrollOptions{Enabled: true, MaxScrolls: 2, Delay: 200 * time.Millisecond}, "item 3.4", "item 4.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := localOptions()
+			opts.AutoScroll = tt.scroll
+			page, err := FetchPageWithOptions(context.Background(), srv.URL, "", opts)
+			if err != nil {
+				t.Fatalf("FetchPageWithOptions: %v", err)
+			}
+			if !strings.Contains(page, tt.want) {
+				t.Errorf("page is missing %q", tt.want)
+			}
+			if tt.wantAbsent != "" && strings.Contains(page, tt.wantAbsent) {
+				t.Errorf("page has %q, which needs more scrolling", tt.wantAbsent)
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/antchfx/xpath"
+	"github.com/go-rod/rod"
+)
+
+// SelectorType is the language of the selectors in CrawlOptions
+type SelectorType string
+
+const (
+	// CSSSelector selectors are CSS selectors, such as "article > h1"
+	CSSSelector SelectorType = "css"
+	// XPathSelector selectors are XPath 1.0 expressions, such as
+	// "//th[text()='Price']/following-sibling::td"
+	XPathSelector SelectorType = "xpath"
+)
+
+// Validate rejects unknown selector types
+func (t SelectorType) Validate() error {
+	switch t {
+	case "", CSSSelector, XPathSelector:
+		return nil
+	}
+	return fmt.Errorf("unsupported selector type %q, use %q or %q", t, CSSSelector, XPathSelector)
+}
+
+// validateSelectors rejects empty or malformed CSS selectors before a browser
+// is launched, so bad input yields a clear error instead of a go-rod failure
+func validateSelectors(opts CrawlOptions) error {
+	if err := opts.SelectorType.Validate(); err != nil {
+		return err
+	}
+	if opts.Selector != "" {
+		if err := validateSelectorOfType(opts.Selector, opts.SelectorType); err != nil {
+			return err
+		}
+	}
+	for name, selector := range opts.Selectors {
+		if err := validateSelectorOfType(selector, opts.SelectorType); err != nil {
+			return fmt.Errorf("selector %q: %w", name, err)
+		}
+	}
+	if err := validateSchema(opts.ExtractSchema, opts.SelectorType); err != nil {
+		return err
+	}
+	// Waits always take CSS selectors
+	for _, selector := range []string{opts.WaitForSelector, opts.WaitForSelectorHidden} {
+		if selector == "" {
+			continue
+		}
+		if err := validateSelector(selector); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateSelector checks a single CSS selector
+func validateSelector(selector string) error {
+	if strings.TrimSpace(selector) == "" {
+		return fmt.Errorf("empty CSS selector")
+	}
+	if _, err := cascadia.ParseGroup(selector); err != nil {
+		return fmt.Errorf("invalid CSS selector %q: %v", selector, err)
+	}
+	return nil
+}
+
+// validateSelectorOfType checks a single selector of type typ
+func validateSelectorOfType(selector string, typ SelectorType) error {
+	if typ != XPathSelector {
+		return validateSelector(selector)
+	}
+	if strings.TrimSpace(selector) == "" {
+		return fmt.Errorf("empty XPath expression")
+	}
+	if _, err := xpath.Compile(selector); err != nil {
+		return fmt.Errorf("invalid XPath expression %q: %v", selector, err)
+	}
+	return nil
+}
+
+// queryElements returns the elements of page matching selector of type
+// typ. Unlike page.Element it doesn't wait for a match to appear.
+func queryElements(page *rod.Page, selector string, typ SelectorType) (rod.Elements, error) {
+	var elements rod.Elements
+	var err error
+	if typ == XPathSelector {
+		elements, err = page.ElementsX(selector)
+	} else {
+		elements, err = page.Elements(selector)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %q: %w", selector, err)
+	}
+	return elements, nil
+}
+
+// selectorHiddenJS reports whether no element matching the selector argument
+// is rendered visibly
+const selectorHiddenJS = `(selector) => Array.from(document.querySelectorAll(selector)).every(el => {
+	const style = getComputedStyle(el)
+	const rect = el.getBoundingClientRect()
+	return style.display === 'none' || style.visibility === 'hidden' || (rect.width === 0 && rect.height === 0)
+})`
+
+// waitForSelectors blocks until the WaitForSelector element exists and the
+// WaitForSelectorHidden elements are gone. It reports whether it waited.
+func waitForSelectors(ctx context.Context, page *rod.Page, opts CrawlOptions) (bool, error) {
+	if opts.WaitForSelector == "" && opts.WaitForSelectorHidden == "" {
+		return false, nil
+	}
+
+	waiting := page.Timeout(opts.SelectorTimeout)
+	defer waiting.CancelTimeout()
+
+	if opts.WaitForSelector != "" {
+		if _, err := waiting.Element(opts.WaitForSelector); err != nil {
+			return true, selectorWaitError(ctx, opts.WaitForSelector, "appear", opts.SelectorTimeout, err)
+		}
+	}
+	if opts.WaitForSelectorHidden != "" {
+		if err := waiting.Wait(rod.Eval(selectorHiddenJS, opts.WaitForSelectorHidden)); err != nil {
+			return true, selectorWaitError(ctx, opts.WaitForSelectorHidden, "disappear", opts.SelectorTimeout, err)
+		}
+	}
+	return true, nil
+}
+
+// selectorWaitError describes a failed wait for selector
+func selectorWaitError(ctx context.Context, selector, event string, timeout time.Duration, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("selector %q did not %s within %v", selector, event, timeout)
+	}
+	return fmt.Errorf("failed waiting for selector %q to %s: %w", selector, event, err)
+}
+
+// captureSelections runs the configured selectors against the open page
+func captureSelections(page *rod.Page, opts CrawlOptions, capture *pageCapture) error {
+	if opts.Selector != "" {
+		matches, err := selectAll(page, opts.Selector, opts.SelectorType, opts.SelectText)
+		if err != nil {
+			return err
+		}
+		if len(matches) == 0 {
+			return fmt.Errorf("selector %q matched no elements", opts.Selector)
+		}
+		capture.Selected = matches
+	}
+
+	if len(opts.Selectors) > 0 {
+		// Query in a stable order so errors are deterministic
+		names := make([]string, 0, len(opts.Selectors))
+		for name := range opts.Selectors {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		capture.Selections = make(map[string][]string, len(names))
+		for _, name := range names {
+			matches, err := selectAll(page, opts.Selectors[name], opts.SelectorType, opts.SelectText)
+			if err != nil {
+				return fmt.Errorf("selector %q: %w", name, err)
+			}
+			capture.Selections[name] = matches
+		}
+	}
+
+	if len(opts.ExtractSchema) > 0 {
+		fields, err := extractFields(page, opts.ExtractSchema, opts.SelectorType)
+		if err != nil {
+			return err
+		}
+		capture.Fields = fields
+	}
+	return nil
+}
+
+// selectAll returns the outer HTML, or text when text is true, of every
+// element matching selector of type typ
+func selectAll(page *rod.Page, selector string, typ SelectorType, text bool) ([]string, error) {
+	elements, err := queryElements(page, selector, typ)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := make([]string, 0, len(elements))
+	for _, el := range elements {
+		var value string
+		if text {
+			value, err = el.Text()
+		} else {
+			value, err = el.HTML()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read match of %q: %w", selector, err)
+		}
+		matches = append(matches, value)
+	}
+	return matches, nil
+}
+
+// selectedMarkdown converts the matches of CrawlOptions.Selector to Markdown.
+// It returns an empty string when no selector was configured.
+func selectedMarkdown(capture *pageCapture, pageURL string, opts CrawlOptions) (string, error) {
+	if capture.Selected == nil {
+		return "", nil
+	}
+	if opts.SelectText {
+		return strings.Join(capture.Selected, "\n\n"), nil
+	}
+	return ConvertToMarkdownWithOptions(strings.Join(capture.Selected, "\n"), opts.Markdown.forPage(pageURL))
+}
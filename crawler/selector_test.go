@@ -0,0 +1,92 @@
+package crawler
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestValidateSelectors(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    CrawlOptions
+		wantErr bool
+	}{
+		{"none", CrawlOptions{}, false},
+		{"css", CrawlOptions{Selector: "article > h1", Selectors: map[string]string{"price": "td.price"}}, false},
+		{"xpath", CrawlOptions{SelectorType: XPathSelector, Selector: "//th[text()='Price']/following-sibling::td"}, false},
+		{"xpath schema", CrawlOptions{SelectorType: XPathSelector, ExtractSchema: map[string]string{"names[]": "//li/text()"}}, false},
+		{"unknown type", CrawlOptions{SelectorType: "jquery", Selector: "p"}, true},
+		{"malformed css", CrawlOptions{Selector: "div["}, true},
+		{"xpath as css", CrawlOptions{Selector: "//div"}, true},
+		{"malformed xpath", CrawlOptions{SelectorType: XPathSelector, Selector: "//div["}, true},
+		{"malformed xpath function", CrawlOptions{SelectorType: XPathSelector, Selectors: map[string]string{"n": "count(//li"}}, true},
+		{"empty xpath", CrawlOptions{SelectorType: XPathSelector, Selector: " "}, true},
+		{"malformed xpath schema", CrawlOptions{SelectorType: XPathSelector, ExtractSchema: map[string]string{"title": "//h1[@"}}, true},
+		// Waits always take CSS, whatever the selector type
+		{"css wait with xpath", CrawlOptions{SelectorType: XPathSelector, Selector: "//h1", WaitForSelector: "h1"}, false},
+		{"xpath wait", CrawlOptions{SelectorType: XPathSelector, Selector: "//h1", WaitForSelector: "//h1"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateSelectors(tt.opts); (err != nil) != tt.wantErr {
+				t.Errorf("validateSelectors = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSelectorTypes(t *testing.T) {
+	requireBrowser(t)
+
+	srv := serveHTML(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><body>
+<h1>Widget</h1>
+<table>
+<tr><th>Price</th><td class="price">$10</td></tr>
+<tr><th>Stock</th><td class="stock">3</td></tr>
+</table>
+<ul><li>red</li><li>blue</li></ul>
+</body></html>`))
+	})
+
+	// The same queries in both languages must scrape the same record
+	tests := []struct {
+		typ       SelectorType
+		selectors map[string]string
+		schema    map[string]string
+	}{
+		{
+			CSSSelector,
+			map[string]string{"price": "td.price", "colors": "li"},
+			map[string]string{"title": "h1", "stock": "td.stock", "colors[]": "li"},
+		},
+		{
+			XPathSelector,
+			map[string]string{"price": "//th[text()='Price']/following-sibling::td", "colors": "//li"},
+			map[string]string{"title": "//h1", "stock": "//th[text()='Stock']/following-sibling::td", "colors[]": "//ul/li"},
+		},
+	}
+	wantSelections := map[string][]string{"price": {"$10"}, "colors": {"red", "blue"}}
+	wantFields := map[string]interface{}{"title": "Widget", "stock": "3", "colors": []string{"red", "blue"}}
+	for _, tt := range tests {
+		t.Run(string(tt.typ), func(t *testing.T) {
+			opts := localOptions()
+			opts.SelectorType = tt.typ
+			opts.Selectors = tt.selectors
+			opts.ExtractSchema = tt.schema
+			opts.SelectText = true
+			result, err := CrawlToMemory(srv.URL, opts)
+			if err != nil {
+				t.Fatalf("CrawlToMemory: %v", err)
+			}
+			if !reflect.DeepEqual(result.Selections, wantSelections) {
+				t.Errorf("Selections = %v, want %v", result.Selections, wantSelections)
+			}
+			if !reflect.DeepEqual(result.Fields, wantFields) {
+				t.Errorf("Fields = %#v, want %#v", result.Fields, wantFields)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package crawler
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// Cookie is a cookie injected into the page before navigation, e.g. an
+// existing session cookie for crawling logged-in pages
+type Cookie struct {
+	Name  string
+	Value string
+	// Domain defaults to the host of the crawled URL. A leading dot makes
+	// the cookie apply to subdomains as well.
+	Domain   string
+	Path     string // Defaults to "/"
+	Secure   bool
+	HTTPOnly bool
+}
+
+// BasicAuth holds HTTP Basic Auth credentials for the crawled URL's host
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+// validateCookies ensures every cookie would actually be sent to pageURL, so
+// credentials are never set for unrelated domains
+func validateCookies(pageURL string, cookies []Cookie) error {
+	if len(cookies) == 0 {
+		return nil
+	}
+	parsedURL, err := url.Parse(pageURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL format: %v", err)
+	}
+	host := strings.ToLower(parsedURL.Hostname())
+
+	for _, c := range cookies {
+		if c.Name == "" {
+			return fmt.Errorf("cookie name must not be empty")
+		}
+		if c.Domain == "" {
+			continue
+		}
+		domain := strings.ToLower(strings.TrimPrefix(c.Domain, "."))
+		if host != domain && !strings.HasSuffix(host, "."+domain) {
+			return fmt.Errorf("cookie %q domain %s does not match %s", c.Name, c.Domain, host)
+		}
+	}
+	return nil
+}
+
+// preparePage applies per-page settings that must be in place before
+// navigation to pageURL
+func preparePage(page *rod.Page, pageURL string, opts CrawlOptions) error {
+	// Always emulate, even the desktop default, so a page doesn't take the
+	// window size of whichever browser, local or remote, it was opened in
+	if err := emulate(page, opts); err != nil {
+		return err
+	}
+
+	// Override the UA through CDP so the User-Agent request header changes,
+	// not just what scripts see
+	err := page.SetUserAgent(&proto.NetworkSetUserAgentOverride{
+		UserAgent:      pickUserAgent(opts),
+		AcceptLanguage: opts.acceptLanguage(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set user agent: %w", err)
+	}
+	if err := emulateLocale(page, opts); err != nil {
+		return err
+	}
+
+	if len(opts.Cookies) > 0 {
+		params := make([]*proto.NetworkCookieParam, 0, len(opts.Cookies))
+		for _, c := range opts.Cookies {
+			param := &proto.NetworkCookieParam{
+				Name:     c.Name,
+				Value:    c.Value,
+				Domain:   c.Domain,
+				Path:     c.Path,
+				Secure:   c.Secure,
+				HTTPOnly: c.HTTPOnly,
+			}
+			if param.Domain == "" {
+				param.URL = pageURL // Host-only cookie for the crawled URL
+			}
+			if param.Path == "" {
+				param.Path = "/"
+			}
+			params = append(params, param)
+		}
+		if err := page.SetCookies(params); err != nil {
+			return fmt.Errorf("failed to set cookies: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package crawler
+
+import (
+	"context"
+	"html"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPickUserAgent(t *testing.T) {
+	agents := []string{"agent-a", "agent-b"}
+	if got := pickUserAgent(CrawlOptions{UserAgent: "pinned", UserAgents: agents}); got != "pinned" {
+		t.Fatalf("pickUserAgent = %q, want the pinned agent", got)
+	}
+	for i := 0; i < 20; i++ {
+		if got := pickUserAgent(CrawlOptions{UserAgents: agents}); got != "agent-a" && got != "agent-b" {
+			t.Fatalf("pickUserAgent = %q, want one of %v", got, agents)
+		}
+	}
+}
+
+func TestUserAgentHeader(t *testing.T) {
+	requireBrowser(t)
+
+	srv := serveHTML(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html><body><p id=\"ua\">" + html.EscapeString(r.UserAgent()) + "</p></body></html>"))
+	})
+
+	agents := []string{"PathikTest/1.0 (agent-a)", "PathikTest/1.0 (agent-b)"}
+	opts := localOptions()
+	opts.UserAgents = agents
+	for i := 0; i < 3; i++ {
+		page, err := FetchPageWithOptions(context.Background(), srv.URL, "", opts)
+		if err != nil {
+			t.Fatalf("FetchPageWithOptions: %v", err)
+		}
+		if !strings.Contains(page, agents[0]) && !strings.Contains(page, agents[1]) {
+			t.Fatalf("server received none of %v:\n%s", agents, page)
+		}
+	}
+}
+
+func TestValidateCookies(t *testing.T) {
+	tests := []struct {
+		name    string
+		cookies []Cookie
+		wantErr bool
+	}{
+		{"none", nil, false},
+		{"host only", []Cookie{{Name: "session", Value: "abc"}}, false},
+		{"same host", []Cookie{{Name: "session", Domain: "app.example.com"}}, false},
+		{"parent domain", []Cookie{{Name: "session", Domain: ".example.com"}}, false},
+		{"case insensitive", []Cookie{{Name: "session", Domain: "EXAMPLE.com"}}, false},
+		{"other domain", []Cookie{{Name: "session", Domain: "evil.com"}}, true},
+		{"suffix without a dot", []Cookie{{Name: "session", Domain: "ple.com"}}, true},
+		{"subdomain of the host", []Cookie{{Name: "session", Domain: "sub.app.example.com"}}, true},
+		{"no name", []Cookie{{Value: "abc"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateCookies("https://app.example.com/dashboard", tt.cookies)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateCookies = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCookiesSentWithRequest(t *testing.T) {
+	requireBrowser(t)
+
+	srv := serveHTML(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if cookie, err := r.Cookie("session"); err == nil && cookie.Value == "abc" {
+			w.Write([]byte("<html><body><p>Welcome back</p></body></html>"))
+			return
+		}
+		w.Write([]byte("<html><body><p>Please log in</p></body></html>"))
+	})
+
+	opts := localOptions()
+	opts.Cookies = []Cookie{{Name: "session", Value: "abc"}}
+	result, err := CrawlToMemory(srv.URL, opts)
+	if err != nil {
+		t.Fatalf("CrawlToMemory: %v", err)
+	}
+	if !strings.Contains(result.HTML, "Welcome back") {
+		t.Fatalf("page without the session cookie:\n%s", result.HTML)
+	}
+
+	result, err = CrawlToMemory(srv.URL, localOptions())
+	if err != nil {
+		t.Fatalf("CrawlToMemory: %v", err)
+	}
+	if !strings.Contains(result.HTML, "Please log in") {
+		t.Fatalf("page with a cookie nobody set:\n%s", result.HTML)
+	}
+}
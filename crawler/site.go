@@ -0,0 +1,132 @@
+package crawler
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// CrawlSite crawls seed and follows the links it discovers up to maxDepth
+// hops away. By default only links on the seed's registered domain are
+// followed; SameHostOnly and URLFilter narrow the frontier further. Files
+// are written to opts.OutputDir.
+func CrawlSite(seed string, maxDepth int, opts CrawlOptions) []CrawlResult {
+	return CrawlSiteCtx(context.Background(), seed, maxDepth, opts)
+}
+
+// CrawlSiteCtx is like CrawlSite but stops once ctx is cancelled
+func CrawlSiteCtx(ctx context.Context, seed string, maxDepth int, opts CrawlOptions) []CrawlResult {
+	return CrawlSiteWithResult(ctx, seed, maxDepth, opts).Results
+}
+
+// SiteResult is the outcome of a CrawlSiteWithResult crawl
+type SiteResult struct {
+	Results   []CrawlResult // One per crawled page, level by level
+	Truncated bool          // Whether opts.MaxPages left discovered links uncrawled
+}
+
+// CrawlSiteWithResult is like CrawlSiteCtx but also reports whether the
+// crawl was cut short by opts.MaxPages
+func CrawlSiteWithResult(ctx context.Context, seed string, maxDepth int, opts CrawlOptions) SiteResult {
+	seedURL, err := url.Parse(seed)
+	if err != nil {
+		return SiteResult{Results: []CrawlResult{{URL: seed, Error: err}}}
+	}
+	seedURL.Fragment = ""
+
+	inScope := func(link *url.URL) bool {
+		if opts.SameHostOnly {
+			return strings.EqualFold(link.Hostname(), seedURL.Hostname())
+		}
+		return registeredDomain(link.Hostname()) == registeredDomain(seedURL.Hostname())
+	}
+
+	ctx, cancel := withBudget(ctx, opts)
+	defer cancel()
+	opts, closePool := withBrowserPool(ctx, opts)
+	defer closePool()
+
+	// Links are told apart by their normalized form, so variants such as
+	// http://A.com:80/ and http://a.com/ are crawled once
+	normalize := func(link string) string {
+		if normalized, err := NormalizeURLWithOptions(link, opts.Normalize); err == nil {
+			return normalized
+		}
+		return link
+	}
+	start := normalize(seedURL.String())
+	seen := map[string]bool{start: true}
+	frontier := []string{start}
+	var site SiteResult
+
+	for depth := 0; depth <= maxDepth && len(frontier) > 0 && ctx.Err() == nil; depth++ {
+		levelResults, levelHTML := crawlBatch(ctx, frontier, opts.OutputDir, opts)
+		site.Results = append(site.Results, levelResults...)
+		if depth == maxDepth {
+			break
+		}
+
+		var next []string
+		for i, html := range levelHTML {
+			if levelResults[i].Error != nil {
+				continue
+			}
+			// Relative links resolve against where the page ended up after
+			// its redirects, not the URL that was requested
+			for _, link := range extractLinks(html, finalURL(levelResults[i])) {
+				link = normalize(link)
+				parsedLink, err := url.Parse(link)
+				if err != nil || seen[link] || !inScope(parsedLink) {
+					continue
+				}
+				if opts.URLFilter != nil && !opts.URLFilter(link) {
+					continue
+				}
+				// Every page seen so far is crawled, so seen counts toward MaxPages
+				if opts.MaxPages > 0 && len(seen) >= opts.MaxPages {
+					site.Truncated = true
+					break
+				}
+				seen[link] = true
+				next = append(next, link)
+			}
+		}
+		frontier = next
+	}
+
+	return site
+}
+
+// finalURL returns the URL result's page was served from: the last hop of
+// its redirects, or the crawled URL if it wasn't redirected
+func finalURL(result CrawlResult) string {
+	if n := len(result.RedirectChain); n > 0 {
+		return result.RedirectChain[n-1]
+	}
+	return result.URL
+}
+
+// extractLinks returns the URLs of ExtractLinks, or none if the page can't
+// be parsed
+func extractLinks(htmlStr, pageURL string) []string {
+	links, err := ExtractLinks(htmlStr, pageURL)
+	if err != nil {
+		return nil
+	}
+	urls := make([]string, len(links))
+	for i, link := range links {
+		urls[i] = link.Href
+	}
+	return urls
+}
+
+// registeredDomain returns the eTLD+1 of host, or host itself when it has none
+func registeredDomain(host string) string {
+	domain, err := publicsuffix.EffectiveTLDPlusOne(strings.ToLower(host))
+	if err != nil {
+		return strings.ToLower(host)
+	}
+	return domain
+}
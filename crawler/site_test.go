@@ -0,0 +1,42 @@
+package crawler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFinalURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		result CrawlResult
+		want   string
+	}{
+		{"not redirected", CrawlResult{URL: "https://example.com/a"}, "https://example.com/a"},
+		{"redirected", CrawlResult{
+			URL:           "https://example.com/old",
+			RedirectChain: []string{"https://example.com/old", "https://example.com/new/", "https://www.example.com/new/"},
+		}, "https://www.example.com/new/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := finalURL(tt.result); got != tt.want {
+				t.Errorf("finalURL = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractLinksAfterRedirect(t *testing.T) {
+	// /docs redirected to /docs/v2/, so "intro" is /docs/v2/intro
+	result := CrawlResult{
+		URL:           "https://example.com/docs",
+		RedirectChain: []string{"https://example.com/docs", "https://example.com/docs/v2/"},
+	}
+	html := `<a href="intro">Intro</a><a href="../v1/">Old</a><a href="/about">About</a>`
+
+	got := extractLinks(html, finalURL(result))
+	want := []string{"https://example.com/docs/v2/intro", "https://example.com/docs/v1/", "https://example.com/about"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("extractLinks = %v, want %v", got, want)
+	}
+}
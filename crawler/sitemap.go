@@ -0,0 +1,196 @@
+package crawler
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	sitemapMaxSize  = 50 * 1024 * 1024 // Sitemap protocol limit for uncompressed files
+	sitemapMaxDepth = 5                // Max nesting of sitemap index files
+	sitemapTimeout  = 30 * time.Second // Timeout for fetching a single sitemap
+)
+
+// sitemapDocument covers both <urlset> and <sitemapindex> documents
+type sitemapDocument struct {
+	URLs     []sitemapEntry `xml:"url"`
+	Sitemaps []sitemapEntry `xml:"sitemap"`
+}
+
+// sitemapEntry is a <url> or <sitemap> element
+type sitemapEntry struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+// sitemapClient returns the client fetching sitemap files through proxy,
+// like the pages they list, which validates every redirect like the sitemap
+// URL itself. Without a proxy Go can use, the address connected to is
+// checked too.
+func sitemapClient(proxy string, opts CrawlOptions) *http.Client {
+	client := &http.Client{Timeout: sitemapTimeout, CheckRedirect: checkHTTPRedirect(opts)}
+	if transport := proxyTransport(proxy); transport != nil {
+		client.Transport = transport
+	} else {
+		client.Transport = &http.Transport{DialContext: guardedDial(opts), DisableKeepAlives: true}
+	}
+	return client
+}
+
+// CrawlSitemap enumerates the pages listed in a sitemap, following nested
+// sitemap indexes, and crawls them. Entries last modified before opts.Since
+// are skipped and at most opts.MaxURLs pages are crawled. Sitemaps are
+// fetched through the same proxies as the pages.
+func CrawlSitemap(sitemapURL string, opts CrawlOptions) ([]CrawlResult, error) {
+	return CrawlSitemapCtx(context.Background(), sitemapURL, opts)
+}
+
+// CrawlSitemapCtx is like CrawlSitemap but stops once ctx is cancelled
+func CrawlSitemapCtx(ctx context.Context, sitemapURL string, opts CrawlOptions) ([]CrawlResult, error) {
+	ctx, cancel := withBudget(ctx, opts)
+	defer cancel()
+	// One pool for the sitemaps and the pages, so failover carries over
+	opts = opts.withProxyPool()
+	urls, err := SitemapURLs(ctx, sitemapURL, opts)
+	if err != nil {
+		return nil, err
+	}
+	opts, closePool := withBrowserPool(ctx, opts)
+	defer closePool()
+
+	results, _ := crawlBatch(ctx, urls, opts.OutputDir, opts)
+	return results, nil
+}
+
+// SitemapURLs returns the page URLs listed in a sitemap, applying the Since
+// and MaxURLs options, without crawling them. As the sitemap protocol
+// requires, entries on another host than the sitemap listing them are
+// skipped. Sitemaps are fetched through opts.ProxyPool, or the proxies
+// LoadProxies returns without one.
+func SitemapURLs(ctx context.Context, sitemapURL string, opts CrawlOptions) ([]string, error) {
+	opts = opts.withProxyPool()
+	var urls []string
+	seen := make(map[string]bool)
+	if err := collectSitemap(ctx, sitemapURL, opts, 0, seen, &urls); err != nil {
+		return nil, err
+	}
+	return urls, nil
+}
+
+// collectSitemap appends the entries of one sitemap to urls, recursing into
+// child sitemaps of an index
+func collectSitemap(ctx context.Context, sitemapURL string, opts CrawlOptions, depth int, seen map[string]bool, urls *[]string) error {
+	if depth > sitemapMaxDepth {
+		return fmt.Errorf("sitemap index nesting exceeds %d levels at %s", sitemapMaxDepth, sitemapURL)
+	}
+
+	doc, err := fetchSitemap(ctx, sitemapURL, opts)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range doc.URLs {
+		if opts.MaxURLs > 0 && len(*urls) >= opts.MaxURLs {
+			return nil
+		}
+		loc := strings.TrimSpace(entry.Loc)
+		if loc == "" || seen[loc] || !modifiedSince(entry.LastMod, opts.Since) {
+			continue
+		}
+		if !sameSitemapHost(sitemapURL, loc) {
+			opts.logger().Debug("Skipping sitemap entry on another host", "sitemap", sitemapURL, "url", loc)
+			continue
+		}
+		seen[loc] = true
+		*urls = append(*urls, loc)
+	}
+
+	for _, child := range doc.Sitemaps {
+		if opts.MaxURLs > 0 && len(*urls) >= opts.MaxURLs {
+			return nil
+		}
+		loc := strings.TrimSpace(child.Loc)
+		if loc == "" || !modifiedSince(child.LastMod, opts.Since) {
+			continue
+		}
+		if !sameSitemapHost(sitemapURL, loc) {
+			opts.logger().Debug("Skipping child sitemap on another host", "sitemap", sitemapURL, "url", loc)
+			continue
+		}
+		if err := collectSitemap(ctx, loc, opts, depth+1, seen, urls); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sameSitemapHost reports whether loc is on the host of the sitemap listing
+// it, the only one a sitemap may list URLs for
+func sameSitemapHost(sitemapURL, loc string) bool {
+	return strings.EqualFold(hostOf(sitemapURL), hostOf(loc))
+}
+
+// fetchSitemap downloads and parses a sitemap through opts.ProxyPool, if
+// set, transparently decompressing gzipped files
+func fetchSitemap(ctx context.Context, sitemapURL string, opts CrawlOptions) (*sitemapDocument, error) {
+	if err := ValidateURLWithOptions(sitemapURL, opts); err != nil {
+		return nil, err
+	}
+	var proxy string
+	if opts.ProxyPool != nil {
+		proxy = opts.ProxyPool.Get(hostOf(sitemapURL))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sitemapURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sitemap request: %v", err)
+	}
+	resp, err := sitemapClient(proxy, opts).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch sitemap %s: %w", sitemapURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch sitemap %s: status %d", sitemapURL, resp.StatusCode)
+	}
+
+	// Detect gzip by its magic bytes rather than trusting the extension
+	body := bufio.NewReader(resp.Body)
+	var reader io.Reader = body
+	if magic, err := body.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress sitemap %s: %v", sitemapURL, err)
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	var doc sitemapDocument
+	if err := xml.NewDecoder(io.LimitReader(reader, sitemapMaxSize)).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to parse sitemap %s: %v", sitemapURL, err)
+	}
+	return &doc, nil
+}
+
+// modifiedSince reports whether a W3C datetime lastmod is not before since.
+// Entries without a parseable lastmod are always included.
+func modifiedSince(lastMod string, since time.Time) bool {
+	if since.IsZero() || lastMod == "" {
+		return true
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04Z07:00", "2006-01-02"} {
+		if t, err := time.Parse(layout, strings.TrimSpace(lastMod)); err == nil {
+			return !t.Before(since)
+		}
+	}
+	return true
+}
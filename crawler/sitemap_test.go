@@ -0,0 +1,159 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestFetchSitemapRejectsPrivateRedirect(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+	}))
+	defer server.Close()
+
+	// The test server itself is on loopback, so only it is allowed
+	opts := CrawlOptions{AllowedHosts: []string{"127.0.0.1"}}
+	_, err := fetchSitemap(context.Background(), server.URL+"/sitemap.xml", opts)
+	if !errors.Is(err, ErrNavigationRejected) {
+		t.Fatalf("fetchSitemap error = %v, want ErrNavigationRejected", err)
+	}
+}
+
+func TestFetchSitemapFollowsAllowedRedirect(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sitemap.xml", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/real.xml", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/real.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<urlset><url><loc>https://example.com/a</loc></url></urlset>`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	opts := CrawlOptions{AllowedHosts: []string{"127.0.0.1"}}
+	doc, err := fetchSitemap(context.Background(), server.URL+"/sitemap.xml", opts)
+	if err != nil {
+		t.Fatalf("fetchSitemap: %v", err)
+	}
+	if len(doc.URLs) != 1 || doc.URLs[0].Loc != "https://example.com/a" {
+		t.Fatalf("URLs = %+v, want the redirected sitemap's entry", doc.URLs)
+	}
+}
+
+func TestFetchSitemapLimitsRedirects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, r.URL.Path+"x", http.StatusFound)
+	}))
+	defer server.Close()
+
+	opts := CrawlOptions{AllowedHosts: []string{"127.0.0.1"}, MaxRedirects: 2}
+	_, err := fetchSitemap(context.Background(), server.URL+"/", opts)
+	if !errors.Is(err, ErrTooManyRedirects) {
+		t.Fatalf("fetchSitemap error = %v, want ErrTooManyRedirects", err)
+	}
+}
+
+func TestFetchSitemapThroughProxy(t *testing.T) {
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+		w.Write([]byte(`<urlset><url><loc>http://example.invalid/a</loc></url></urlset>`))
+	}))
+	defer proxy.Close()
+
+	t.Run("pool", func(t *testing.T) {
+		proxied = nil
+		opts := CrawlOptions{ProxyPool: NewProxyPool([]string{proxy.URL}, ProxyPoolOptions{})}
+		urls, err := SitemapURLs(context.Background(), "http://example.invalid/sitemap.xml", opts)
+		if err != nil {
+			t.Fatalf("SitemapURLs: %v", err)
+		}
+		if !reflect.DeepEqual(proxied, []string{"http://example.invalid/sitemap.xml"}) || len(urls) != 1 {
+			t.Fatalf("proxy got %v and listed %v, want the sitemap fetched through it", proxied, urls)
+		}
+	})
+	t.Run("environment", func(t *testing.T) {
+		proxied = nil
+		t.Setenv(proxiesEnv, proxy.URL)
+		if _, err := SitemapURLs(context.Background(), "http://example.invalid/sitemap.xml", CrawlOptions{}); err != nil {
+			t.Fatalf("SitemapURLs: %v", err)
+		}
+		if !reflect.DeepEqual(proxied, []string{"http://example.invalid/sitemap.xml"}) {
+			t.Fatalf("proxy got %v, want the sitemap fetched through PATHIK_PROXIES", proxied)
+		}
+	})
+}
+
+func TestSitemapClientChecksConnectedAddress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<urlset></urlset>`))
+	}))
+	defer server.Close()
+
+	// Whatever the host resolved to when the URL was validated, a direct
+	// fetch can't connect to a private address
+	_, err := sitemapClient("", CrawlOptions{}).Get(server.URL + "/sitemap.xml")
+	if !errors.Is(err, ErrPrivateAddress) {
+		t.Fatalf("Get error = %v, want ErrPrivateAddress", err)
+	}
+	resp, err := sitemapClient("", CrawlOptions{AllowedHosts: []string{"127.0.0.1"}}).Get(server.URL + "/sitemap.xml")
+	if err != nil {
+		t.Fatalf("Get from an allowed host: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestSitemapURLsSkipsOtherHosts(t *testing.T) {
+	var server *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sitemap.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<sitemapindex>
+<sitemap><loc>` + server.URL + `/pages.xml</loc></sitemap>
+<sitemap><loc>https://other.example/pages.xml</loc></sitemap>
+</sitemapindex>`))
+	})
+	mux.HandleFunc("/pages.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<urlset>
+<url><loc>` + server.URL + `/a</loc></url>
+<url><loc>https://other.example/b</loc></url>
+<url><loc>http://127.0.0.1.other.example/c</loc></url>
+<url><loc>` + server.URL + `/d</loc></url>
+</urlset>`))
+	})
+	server = httptest.NewServer(mux)
+	defer server.Close()
+
+	opts := CrawlOptions{AllowedHosts: []string{"127.0.0.1"}}
+	urls, err := SitemapURLs(context.Background(), server.URL+"/sitemap.xml", opts)
+	if err != nil {
+		t.Fatalf("SitemapURLs: %v", err)
+	}
+	if want := []string{server.URL + "/a", server.URL + "/d"}; !reflect.DeepEqual(urls, want) {
+		t.Fatalf("SitemapURLs = %v, want only the sitemap host's %v", urls, want)
+	}
+}
+
+func TestSameSitemapHost(t *testing.T) {
+	tests := []struct {
+		loc  string
+		same bool
+	}{
+		{"https://example.com/a", true},
+		{"http://example.com/a", true},
+		{"https://EXAMPLE.com/a", true},
+		{"https://example.com:8443/a", true},
+		{"https://www.example.com/a", false},
+		{"https://example.com.evil.example/a", false},
+		{"/relative", false},
+		{"::not a url", false},
+	}
+	for _, tt := range tests {
+		if got := sameSitemapHost("https://example.com/sitemap.xml", tt.loc); got != tt.same {
+			t.Errorf("sameSitemapHost(%q) = %v, want %v", tt.loc, got, tt.same)
+		}
+	}
+}
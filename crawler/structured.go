@@ -0,0 +1,154 @@
+package crawler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-rod/rod"
+)
+
+// listFieldSuffix ends the names of ExtractSchema fields that take the text
+// of every match, e.g. "titles[]"
+const listFieldSuffix = "[]"
+
+// ExtractStructured reads a record from page. schema maps field names to
+// CSS selectors; each field is the trimmed text of the first element its
+// selector matches, or empty if none does.
+func ExtractStructured(page *rod.Page, schema map[string]string) (map[string]string, error) {
+	return extractStructured(page, schema, CSSSelector)
+}
+
+// ExtractStructuredX is like ExtractStructured with XPath expressions in
+// place of CSS selectors
+func ExtractStructuredX(page *rod.Page, schema map[string]string) (map[string]string, error) {
+	return extractStructured(page, schema, XPathSelector)
+}
+
+// ExtractStructuredList is like ExtractStructured, but each field is the
+// trimmed text of every element its selector matches, e.g. a column of a
+// table or listing
+func ExtractStructuredList(page *rod.Page, schema map[string]string) (map[string][]string, error) {
+	return extractStructuredList(page, schema, CSSSelector)
+}
+
+// ExtractStructuredListX is like ExtractStructuredList with XPath
+// expressions in place of CSS selectors
+func ExtractStructuredListX(page *rod.Page, schema map[string]string) (map[string][]string, error) {
+	return extractStructuredList(page, schema, XPathSelector)
+}
+
+// extractStructured reads the first match of each field of schema, whose
+// selectors are of type typ
+func extractStructured(page *rod.Page, schema map[string]string, typ SelectorType) (map[string]string, error) {
+	fields := make(map[string]string, len(schema))
+	for _, name := range sortedFieldNames(schema) {
+		matches, err := matchTexts(page, schema[name], typ, true)
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %w", name, err)
+		}
+		fields[name] = ""
+		if len(matches) > 0 {
+			fields[name] = matches[0]
+		}
+	}
+	return fields, nil
+}
+
+// extractStructuredList reads every match of each field of schema, whose
+// selectors are of type typ
+func extractStructuredList(page *rod.Page, schema map[string]string, typ SelectorType) (map[string][]string, error) {
+	fields := make(map[string][]string, len(schema))
+	for _, name := range sortedFieldNames(schema) {
+		matches, err := matchTexts(page, schema[name], typ, false)
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %w", name, err)
+		}
+		fields[name] = matches
+	}
+	return fields, nil
+}
+
+// extractFields reads CrawlOptions.ExtractSchema, with selectors of type
+// typ, from page. Fields named with listFieldSuffix become a []string under
+// the name without it, the others a string.
+func extractFields(page *rod.Page, schema map[string]string, typ SelectorType) (map[string]interface{}, error) {
+	single := make(map[string]string)
+	lists := make(map[string]string)
+	for name, selector := range schema {
+		if list, ok := strings.CutSuffix(name, listFieldSuffix); ok {
+			lists[list] = selector
+		} else {
+			single[name] = selector
+		}
+	}
+
+	fields := make(map[string]interface{}, len(schema))
+	values, err := extractStructured(page, single, typ)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range values {
+		fields[name] = value
+	}
+	listValues, err := extractStructuredList(page, lists, typ)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range listValues {
+		fields[name] = value
+	}
+	return fields, nil
+}
+
+// validateSchema rejects ExtractSchema fields without a name, with a
+// malformed selector of type typ, or named twice as a single value and a
+// list
+func validateSchema(schema map[string]string, typ SelectorType) error {
+	for name, selector := range schema {
+		field, list := strings.CutSuffix(name, listFieldSuffix)
+		if strings.TrimSpace(field) == "" {
+			return fmt.Errorf("extract schema field %q has no name", name)
+		}
+		if _, ok := schema[field]; list && ok {
+			return fmt.Errorf("extract schema field %q is both a value and a list", field)
+		}
+		if err := validateSelectorOfType(selector, typ); err != nil {
+			return fmt.Errorf("extract schema field %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// matchTexts returns the trimmed text of the elements matching selector of
+// type typ, only the first one when first is true
+func matchTexts(page *rod.Page, selector string, typ SelectorType, first bool) ([]string, error) {
+	elements, err := queryElements(page, selector, typ)
+	if err != nil {
+		return nil, err
+	}
+	if first && len(elements) > 1 {
+		elements = elements[:1]
+	}
+
+	texts := make([]string, 0, len(elements))
+	for _, el := range elements {
+		text, err := el.Text()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read match of %q: %w", selector, err)
+		}
+		texts = append(texts, strings.TrimSpace(text))
+	}
+	return texts, nil
+}
+
+// sortedFieldNames returns the names of schema in a stable order, so errors
+// are deterministic
+func sortedFieldNames(schema map[string]string) []string {
+	names := make([]string, 0, len(schema))
+	for name := range schema {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,74 @@
+package crawler
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// textBlockElements start a new paragraph in plain text
+var textBlockElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true,
+	"br": true, "dd": true, "div": true, "dl": true, "dt": true,
+	"figcaption": true, "figure": true, "footer": true, "h1": true,
+	"h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"header": true, "hr": true, "li": true, "main": true, "nav": true,
+	"ol": true, "p": true, "pre": true, "section": true, "table": true,
+	"td": true, "th": true, "tr": true, "ul": true,
+}
+
+// textSkippedElements never contribute text
+var textSkippedElements = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true,
+	"head": true, "svg": true,
+}
+
+// ExtractPlainText returns the text of htmlStr without markup: whitespace is
+// collapsed within each paragraph and paragraphs, such as <p> or <li>
+// elements, are separated by a blank line
+func ExtractPlainText(htmlStr string) (string, error) {
+	doc, err := html.Parse(strings.NewReader(htmlStr))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse HTML: %v", err)
+	}
+
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			// Only block elements break paragraphs, not newlines in the source
+			b.WriteString(strings.Map(func(r rune) rune {
+				if r == '\n' || r == '\r' {
+					return ' '
+				}
+				return r
+			}, n.Data))
+			return
+		case html.ElementNode:
+			if textSkippedElements[n.Data] {
+				return
+			}
+		}
+		block := n.Type == html.ElementNode && textBlockElements[n.Data]
+		if block {
+			b.WriteString("\n")
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+		if block {
+			b.WriteString("\n")
+		}
+	}
+	walk(doc)
+
+	var paragraphs []string
+	for _, line := range strings.Split(b.String(), "\n") {
+		if paragraph := strings.Join(strings.Fields(line), " "); paragraph != "" {
+			paragraphs = append(paragraphs, paragraph)
+		}
+	}
+	return strings.Join(paragraphs, "\n\n"), nil
+}
@@ -0,0 +1,62 @@
+package crawler
+
+import (
+	"context"
+	"sync"
+)
+
+// URLValidation is the verdict of ValidateURLs on one URL
+type URLValidation struct {
+	URL    string
+	Valid  bool   // Whether a crawl would go on to fetch the URL
+	Reason string // Why it wouldn't, empty if Valid
+	Err    error  // The error the crawl would fail with, nil if Valid
+}
+
+// ValidateURLs pre-flights urls without launching a browser, returning a
+// verdict per URL in the same order. A URL passes when it is well-formed
+// HTTP(S), doesn't resolve to a private address unless opts allows it,
+// matches opts.Cookies and, unless opts.IgnoreRobots is set, is allowed by
+// its host's robots.txt. Hosts are looked up and robots.txt files fetched
+// concurrently; the rules are cached for a later crawl.
+func ValidateURLs(urls []string, opts CrawlOptions) []URLValidation {
+	return ValidateURLsCtx(context.Background(), urls, opts)
+}
+
+// ValidateURLsCtx is like ValidateURLs but stops once ctx is cancelled
+func ValidateURLsCtx(ctx context.Context, urls []string, opts CrawlOptions) []URLValidation {
+	sem := make(chan struct{}, opts.concurrency())
+	var wg sync.WaitGroup
+	results := make([]URLValidation, len(urls))
+	for i, url := range urls {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, url string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			results[i] = validateURL(ctx, url, opts)
+		}(i, url)
+	}
+	wg.Wait()
+	return results
+}
+
+// validateURL runs the checks a crawl of url makes before fetching it
+func validateURL(ctx context.Context, url string, opts CrawlOptions) URLValidation {
+	err := ctx.Err()
+	if err == nil {
+		err = ValidateURLWithOptions(url, opts)
+	}
+	if err == nil {
+		err = validateCookies(url, opts.Cookies)
+	}
+	if err == nil {
+		err = checkRobots(ctx, url, "", opts)
+	}
+	if err != nil {
+		return URLValidation{URL: url, Reason: err.Error(), Err: err}
+	}
+	return URLValidation{URL: url, Valid: true}
+}
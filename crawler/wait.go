@@ -0,0 +1,106 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-rod/rod"
+)
+
+// WaitStrategy decides when a loaded page is ready to be captured
+type WaitStrategy int
+
+const (
+	// WaitContentLength captures short pages only after the DOM stops
+	// changing, assuming long pages are already complete. This is the default.
+	WaitContentLength WaitStrategy = iota
+	// WaitNetworkIdle captures the page once no requests have been in flight
+	// for a moment, bounded by StabilityTimeout
+	WaitNetworkIdle
+	// WaitSelector captures the page as soon as WaitForSelector and
+	// WaitForSelectorHidden are satisfied
+	WaitSelector
+)
+
+// networkIdleTime is how long the network must be quiet to count as idle
+const networkIdleTime = 500 * time.Millisecond
+
+// validate rejects unknown strategies and strategies missing their inputs
+func (s WaitStrategy) validate(opts CrawlOptions) error {
+	switch s {
+	case WaitContentLength, WaitNetworkIdle:
+		return nil
+	case WaitSelector:
+		if opts.WaitForSelector == "" && opts.WaitForSelectorHidden == "" {
+			return fmt.Errorf("WaitSelector strategy requires WaitForSelector or WaitForSelectorHidden")
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown wait strategy %d", s)
+}
+
+// contentWaiter waits for a page to be ready according to the strategy
+type contentWaiter struct {
+	opts     CrawlOptions
+	idleWait func()             // Blocks until the network is idle
+	idleStop context.CancelFunc // Stops network idle tracking
+	idleCtx  context.Context
+}
+
+// startContentWait prepares the wait for page. Network idle tracking has to
+// see every request, so it must run before navigating.
+func startContentWait(ctx context.Context, page *rod.Page, opts CrawlOptions) *contentWaiter {
+	w := &contentWaiter{opts: opts}
+	if opts.WaitStrategy == WaitNetworkIdle {
+		w.idleCtx, w.idleStop = context.WithCancel(ctx)
+		w.idleWait = page.Context(w.idleCtx).WaitRequestIdle(networkIdleTime, nil, nil, nil)
+	}
+	return w
+}
+
+// stop releases the resources of the wait
+func (w *contentWaiter) stop() {
+	if w.idleStop != nil {
+		w.idleStop()
+	}
+}
+
+// wait blocks until the loaded page is ready and returns its HTML
+func (w *contentWaiter) wait(ctx context.Context, page *rod.Page, url string) (string, error) {
+	if w.opts.WaitStrategy == WaitNetworkIdle {
+		w.waitNetworkIdle(ctx, url)
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+	}
+
+	waited, err := waitForSelectors(ctx, page, w.opts)
+	if err != nil {
+		return "", err
+	}
+
+	// The content length heuristic only applies when nothing else decided
+	// the page was ready
+	if w.opts.WaitStrategy == WaitContentLength && !waited {
+		return waitForContent(ctx, page, url, w.opts.StabilityTimeout, w.opts.logger())
+	}
+
+	html, err := page.HTML()
+	if err != nil {
+		return "", fmt.Errorf("failed to get HTML: %w", err)
+	}
+	return html, nil
+}
+
+// waitNetworkIdle waits until the network is idle or StabilityTimeout
+// passes, in which case the page is captured as it is
+func (w *contentWaiter) waitNetworkIdle(ctx context.Context, url string) {
+	timer := time.AfterFunc(w.opts.StabilityTimeout, w.idleStop)
+	defer timer.Stop()
+
+	w.idleWait()
+	if ctx.Err() == nil && w.idleCtx.Err() != nil {
+		w.opts.logger().Warn("Network idle timeout; using current HTML", "url", url, "timeout", w.opts.StabilityTimeout)
+	}
+}
@@ -0,0 +1,331 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+	"github.com/google/uuid"
+)
+
+// defaultWARCMaxBytes is the size WARC files are rotated at by default
+const defaultWARCMaxBytes = 1024 * 1024 * 1024 // 1 GB compressed
+
+// warcDateFormat is how WARC-Date is written, UTC to the second
+const warcDateFormat = "2006-01-02T15:04:05Z"
+
+// WARCOptions controls the files WARCWriter writes
+type WARCOptions struct {
+	// Dir is the directory files are written to. Empty means the current
+	// directory.
+	Dir string
+	// Prefix starts the file names, followed by the time the writer was
+	// created and a sequence number, e.g. crawl-20250102T150405-00001.warc.gz.
+	// Empty means "crawl".
+	Prefix string
+	// MaxBytes starts a new file once a file is this many bytes long,
+	// compressed. Zero means 1 GB.
+	MaxBytes int64
+}
+
+// WARCWriter archives fetched pages in the WARC format read by web archive
+// tools such as pywb and the Wayback Machine. Every page becomes a response
+// record of its main document, with the HTTP headers and body the browser
+// received, and the request record that asked for it. Records are
+// compressed one by one into rotating .warc.gz files.
+//
+// Set it as CrawlOptions.WARC; it is safe for concurrent crawls. Bodies
+// are recorded decoded, see DecompressResponse, so responses go without
+// their Content-Encoding and with the decoded Content-Length.
+type WARCWriter struct {
+	mu      sync.Mutex
+	opts    WARCOptions
+	started string // Creation time in file names
+
+	file  *os.File
+	size  int64
+	files []string
+}
+
+// warcExchange is the HTTP exchange that delivered a page's main document
+type warcExchange struct {
+	Response *documentResponse
+	Body     []byte // Decoded body of the response
+}
+
+// NewWARCWriter creates a writer writing files as opts says. Close it to
+// complete the last file.
+func NewWARCWriter(opts WARCOptions) (*WARCWriter, error) {
+	if opts.MaxBytes < 0 {
+		return nil, fmt.Errorf("WARC file limit must not be negative")
+	}
+	if opts.Prefix == "" {
+		opts.Prefix = "crawl"
+	}
+	if strings.ContainsAny(opts.Prefix, `/\`) {
+		return nil, fmt.Errorf("invalid WARC file prefix %q", opts.Prefix)
+	}
+	if opts.Dir == "" {
+		opts.Dir = "."
+	}
+	if opts.MaxBytes == 0 {
+		opts.MaxBytes = defaultWARCMaxBytes
+	}
+	return &WARCWriter{
+		opts:    opts,
+		started: time.Now().UTC().Format("20060102T150405"),
+	}, nil
+}
+
+// Files returns the paths of the files written so far, including the one
+// still open
+func (w *WARCWriter) Files() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]string(nil), w.files...)
+}
+
+// Close completes the open file
+func (w *WARCWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.rotate()
+}
+
+// write appends the response and request records of ex, fetched for
+// targetURL
+func (w *WARCWriter) write(targetURL string, ex *warcExchange) error {
+	resp := ex.Response
+	date := resp.Received.UTC().Format(warcDateFormat)
+	responseID := warcRecordID()
+
+	responseBlock := warcResponseBlock(resp, ex.Body)
+	responseHeader := [][2]string{
+		{"WARC-Type", "response"},
+		{"WARC-Record-ID", responseID},
+		{"WARC-Date", date},
+		{"WARC-Target-URI", targetURL},
+		{"WARC-IP-Address", resp.RemoteIP},
+		{"WARC-Payload-Digest", warcDigest(ex.Body)},
+		{"Content-Type", "application/http; msgtype=response"},
+	}
+	requestHeader := [][2]string{
+		{"WARC-Type", "request"},
+		{"WARC-Record-ID", warcRecordID()},
+		{"WARC-Date", date},
+		{"WARC-Target-URI", targetURL},
+		{"WARC-Concurrent-To", responseID},
+		{"Content-Type", "application/http; msgtype=request"},
+	}
+	// Build both records first, so a failure never leaves half a pair
+	var records bytes.Buffer
+	if err := writeWARCRecord(&records, responseHeader, responseBlock); err != nil {
+		return err
+	}
+	if err := writeWARCRecord(&records, requestHeader, warcRequestBlock(resp)); err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			return err
+		}
+	}
+	n, err := w.file.Write(records.Bytes())
+	w.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write WARC file %s: %v", w.file.Name(), err)
+	}
+	if w.size >= w.opts.MaxBytes {
+		return w.rotate()
+	}
+	return nil
+}
+
+// open starts the next file with a warcinfo record describing it
+func (w *WARCWriter) open() error {
+	name := fmt.Sprintf("%s-%s-%05d.warc.gz", w.opts.Prefix, w.started, len(w.files)+1)
+	path := filepath.Join(w.opts.Dir, name)
+	// Never overwrite the files of another writer
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create WARC file %s: %v", path, err)
+	}
+	w.file = file
+	w.files = append(w.files, path)
+
+	var info bytes.Buffer
+	fields := "software: pathik/" + buildVersion() + "\r\nformat: WARC File Format 1.1\r\n"
+	err = writeWARCRecord(&info, [][2]string{
+		{"WARC-Type", "warcinfo"},
+		{"WARC-Record-ID", warcRecordID()},
+		{"WARC-Date", time.Now().UTC().Format(warcDateFormat)},
+		{"WARC-Filename", name},
+		{"Content-Type", "application/warc-fields"},
+	}, []byte(fields))
+	if err == nil {
+		var n int
+		n, err = file.Write(info.Bytes())
+		w.size = int64(n)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write WARC file %s: %v", path, err)
+	}
+	return nil
+}
+
+// rotate completes the open file, if any, so the next page starts a new one
+func (w *WARCWriter) rotate() error {
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	path := w.file.Name()
+	w.file, w.size = nil, 0
+	if err != nil {
+		return fmt.Errorf("failed to write WARC file %s: %v", path, err)
+	}
+	return nil
+}
+
+// writeWARCRecord appends a record with header and block to w as a gzip
+// member of its own, so readers can seek to any record. Header fields with
+// empty values are left out.
+func writeWARCRecord(w io.Writer, header [][2]string, block []byte) error {
+	gz := gzip.NewWriter(w)
+	var head strings.Builder
+	head.WriteString("WARC/1.1\r\n")
+	for _, field := range header {
+		if field[1] != "" {
+			head.WriteString(field[0] + ": " + field[1] + "\r\n")
+		}
+	}
+	head.WriteString("WARC-Block-Digest: " + warcDigest(block) + "\r\n")
+	head.WriteString("Content-Length: " + strconv.Itoa(len(block)) + "\r\n\r\n")
+
+	if _, err := io.WriteString(gz, head.String()); err != nil {
+		return err
+	}
+	if _, err := gz.Write(block); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(gz, "\r\n\r\n"); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// warcResponseBlock renders resp with body as an HTTP/1.1 message, which is
+// what replay tools parse whatever protocol the page came over
+func warcResponseBlock(resp *documentResponse, body []byte) []byte {
+	header := resp.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	// The body is recorded as the browser decoded it
+	for _, name := range []string{"Content-Encoding", "Transfer-Encoding"} {
+		header.Del(name)
+	}
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+
+	statusText := resp.StatusText
+	if statusText == "" {
+		statusText = http.StatusText(resp.StatusCode)
+	}
+	var block bytes.Buffer
+	fmt.Fprintf(&block, "HTTP/1.1 %d %s\r\n", resp.StatusCode, statusText)
+	writeHTTPHeader(&block, header)
+	block.Write(body)
+	return block.Bytes()
+}
+
+// warcRequestBlock renders the request resp answered as an HTTP/1.1 message
+func warcRequestBlock(resp *documentResponse) []byte {
+	req := resp.Request
+	header := req.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	target, method := "/", req.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	rawURL := req.URL
+	if rawURL == "" {
+		rawURL = resp.URL
+	}
+	if parsed, err := url.Parse(rawURL); err == nil {
+		target = parsed.RequestURI()
+		// The browser reports the headers it sets itself, but not Host
+		if header.Get("Host") == "" {
+			header.Set("Host", parsed.Host)
+		}
+	}
+
+	var block bytes.Buffer
+	fmt.Fprintf(&block, "%s %s HTTP/1.1\r\n", method, target)
+	writeHTTPHeader(&block, header)
+	return block.Bytes()
+}
+
+// writeHTTPHeader writes header sorted by name, followed by the blank line
+// ending it. HTTP/2 pseudo-headers such as ":authority" are left out.
+func writeHTTPHeader(w *bytes.Buffer, header http.Header) {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		if !strings.HasPrefix(name, ":") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range header[name] {
+			w.WriteString(name + ": " + value + "\r\n")
+		}
+	}
+	w.WriteString("\r\n")
+}
+
+// warcDigest returns the SHA-1 digest of data the way WARC records give it
+func warcDigest(data []byte) string {
+	sum := sha1.Sum(data)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
+
+// warcRecordID returns a new unique WARC-Record-ID
+func warcRecordID() string {
+	return "<urn:uuid:" + uuid.NewString() + ">"
+}
+
+// captureExchange reads the body of the main document response resp from
+// the browser, which keeps it while the page is open
+func captureExchange(page *rod.Page, resp *documentResponse) (*warcExchange, error) {
+	res, err := proto.NetworkGetResponseBody{RequestID: resp.RequestID}.Call(page)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	body := []byte(res.Body)
+	if res.Base64Encoded {
+		if body, err = base64.StdEncoding.DecodeString(res.Body); err != nil {
+			return nil, fmt.Errorf("failed to decode response body: %w", err)
+		}
+	}
+	return &warcExchange{Response: resp, Body: decodeCapturedBody(body, resp.Header.Get("Content-Encoding"))}, nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
@@ -11,9 +12,9 @@ import (
 	"syscall"
 	"time"
 
+	"pathik/storage"
+
 	"github.com/joho/godotenv"
-	"github.com/segmentio/kafka-go"
-	"github.com/segmentio/kafka-go/sasl/plain"
 )
 
 func main() {
@@ -41,8 +42,7 @@ func main() {
 		cancel()
 	}()
 
-	// Create Kafka reader
-	brokerList := strings.Split(*brokers, ",")
+	// Create Kafka consumer
 	fmt.Printf("Connecting to Kafka brokers: %s\n", *brokers)
 	fmt.Printf("Consuming from topic: %s\n", *topic)
 	if *contentType != "" {
@@ -51,96 +51,50 @@ func main() {
 	if *sessionID != "" {
 		fmt.Printf("Filtering for session ID: %s\n", *sessionID)
 	}
-
-	// Configure reader
-	readerConfig := kafka.ReaderConfig{
-		Brokers:     brokerList,
-		Topic:       *topic,
-		MinBytes:    10e3, // 10KB
-		MaxBytes:    10e6, // 10MB
-		StartOffset: kafka.LastOffset,
-		Logger:      kafka.LoggerFunc(logKafkaInfo),
-		ErrorLogger: kafka.LoggerFunc(logKafkaError),
-	}
-
-	// Add SASL authentication if credentials provided
 	if *username != "" && *password != "" {
-		dialer := &kafka.Dialer{
-			Timeout:   10 * time.Second,
-			DualStack: true,
-			SASLMechanism: plain.Mechanism{
-				Username: *username,
-				Password: *password,
-			},
-		}
-		readerConfig.Dialer = dialer
 		fmt.Println("Using SASL authentication")
 	}
 
-	reader := kafka.NewReader(readerConfig)
-	defer reader.Close()
+	config := storage.KafkaConfig{
+		Brokers:  strings.Split(*brokers, ","),
+		Topic:    *topic,
+		Username: *username,
+		Password: *password,
+	}
+	consumer, err := storage.NewKafkaConsumerWithOptions(config, storage.KafkaConsumerOptions{
+		ContentType: storage.ContentType(*contentType),
+		SessionID:   *sessionID,
+	})
+	if err != nil {
+		log.Fatalf("Failed to create Kafka consumer: %v", err)
+	}
+	defer consumer.Close()
 
 	fmt.Println("Consumer started. Press Ctrl+C to exit.")
 	fmt.Println("-----------------------------------------")
 
 	// Consume messages
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-			m, err := reader.ReadMessage(ctx)
-			if err != nil {
-				if ctx.Err() != context.Canceled {
-					log.Printf("Error reading message: %v", err)
-				}
-				continue
-			}
-
-			// Extract headers
-			var msgURL, msgContentType, msgTimestamp, msgSessionID string
-			for _, header := range m.Headers {
-				switch header.Key {
-				case "url":
-					msgURL = string(header.Value)
-				case "contentType":
-					msgContentType = string(header.Value)
-				case "timestamp":
-					msgTimestamp = string(header.Value)
-				case "sessionID":
-					msgSessionID = string(header.Value)
-				}
-			}
-
-			// Skip if content type filter is set and doesn't match
-			if *contentType != "" && !strings.Contains(msgContentType, *contentType) {
-				continue
-			}
-
-			// Skip if session ID filter is set and doesn't match
-			if *sessionID != "" && msgSessionID != *sessionID {
-				continue
-			}
-
-			// Display message
-			fmt.Println("-----------------------------------------")
-			fmt.Printf("Message received at partition %d, offset %d\n", m.Partition, m.Offset)
-			fmt.Printf("Key: %s\n", string(m.Key))
-			fmt.Printf("URL: %s\n", msgURL)
-			fmt.Printf("Content Type: %s\n", msgContentType)
-			fmt.Printf("Timestamp: %s\n", msgTimestamp)
-			if msgSessionID != "" {
-				fmt.Printf("Session ID: %s\n", msgSessionID)
-			}
+	err = consumer.Consume(ctx, func(msg storage.CrawlMessage) error {
+		// Display message
+		fmt.Println("-----------------------------------------")
+		fmt.Printf("URL: %s\n", msg.URL)
+		fmt.Printf("Content Type: %s\n", msg.ContentType)
+		fmt.Printf("Timestamp: %s\n", msg.Timestamp.Format(time.RFC3339))
+		if msg.SessionID != "" {
+			fmt.Printf("Session ID: %s\n", msg.SessionID)
+		}
 
-			// Print preview of the content (first 200 chars)
-			content := string(m.Value)
-			preview := content
-			if len(content) > 200 {
-				preview = content[:200] + "... [truncated]"
-			}
-			fmt.Printf("Content Preview (%d bytes total):\n%s\n", len(content), preview)
+		// Print preview of the content (first 200 chars)
+		content := string(msg.Body)
+		preview := content
+		if len(content) > 200 {
+			preview = content[:200] + "... [truncated]"
 		}
+		fmt.Printf("Content Preview (%d bytes total):\n%s\n", len(content), preview)
+		return nil
+	})
+	if err != nil && !errors.Is(err, context.Canceled) {
+		log.Fatalf("Error consuming messages: %v", err)
 	}
 }
 
@@ -151,12 +105,3 @@ func getEnvWithDefault(key, defaultValue string) string {
 	}
 	return value
 }
-
-func logKafkaInfo(msg string, args ...interface{}) {
-	// Uncomment to see verbose Kafka client logs
-	// log.Printf("INFO: "+msg, args...)
-}
-
-func logKafkaError(msg string, args ...interface{}) {
-	log.Printf("ERROR: "+msg, args...)
-}
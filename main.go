@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
@@ -23,6 +25,12 @@ func validateURL(url string) error {
 	return crawler.ValidateURL(url)
 }
 
+// stdinIsPiped reports whether stdin is a pipe or file rather than a terminal
+func stdinIsPiped() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice == 0
+}
+
 // validateOutputDir ensures the output directory is safe
 func validateOutputDir(dir string) error {
 	// Check for directory traversal
@@ -97,14 +105,26 @@ func main() {
 	uuidFlag := flag.String("uuid", "", "UUID to prefix filenames for uploads")
 	dirFlag := flag.String("dir", ".", "Directory containing files to upload")
 	useR2Flag := flag.Bool("r2", false, "Upload files to Cloudflare R2 (requires uuid)")
+	sseFlag := flag.String("sse", "", "Server-side encryption for uploaded objects, e.g. AES256 (with -r2)")
+	cacheControlFlag := flag.String("cache-control", "", "Cache-Control header for uploaded objects (with -r2)")
 	outDirFlag := flag.String("outdir", ".", "Directory to save crawled files")
 	useKafkaFlag := flag.Bool("kafka", false, "Stream crawled content to Kafka")
 	contentTypeFlag := flag.String("content", "both", "Content type to stream to Kafka: html, markdown, or both (default: both)")
 	topicFlag := flag.String("topic", "", "Kafka topic to stream to (overrides KAFKA_TOPIC environment variable)")
 	sessionFlag := flag.String("session", "", "Session ID to include with Kafka messages (for multi-user environments)")
 	compressionFlag := flag.String("compression", "", "Compression algorithm to use for Kafka messages (gzip, snappy, lz4, zstd)")
+	partitionKeyFlag := flag.String("partition-key", "", "Kafka message key deciding the partition: url, domain or session")
+	envelopeFlag := flag.String("envelope", "", "Kafka message value format: raw content or a versioned json envelope (default: raw)")
 	maxMessageSizeFlag := flag.Int("max-message-size", 0, "Maximum message size in bytes for Kafka")
 	bufferMemoryFlag := flag.Int("buffer-memory", 0, "Buffer memory in bytes for Kafka producer")
+	selectorFlag := flag.String("selector", "", "CSS or XPath selector (see -selector-type) to extract instead of the Readability main content")
+	selectorTypeFlag := flag.String("selector-type", "css", "Language of -selector: css or xpath")
+	jsonFlag := flag.Bool("json", false, "Print a JSON summary per crawled URL, with progress messages on stderr")
+	webhookFlag := flag.Bool("webhook", false, "POST each crawled page to PATHIK_WEBHOOK_URL (with -crawl)")
+	jsonlFlag := flag.String("jsonl", "", "Append each crawled page with its metadata as a JSON line to this file (with -crawl)")
+	sqliteFlag := flag.String("sqlite", "", "Store each crawled page in the pages table of this SQLite database (with -crawl)")
+	maxContentFlag := flag.Int("max-content-bytes", storage.DefaultMaxContentBytes, "Size fetched HTML and saved text are truncated to, -1 for no limit (with -crawl)")
+	warcFlag := flag.String("warc", "", "Archive each fetched page as WARC records in rotating .warc.gz files in this directory (with -crawl)")
 	flag.Parse()
 
 	// Print version if requested
@@ -134,8 +154,16 @@ func main() {
 		}
 	}
 
-	// Get URLs from remaining arguments
+	// Get URLs from remaining arguments, or from stdin given "-" or a pipe
 	urls := flag.Args()
+	if (len(urls) == 1 && urls[0] == "-") || (len(urls) == 0 && stdinIsPiped()) {
+		var err error
+		urls, err = crawler.ReadURLs(os.Stdin)
+		if err != nil {
+			// Report malformed lines and go on with the rest of the list
+			log.Printf("Invalid URL list: %v", err)
+		}
+	}
 	if len(urls) == 0 {
 		log.Fatal("No URLs provided")
 	}
@@ -154,27 +182,83 @@ func main() {
 
 	// Kafka mode - crawl and stream to Kafka
 	if *useKafkaFlag {
-		streamToKafka(urls, *parallelFlag, *contentTypeFlag, *topicFlag, *sessionFlag, *compressionFlag, *maxMessageSizeFlag, *bufferMemoryFlag)
+		streamToKafka(urls, *parallelFlag, *contentTypeFlag, *topicFlag, *sessionFlag, *compressionFlag, *envelopeFlag, *partitionKeyFlag, *maxMessageSizeFlag, *bufferMemoryFlag)
 		return
 	}
 
 	// Just crawl URLs if -crawl flag is set
 	if *crawlFlag {
+		opts := crawler.CrawlOptions{Selector: *selectorFlag, SelectorType: crawler.SelectorType(*selectorTypeFlag), JSONOutput: *jsonFlag, SessionID: *sessionFlag, MaxContentBytes: *maxContentFlag}
+		sinks := 0
+		for _, set := range []bool{*webhookFlag, *jsonlFlag != "", *sqliteFlag != ""} {
+			if set {
+				sinks++
+			}
+		}
+		if sinks > 1 {
+			log.Fatal("Use only one of -webhook, -jsonl and -sqlite")
+		}
+		if *warcFlag != "" {
+			writer, err := crawler.NewWARCWriter(crawler.WARCOptions{Dir: *warcFlag})
+			if err != nil {
+				log.Fatalf("Failed to create WARC writer: %v", err)
+			}
+			defer writer.Close()
+			opts.WARC = writer
+		}
+		if *sqliteFlag != "" {
+			sink, err := storage.OpenSQLiteSink(*sqliteFlag)
+			if err != nil {
+				log.Fatalf("Failed to open SQLite database: %v", err)
+			}
+			defer sink.Close()
+			opts.Streamer = sink
+		}
+		if *jsonlFlag != "" {
+			sink, err := storage.OpenJSONLSink(*jsonlFlag)
+			if err != nil {
+				log.Fatalf("Failed to open JSONL file: %v", err)
+			}
+			defer sink.Close()
+			opts.Streamer = sink
+			opts.Metadata = true
+		}
+		if *webhookFlag {
+			webhookConfig, err := storage.LoadWebhookConfig()
+			if err != nil {
+				log.Fatalf("Failed to load webhook configuration: %v", err)
+			}
+			sink, err := storage.NewWebhookSink(webhookConfig)
+			if err != nil {
+				log.Fatalf("Failed to create webhook sink: %v", err)
+			}
+			defer sink.Close()
+			opts.Streamer = sink
+		}
+		// Keep stdout for the JSON summaries in JSON mode
+		progress := io.Writer(os.Stdout)
+		if *jsonFlag {
+			progress = os.Stderr
+		}
 		if *parallelFlag && len(urls) > 1 {
 			// Use parallel crawling
-			fmt.Printf("Crawling %d URLs in parallel...\n", len(urls))
-			crawler.CrawlURLs(urls, *outDirFlag)
+			fmt.Fprintf(progress, "Crawling %d URLs in parallel...\n", len(urls))
+			for _, result := range crawler.CrawlURLsWithOptions(context.Background(), urls, *outDirFlag, opts) {
+				if result.Error != nil {
+					log.Printf("Error crawling %s: %v", result.URL, result.Error)
+				}
+			}
 		} else {
 			// Use sequential crawling
 			for _, url := range urls {
-				fmt.Printf("Crawling %s...\n", url)
-				err := crawler.CrawlURL(url, "", nil, nil, *outDirFlag)
+				fmt.Fprintf(progress, "Crawling %s...\n", url)
+				_, err := crawler.CrawlURLWithOptions(context.Background(), url, "", *outDirFlag, opts)
 				if err != nil {
 					log.Printf("Error crawling %s: %v", url, err)
 				}
 			}
-			fmt.Println("Crawling complete!")
 		}
+		fmt.Fprintln(progress, "Crawling complete!")
 		return
 	}
 
@@ -198,9 +282,13 @@ func main() {
 		if err != nil {
 			log.Fatalf("Failed to load R2 configuration: %v", err)
 		}
+		uploadOpts := storage.UploadOptions{SSE: *sseFlag, CacheControl: *cacheControlFlag, KeyPrefix: r2Config.KeyPrefix}
+		if err := uploadOpts.Validate(); err != nil {
+			log.Fatalf("Invalid upload options: %v", err)
+		}
 
 		// Create S3 client for R2
-		client, err := storage.CreateS3Client(r2Config)
+		backend, err := storage.NewR2Backend(r2Config)
 		if err != nil {
 			log.Fatalf("Failed to create S3 client: %v", err)
 		}
@@ -216,17 +304,21 @@ func main() {
 
 			// Upload HTML file if found
 			if htmlFile != "" {
-				err = storage.UploadFileToR2(client, r2Config.BucketName, htmlFile, *uuidFlag, url, "html")
+				result, err := storage.UploadFileWithOptions(backend, htmlFile, *uuidFlag, url, "html", uploadOpts)
 				if err != nil {
 					log.Printf("Error uploading HTML file: %v", err)
+				} else if result.URL != "" {
+					fmt.Printf("Public URL: %s\n", result.URL)
 				}
 			}
 
 			// Upload MD file if found
 			if mdFile != "" {
-				err = storage.UploadFileToR2(client, r2Config.BucketName, mdFile, *uuidFlag, url, "md")
+				result, err := storage.UploadFileWithOptions(backend, mdFile, *uuidFlag, url, "md", uploadOpts)
 				if err != nil {
 					log.Printf("Error uploading MD file: %v", err)
+				} else if result.URL != "" {
+					fmt.Printf("Public URL: %s\n", result.URL)
 				}
 			}
 		}
@@ -237,7 +329,7 @@ func main() {
 	}
 }
 
-func streamToKafka(urls []string, parallel bool, contentType string, topic string, session string, compression string, maxMessageSize int, bufferMemory int) {
+func streamToKafka(urls []string, parallel bool, contentType string, topic string, session string, compression string, envelope string, partitionKey string, maxMessageSize int, bufferMemory int) {
 	// Create a Kafka writer
 	kafkaConfig, err := storage.LoadKafkaConfig()
 	if err != nil {
@@ -257,6 +349,18 @@ func streamToKafka(urls []string, parallel bool, contentType string, topic strin
 		fmt.Printf("Using compression: %s\n", compression)
 	}
 
+	// Set the envelope format if provided
+	if envelope != "" {
+		kafkaConfig.EnvelopeFormat = storage.EnvelopeFormat(envelope)
+		fmt.Printf("Using envelope format: %s\n", envelope)
+	}
+
+	// Set the partition key strategy if provided
+	if partitionKey != "" {
+		kafkaConfig.PartitionKeyStrategy = storage.PartitionKeyStrategy(partitionKey)
+		fmt.Printf("Using partition key: %s\n", partitionKey)
+	}
+
 	// Add message size if provided
 	if maxMessageSize > 0 {
 		kafkaConfig.MaxMessageSize = maxMessageSize
@@ -269,12 +373,13 @@ func streamToKafka(urls []string, parallel bool, contentType string, topic strin
 		fmt.Printf("Using buffer memory: %d bytes\n", bufferMemory)
 	}
 
-	writer, err := storage.CreateKafkaWriter(kafkaConfig)
+	var streamer storage.Streamer
+	streamer, err = storage.NewKafkaWriter(kafkaConfig)
 	if err != nil {
 		fmt.Printf("Error creating Kafka writer: %v\n", err)
 		return
 	}
-	defer storage.CloseKafkaWriter(writer)
+	defer streamer.Close()
 
 	fmt.Printf("Streaming content to Kafka topic %s at %s\n",
 		kafkaConfig.Topic, strings.Join(kafkaConfig.Brokers, ","))
@@ -299,20 +404,20 @@ func streamToKafka(urls []string, parallel bool, contentType string, topic strin
 			wg.Add(1)
 			go func(u string) {
 				defer wg.Done()
-				processURLForKafka(u, writer, contentTypes, session)
+				processURLForKafka(u, streamer, contentTypes, session)
 			}(url)
 		}
 		wg.Wait()
 	} else {
 		for _, url := range urls {
-			processURLForKafka(url, writer, contentTypes, session)
+			processURLForKafka(url, streamer, contentTypes, session)
 		}
 	}
 
 	fmt.Println("Completed streaming to Kafka")
 }
 
-func processURLForKafka(url string, writer interface{}, contentTypes []storage.ContentType, session string) {
+func processURLForKafka(url string, streamer storage.Streamer, contentTypes []storage.ContentType, session string) {
 	fmt.Printf("Streaming content from %s to Kafka\n", url)
 
 	// Fetch the page
@@ -330,14 +435,14 @@ func processURLForKafka(url string, writer interface{}, contentTypes []storage.C
 	}
 
 	// Convert to markdown
-	markdown, err := crawler.ConvertToMarkdown(extractedHTML)
+	markdown, err := crawler.ConvertToMarkdownWithBase(extractedHTML, url)
 	if err != nil {
 		fmt.Printf("Error converting to Markdown: %v\n", err)
 		return
 	}
 
 	// Stream to Kafka with specified content types
-	err = storage.StreamToKafka(writer, url, htmlContent, markdown, session, contentTypes...)
+	err = streamer.Stream(url, htmlContent, markdown, session, contentTypes...)
 	if err != nil {
 		fmt.Printf("Error streaming content to Kafka for %s: %v\n", url, err)
 		return
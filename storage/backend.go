@@ -0,0 +1,464 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// StorageBackend stores crawl output under a key
+type StorageBackend interface {
+	// Upload stores content under key with the given MIME type
+	Upload(ctx context.Context, key string, content io.Reader, contentType string) error
+}
+
+// EncodingUploader is implemented by backends that can record a content
+// encoding with an object, so compressed content is decoded transparently
+// when it is served
+type EncodingUploader interface {
+	// UploadWithEncoding is like Upload but also sets the Content-Encoding
+	UploadWithEncoding(ctx context.Context, key string, content io.Reader, contentType, contentEncoding string) error
+}
+
+// MetadataUploader is implemented by backends that can record encryption,
+// cache and user metadata settings with an object
+type MetadataUploader interface {
+	// UploadWithOptions is like UploadWithEncoding but also applies opts
+	UploadWithOptions(ctx context.Context, key string, content io.Reader, contentType, contentEncoding string, opts UploadOptions) error
+}
+
+// Object metadata keys set on every upload that records metadata
+const (
+	MetadataOriginalURL = "original-url" // The crawled URL
+	MetadataCrawledAt   = "crawled-at"   // When it was crawled, in RFC 3339
+)
+
+// UploadOptions controls the object settings of uploads to buckets.
+// Backends that can't record them, such as LocalBackend, store the content
+// alone.
+type UploadOptions struct {
+	// SSE is the S3 server-side encryption algorithm, e.g. "AES256" or
+	// "aws:kms". GCS always encrypts objects and ignores it.
+	SSE string
+	// Metadata is stored as user metadata with every object, next to the
+	// original URL and crawl timestamp
+	Metadata map[string]string
+	// CacheControl is the Cache-Control header objects are served with,
+	// e.g. "public, max-age=86400"
+	CacheControl string
+
+	// KeyPrefix is prepended to the keys of uploaded files, e.g.
+	// "crawls/{{.Date}}/"; see ExpandKeyPrefix
+	KeyPrefix string
+	// Concurrency is the number of files UploadDirectory uploads at once.
+	// Zero means 5.
+	Concurrency int
+}
+
+// Validate rejects unknown encryption algorithms and metadata that can't be
+// sent as HTTP headers
+func (o UploadOptions) Validate() error {
+	if o.SSE != "" && !slices.Contains(types.ServerSideEncryption("").Values(), types.ServerSideEncryption(o.SSE)) {
+		return fmt.Errorf("unsupported server-side encryption %q", o.SSE)
+	}
+	if o.Concurrency < 0 {
+		return fmt.Errorf("upload concurrency must not be negative")
+	}
+	if err := ValidateKeyPrefix(o.KeyPrefix); err != nil {
+		return err
+	}
+	for name, value := range o.Metadata {
+		if name == "" || strings.ContainsFunc(name, func(r rune) bool {
+			return r > unicode.MaxASCII || r <= ' ' || strings.ContainsRune(`()<>@,;:\"/[]?={}`, r)
+		}) {
+			return fmt.Errorf("invalid metadata name %q", name)
+		}
+		if strings.ContainsFunc(value, func(r rune) bool {
+			return r > unicode.MaxASCII || (r < ' ' && r != '\t') || r == 0x7f
+		}) {
+			return fmt.Errorf("metadata %s must be printable ASCII", name)
+		}
+	}
+	return nil
+}
+
+// withCrawlMetadata returns a copy of o whose metadata also records the
+// crawled URL, unless it is unknown, and time
+func (o UploadOptions) withCrawlMetadata(originalURL string, crawledAt time.Time) UploadOptions {
+	metadata := make(map[string]string, len(o.Metadata)+2)
+	for name, value := range o.Metadata {
+		metadata[name] = value
+	}
+	if originalURL != "" {
+		metadata[MetadataOriginalURL] = asciiMetadata(originalURL)
+	}
+	metadata[MetadataCrawledAt] = crawledAt.UTC().Format(time.RFC3339)
+	o.Metadata = metadata
+	return o
+}
+
+// asciiMetadata percent-encodes the bytes of s that aren't printable ASCII,
+// since metadata travels in HTTP headers
+func asciiMetadata(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < ' ' || c >= 0x7f || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// S3Config holds the configuration for AWS S3
+type S3Config struct {
+	AccessKeyID     string // Optional; the default AWS credential chain is used if empty
+	AccessKeySecret string
+	BucketName      string
+	Region          string // Optional; AWS_REGION or the shared config is used if empty
+	// EndpointURL points the client at an S3-compatible service such as
+	// MinIO, Backblaze B2 or Wasabi, e.g. "http://localhost:9000". Requests
+	// use path-style addressing when it is set.
+	EndpointURL string
+	// ForcePathStyle addresses buckets as https://host/bucket rather than
+	// https://bucket.host, e.g. for bucket names containing dots
+	ForcePathStyle bool
+	// KeyPrefix is the UploadOptions.KeyPrefix for uploads to the bucket
+	KeyPrefix string
+	// MaxRetries is the number of retries of a request failing with a
+	// transient error, such as throttling, a 5xx response or a timeout.
+	// Permanent errors such as access denied aren't retried. Zero means 2.
+	MaxRetries int
+	// RetryDelay is the pause before the first retry, doubled for each
+	// retry after it up to 20s. Zero means a random backoff of up to 1s,
+	// growing with each retry.
+	RetryDelay time.Duration
+}
+
+// LoadS3Config loads S3 configuration from environment variables
+func LoadS3Config() (S3Config, error) {
+	config := S3Config{
+		AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+		AccessKeySecret: os.Getenv("S3_ACCESS_KEY_SECRET"),
+		BucketName:      os.Getenv("S3_BUCKET_NAME"),
+		Region:          os.Getenv("S3_REGION"),
+		EndpointURL:     os.Getenv("S3_ENDPOINT_URL"),
+		KeyPrefix:       os.Getenv("S3_KEY_PREFIX"),
+	}
+
+	if config.BucketName == "" {
+		return config, fmt.Errorf("missing required S3 configuration in environment variables")
+	}
+	if value := os.Getenv("S3_FORCE_PATH_STYLE"); value != "" {
+		forcePathStyle, err := strconv.ParseBool(value)
+		if err != nil {
+			return config, fmt.Errorf("invalid S3_FORCE_PATH_STYLE %q: %v", value, err)
+		}
+		config.ForcePathStyle = forcePathStyle
+	}
+	if err := validateEndpointURL(config.EndpointURL); err != nil {
+		return config, fmt.Errorf("invalid S3_ENDPOINT_URL: %v", err)
+	}
+	if err := ValidateKeyPrefix(config.KeyPrefix); err != nil {
+		return config, fmt.Errorf("invalid S3_KEY_PREFIX: %v", err)
+	}
+	if value := os.Getenv("S3_MAX_RETRIES"); value != "" {
+		maxRetries, err := strconv.Atoi(value)
+		if err != nil || maxRetries < 0 {
+			return config, fmt.Errorf("invalid S3_MAX_RETRIES %q", value)
+		}
+		config.MaxRetries = maxRetries
+	}
+	if (config.AccessKeyID == "") != (config.AccessKeySecret == "") {
+		return config, fmt.Errorf("S3_ACCESS_KEY_ID and S3_ACCESS_KEY_SECRET must be set together")
+	}
+	return config, nil
+}
+
+// defaultEndpointRegion is the region used for custom endpoints when none is
+// configured; S3-compatible services mostly ignore it but requests must be
+// signed for some region
+const defaultEndpointRegion = "us-east-1"
+
+// validateEndpointURL rejects endpoints that aren't absolute HTTP(S) URLs.
+// An empty endpoint is valid and means AWS.
+func validateEndpointURL(endpoint string) error {
+	if endpoint == "" {
+		return nil
+	}
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return err
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("%q is not an http or https URL", endpoint)
+	}
+	return nil
+}
+
+// s3Retryer returns a retry option for clients retrying transient errors
+// maxRetries times, after the SDK's default of 2 if zero. With retryDelay,
+// the backoff doubles from it rather than being random.
+func s3Retryer(maxRetries int, retryDelay time.Duration) (func(*config.LoadOptions) error, error) {
+	if maxRetries < 0 {
+		return nil, fmt.Errorf("max retries must not be negative")
+	}
+	if retryDelay < 0 {
+		return nil, fmt.Errorf("retry delay must not be negative")
+	}
+	return config.WithRetryer(func() aws.Retryer {
+		return retry.NewStandard(func(o *retry.StandardOptions) {
+			if maxRetries > 0 {
+				o.MaxAttempts = maxRetries + 1
+			}
+			if retryDelay > 0 {
+				maxBackoff := o.MaxBackoff
+				o.Backoff = retry.BackoffDelayerFunc(func(attempt int, err error) (time.Duration, error) {
+					// attempt counts from 1, the attempt that just failed
+					delay := retryDelay
+					for i := 1; i < attempt && delay < maxBackoff; i++ {
+						delay *= 2
+					}
+					return min(delay, maxBackoff), nil
+				})
+			}
+		})
+	}), nil
+}
+
+// CreateAWSS3Client creates an S3 client for AWS using the default endpoint
+// and standard region resolution, or for the S3-compatible service at
+// cfg.EndpointURL
+func CreateAWSS3Client(cfg S3Config) (*s3.Client, error) {
+	if err := validateEndpointURL(cfg.EndpointURL); err != nil {
+		return nil, fmt.Errorf("invalid S3 endpoint: %v", err)
+	}
+	retryer, err := s3Retryer(cfg.MaxRetries, cfg.RetryDelay)
+	if err != nil {
+		return nil, err
+	}
+
+	loadOptions := []func(*config.LoadOptions) error{retryer}
+	if cfg.Region != "" {
+		loadOptions = append(loadOptions, config.WithRegion(cfg.Region))
+	}
+	if cfg.EndpointURL != "" {
+		endpointResolver := aws.EndpointResolverWithOptionsFunc(func(service, region string, options ...interface{}) (aws.Endpoint, error) {
+			return aws.Endpoint{URL: cfg.EndpointURL}, nil
+		})
+		loadOptions = append(loadOptions, config.WithEndpointResolverWithOptions(endpointResolver))
+	}
+	if cfg.AccessKeyID != "" {
+		loadOptions = append(loadOptions, config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
+			cfg.AccessKeyID,
+			cfg.AccessKeySecret,
+			"",
+		)))
+	}
+
+	awsCfg, err := config.LoadDefaultConfig(context.TODO(), loadOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %v", err)
+	}
+	if cfg.EndpointURL != "" && awsCfg.Region == "" {
+		awsCfg.Region = defaultEndpointRegion
+	}
+	return s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+		// Self-hosted services such as MinIO have no per-bucket hostnames
+		o.UsePathStyle = cfg.ForcePathStyle || cfg.EndpointURL != ""
+	}), nil
+}
+
+// publicURLer is implemented by backends that can serve objects publicly
+type publicURLer interface {
+	PublicURL(key string) string
+}
+
+// multipartPartSize is the part size of multipart uploads; bodies up to this
+// size are uploaded with a single PutObject
+const multipartPartSize = 8 * 1024 * 1024 // 8 MB
+
+// S3Backend uploads to a bucket through the S3 API, which both AWS S3 and
+// Cloudflare R2 speak
+type S3Backend struct {
+	Client *s3.Client
+	Bucket string
+	// PublicBaseURL is the URL the bucket is publicly served from, if any
+	PublicBaseURL string
+}
+
+// NewS3Backend creates a backend for an AWS S3 bucket
+func NewS3Backend(cfg S3Config) (*S3Backend, error) {
+	client, err := CreateAWSS3Client(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &S3Backend{Client: client, Bucket: cfg.BucketName}, nil
+}
+
+// NewR2Backend creates a backend for a Cloudflare R2 bucket
+func NewR2Backend(cfg R2Config) (*S3Backend, error) {
+	client, err := CreateS3Client(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &S3Backend{Client: client, Bucket: cfg.BucketName, PublicBaseURL: cfg.PublicDomain}, nil
+}
+
+// PublicURL returns the public URL of key, or "" when PublicBaseURL is unset
+func (b *S3Backend) PublicURL(key string) string {
+	return publicObjectURL(b.PublicBaseURL, key)
+}
+
+// Upload stores content in the bucket under key
+func (b *S3Backend) Upload(ctx context.Context, key string, content io.Reader, contentType string) error {
+	return b.UploadWithOptions(ctx, key, content, contentType, "", UploadOptions{})
+}
+
+// UploadWithEncoding stores content under key with its Content-Encoding
+// metadata, if any
+func (b *S3Backend) UploadWithEncoding(ctx context.Context, key string, content io.Reader, contentType, contentEncoding string) error {
+	return b.UploadWithOptions(ctx, key, content, contentType, contentEncoding, UploadOptions{})
+}
+
+// UploadWithOptions stores content under key with its Content-Encoding and
+// the encryption, cache and user metadata settings of opts
+func (b *S3Backend) UploadWithOptions(ctx context.Context, key string, content io.Reader, contentType, contentEncoding string, opts UploadOptions) error {
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(b.Bucket),
+		Key:         aws.String(key),
+		Body:        content,
+		ContentType: aws.String(contentType),
+		Metadata:    opts.Metadata,
+	}
+	if contentEncoding != "" {
+		input.ContentEncoding = aws.String(contentEncoding)
+	}
+	if opts.SSE != "" {
+		input.ServerSideEncryption = types.ServerSideEncryption(opts.SSE)
+	}
+	if opts.CacheControl != "" {
+		input.CacheControl = aws.String(opts.CacheControl)
+	}
+
+	// The upload manager sends small bodies in a single request and streams
+	// larger ones in parts, so memory use stays flat
+	uploader := manager.NewUploader(b.Client, func(u *manager.Uploader) {
+		u.PartSize = multipartPartSize
+	})
+	_, err := uploader.Upload(ctx, input)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s to bucket %s: %v", key, b.Bucket, err)
+	}
+	return nil
+}
+
+// Exists reports whether an object is stored under key
+func (b *S3Backend) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := b.Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(b.Bucket),
+		Key:    aws.String(key),
+	})
+	if err == nil {
+		return true, nil
+	}
+	var notFound *types.NotFound
+	if errors.As(err, &notFound) {
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to check %s in bucket %s: %v", key, b.Bucket, err)
+}
+
+// List returns the keys of the objects in the bucket starting with prefix,
+// following the listing through every page
+func (b *S3Backend) List(ctx context.Context, prefix string) ([]string, error) {
+	input := &s3.ListObjectsV2Input{Bucket: aws.String(b.Bucket)}
+	if prefix != "" {
+		input.Prefix = aws.String(prefix)
+	}
+
+	var keys []string
+	paginator := s3.NewListObjectsV2Paginator(b.Client, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %q in bucket %s: %v", prefix, b.Bucket, err)
+		}
+		for _, object := range page.Contents {
+			keys = append(keys, aws.ToString(object.Key))
+		}
+	}
+	return keys, nil
+}
+
+// upload stores content through backend, recording contentEncoding and
+// opts when the backend supports them
+func upload(ctx context.Context, backend StorageBackend, key string, content io.Reader, contentType, contentEncoding string, opts UploadOptions) error {
+	if uploader, ok := backend.(MetadataUploader); ok {
+		return uploader.UploadWithOptions(ctx, key, content, contentType, contentEncoding, opts)
+	}
+	if encoder, ok := backend.(EncodingUploader); ok && contentEncoding != "" {
+		return encoder.UploadWithEncoding(ctx, key, content, contentType, contentEncoding)
+	}
+	return backend.Upload(ctx, key, content, contentType)
+}
+
+// publicObjectURL joins a public domain or base URL with an object key
+func publicObjectURL(base, key string) string {
+	base = strings.TrimRight(strings.TrimSpace(base), "/")
+	if base == "" {
+		return ""
+	}
+	if !strings.Contains(base, "://") {
+		base = "https://" + base
+	}
+
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return base + "/" + strings.Join(segments, "/")
+}
+
+// LoadStorageBackend picks a backend from the environment: R2 when its
+// account is configured, then GCS when its bucket is, AWS S3 otherwise
+func LoadStorageBackend() (StorageBackend, error) {
+	if os.Getenv("R2_ACCOUNT_ID") != "" {
+		cfg, err := LoadR2Config()
+		if err != nil {
+			return nil, err
+		}
+		return NewR2Backend(cfg)
+	}
+
+	if os.Getenv("GCS_BUCKET") != "" {
+		cfg, err := LoadGCSConfig()
+		if err != nil {
+			return nil, err
+		}
+		return NewGCSBackend(cfg)
+	}
+
+	cfg, err := LoadS3Config()
+	if err != nil {
+		return nil, fmt.Errorf("no storage backend configured: set R2_*, GCS_* or S3_* environment variables")
+	}
+	return NewS3Backend(cfg)
+}
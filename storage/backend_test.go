@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyS3 is a mock S3 endpoint failing the first failures PUTs with status
+type flakyS3 struct {
+	mu       sync.Mutex
+	status   int
+	failures int
+	puts     int
+	body     string
+}
+
+func (s *flakyS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.Method != http.MethodPut {
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+		return
+	}
+	s.puts++
+	body, _ := io.ReadAll(r.Body)
+	if s.puts <= s.failures {
+		w.WriteHeader(s.status)
+		io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>Flaky</Code><Message>try again</Message></Error>`)
+		return
+	}
+	s.body = string(body)
+	w.Header().Set("ETag", `"etag"`)
+}
+
+func TestS3BackendRetriesTransientErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		failures int
+		wantPuts int
+		wantErr  bool
+	}{
+		{"service unavailable then ok", http.StatusServiceUnavailable, 1, 2, false},
+		{"server errors then ok", http.StatusInternalServerError, 2, 3, false},
+		{"retries used up", http.StatusServiceUnavailable, 5, 3, true},
+		{"access denied not retried", http.StatusForbidden, 1, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &flakyS3{status: tt.status, failures: tt.failures}
+			srv := httptest.NewServer(mock)
+			defer srv.Close()
+
+			backend, err := NewS3Backend(S3Config{
+				AccessKeyID:     "AKIDEXAMPLE",
+				AccessKeySecret: "secret",
+				BucketName:      "pages",
+				EndpointURL:     srv.URL,
+				MaxRetries:      2,
+				RetryDelay:      time.Millisecond,
+			})
+			if err != nil {
+				t.Fatalf("NewS3Backend: %v", err)
+			}
+			err = backend.Upload(context.Background(), "example.com/page.html", strings.NewReader("<p>page</p>"), "text/html")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Upload = %v, want error %v", err, tt.wantErr)
+			}
+			if mock.puts != tt.wantPuts {
+				t.Errorf("%d PUT requests, want %d", mock.puts, tt.wantPuts)
+			}
+			if !tt.wantErr && mock.body != "<p>page</p>" {
+				t.Errorf("stored %q, want the uploaded content", mock.body)
+			}
+		})
+	}
+}
+
+func TestCreateAWSS3ClientEndpoint(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  S3Config
+		want string // Scheme, host and path of the object URL
+	}{
+		// Custom endpoints such as MinIO have no per-bucket hostnames
+		{"custom endpoint", S3Config{EndpointURL: "http://localhost:9000"}, "http://localhost:9000/pages/docs/page.html"},
+		{"custom endpoint with path style", S3Config{EndpointURL: "http://localhost:9000", ForcePathStyle: true}, "http://localhost:9000/pages/docs/page.html"},
+		{"custom endpoint with a path", S3Config{EndpointURL: "https://storage.example.com/s3"}, "https://storage.example.com/s3/pages/docs/page.html"},
+		{"aws", S3Config{Region: "eu-west-1"}, "https://pages.s3.eu-west-1.amazonaws.com/docs/page.html"},
+		{"aws with path style", S3Config{Region: "eu-west-1", ForcePathStyle: true}, "https://s3.eu-west-1.amazonaws.com/pages/docs/page.html"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := testS3Client(t, tt.cfg)
+			raw, err := GeneratePresignedGetURL(client, "pages", "docs/page.html", time.Minute)
+			if err != nil {
+				t.Fatalf("GeneratePresignedGetURL: %v", err)
+			}
+			if got, _, _ := strings.Cut(raw, "?"); got != tt.want {
+				t.Errorf("object URL = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateAWSS3ClientRejectsInvalidEndpoint(t *testing.T) {
+	for _, endpoint := range []string{"localhost:9000", "ftp://localhost", "http://"} {
+		if _, err := CreateAWSS3Client(S3Config{EndpointURL: endpoint}); err == nil {
+			t.Errorf("CreateAWSS3Client accepted endpoint %q", endpoint)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DedupRecord is what a DedupStore remembers about a crawled URL
+type DedupRecord struct {
+	Hash         string    `json:"hash"`                    // ContentHash of the page
+	ETag         string    `json:"etag,omitempty"`          // ETag header of the page's response
+	LastModified string    `json:"last_modified,omitempty"` // Last-Modified header of the page's response
+	CrawledAt    time.Time `json:"crawled_at"`
+}
+
+// DedupStore remembers the content of crawled URLs between crawls so that
+// unchanged pages aren't saved again
+type DedupStore interface {
+	// Get returns the record of url and whether there is one
+	Get(ctx context.Context, url string) (DedupRecord, bool, error)
+	// Put replaces the record of url
+	Put(ctx context.Context, url string, record DedupRecord) error
+}
+
+// ContentHash returns the hex-encoded SHA-256 of content
+func ContentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// MemoryDedupStore is a DedupStore that lives as long as the process
+type MemoryDedupStore struct {
+	mu      sync.Mutex
+	records map[string]DedupRecord
+}
+
+// NewMemoryDedupStore creates an empty in-memory store
+func NewMemoryDedupStore() *MemoryDedupStore {
+	return &MemoryDedupStore{records: make(map[string]DedupRecord)}
+}
+
+// Get returns the record of url
+func (s *MemoryDedupStore) Get(ctx context.Context, url string) (DedupRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.records[url]
+	return record, ok, nil
+}
+
+// Put replaces the record of url
+func (s *MemoryDedupStore) Put(ctx context.Context, url string, record DedupRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[url] = record
+	return nil
+}
+
+// FileDedupStore is a DedupStore kept in a JSON file mapping URLs to their
+// records, so recrawls in later runs can skip unchanged pages
+type FileDedupStore struct {
+	mu      sync.Mutex
+	path    string
+	records map[string]DedupRecord
+}
+
+// NewFileDedupStore loads the store kept at path. A missing file starts an
+// empty store, which is created on the first Put.
+func NewFileDedupStore(path string) (*FileDedupStore, error) {
+	s := &FileDedupStore{path: path, records: make(map[string]DedupRecord)}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dedup store %s: %v", path, err)
+	}
+	if err := json.Unmarshal(data, &s.records); err != nil {
+		return nil, fmt.Errorf("invalid dedup store %s: %v", path, err)
+	}
+	return s, nil
+}
+
+// Get returns the record of url
+func (s *FileDedupStore) Get(ctx context.Context, url string) (DedupRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.records[url]
+	return record, ok, nil
+}
+
+// Put replaces the record of url and rewrites the file
+func (s *FileDedupStore) Put(ctx context.Context, url string, record DedupRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, existed := s.records[url]
+	s.records[url] = record
+	if err := s.save(); err != nil {
+		// Keep memory in line with the file
+		if existed {
+			s.records[url] = previous
+		} else {
+			delete(s.records, url)
+		}
+		return err
+	}
+	return nil
+}
+
+// save writes the records to a temporary file and renames it over the store
+// so a crash never leaves a half-written file. s.mu must be held.
+func (s *FileDedupStore) save() error {
+	data, err := json.MarshalIndent(s.records, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode dedup store: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to write dedup store %s: %v", s.path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write dedup store %s: %v", s.path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write dedup store %s: %v", s.path, err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to write dedup store %s: %v", s.path, err)
+	}
+	return nil
+}
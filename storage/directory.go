@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// defaultUploadConcurrency is the number of parallel uploads of
+// UploadDirectory when UploadOptions.Concurrency is zero
+const defaultUploadConcurrency = 5
+
+// UploadDirectoryToR2 uploads every file under dir to an R2 bucket; see
+// UploadDirectory
+func UploadDirectoryToR2(client *s3.Client, bucketName, dir string, opts UploadOptions) ([]UploadResult, error) {
+	return UploadDirectory(&S3Backend{Client: client, Bucket: bucketName}, dir, opts)
+}
+
+// UploadDirectory uploads every file under dir, such as the output
+// directory of a crawl, with opts.Concurrency uploads at a time. Keys are
+// the expanded opts.KeyPrefix followed by the file's path relative to dir, and content
+// types follow the file extensions; ".gz" files keep their gzip encoding,
+// except ".warc.gz" archives, which are served as stored.
+// It returns a result per file in walk order, each carrying its own error,
+// and an error joining those of the failed files.
+func UploadDirectory(backend StorageBackend, dir string, opts UploadOptions) ([]UploadResult, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// Symlinks aren't followed, so nothing outside dir is uploaded
+		if entry.Type().IsRegular() {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list directory %s: %v", dir, err)
+	}
+
+	concurrency := opts.Concurrency
+	if concurrency == 0 {
+		concurrency = defaultUploadConcurrency
+	}
+	results := make([]UploadResult, len(paths))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, path := range paths {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, path string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			results[i] = uploadDirectoryFile(backend, dir, path, opts)
+		}(i, path)
+	}
+	wg.Wait()
+
+	var errs []error
+	for _, result := range results {
+		if result.Error != nil {
+			errs = append(errs, result.Error)
+		}
+	}
+	return results, errors.Join(errs...)
+}
+
+// uploadDirectoryFile uploads the file at path under its path relative to
+// dir
+func uploadDirectoryFile(backend StorageBackend, dir, path string, opts UploadOptions) UploadResult {
+	result := UploadResult{Path: path}
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		result.Error = fmt.Errorf("failed to upload %s: %v", path, err)
+		return result
+	}
+	// The prefix can't depend on the page, which the file name doesn't tell
+	prefix, err := ExpandKeyPrefix(opts.KeyPrefix, "", "")
+	if err != nil {
+		result.Error = err
+		return result
+	}
+	key := prefix + filepath.ToSlash(rel)
+
+	file, err := os.Open(path)
+	if err != nil {
+		result.Error = fmt.Errorf("failed to read file %s: %v", path, err)
+		return result
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		result.Error = fmt.Errorf("failed to read file %s: %v", path, err)
+		return result
+	}
+
+	// The original URL can't be recovered from the file name
+	contentType, contentEncoding := fileContentType(path)
+	uploadOpts := opts.withCrawlMetadata("", info.ModTime())
+	if err := upload(context.TODO(), backend, key, file, contentType, contentEncoding, uploadOpts); err != nil {
+		result.Error = fmt.Errorf("failed to upload %s: %v", path, err)
+		return result
+	}
+
+	result.Key = key
+	if public, ok := backend.(publicURLer); ok {
+		result.URL = public.PublicURL(key)
+	}
+	slog.Info("Uploaded file", "path", path, "key", key)
+	return result
+}
+
+// fileContentType infers the MIME type and encoding of a file from its
+// extension, looking through a ".gz" suffix. WARC archives are the
+// exception: their gzip members are part of the format, so clients must
+// get them as stored rather than decompressed.
+func fileContentType(path string) (contentType, contentEncoding string) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".gz" {
+		ext = strings.ToLower(filepath.Ext(strings.TrimSuffix(path, filepath.Ext(path))))
+		if ext == ".warc" {
+			return getContentType("warc"), ""
+		}
+		contentEncoding = "gzip"
+	}
+
+	fileType := strings.TrimPrefix(ext, ".")
+	if fileType == "jpeg" {
+		fileType = "jpg"
+	}
+	contentType = getContentType(fileType)
+	if contentType == "application/octet-stream" && ext != "" {
+		// Captured page resources come with all kinds of extensions
+		if byExt := mime.TypeByExtension(ext); byExt != "" {
+			contentType = byExt
+		}
+	}
+	return contentType, contentEncoding
+}
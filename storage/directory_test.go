@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestFileContentType(t *testing.T) {
+	tests := []struct {
+		path     string
+		typ      string
+		encoding string
+	}{
+		{"page.html", "text/html", ""},
+		{"page.html.gz", "text/html", "gzip"},
+		{"page.MD.GZ", "text/markdown", "gzip"},
+		{"shot.jpeg", "image/jpeg", ""},
+		{"page.mhtml", "multipart/related", ""},
+		// WARC records are gzipped one by one and must reach clients that way
+		{"crawl-00000.warc.gz", "application/warc", ""},
+		{"crawl-00000.WARC.GZ", "application/warc", ""},
+		{"crawl-00000.warc", "application/warc", ""},
+		{"archive.gz", "application/octet-stream", "gzip"},
+		{"resources/style.css", "text/css; charset=utf-8", ""},
+		{"README", "application/octet-stream", ""},
+	}
+	for _, tt := range tests {
+		typ, encoding := fileContentType(tt.path)
+		if typ != tt.typ || encoding != tt.encoding {
+			t.Errorf("fileContentType(%q) = %q, %q, want %q, %q", tt.path, typ, encoding, tt.typ, tt.encoding)
+		}
+	}
+}
+
+// encodingBackend records the content type and encoding of every upload
+type encodingBackend struct {
+	mu       sync.Mutex
+	uploaded map[string][2]string
+}
+
+func (b *encodingBackend) Upload(ctx context.Context, key string, content io.Reader, contentType string) error {
+	return b.UploadWithEncoding(ctx, key, content, contentType, "")
+}
+
+func (b *encodingBackend) UploadWithEncoding(_ context.Context, key string, content io.Reader, contentType, contentEncoding string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.uploaded[key] = [2]string{contentType, contentEncoding}
+	return nil
+}
+
+func TestUploadDirectoryWARC(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"crawl-00000.warc.gz", "page.html.gz"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backend := &encodingBackend{uploaded: make(map[string][2]string)}
+	if _, err := UploadDirectory(backend, dir, UploadOptions{}); err != nil {
+		t.Fatalf("UploadDirectory: %v", err)
+	}
+	if got := backend.uploaded["crawl-00000.warc.gz"]; got != [2]string{"application/warc", ""} {
+		t.Errorf("WARC uploaded as %q, want application/warc without an encoding", got)
+	}
+	if got := backend.uploaded["page.html.gz"]; got != [2]string{"text/html", "gzip"} {
+		t.Errorf("compressed page uploaded as %q, want text/html with gzip encoding", got)
+	}
+}
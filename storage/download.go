@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// DownloadFromR2 returns the content stored under key in an R2 or S3
+// bucket, e.g. a crawled page to reprocess without fetching it again.
+// Objects saved compressed, with a ".gz" key, are returned compressed.
+func DownloadFromR2(client *s3.Client, bucketName, key string) ([]byte, error) {
+	return (&S3Backend{Client: client, Bucket: bucketName}).Download(context.TODO(), key)
+}
+
+// DownloadToFile stores the content under key in an R2 or S3 bucket at
+// destPath, streaming it so large objects aren't held in memory
+func DownloadToFile(client *s3.Client, bucketName, key, destPath string) error {
+	return (&S3Backend{Client: client, Bucket: bucketName}).DownloadToFile(context.TODO(), key, destPath)
+}
+
+// Download returns the content stored under key
+func (b *S3Backend) Download(ctx context.Context, key string) ([]byte, error) {
+	buf := manager.NewWriteAtBuffer(nil)
+	if err := b.download(ctx, key, buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DownloadToFile stores the content under key at destPath. The file only
+// appears once the download is complete, so a failed download never
+// leaves a truncated copy behind.
+func (b *S3Backend) DownloadToFile(ctx context.Context, key, destPath string) error {
+	file, err := os.CreateTemp(filepath.Dir(destPath), filepath.Base(destPath)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create file for %s: %v", destPath, err)
+	}
+	defer os.Remove(file.Name())
+
+	err = b.download(ctx, key, file)
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write file %s: %v", file.Name(), closeErr)
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(file.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to write file %s: %v", file.Name(), err)
+	}
+	if err := os.Rename(file.Name(), destPath); err != nil {
+		return fmt.Errorf("failed to save file %s: %v", destPath, err)
+	}
+	slog.Info("Downloaded file", "key", key, "path", destPath)
+	return nil
+}
+
+// download writes the object under key to w. Like uploads, large objects
+// are fetched in parts of multipartPartSize.
+func (b *S3Backend) download(ctx context.Context, key string, w io.WriterAt) error {
+	downloader := manager.NewDownloader(b.Client, func(d *manager.Downloader) {
+		d.PartSize = multipartPartSize
+	})
+	_, err := downloader.Download(ctx, w, &s3.GetObjectInput{
+		Bucket: aws.String(b.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to download %s from bucket %s: %v", key, b.Bucket, err)
+	}
+	return nil
+}
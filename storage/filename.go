@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// defaultFilenameTemplate is the domain_path_hash_YYYY-MM-DD.ext scheme. The
+// hash of the whole URL keeps pages differing only in their query string,
+// such as ?page=1 and ?page=2, apart.
+const defaultFilenameTemplate = "{{.Name}}_{{.Hash}}_{{.Date}}.{{.Ext}}"
+
+// FilenameFields are the fields available to filename templates
+type FilenameFields struct {
+	Name      string // Domain and path, as GetDomainNameForFile returns them
+	Domain    string // Host name with dots replaced, e.g. example_com
+	Path      string // URL path with slashes replaced, empty for the root
+	Date      string // Current date as YYYY-MM-DD
+	Timestamp string // Current time in RFC 3339 format
+	Hash      string // First 8 hex digits of the SHA-256 of the URL
+	UUID      string // Random UUID, unique to each saved file
+	Ext       string // File extension without the dot
+}
+
+// FileKey returns the name content of the given type for url is stored
+// under: the URL's domain and path, a hash of the URL, today's date and the
+// extension
+func FileKey(url, fileType string) string {
+	key, _ := FileKeyWithTemplate("", url, fileType)
+	return key
+}
+
+// FileKeyWithTemplate names content of the given type for url with a
+// text/template over FilenameFields, e.g. "{{.Domain}}_{{.Timestamp}}.{{.Ext}}".
+// An empty template means the default scheme of FileKey.
+func FileKeyWithTemplate(tmpl, rawURL, fileType string) (string, error) {
+	if tmpl == "" {
+		tmpl = defaultFilenameTemplate
+	}
+	parsed, err := template.New("filename").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("invalid filename template: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := parsed.Execute(&buf, filenameFields(rawURL, fileType)); err != nil {
+		return "", fmt.Errorf("invalid filename template: %v", err)
+	}
+
+	// Templates must name a file, never a path
+	key := buf.String()
+	if key == "" || key == "." || key == ".." || strings.ContainsAny(key, "/\\") {
+		return "", fmt.Errorf("filename template produced unsafe name %q", key)
+	}
+	return key, nil
+}
+
+// ValidateFilenameTemplate checks that tmpl parses and renders a safe name
+func ValidateFilenameTemplate(tmpl string) error {
+	_, err := FileKeyWithTemplate(tmpl, "https://example.com/page", "html")
+	return err
+}
+
+// ExpandKeyPrefix renders a key prefix for content of the given type for
+// rawURL. The prefix is a text/template over FilenameFields, so uploads can
+// be partitioned e.g. by day with "crawls/{{.Date}}/". Leading slashes are
+// dropped and a trailing one added, and prefixes with ".." segments are
+// rejected. An empty prefix stays empty.
+func ExpandKeyPrefix(prefix, rawURL, fileType string) (string, error) {
+	if prefix == "" {
+		return "", nil
+	}
+	parsed, err := template.New("prefix").Option("missingkey=error").Parse(prefix)
+	if err != nil {
+		return "", fmt.Errorf("invalid key prefix: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := parsed.Execute(&buf, filenameFields(rawURL, fileType)); err != nil {
+		return "", fmt.Errorf("invalid key prefix: %v", err)
+	}
+
+	if strings.Contains(buf.String(), "\\") {
+		return "", fmt.Errorf("key prefix %q must use forward slashes", buf.String())
+	}
+	var segments []string
+	for _, segment := range strings.Split(buf.String(), "/") {
+		switch segment {
+		case "", ".":
+			// Leading, doubled and trailing slashes
+		case "..":
+			return "", fmt.Errorf("key prefix %q must not contain ..", buf.String())
+		default:
+			segments = append(segments, segment)
+		}
+	}
+	if len(segments) == 0 {
+		return "", nil
+	}
+	return strings.Join(segments, "/") + "/", nil
+}
+
+// ValidateKeyPrefix checks that prefix parses and renders a safe prefix
+func ValidateKeyPrefix(prefix string) error {
+	_, err := ExpandKeyPrefix(prefix, "https://example.com/page", "html")
+	return err
+}
+
+// filenameFields fills in the template fields for rawURL
+func filenameFields(rawURL, fileType string) FilenameFields {
+	now := time.Now()
+
+	// Ensure safe file type
+	safeFileType := fileType
+	if !allowedFileTypes[fileType] {
+		safeFileType = "txt" // Default to txt if type is unexpected
+	}
+
+	fields := FilenameFields{
+		Name:      GetDomainNameForFile(rawURL),
+		Domain:    "unknown",
+		Date:      now.Format("2006-01-02"),
+		Timestamp: now.Format(time.RFC3339),
+		Hash:      urlHash(rawURL),
+		UUID:      randomUUID(),
+		Ext:       safeFileType,
+	}
+	if parsedURL, err := url.Parse(rawURL); err == nil {
+		fields.Domain = strings.ReplaceAll(parsedURL.Hostname(), ".", "_")
+		fields.Path = strings.ReplaceAll(strings.Trim(parsedURL.Path, "/"), "/", "_")
+	}
+	return fields
+}
+
+// urlHash returns the first 8 hex digits of the SHA-256 of rawURL
+func urlHash(rawURL string) string {
+	sum := sha256.Sum256([]byte(rawURL))
+	return hex.EncodeToString(sum[:4])
+}
+
+// randomUUID returns a random version 4 UUID
+func randomUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	b[6] = b[6]&0x0f | 0x40 // Version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
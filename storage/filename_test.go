@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeURLDistinctURLs(t *testing.T) {
+	// Each group differs only in what the readable part drops or replaces
+	groups := [][]string{
+		{"https://example.com/a/b", "https://example.com/a_b", "https://example.com/a?b"},
+		{"https://example.com/page?id=1", "https://example.com/page?id=2"},
+		{"https://example.com/page#one", "https://example.com/page#two"},
+		{"http://example.com/", "https://example.com/"},
+		{"https://example.com/" + strings.Repeat("x", 250) + "1", "https://example.com/" + strings.Repeat("x", 250) + "2"},
+	}
+	for _, urls := range groups {
+		seen := make(map[string]string)
+		for _, u := range urls {
+			name := SanitizeURL(u)
+			if other, ok := seen[name]; ok {
+				t.Errorf("SanitizeURL(%q) = SanitizeURL(%q) = %q", u, other, name)
+			}
+			seen[name] = u
+		}
+	}
+}
+
+func TestSanitizeURLStable(t *testing.T) {
+	u := "https://example.com/page?id=1"
+	if SanitizeURL(u) != SanitizeURL(u) {
+		t.Fatalf("SanitizeURL(%q) differs between calls", u)
+	}
+	if name := SanitizeURL(u); strings.ContainsAny(name, `/\:*?"<>|`) {
+		t.Fatalf("SanitizeURL(%q) = %q, contains characters unsafe in file names", u, name)
+	}
+}
+
+func TestFileKeyKeepsQueriesApart(t *testing.T) {
+	a := FileKey("https://example.com/list?page=1", "html")
+	b := FileKey("https://example.com/list?page=2", "html")
+	if a == b {
+		t.Fatalf("FileKey gives both pages %q", a)
+	}
+	for _, key := range []string{a, b} {
+		if !strings.HasPrefix(key, "example_com_list_") || !strings.HasSuffix(key, ".html") {
+			t.Errorf("FileKey = %q, want example_com_list_<hash>_<date>.html", key)
+		}
+	}
+}
+
+func TestFindFilesForURL(t *testing.T) {
+	dir := t.TempDir()
+	page1 := "https://example.com/list?page=1"
+	page2 := "https://example.com/list?page=2"
+	for _, name := range []string{FileKey(page1, "html"), FileKey(page1, "md"), FileKey(page2, "html")} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	htmlFile, mdFile, err := FindFilesForURL(dir, page1)
+	if err != nil {
+		t.Fatalf("FindFilesForURL: %v", err)
+	}
+	if filepath.Base(htmlFile) != FileKey(page1, "html") || filepath.Base(mdFile) != FileKey(page1, "md") {
+		t.Fatalf("FindFilesForURL = %s, %s, want the files of %s", htmlFile, mdFile, page1)
+	}
+	if _, mdFile, _ := FindFilesForURL(dir, page2); mdFile != "" {
+		t.Fatalf("FindFilesForURL(%s) found %s, which belongs to %s", page2, mdFile, page1)
+	}
+}
@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	gcs "cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+// GCSConfig holds the configuration for Google Cloud Storage
+type GCSConfig struct {
+	BucketName      string
+	CredentialsFile string // Service account key file; Application Default Credentials if empty
+}
+
+// LoadGCSConfig loads GCS configuration from environment variables
+func LoadGCSConfig() (GCSConfig, error) {
+	config := GCSConfig{
+		BucketName:      os.Getenv("GCS_BUCKET"),
+		CredentialsFile: os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"),
+	}
+
+	if config.BucketName == "" {
+		return config, fmt.Errorf("missing required GCS configuration in environment variables")
+	}
+	return config, nil
+}
+
+// CreateGCSClient creates a Google Cloud Storage client
+func CreateGCSClient(cfg GCSConfig) (*gcs.Client, error) {
+	var clientOptions []option.ClientOption
+	if cfg.CredentialsFile != "" {
+		clientOptions = append(clientOptions, option.WithCredentialsFile(cfg.CredentialsFile))
+	}
+
+	client, err := gcs.NewClient(context.TODO(), clientOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCS client: %v", err)
+	}
+	return client, nil
+}
+
+// GCSBackend uploads to a Google Cloud Storage bucket
+type GCSBackend struct {
+	Client *gcs.Client
+	Bucket string
+}
+
+// NewGCSBackend creates a backend for a GCS bucket
+func NewGCSBackend(cfg GCSConfig) (*GCSBackend, error) {
+	client, err := CreateGCSClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &GCSBackend{Client: client, Bucket: cfg.BucketName}, nil
+}
+
+// Upload stores content in the bucket under key
+func (b *GCSBackend) Upload(ctx context.Context, key string, content io.Reader, contentType string) error {
+	return b.UploadWithOptions(ctx, key, content, contentType, "", UploadOptions{})
+}
+
+// UploadWithEncoding stores content under key with its Content-Encoding
+// metadata, if any
+func (b *GCSBackend) UploadWithEncoding(ctx context.Context, key string, content io.Reader, contentType, contentEncoding string) error {
+	return b.UploadWithOptions(ctx, key, content, contentType, contentEncoding, UploadOptions{})
+}
+
+// UploadWithOptions stores content under key with its Content-Encoding and
+// the cache and user metadata settings of opts
+func (b *GCSBackend) UploadWithOptions(ctx context.Context, key string, content io.Reader, contentType, contentEncoding string, opts UploadOptions) error {
+	writer := b.Client.Bucket(b.Bucket).Object(key).NewWriter(ctx)
+	writer.ContentType = contentType
+	writer.ContentEncoding = contentEncoding
+	writer.CacheControl = opts.CacheControl
+	writer.Metadata = opts.Metadata
+
+	if _, err := io.Copy(writer, content); err != nil {
+		writer.Close()
+		return fmt.Errorf("failed to upload %s to bucket %s: %v", key, b.Bucket, err)
+	}
+	// The object is only committed once the writer is closed
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to upload %s to bucket %s: %v", key, b.Bucket, err)
+	}
+	return nil
+}
+
+// Exists reports whether an object is stored under key
+func (b *GCSBackend) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := b.Client.Bucket(b.Bucket).Object(key).Attrs(ctx)
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, gcs.ErrObjectNotExist) {
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to check %s in bucket %s: %v", key, b.Bucket, err)
+}
+
+// List returns the keys of the objects in the bucket starting with prefix
+func (b *GCSBackend) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	objects := b.Client.Bucket(b.Bucket).Objects(ctx, &gcs.Query{Prefix: prefix})
+	for {
+		attrs, err := objects.Next()
+		if errors.Is(err, iterator.Done) {
+			return keys, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %q in bucket %s: %v", prefix, b.Bucket, err)
+		}
+		keys = append(keys, attrs.Name)
+	}
+}
+
+// UploadFileToGCS uploads a file to a GCS bucket
+func UploadFileToGCS(client *gcs.Client, bucketName, filePath, uuid, originalURL, fileType string) (UploadResult, error) {
+	return uploadFile(&GCSBackend{Client: client, Bucket: bucketName}, "GCS", filePath, uuid, originalURL, fileType, UploadOptions{})
+}
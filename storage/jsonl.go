@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// JSONLRecord is the line JSONLSink writes for each page
+type JSONLRecord struct {
+	URL       string          `json:"url"`
+	HTML      string          `json:"html,omitempty"`
+	Markdown  string          `json:"markdown,omitempty"`
+	Metadata  json.RawMessage `json:"metadata,omitempty"`
+	SessionID string          `json:"session_id,omitempty"`
+	Timestamp time.Time       `json:"timestamp"`
+}
+
+// JSONLSink is a Streamer writing every page as a JSONLRecord on a line of
+// its own, for bulk loading into data warehouses. It is safe for
+// concurrent use; lines are never interleaved.
+type JSONLSink struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+}
+
+// NewJSONLSink creates a sink writing to w. Closing the sink doesn't close w.
+func NewJSONLSink(w io.Writer) *JSONLSink {
+	return &JSONLSink{w: w}
+}
+
+// OpenJSONLSink creates a sink appending to the file at path, creating it
+// if needed. Close it when the crawl is done.
+func OpenJSONLSink(path string) (*JSONLSink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open JSONL file %s: %v", path, err)
+	}
+	return &JSONLSink{w: file, closer: file}, nil
+}
+
+// Stream writes a line with the content of url of each of types, HTML and
+// Markdown if none are given
+func (s *JSONLSink) Stream(url, htmlContent, markdownContent, sessionID string, types ...ContentType) error {
+	return s.StreamWithMetadata(url, htmlContent, markdownContent, sessionID, nil, types...)
+}
+
+// StreamWithMetadata is like Stream but also records the page's metadata
+func (s *JSONLSink) StreamWithMetadata(url, htmlContent, markdownContent, sessionID string, metadata json.RawMessage, types ...ContentType) error {
+	// If no content types specified, write both
+	if len(types) == 0 {
+		types = []ContentType{HTMLContent, MarkdownContent}
+	}
+	record := JSONLRecord{
+		URL:       url,
+		Metadata:  metadata,
+		SessionID: sessionID,
+		Timestamp: time.Now().UTC(),
+	}
+	if containsContentType(types, HTMLContent) {
+		record.HTML = htmlContent
+	}
+	if containsContentType(types, MarkdownContent) {
+		record.Markdown = markdownContent
+	}
+
+	// The encoder escapes newlines and quotes in the content, keeping the
+	// record on one line; HTML is left readable rather than <-escaped
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(record); err != nil {
+		return fmt.Errorf("failed to encode JSONL record for %s: %v", url, err)
+	}
+
+	// A single write per line, so concurrent crawls can't interleave
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write JSONL record for %s: %v", url, err)
+	}
+	return nil
+}
+
+// Close closes the file the sink was opened on, if any
+func (s *JSONLSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closer == nil {
+		return nil
+	}
+	return s.closer.Close()
+}
@@ -3,10 +3,17 @@ package storage
 import (
 	"context"
 	"crypto/tls"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/segmentio/kafka-go"
@@ -25,6 +32,103 @@ type KafkaConfig struct {
 	CompressionType string
 	MaxMessageSize  int
 	BufferMemory    int
+	// RetryDelay is the pause before retrying a failed write, growing with
+	// each retry up to 1s or RetryDelay, whichever is larger. Zero means
+	// 100ms. A write is attempted MaxRetry times, 10 if zero; broker and
+	// network errors are retried, others such as an oversized message
+	// aren't.
+	RetryDelay time.Duration
+	// EnvelopeFormat decides how content is encoded as the message value.
+	// Empty means RawEnvelope.
+	EnvelopeFormat EnvelopeFormat
+	// PartitionKeyStrategy picks the message key, and with it the partition
+	// of every message, see PartitionKeyStrategy. Empty keys messages by URL
+	// but spreads them over partitions by load.
+	PartitionKeyStrategy PartitionKeyStrategy
+	// KeyFunc, if set, returns the message key of a page and takes
+	// precedence over PartitionKeyStrategy
+	KeyFunc func(url, sessionID string) string
+	// Completion, if set, is called with every batch of messages once it is
+	// delivered, or with the error that failed it. It is the only way to
+	// learn about failures when BufferMemory makes writes asynchronous.
+	Completion func(messages []kafka.Message, err error)
+	// Logger receives asynchronous delivery failures when Completion is
+	// nil. Nil means slog.Default().
+	Logger *slog.Logger
+}
+
+// PartitionKeyStrategy decides which messages share a partition. Messages
+// with the same key land on the same partition, in the order they were sent.
+type PartitionKeyStrategy string
+
+const (
+	// URLPartitionKey keys messages by page URL
+	URLPartitionKey PartitionKeyStrategy = "url"
+	// DomainPartitionKey keys messages by host, keeping a site's pages in
+	// order on one partition
+	DomainPartitionKey PartitionKeyStrategy = "domain"
+	// SessionPartitionKey keys messages by session ID, or by URL for pages
+	// crawled without one
+	SessionPartitionKey PartitionKeyStrategy = "session"
+)
+
+// Validate rejects unknown strategies
+func (s PartitionKeyStrategy) Validate() error {
+	switch s {
+	case "", URLPartitionKey, DomainPartitionKey, SessionPartitionKey:
+		return nil
+	}
+	return fmt.Errorf("unknown partition key strategy %q (must be 'url', 'domain' or 'session')", string(s))
+}
+
+// key returns the message key of a page of url crawled in sessionID
+func (s PartitionKeyStrategy) key(pageURL, sessionID string) string {
+	switch s {
+	case DomainPartitionKey:
+		if parsedURL, err := url.Parse(pageURL); err == nil && parsedURL.Host != "" {
+			return strings.ToLower(parsedURL.Hostname())
+		}
+	case SessionPartitionKey:
+		if sessionID != "" {
+			return sessionID
+		}
+	}
+	return pageURL
+}
+
+// EnvelopeFormat is the encoding of a Kafka message's value
+type EnvelopeFormat string
+
+const (
+	// RawEnvelope sends the content bytes as they are, with the metadata
+	// only in headers
+	RawEnvelope EnvelopeFormat = "raw"
+	// JSONEnvelope wraps the content and its metadata in a versioned JSON
+	// CrawlEnvelope
+	JSONEnvelope EnvelopeFormat = "json"
+)
+
+// CrawlEnvelopeVersion is the schema version of the CrawlEnvelope sent. It
+// changes whenever a field is removed or its meaning changes.
+const CrawlEnvelopeVersion = 1
+
+// CrawlEnvelope is the message value sent with JSONEnvelope
+type CrawlEnvelope struct {
+	SchemaVersion int         `json:"schema_version"`
+	URL           string      `json:"url"`
+	ContentType   ContentType `json:"content_type"`
+	CrawledAt     time.Time   `json:"crawled_at"`
+	SessionID     string      `json:"session_id,omitempty"`
+	Content       string      `json:"content"`
+}
+
+// Validate rejects unknown envelope formats
+func (f EnvelopeFormat) Validate() error {
+	switch f {
+	case "", RawEnvelope, JSONEnvelope:
+		return nil
+	}
+	return fmt.Errorf("unknown envelope format %q (must be 'raw' or 'json')", string(f))
 }
 
 // LoadKafkaConfig loads Kafka configuration from environment variables
@@ -49,6 +153,15 @@ func LoadKafkaConfig() (KafkaConfig, error) {
 		}
 	}
 
+	var retryDelay time.Duration
+	if retryDelayStr := os.Getenv("KAFKA_RETRY_DELAY"); retryDelayStr != "" {
+		var err error
+		retryDelay, err = time.ParseDuration(retryDelayStr)
+		if err != nil {
+			return KafkaConfig{}, err
+		}
+	}
+
 	useTLSStr := os.Getenv("KAFKA_USE_TLS")
 	useTLS := false
 	if useTLSStr != "" {
@@ -67,9 +180,19 @@ func LoadKafkaConfig() (KafkaConfig, error) {
 		ClientID:        os.Getenv("KAFKA_CLIENT_ID"),
 		UseTLS:          useTLS,
 		MaxRetry:        maxRetry,
+		RetryDelay:      retryDelay,
 		CompressionType: os.Getenv("KAFKA_COMPRESSION"),
 		MaxMessageSize:  0, // Default to 0 (uses Kafka default)
 		BufferMemory:    0, // Default to 0 (uses Kafka default)
+		EnvelopeFormat:  EnvelopeFormat(os.Getenv("KAFKA_ENVELOPE_FORMAT")),
+
+		PartitionKeyStrategy: PartitionKeyStrategy(os.Getenv("KAFKA_PARTITION_KEY")),
+	}
+	if err := config.EnvelopeFormat.Validate(); err != nil {
+		return KafkaConfig{}, err
+	}
+	if err := config.PartitionKeyStrategy.Validate(); err != nil {
+		return KafkaConfig{}, err
 	}
 
 	// Try to parse MaxMessageSize if provided in env
@@ -101,32 +224,19 @@ func CreateKafkaWriter(config KafkaConfig) (*kafka.Writer, error) {
 		return nil, errors.New("no Kafka topic specified")
 	}
 
-	dialer := &kafka.Dialer{
-		Timeout:   10 * time.Second,
-		DualStack: true,
-	}
+	dialer := kafkaDialer(config)
 
-	// Setup SASL authentication if username and password are provided
-	if config.Username != "" && config.Password != "" {
-		mechanism := plain.Mechanism{
-			Username: config.Username,
-			Password: config.Password,
-		}
-		dialer.SASLMechanism = mechanism
-	}
-
-	// Setup TLS if enabled
-	if config.UseTLS {
-		dialer.TLS = &tls.Config{
-			MinVersion: tls.VersionTLS12,
-		}
+	// Partition by key only when the key was chosen for it
+	var balancer kafka.Balancer = &kafka.LeastBytes{}
+	if config.PartitionKeyStrategy != "" || config.KeyFunc != nil {
+		balancer = &kafka.Hash{}
 	}
 
 	// Create the writer with custom buffer configurations
 	writerConfig := kafka.WriterConfig{
 		Brokers:      config.Brokers,
 		Topic:        config.Topic,
-		Balancer:     &kafka.LeastBytes{},
+		Balancer:     balancer,
 		MaxAttempts:  config.MaxRetry,
 		BatchSize:    1,                    // Default to sending immediately
 		BatchTimeout: 1 * time.Millisecond, // Almost no delay
@@ -147,6 +257,23 @@ func CreateKafkaWriter(config KafkaConfig) (*kafka.Writer, error) {
 	}
 
 	writer := kafka.NewWriter(writerConfig)
+	if config.RetryDelay > 0 {
+		writer.WriteBackoffMin = config.RetryDelay
+		writer.WriteBackoffMax = max(config.RetryDelay, time.Second)
+	}
+	writer.Completion = config.Completion
+	if writer.Completion == nil && writerConfig.Async {
+		// WriteMessages returns before delivery, so failures would be lost
+		logger := config.Logger
+		if logger == nil {
+			logger = slog.Default()
+		}
+		writer.Completion = func(messages []kafka.Message, err error) {
+			if err != nil {
+				logger.Error("Failed to deliver Kafka messages", "topic", config.Topic, "messages", len(messages), "error", err)
+			}
+		}
+	}
 
 	// Set compression codec
 	compressionCodec := kafka.Compression(kafka.Gzip) // Default to Gzip
@@ -164,12 +291,72 @@ func CreateKafkaWriter(config KafkaConfig) (*kafka.Writer, error) {
 	}
 	writer.Compression = compressionCodec
 
+	return writer, nil
+}
+
+// KafkaWriter is a Kafka writer that remembers the envelope format its
+// messages are sent in. It is the Kafka Streamer.
+type KafkaWriter struct {
+	*kafka.Writer
+	EnvelopeFormat EnvelopeFormat
+	// KeyFunc returns the message key of a page. Nil keys by URL.
+	KeyFunc func(url, sessionID string) string
+}
+
+// NewKafkaWriter creates a writer like CreateKafkaWriter whose messages
+// StreamToKafka sends in config's envelope format
+func NewKafkaWriter(config KafkaConfig) (*KafkaWriter, error) {
+	if err := config.EnvelopeFormat.Validate(); err != nil {
+		return nil, err
+	}
+	if err := config.PartitionKeyStrategy.Validate(); err != nil {
+		return nil, err
+	}
+	writer, err := CreateKafkaWriter(config)
+	if err != nil {
+		return nil, err
+	}
+	keyFunc := config.KeyFunc
+	if keyFunc == nil {
+		keyFunc = config.PartitionKeyStrategy.key
+	}
+	return &KafkaWriter{Writer: writer, EnvelopeFormat: config.EnvelopeFormat, KeyFunc: keyFunc}, nil
+}
+
+// Stream streams content to Kafka, see StreamToKafka
+func (w *KafkaWriter) Stream(url, htmlContent, markdownContent, sessionID string, types ...ContentType) error {
+	return streamToKafka(w, url, htmlContent, markdownContent, sessionID, types...)
+}
+
+// kafkaDialer creates the dialer for config's brokers, with its SASL
+// credentials, TLS and client ID
+func kafkaDialer(config KafkaConfig) *kafka.Dialer {
+	dialer := &kafka.Dialer{
+		Timeout:   10 * time.Second,
+		DualStack: true,
+	}
+
+	// Setup SASL authentication if username and password are provided
+	if config.Username != "" && config.Password != "" {
+		mechanism := plain.Mechanism{
+			Username: config.Username,
+			Password: config.Password,
+		}
+		dialer.SASLMechanism = mechanism
+	}
+
+	// Setup TLS if enabled
+	if config.UseTLS {
+		dialer.TLS = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+		}
+	}
+
 	// Set client ID if provided
 	if config.ClientID != "" {
 		dialer.ClientID = config.ClientID
 	}
-
-	return writer, nil
+	return dialer
 }
 
 // SendToKafka sends content to Kafka
@@ -190,13 +377,83 @@ func SendToKafka(writer *kafka.Writer, key string, value []byte, headers ...kafk
 	}
 
 	// Write message with retry logic
-	ctx := context.Background()
-	err := writer.WriteMessages(ctx, message)
-	if err != nil {
-		return err
+	return writeKafkaMessage(context.Background(), writer, writerRetry(writer), message)
+}
+
+// Kafka write retry settings, the kafka-go defaults
+const (
+	defaultKafkaAttempts   = 10
+	defaultKafkaBackoffMin = 100 * time.Millisecond
+	defaultKafkaBackoffMax = time.Second
+)
+
+// kafkaMessageWriter is the part of kafka.Writer writeKafkaMessage uses
+type kafkaMessageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// kafkaRetry is how often and how long apart a write is attempted
+type kafkaRetry struct {
+	attempts   int
+	backoffMin time.Duration
+	backoffMax time.Duration
+}
+
+// writerRetry returns the retry settings of writer, which CreateKafkaWriter
+// takes from KafkaConfig.MaxRetry and RetryDelay
+func writerRetry(writer *kafka.Writer) kafkaRetry {
+	retry := kafkaRetry{attempts: writer.MaxAttempts, backoffMin: writer.WriteBackoffMin, backoffMax: writer.WriteBackoffMax}
+	if retry.attempts <= 0 {
+		retry.attempts = defaultKafkaAttempts
+	}
+	if retry.backoffMin <= 0 {
+		retry.backoffMin = defaultKafkaBackoffMin
 	}
+	if retry.backoffMax <= 0 {
+		retry.backoffMax = defaultKafkaBackoffMax
+	}
+	return retry
+}
 
-	return nil
+// writeKafkaMessage writes message, retrying the failures kafka-go doesn't
+// retry itself, such as the broker being unreachable while the topic's
+// partitions are looked up. Failed produce requests come back as
+// kafka.WriteErrors once the writer's own retries are used up, and aren't
+// retried again.
+func writeKafkaMessage(ctx context.Context, writer kafkaMessageWriter, retry kafkaRetry, message kafka.Message) error {
+	delay := retry.backoffMin
+	for attempt := 1; ; attempt++ {
+		err := writer.WriteMessages(ctx, message)
+		if err == nil || attempt >= retry.attempts || !retryableKafkaError(err) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, max(retry.backoffMax, retry.backoffMin))
+	}
+}
+
+// retryableKafkaError reports whether err is a temporary broker error or a
+// network error that happened before any message was produced
+func retryableKafkaError(err error) bool {
+	var writeErrors kafka.WriteErrors
+	if errors.As(err, &writeErrors) {
+		return false
+	}
+	// kafka.Error looks like a net.Error, but only some codes are temporary
+	var kafkaErr kafka.Error
+	if errors.As(err, &kafkaErr) {
+		return kafkaErr.Temporary()
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE)
 }
 
 // ContentType represents the type of content to stream
@@ -207,16 +464,49 @@ const (
 	HTMLContent ContentType = "html"
 	// MarkdownContent is the Markdown content type
 	MarkdownContent ContentType = "markdown"
+	// TextContent is the plain text content type
+	TextContent ContentType = "text"
 )
 
 // StreamToKafka streams content to Kafka based on the specified content types
 // If contentTypes is empty, both HTML and Markdown will be streamed
 // If sessionID is provided, it will be included in message headers
+// writer is a *KafkaWriter, whose envelope format content is sent in, or a
+// *kafka.Writer from CreateKafkaWriter, which sends raw content
 func StreamToKafka(writer interface{}, url string, htmlContent string, markdownContent string, sessionID string, contentTypes ...ContentType) error {
-	kafkaWriter, ok := writer.(*kafka.Writer)
-	if !ok {
+	return streamToKafka(asKafkaWriter(writer), url, htmlContent, markdownContent, sessionID, contentTypes...)
+}
+
+// asKafkaWriter returns writer, a *KafkaWriter or *kafka.Writer, as a
+// *KafkaWriter, or nil if it's neither
+func asKafkaWriter(writer interface{}) *KafkaWriter {
+	switch w := writer.(type) {
+	case *KafkaWriter:
+		if w != nil && w.Writer != nil {
+			return w
+		}
+	case *kafka.Writer:
+		if w != nil {
+			return &KafkaWriter{Writer: w}
+		}
+	}
+	return nil
+}
+
+// streamToKafka is StreamToKafka with writer resolved
+func streamToKafka(writer *KafkaWriter, url string, htmlContent string, markdownContent string, sessionID string, contentTypes ...ContentType) error {
+	if writer == nil {
 		return errors.New("invalid Kafka writer provided")
 	}
+	kafkaWriter := writer.Writer
+	format := RawEnvelope
+	if writer.EnvelopeFormat != "" {
+		format = writer.EnvelopeFormat
+	}
+	key := url
+	if writer.KeyFunc != nil {
+		key = writer.KeyFunc(url, sessionID)
+	}
 
 	// If no content types specified, stream both
 	if len(contentTypes) == 0 {
@@ -236,17 +526,29 @@ func StreamToKafka(writer interface{}, url string, htmlContent string, markdownC
 		})
 	}
 
+	// Tell consumers the value is an envelope rather than the content
+	if format != RawEnvelope {
+		headers = append(headers, kafka.Header{
+			Key:   "envelopeFormat",
+			Value: []byte(format),
+		})
+	}
+
 	// Check if HTML should be streamed
 	if containsContentType(contentTypes, HTMLContent) {
 		htmlHeaders := append(headers, kafka.Header{
 			Key:   "contentType",
-			Value: []byte("text/html"),
+			Value: []byte(contentTypeMIMETypes[HTMLContent]),
 		})
 
-		err := SendToKafka(
+		value, err := encodeEnvelope(format, url, HTMLContent, htmlContent, sessionID)
+		if err != nil {
+			return err
+		}
+		err = SendToKafka(
 			kafkaWriter,
-			url,
-			[]byte(htmlContent),
+			key,
+			value,
 			htmlHeaders...,
 		)
 		if err != nil {
@@ -258,13 +560,17 @@ func StreamToKafka(writer interface{}, url string, htmlContent string, markdownC
 	if containsContentType(contentTypes, MarkdownContent) {
 		markdownHeaders := append(headers, kafka.Header{
 			Key:   "contentType",
-			Value: []byte("text/markdown"),
+			Value: []byte(contentTypeMIMETypes[MarkdownContent]),
 		})
 
-		err := SendToKafka(
+		value, err := encodeEnvelope(format, url, MarkdownContent, markdownContent, sessionID)
+		if err != nil {
+			return err
+		}
+		err = SendToKafka(
 			kafkaWriter,
-			url,
-			[]byte(markdownContent),
+			key,
+			value,
 			markdownHeaders...,
 		)
 		if err != nil {
@@ -275,6 +581,26 @@ func StreamToKafka(writer interface{}, url string, htmlContent string, markdownC
 	return nil
 }
 
+// encodeEnvelope returns the message value carrying content in format, for
+// Kafka and NATS alike
+func encodeEnvelope(format EnvelopeFormat, url string, contentType ContentType, content string, sessionID string) ([]byte, error) {
+	if format != JSONEnvelope {
+		return []byte(content), nil
+	}
+	value, err := json.Marshal(CrawlEnvelope{
+		SchemaVersion: CrawlEnvelopeVersion,
+		URL:           url,
+		ContentType:   contentType,
+		CrawledAt:     time.Now().UTC(),
+		SessionID:     sessionID,
+		Content:       content,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s envelope for %s: %v", contentType, url, err)
+	}
+	return value, nil
+}
+
 // Helper function to check if a content type is in the list
 func containsContentType(types []ContentType, target ContentType) bool {
 	for _, t := range types {
@@ -285,9 +611,10 @@ func containsContentType(types []ContentType, target ContentType) bool {
 	return false
 }
 
-// CloseKafkaWriter safely closes the Kafka writer
+// CloseKafkaWriter safely closes the Kafka writer, a *KafkaWriter or a
+// *kafka.Writer
 func CloseKafkaWriter(writer interface{}) {
-	if kafkaWriter, ok := writer.(*kafka.Writer); ok {
+	if kafkaWriter := asKafkaWriter(writer); kafkaWriter != nil {
 		kafkaWriter.Close()
 	}
 }
@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// contentTypeMIMETypes maps each ContentType to the contentType header value
+// StreamToKafka sends it with
+var contentTypeMIMETypes = map[ContentType]string{
+	HTMLContent:     "text/html",
+	MarkdownContent: "text/markdown",
+	TextContent:     "text/plain",
+}
+
+// CrawlMessage is a crawled page's content as read back from Kafka
+type CrawlMessage struct {
+	URL         string
+	ContentType ContentType // Empty if the contentType header is unknown
+	Timestamp   time.Time   // When the message was sent
+	SessionID   string      // Empty if the crawl had no session
+	Body        []byte
+}
+
+// ParseCrawlMessage reads the headers StreamToKafka sets on a message into a
+// CrawlMessage, unwrapping a JSON envelope into its fields. Missing headers
+// leave their fields empty; a missing or malformed timestamp falls back to
+// the message's own time.
+func ParseCrawlMessage(m kafka.Message) (CrawlMessage, error) {
+	msg := CrawlMessage{Timestamp: m.Time, Body: m.Value}
+	format := RawEnvelope
+	for _, header := range m.Headers {
+		value := string(header.Value)
+		switch header.Key {
+		case "url":
+			msg.URL = value
+		case "contentType":
+			msg.ContentType = contentTypeForMIME(value)
+		case "timestamp":
+			if t, err := time.Parse(time.RFC3339, value); err == nil {
+				msg.Timestamp = t
+			}
+		case "sessionID":
+			msg.SessionID = value
+		case "envelopeFormat":
+			format = EnvelopeFormat(value)
+		}
+	}
+
+	switch format {
+	case RawEnvelope:
+	case JSONEnvelope:
+		var envelope CrawlEnvelope
+		if err := json.Unmarshal(m.Value, &envelope); err != nil {
+			return msg, fmt.Errorf("invalid crawl envelope: %v", err)
+		}
+		if envelope.SchemaVersion > CrawlEnvelopeVersion {
+			return msg, fmt.Errorf("unsupported crawl envelope schema version %d", envelope.SchemaVersion)
+		}
+		msg.URL = envelope.URL
+		msg.ContentType = envelope.ContentType
+		msg.Timestamp = envelope.CrawledAt
+		msg.SessionID = envelope.SessionID
+		msg.Body = []byte(envelope.Content)
+	default:
+		return msg, fmt.Errorf("unknown envelope format %q", string(format))
+	}
+	return msg, nil
+}
+
+// contentTypeForMIME returns the ContentType sent with mimeType, or "" if
+// there is none
+func contentTypeForMIME(mimeType string) ContentType {
+	for contentType, mime := range contentTypeMIMETypes {
+		if mime == mimeType {
+			return contentType
+		}
+	}
+	return ""
+}
+
+// KafkaConsumerOptions filters and positions a KafkaConsumer
+type KafkaConsumerOptions struct {
+	// ContentType, if set, skips messages of other content types
+	ContentType ContentType
+	// SessionID, if set, skips messages from other sessions
+	SessionID string
+	// GroupID joins a consumer group, which spreads partitions across its
+	// members and commits offsets once the handler succeeds. Without one
+	// the consumer reads every partition, starting at new messages.
+	GroupID string
+	// Logger receives errors from the Kafka client and skipped malformed
+	// messages. Nil means slog.Default().
+	Logger *slog.Logger
+}
+
+// KafkaConsumer reads crawl output streamed with StreamToKafka
+type KafkaConsumer struct {
+	reader *kafka.Reader
+	opts   KafkaConsumerOptions
+	logger *slog.Logger
+}
+
+// NewKafkaConsumer creates a consumer of every message on config's topic
+func NewKafkaConsumer(config KafkaConfig) (*KafkaConsumer, error) {
+	return NewKafkaConsumerWithOptions(config, KafkaConsumerOptions{})
+}
+
+// NewKafkaConsumerWithOptions is like NewKafkaConsumer but applies opts
+func NewKafkaConsumerWithOptions(config KafkaConfig, opts KafkaConsumerOptions) (*KafkaConsumer, error) {
+	if len(config.Brokers) == 0 {
+		return nil, errors.New("no Kafka brokers specified")
+	}
+	if config.Topic == "" {
+		return nil, errors.New("no Kafka topic specified")
+	}
+	if opts.ContentType != "" && contentTypeMIMETypes[opts.ContentType] == "" {
+		return nil, fmt.Errorf("unknown content type %q", opts.ContentType)
+	}
+
+	logger := opts.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	readerConfig := kafka.ReaderConfig{
+		Brokers:  config.Brokers,
+		Topic:    config.Topic,
+		GroupID:  opts.GroupID,
+		MinBytes: 10e3, // 10KB
+		MaxBytes: 10e6, // 10MB
+		Dialer:   kafkaDialer(config),
+		ErrorLogger: kafka.LoggerFunc(func(msg string, args ...interface{}) {
+			logger.Error("Kafka consumer error", "error", fmt.Sprintf(msg, args...))
+		}),
+	}
+	if opts.GroupID == "" {
+		readerConfig.StartOffset = kafka.LastOffset
+	}
+
+	return &KafkaConsumer{reader: kafka.NewReader(readerConfig), opts: opts, logger: logger}, nil
+}
+
+// Consume passes each message matching the consumer's filters to handler
+// until ctx is cancelled or handler fails. It returns handler's error, or
+// ctx's once cancelled.
+func (c *KafkaConsumer) Consume(ctx context.Context, handler func(CrawlMessage) error) error {
+	for {
+		m, err := c.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("failed to read Kafka message: %w", err)
+		}
+
+		// A malformed message is skipped rather than blocking the ones after it
+		msg, err := ParseCrawlMessage(m)
+		if err != nil {
+			c.logger.Warn("Skipping malformed Kafka message", "partition", m.Partition, "offset", m.Offset, "error", err)
+		} else if c.matches(msg) {
+			if err := handler(msg); err != nil {
+				return err
+			}
+		}
+
+		// Only consumer groups track offsets
+		if c.opts.GroupID != "" {
+			if err := c.reader.CommitMessages(ctx, m); err != nil {
+				return fmt.Errorf("failed to commit Kafka message: %w", err)
+			}
+		}
+	}
+}
+
+// matches reports whether msg passes the consumer's filters
+func (c *KafkaConsumer) matches(msg CrawlMessage) bool {
+	if c.opts.ContentType != "" && msg.ContentType != c.opts.ContentType {
+		return false
+	}
+	return c.opts.SessionID == "" || msg.SessionID == c.opts.SessionID
+}
+
+// Close closes the consumer's connections, leaving its consumer group if it
+// joined one
+func (c *KafkaConsumer) Close() error {
+	return c.reader.Close()
+}
@@ -0,0 +1,245 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	metadataAPI "github.com/segmentio/kafka-go/protocol/metadata"
+	produceAPI "github.com/segmentio/kafka-go/protocol/produce"
+)
+
+// closedAddr returns a local address nothing listens on, so connecting to it
+// fails at once
+func closedAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+func TestStreamToKafkaAcceptsCreateKafkaWriter(t *testing.T) {
+	writer, err := CreateKafkaWriter(KafkaConfig{Brokers: []string{closedAddr(t)}, Topic: "pages", MaxRetry: 1})
+	if err != nil {
+		t.Fatalf("CreateKafkaWriter: %v", err)
+	}
+	defer CloseKafkaWriter(writer)
+
+	// The writer is accepted, so the error is the unreachable broker's
+	err = StreamToKafka(writer, "https://example.com/", "<p>hi</p>", "hi", "", HTMLContent)
+	if err == nil || strings.Contains(err.Error(), "invalid Kafka writer") {
+		t.Fatalf("StreamToKafka = %v, want a delivery error", err)
+	}
+}
+
+func TestStreamToKafkaRejectsInvalidWriter(t *testing.T) {
+	for _, writer := range []interface{}{nil, "writer", (*kafka.Writer)(nil), (*KafkaWriter)(nil), &KafkaWriter{}} {
+		err := StreamToKafka(writer, "https://example.com/", "", "", "")
+		if err == nil || !strings.Contains(err.Error(), "invalid Kafka writer") {
+			t.Errorf("StreamToKafka(%#v) = %v, want invalid writer", writer, err)
+		}
+		CloseKafkaWriter(writer)
+	}
+}
+
+// flakyKafkaWriter fails its first writes with the errors in errs
+type flakyKafkaWriter struct {
+	errs  []error
+	calls int
+}
+
+func (w *flakyKafkaWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	w.calls++
+	if w.calls <= len(w.errs) {
+		return w.errs[w.calls-1]
+	}
+	return nil
+}
+
+func TestWriteKafkaMessageRetries(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	produceFailed := kafka.WriteErrors{kafka.NotEnoughReplicas}
+	tests := []struct {
+		name      string
+		errs      []error
+		attempts  int
+		wantCalls int
+		wantErr   bool
+	}{
+		{"succeeds at once", nil, 3, 1, false},
+		{"unreachable broker recovers", []error{refused, refused}, 3, 3, false},
+		{"temporary broker error recovers", []error{kafka.LeaderNotAvailable}, 3, 2, false},
+		{"wrapped network error recovers", []error{fmt.Errorf("metadata: %w", syscall.ECONNRESET)}, 3, 2, false},
+		{"attempts used up", []error{refused, refused, refused}, 3, 3, true},
+		{"produce already retried by the writer", []error{produceFailed}, 3, 1, true},
+		{"permanent error", []error{kafka.MessageSizeTooLarge}, 3, 1, true},
+		{"other error", []error{errors.New("invalid topic")}, 3, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writer := &flakyKafkaWriter{errs: tt.errs}
+			retry := kafkaRetry{attempts: tt.attempts, backoffMin: time.Millisecond, backoffMax: time.Millisecond}
+			err := writeKafkaMessage(context.Background(), writer, retry, kafka.Message{Value: []byte("page")})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("writeKafkaMessage = %v, want error %v", err, tt.wantErr)
+			}
+			if writer.calls != tt.wantCalls {
+				t.Errorf("%d write attempts, want %d", writer.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestWriterRetry(t *testing.T) {
+	writer, err := CreateKafkaWriter(KafkaConfig{Brokers: []string{"localhost:9092"}, Topic: "pages", MaxRetry: 4, RetryDelay: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	want := kafkaRetry{attempts: 4, backoffMin: 50 * time.Millisecond, backoffMax: time.Second}
+	if got := writerRetry(writer); got != want {
+		t.Errorf("writerRetry = %+v, want %+v", got, want)
+	}
+	if got := writerRetry(&kafka.Writer{}); got.attempts != defaultKafkaAttempts || got.backoffMin != defaultKafkaBackoffMin {
+		t.Errorf("writerRetry of a default writer = %+v, want the kafka-go defaults", got)
+	}
+}
+
+// fakeBroker answers a writer's requests in memory: topics have a single
+// partition, and produce requests fail with errorCode unless it's zero
+type fakeBroker struct {
+	errorCode kafka.Error
+}
+
+func (b *fakeBroker) RoundTrip(ctx context.Context, addr net.Addr, req kafka.Request) (kafka.Response, error) {
+	switch req := req.(type) {
+	case *metadataAPI.Request:
+		res := &metadataAPI.Response{Brokers: []metadataAPI.ResponseBroker{{NodeID: 1, Host: "localhost", Port: 9092}}}
+		for _, topic := range req.TopicNames {
+			res.Topics = append(res.Topics, metadataAPI.ResponseTopic{
+				Name:       topic,
+				Partitions: []metadataAPI.ResponsePartition{{PartitionIndex: 0, LeaderID: 1}},
+			})
+		}
+		return res, nil
+	case *produceAPI.Request:
+		return &produceAPI.Response{Topics: []produceAPI.ResponseTopic{{
+			Topic:      req.Topics[0].Topic,
+			Partitions: []produceAPI.ResponsePartition{{Partition: 0, ErrorCode: int16(b.errorCode)}},
+		}}}, nil
+	}
+	return nil, fmt.Errorf("unexpected request %T", req)
+}
+
+func TestKafkaCompletion(t *testing.T) {
+	tests := []struct {
+		name      string
+		errorCode kafka.Error
+	}{
+		{"delivered", 0},
+		{"failed", kafka.InvalidRecord},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			delivered := make(map[string]int) // Completions per message
+			var errs []error
+			config := KafkaConfig{
+				Brokers:      []string{"localhost:9092"},
+				Topic:        "pages",
+				MaxRetry:     1,
+				BufferMemory: 1024 * 1024, // Asynchronous writes
+				Completion: func(messages []kafka.Message, err error) {
+					mu.Lock()
+					defer mu.Unlock()
+					for _, m := range messages {
+						delivered[string(m.Value)]++
+					}
+					errs = append(errs, err)
+				},
+			}
+			writer, err := CreateKafkaWriter(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			writer.Transport = &fakeBroker{errorCode: tt.errorCode}
+
+			for _, url := range []string{"https://example.com/a", "https://example.com/b"} {
+				// Asynchronous writes report their outcome to Completion only
+				if err := StreamToKafka(writer, url, "html of "+url, "markdown of "+url, ""); err != nil {
+					t.Fatalf("StreamToKafka: %v", err)
+				}
+			}
+			// Close flushes the pending batches
+			CloseKafkaWriter(writer)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if len(delivered) != 4 {
+				t.Errorf("Completion saw %d messages, want 4: %v", len(delivered), delivered)
+			}
+			for value, count := range delivered {
+				if count != 1 {
+					t.Errorf("Completion saw %q %d times, want once", value, count)
+				}
+			}
+			for _, err := range errs {
+				if tt.errorCode == 0 && err != nil {
+					t.Errorf("Completion error %v, want none", err)
+				}
+				if tt.errorCode != 0 && !errors.Is(err, tt.errorCode) {
+					t.Errorf("Completion error %v, want %v", err, tt.errorCode)
+				}
+			}
+		})
+	}
+}
+
+func TestKafkaAsyncFailuresLogged(t *testing.T) {
+	var logs strings.Builder
+	config := KafkaConfig{
+		Brokers:      []string{"localhost:9092"},
+		Topic:        "pages",
+		MaxRetry:     1,
+		BufferMemory: 1024 * 1024,
+		Logger:       slog.New(slog.NewTextHandler(&syncWriter{w: &logs}, nil)),
+	}
+	writer, err := CreateKafkaWriter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer.Transport = &fakeBroker{errorCode: kafka.InvalidRecord}
+	if err := StreamToKafka(writer, "https://example.com/", "html", "markdown", "", HTMLContent); err != nil {
+		t.Fatalf("StreamToKafka: %v", err)
+	}
+	CloseKafkaWriter(writer)
+
+	if !strings.Contains(logs.String(), "Failed to deliver Kafka messages") {
+		t.Fatalf("delivery failure wasn't logged: %q", logs.String())
+	}
+}
+
+// syncWriter serializes writes to w
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
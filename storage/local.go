@@ -0,0 +1,270 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// DefaultMaxContentBytes is the size text content is truncated to unless
+// SaveOptions.MaxContentBytes says otherwise
+const DefaultMaxContentBytes = 20 * 1024 * 1024 // 20 MB
+
+// NoContentLimit as a MaxContentBytes saves and fetches content whole, for
+// trusted sources only
+const NoContentLimit = -1
+
+// maxBinarySize caps binary captures such as screenshots and PDFs, which
+// are rejected rather than truncated
+const maxBinarySize = 50 * 1024 * 1024 // 50 MB
+
+// binaryFileTypes are the file types that can't be truncated
+var binaryFileTypes = map[string]bool{
+	"png": true,
+	"jpg": true,
+	"pdf": true,
+	// MHTML is text, but truncating it would cut resources in half
+	"mhtml": true,
+}
+
+// LocalBackend stores files in a directory on disk. An empty Dir means the
+// current directory.
+type LocalBackend struct {
+	Dir string
+}
+
+// NewLocalBackend creates a backend writing to dir
+func NewLocalBackend(dir string) *LocalBackend {
+	return &LocalBackend{Dir: dir}
+}
+
+// Upload writes content to the file named key in the backend's directory
+func (b *LocalBackend) Upload(ctx context.Context, key string, content io.Reader, contentType string) error {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return fmt.Errorf("failed to read content for %s: %v", key, err)
+	}
+	_, err = b.write(key, data, slog.Default())
+	return err
+}
+
+// Path returns the file key is stored in
+func (b *LocalBackend) Path(key string) string {
+	if b.Dir == "" || b.Dir == "." {
+		return key
+	}
+	absDir, err := filepath.Abs(b.Dir)
+	if err != nil {
+		return filepath.Join(b.Dir, key)
+	}
+	return filepath.Join(absDir, key)
+}
+
+// Exists reports whether a file is stored under key
+func (b *LocalBackend) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := os.Stat(b.Path(key))
+	if err == nil {
+		return true, nil
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to check %s: %v", key, err)
+}
+
+// write stores data under key, reports it to logger and returns the file path
+func (b *LocalBackend) write(key string, data []byte, logger *slog.Logger) (string, error) {
+	// Check for directory traversal attempts
+	if strings.Contains(b.Dir, "..") {
+		return "", fmt.Errorf("directory traversal attempt detected")
+	}
+
+	// An empty output directory means the current directory
+	dir := b.Dir
+	if dir == "" {
+		dir = "."
+	}
+	absOutputDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("invalid output directory path: %v", err)
+	}
+
+	// Ensure the final path doesn't go outside the intended directory
+	absFilename, err := filepath.Abs(filepath.Join(absOutputDir, key))
+	if err != nil {
+		return "", fmt.Errorf("invalid file path: %v", err)
+	}
+	if !isWithinDir(absOutputDir, absFilename) {
+		return "", fmt.Errorf("path traversal attempt detected")
+	}
+
+	// Create the directory if it doesn't exist, including any the key
+	// itself names, such as a page's resource directory
+	if parent := filepath.Dir(absFilename); dir != "." || parent != absOutputDir {
+		if err := os.MkdirAll(parent, 0755); err != nil {
+			return "", fmt.Errorf("failed to create directory %s: %v", parent, err)
+		}
+	}
+
+	filename := b.Path(key)
+	err = ioutil.WriteFile(filename, data, 0644)
+	if err != nil {
+		return "", fmt.Errorf("failed to save file %s: %v", filename, err)
+	}
+	logger.Info("Saved file", "path", filename)
+	return filename, nil
+}
+
+// isWithinDir reports whether path is strictly inside dir. Both must be
+// absolute. Unlike a prefix check, siblings such as /tmp/output-evil don't
+// count as inside /tmp/output.
+func isWithinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == "." {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// SaveOptions controls how content is stored
+type SaveOptions struct {
+	// Compress gzips text content such as HTML and Markdown, adding a .gz
+	// suffix to its key. Binary captures are already compressed and are
+	// stored as they are.
+	Compress bool
+	// FilenameTemplate names saved files; see FileKeyWithTemplate. Empty
+	// means the default domain_path_hash_YYYY-MM-DD.ext scheme.
+	FilenameTemplate string
+	// OverwritePolicy decides what happens when the file already exists.
+	// It only applies to backends that implement KeyChecker; others are
+	// always overwritten.
+	OverwritePolicy OverwritePolicy
+	// Upload sets the encryption, cache and user metadata of objects saved
+	// to buckets. The URL and save time are added to the metadata.
+	Upload UploadOptions
+	// MaxContentBytes is the size text content is truncated to, at a UTF-8
+	// character boundary. Zero means DefaultMaxContentBytes; a negative
+	// value such as NoContentLimit means no limit. Binary captures are never
+	// truncated.
+	MaxContentBytes int
+	// Logger receives messages about saved and truncated files. Nil means
+	// slog.Default().
+	Logger *slog.Logger
+}
+
+// Save stores data of the given type for url in backend under FileKey and
+// returns where it was stored: a file path for a LocalBackend, the key
+// otherwise. Text over DefaultMaxContentBytes is truncated; binary data over
+// 50 MB is rejected.
+func Save(ctx context.Context, backend StorageBackend, data []byte, url, fileType string) (string, error) {
+	return SaveWithOptions(ctx, backend, data, url, fileType, SaveOptions{})
+}
+
+// SaveWithOptions is like Save but applies opts
+func SaveWithOptions(ctx context.Context, backend StorageBackend, data []byte, url, fileType string, opts SaveOptions) (string, error) {
+	if binaryFileTypes[fileType] {
+		if len(data) > maxBinarySize {
+			return "", fmt.Errorf("%s for URL %s exceeds %d bytes", fileType, url, maxBinarySize)
+		}
+	} else if opts.Truncates(fileType, len(data)) {
+		// Limit content size to prevent denial of service
+		data = TruncateUTF8(data, opts.contentLimit())
+		opts.logger().Warn("Content truncated", "url", url, "limit", opts.contentLimit())
+	}
+
+	key, err := FileKeyWithTemplate(opts.FilenameTemplate, url, fileType)
+	if err != nil {
+		return "", err
+	}
+	suffix := compressedSuffix(fileType, opts)
+	key, skip, err := resolveKey(ctx, backend, key, suffix, opts.OverwritePolicy)
+	if err != nil {
+		return "", fmt.Errorf("failed to check existing %s for URL %s: %v", fileType, url, err)
+	}
+	if skip {
+		location := storedLocation(backend, key)
+		opts.logger().Info("Kept existing file", "url", url, "path", location)
+		return location, nil
+	}
+
+	contentEncoding := ""
+	if suffix != "" {
+		compressed, err := gzipBytes(data)
+		if err != nil {
+			return "", fmt.Errorf("failed to compress %s for URL %s: %v", fileType, url, err)
+		}
+		data = compressed
+		contentEncoding = "gzip"
+	}
+
+	if local, ok := backend.(*LocalBackend); ok {
+		return local.write(key, data, opts.logger())
+	}
+
+	uploadOpts := opts.Upload.withCrawlMetadata(url, time.Now())
+	if err := upload(ctx, backend, key, bytes.NewReader(data), getContentType(fileType), contentEncoding, uploadOpts); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// Truncates reports whether saving size bytes of fileType cuts them to
+// MaxContentBytes
+func (opts SaveOptions) Truncates(fileType string, size int) bool {
+	limit := opts.contentLimit()
+	return !binaryFileTypes[fileType] && limit > 0 && size > limit
+}
+
+// contentLimit returns the size text is truncated to, negative for none
+func (opts SaveOptions) contentLimit() int {
+	if opts.MaxContentBytes == 0 {
+		return DefaultMaxContentBytes
+	}
+	return opts.MaxContentBytes
+}
+
+// TruncateUTF8 cuts data to at most limit bytes, backing off to the start
+// of a character cut in half so the text stays valid UTF-8
+func TruncateUTF8(data []byte, limit int) []byte {
+	if len(data) <= limit {
+		return data
+	}
+	end := limit
+	for i := 1; i < utf8.UTFMax && end > 0 && !utf8.RuneStart(data[end]); i++ {
+		end--
+	}
+	if !utf8.RuneStart(data[end]) {
+		end = limit // Not UTF-8 to begin with
+	}
+	return data[:end]
+}
+
+// logger returns the logger messages about saved files go to
+func (opts SaveOptions) logger() *slog.Logger {
+	if opts.Logger != nil {
+		return opts.Logger
+	}
+	return slog.Default()
+}
+
+// gzipBytes returns data gzip-compressed
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
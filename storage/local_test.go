@@ -0,0 +1,293 @@
+package storage
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateUTF8(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		limit int
+		want  string
+	}{
+		{"under limit", "abc", 5, "abc"},
+		{"at limit", "abcde", 5, "abcde"},
+		{"ascii", "abcdef", 5, "abcde"},
+		{"boundary before multibyte", "abcdé", 4, "abcd"},
+		{"inside two-byte character", "abcdé", 5, "abcd"},
+		{"after two-byte character", "abcdéf", 6, "abcdé"},
+		{"inside three-byte character", "ab€", 3, "ab"},
+		{"inside four-byte character", "a😀b", 4, "a"},
+		{"after four-byte character", "a😀b", 5, "a😀"},
+		{"character at start", "€", 2, ""},
+		{"zero limit", "abc", 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string(TruncateUTF8([]byte(tt.data), tt.limit))
+			if got != tt.want {
+				t.Errorf("TruncateUTF8(%q, %d) = %q, want %q", tt.data, tt.limit, got, tt.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("TruncateUTF8(%q, %d) = %q, not valid UTF-8", tt.data, tt.limit, got)
+			}
+		})
+	}
+}
+
+func TestTruncateUTF8InvalidInput(t *testing.T) {
+	// Continuation bytes only: there is no character start to back off to
+	data := []byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x80}
+	if got := TruncateUTF8(data, 5); len(got) != 5 {
+		t.Fatalf("TruncateUTF8 kept %d bytes of invalid input, want 5", len(got))
+	}
+}
+
+func TestSaveOptionsTruncates(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    int
+		fileType string
+		size     int
+		want     bool
+	}{
+		{"default limit", 0, "html", DefaultMaxContentBytes + 1, true},
+		{"within default limit", 0, "html", DefaultMaxContentBytes, false},
+		{"unlimited", NoContentLimit, "html", 1 << 30, false},
+		{"under limit", 10, "html", 9, false},
+		{"at limit", 10, "md", 10, false},
+		{"over limit", 10, "md", 11, true},
+		{"binary never", 10, "png", 11, false},
+		{"MHTML never", 10, "mhtml", 11, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := SaveOptions{MaxContentBytes: tt.limit}
+			if got := opts.Truncates(tt.fileType, tt.size); got != tt.want {
+				t.Errorf("Truncates(%q, %d) with limit %d = %v, want %v", tt.fileType, tt.size, tt.limit, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSaveWithOptionsTruncatesAtCharacter(t *testing.T) {
+	dir := t.TempDir()
+	content := strings.Repeat("a", 9) + "é" // 11 bytes, é spans bytes 10 and 11
+	path, err := SaveWithOptions(context.Background(), NewLocalBackend(dir), []byte(content),
+		"https://example.com/page", "md", SaveOptions{MaxContentBytes: 10})
+	if err != nil {
+		t.Fatalf("SaveWithOptions: %v", err)
+	}
+	if filepath.Dir(path) != dir {
+		t.Fatalf("saved to %s, want a file in %s", path, dir)
+	}
+	saved, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(saved) != strings.Repeat("a", 9) {
+		t.Fatalf("saved %q, want the content cut before the split character", saved)
+	}
+}
+
+func TestSaveToLocalFileKeepsLimit(t *testing.T) {
+	dir := t.TempDir()
+	content := strings.Repeat("a", localFileMaxContentBytes+100)
+	path, err := SaveToLocalFile(content, "https://example.com/page", "html", dir)
+	if err != nil {
+		t.Fatalf("SaveToLocalFile: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != localFileMaxContentBytes {
+		t.Fatalf("saved %d bytes, want the content cut to %d", info.Size(), localFileMaxContentBytes)
+	}
+}
+
+func TestSaveToLocalFileMHTML(t *testing.T) {
+	dir := t.TempDir()
+	// Past the text limit, which would cut the archive's resources in half
+	content := "From: <Saved by Blink>\r\nMIME-Version: 1.0\r\n" + strings.Repeat("a", localFileMaxContentBytes)
+	path, err := SaveToLocalFile(content, "https://example.com/page", "mhtml", dir)
+	if err != nil {
+		t.Fatalf("SaveToLocalFile: %v", err)
+	}
+	if filepath.Ext(path) != ".mhtml" {
+		t.Fatalf("saved as %s, want a .mhtml file", path)
+	}
+	saved, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(saved) != content {
+		t.Fatalf("saved %d bytes, want all %d", len(saved), len(content))
+	}
+	if got := getContentType("mhtml"); got != "multipart/related" {
+		t.Fatalf("getContentType(mhtml) = %q, want multipart/related", got)
+	}
+}
+
+func TestSaveWithOptionsNoContentLimit(t *testing.T) {
+	dir := t.TempDir()
+	content := strings.Repeat("a", DefaultMaxContentBytes+100)
+	path, err := SaveWithOptions(context.Background(), NewLocalBackend(dir), []byte(content),
+		"https://example.com/page", "md", SaveOptions{MaxContentBytes: NoContentLimit})
+	if err != nil {
+		t.Fatalf("SaveWithOptions: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != int64(len(content)) {
+		t.Fatalf("saved %d bytes, want all %d", info.Size(), len(content))
+	}
+}
+
+func TestIsWithinDir(t *testing.T) {
+	tests := []struct {
+		name   string
+		dir    string
+		path   string
+		within bool
+	}{
+		{"file in dir", "/tmp/output", "/tmp/output/page.html", true},
+		{"nested file", "/tmp/output", "/tmp/output/res/a.css", true},
+		{"dir itself", "/tmp/output", "/tmp/output", false},
+		{"sibling sharing a prefix", "/tmp/output", "/tmp/output-evil/page.html", false},
+		{"parent", "/tmp/output", "/tmp", false},
+		{"escape through parent", "/tmp/output", "/tmp/output/../secret", false},
+		{"file named like parent", "/tmp/output", "/tmp/output/..page.html", true},
+		{"unrelated", "/tmp/output", "/etc/passwd", false},
+		{"root dir", "/", "/etc/passwd", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isWithinDir(tt.dir, tt.path); got != tt.within {
+				t.Errorf("isWithinDir(%q, %q) = %v, want %v", tt.dir, tt.path, got, tt.within)
+			}
+		})
+	}
+}
+
+func TestLocalBackendRejectsTraversal(t *testing.T) {
+	dir := t.TempDir()
+	backend := NewLocalBackend(filepath.Join(dir, "output"))
+	for _, key := range []string{"../escaped.html", "a/../../escaped.html"} {
+		if _, err := backend.write(key, []byte("x"), slog.Default()); err == nil {
+			t.Errorf("write(%q) succeeded, want a path traversal error", key)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escaped.html")); !os.IsNotExist(err) {
+		t.Fatalf("file written outside the output directory: %v", err)
+	}
+}
+
+func TestSaveWithOptionsCompressRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	pageURL := "https://example.com/docs/page"
+	content := strings.Repeat("<p>Compressible content.</p>\n", 100)
+
+	path, err := SaveWithOptions(context.Background(), NewLocalBackend(dir), []byte(content),
+		pageURL, "html", SaveOptions{Compress: true})
+	if err != nil {
+		t.Fatalf("SaveWithOptions: %v", err)
+	}
+	if !strings.HasSuffix(path, ".html.gz") {
+		t.Fatalf("saved to %s, want a .html.gz file", path)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("saved file isn't gzip: %v", err)
+	}
+	decompressed, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("failed to decompress saved file: %v", err)
+	}
+	if string(decompressed) != content {
+		t.Fatal("decompressed content differs from what was saved")
+	}
+
+	htmlFile, _, err := FindFilesForURL(dir, pageURL)
+	if err != nil || htmlFile != path {
+		t.Fatalf("FindFilesForURL = %q, %v; want %q", htmlFile, err, path)
+	}
+}
+
+func TestSaveWithOptionsOverwritePolicy(t *testing.T) {
+	const pageURL = "https://example.com/page"
+	tests := []struct {
+		name   string
+		policy OverwritePolicy
+		// suffixes are the version suffixes of the paths three saves return
+		suffixes []string
+		// contents are the contents of those paths after all saves
+		contents []string
+	}{
+		{"overwrite", Overwrite, []string{"", "", ""}, []string{"v3", "v3", "v3"}},
+		{"skip", Skip, []string{"", "", ""}, []string{"v1", "v1", "v1"}},
+		{"versioned", Versioned, []string{"", "_1", "_2"}, []string{"v1", "v2", "v3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			backend := NewLocalBackend(dir)
+			opts := SaveOptions{OverwritePolicy: tt.policy, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+			var paths []string
+			for _, content := range []string{"v1", "v2", "v3"} {
+				path, err := SaveWithOptions(context.Background(), backend, []byte(content), pageURL, "md", opts)
+				if err != nil {
+					t.Fatalf("SaveWithOptions: %v", err)
+				}
+				paths = append(paths, path)
+			}
+
+			base := strings.TrimSuffix(paths[0], ".md")
+			for i, path := range paths {
+				if want := base + tt.suffixes[i] + ".md"; path != want {
+					t.Errorf("save %d went to %s, want %s", i+1, path, want)
+				}
+				saved, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(saved) != tt.contents[i] {
+					t.Errorf("%s holds %q, want %q", path, saved, tt.contents[i])
+				}
+			}
+		})
+	}
+}
+
+func TestResolveKeyVersionedCompressed(t *testing.T) {
+	dir := t.TempDir()
+	backend := NewLocalBackend(dir)
+	for _, name := range []string{"page.html.gz", "page_1.html.gz"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Versions go before the extension and the compression suffix
+	key, skip, err := resolveKey(context.Background(), backend, "page.html", ".gz", Versioned)
+	if err != nil || skip || key != "page_2.html.gz" {
+		t.Fatalf("resolveKey = %q, %v, %v; want page_2.html.gz", key, skip, err)
+	}
+}
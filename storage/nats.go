@@ -0,0 +1,225 @@
+package storage
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// NATSConfig holds configuration for NATS
+type NATSConfig struct {
+	Servers  []string
+	Subject  string
+	Username string
+	Password string
+	Token    string
+	ClientID string
+	UseTLS   bool
+	// JetStream publishes through JetStream and waits for the stream to
+	// acknowledge every message, instead of core NATS' fire and forget
+	JetStream bool
+	// EnvelopeFormat decides how content is encoded as the message data.
+	// Empty means RawEnvelope.
+	EnvelopeFormat EnvelopeFormat
+}
+
+// LoadNATSConfig loads NATS configuration from environment variables
+func LoadNATSConfig() (NATSConfig, error) {
+	serversStr := os.Getenv("NATS_URL")
+	if serversStr == "" {
+		serversStr = nats.DefaultURL // Default server
+	}
+
+	subject := os.Getenv("NATS_SUBJECT")
+	if subject == "" {
+		subject = "pathik.crawl_data" // Default subject
+	}
+
+	useTLS := false
+	if useTLSStr := os.Getenv("NATS_USE_TLS"); useTLSStr != "" {
+		var err error
+		useTLS, err = strconv.ParseBool(useTLSStr)
+		if err != nil {
+			return NATSConfig{}, err
+		}
+	}
+
+	jetStream := false
+	if jetStreamStr := os.Getenv("NATS_JETSTREAM"); jetStreamStr != "" {
+		var err error
+		jetStream, err = strconv.ParseBool(jetStreamStr)
+		if err != nil {
+			return NATSConfig{}, err
+		}
+	}
+
+	config := NATSConfig{
+		Servers:        strings.Split(serversStr, ","),
+		Subject:        subject,
+		Username:       os.Getenv("NATS_USERNAME"),
+		Password:       os.Getenv("NATS_PASSWORD"),
+		Token:          os.Getenv("NATS_TOKEN"),
+		ClientID:       os.Getenv("NATS_CLIENT_ID"),
+		UseTLS:         useTLS,
+		JetStream:      jetStream,
+		EnvelopeFormat: EnvelopeFormat(os.Getenv("NATS_ENVELOPE_FORMAT")),
+	}
+	if err := config.EnvelopeFormat.Validate(); err != nil {
+		return NATSConfig{}, err
+	}
+	return config, nil
+}
+
+// NATSPublisher publishes crawled content to a NATS subject. It is the
+// NATS Streamer.
+type NATSPublisher struct {
+	conn           *nats.Conn
+	js             nats.JetStreamContext // Nil unless publishing through JetStream
+	subject        string
+	envelopeFormat EnvelopeFormat
+}
+
+// CreateNATSPublisher connects to NATS with the provided configuration
+func CreateNATSPublisher(config NATSConfig) (*NATSPublisher, error) {
+	if len(config.Servers) == 0 {
+		return nil, errors.New("no NATS servers specified")
+	}
+
+	if config.Subject == "" {
+		return nil, errors.New("no NATS subject specified")
+	}
+
+	if err := config.EnvelopeFormat.Validate(); err != nil {
+		return nil, err
+	}
+
+	options := []nats.Option{nats.Timeout(10 * time.Second)}
+
+	// Setup authentication if credentials are provided
+	if config.Username != "" && config.Password != "" {
+		options = append(options, nats.UserInfo(config.Username, config.Password))
+	}
+	if config.Token != "" {
+		options = append(options, nats.Token(config.Token))
+	}
+
+	// Setup TLS if enabled
+	if config.UseTLS {
+		options = append(options, nats.Secure(&tls.Config{
+			MinVersion: tls.VersionTLS12,
+		}))
+	}
+
+	// Set client name if provided
+	if config.ClientID != "" {
+		options = append(options, nats.Name(config.ClientID))
+	}
+
+	conn, err := nats.Connect(strings.Join(config.Servers, ","), options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %v", err)
+	}
+
+	publisher := &NATSPublisher{conn: conn, subject: config.Subject, envelopeFormat: config.EnvelopeFormat}
+	if config.JetStream {
+		publisher.js, err = conn.JetStream()
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to open JetStream context: %v", err)
+		}
+	}
+	return publisher, nil
+}
+
+// SendToNATS publishes content to the publisher's subject
+func SendToNATS(publisher *NATSPublisher, value []byte, header nats.Header) error {
+	// Add timestamp to headers
+	header.Set("timestamp", time.Now().UTC().Format(time.RFC3339))
+
+	msg := &nats.Msg{
+		Subject: publisher.subject,
+		Data:    value,
+		Header:  header,
+	}
+
+	// JetStream acknowledges each message once it's stored
+	if publisher.js != nil {
+		_, err := publisher.js.PublishMsg(msg)
+		return err
+	}
+	if err := publisher.conn.PublishMsg(msg); err != nil {
+		return err
+	}
+	return publisher.conn.Flush()
+}
+
+// StreamToNATS streams content to NATS based on the specified content types
+// with the same headers StreamToKafka sets
+// If contentTypes is empty, both HTML and Markdown will be streamed
+// If sessionID is provided, it will be included in message headers
+func StreamToNATS(publisher *NATSPublisher, url string, htmlContent string, markdownContent string, sessionID string, contentTypes ...ContentType) error {
+	if publisher == nil {
+		return errors.New("invalid NATS publisher provided")
+	}
+
+	// If no content types specified, stream both
+	if len(contentTypes) == 0 {
+		contentTypes = []ContentType{HTMLContent, MarkdownContent}
+	}
+
+	format := publisher.envelopeFormat
+	if format == "" {
+		format = RawEnvelope
+	}
+
+	contents := []struct {
+		contentType ContentType
+		content     string
+	}{
+		{HTMLContent, htmlContent},
+		{MarkdownContent, markdownContent},
+	}
+	for _, c := range contents {
+		if !containsContentType(contentTypes, c.contentType) {
+			continue
+		}
+
+		header := nats.Header{}
+		header.Set("url", url)
+		header.Set("contentType", contentTypeMIMETypes[c.contentType])
+		if sessionID != "" {
+			header.Set("sessionID", sessionID)
+		}
+		if format != RawEnvelope {
+			header.Set("envelopeFormat", string(format))
+		}
+
+		value, err := encodeEnvelope(format, url, c.contentType, c.content, sessionID)
+		if err != nil {
+			return err
+		}
+		if err := SendToNATS(publisher, value, header); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Stream streams content to NATS, see StreamToNATS
+func (p *NATSPublisher) Stream(url, htmlContent, markdownContent, sessionID string, types ...ContentType) error {
+	return StreamToNATS(p, url, htmlContent, markdownContent, sessionID, types...)
+}
+
+// Close flushes pending messages and closes the NATS connection
+func (p *NATSPublisher) Close() error {
+	err := p.conn.Flush()
+	p.conn.Close()
+	return err
+}
@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// OverwritePolicy decides what happens when a file being saved already exists
+type OverwritePolicy int
+
+const (
+	// Overwrite replaces the existing file. This is the default.
+	Overwrite OverwritePolicy = iota
+	// Skip keeps the existing file and returns its path instead of saving
+	Skip
+	// Versioned saves under the first free name with a _1, _2, ... suffix,
+	// e.g. example_com_2025-01-02_1.html
+	Versioned
+)
+
+// maxVersions bounds the search for a free versioned name
+const maxVersions = 10000
+
+// Validate rejects unknown policies
+func (p OverwritePolicy) Validate() error {
+	switch p {
+	case Overwrite, Skip, Versioned:
+		return nil
+	}
+	return fmt.Errorf("unknown overwrite policy %d", p)
+}
+
+// KeyChecker is implemented by backends that can tell whether a key is
+// already stored. Overwrite policies other than Overwrite need it.
+type KeyChecker interface {
+	// Exists reports whether an object is stored under key
+	Exists(ctx context.Context, key string) (bool, error)
+}
+
+// KeyLister is implemented by backends that can enumerate stored keys
+type KeyLister interface {
+	// List returns the keys starting with prefix
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// ObjectExists reports whether an object is stored under key in an S3 or
+// R2 bucket, e.g. a key from FileKey for a page crawled before
+func ObjectExists(client *s3.Client, bucketName, key string) (bool, error) {
+	return (&S3Backend{Client: client, Bucket: bucketName}).Exists(context.TODO(), key)
+}
+
+// ListObjects returns the keys of all objects in an S3 or R2 bucket
+// starting with prefix, e.g. the uploads of one crawl's UUID
+func ListObjects(client *s3.Client, bucketName, prefix string) ([]string, error) {
+	return (&S3Backend{Client: client, Bucket: bucketName}).List(context.TODO(), prefix)
+}
+
+// Existing returns where content of the given type for url is already
+// stored in backend under the name opts would save it as, and whether it
+// is stored at all. Backends that aren't KeyCheckers never report content.
+func Existing(ctx context.Context, backend StorageBackend, url, fileType string, opts SaveOptions) (string, bool, error) {
+	checker, ok := backend.(KeyChecker)
+	if !ok {
+		return "", false, nil
+	}
+	key, err := FileKeyWithTemplate(opts.FilenameTemplate, url, fileType)
+	if err != nil {
+		return "", false, err
+	}
+	key += compressedSuffix(fileType, opts)
+
+	exists, err := checker.Exists(ctx, key)
+	if err != nil || !exists {
+		return "", false, err
+	}
+	return storedLocation(backend, key), true, nil
+}
+
+// resolveKey applies policy to key, which is saved with suffix appended. It
+// returns the key to save under, or skip when an existing file must be kept.
+func resolveKey(ctx context.Context, backend StorageBackend, key, suffix string, policy OverwritePolicy) (resolved string, skip bool, err error) {
+	checker, ok := backend.(KeyChecker)
+	if policy == Overwrite || !ok {
+		return key + suffix, false, nil
+	}
+
+	exists, err := checker.Exists(ctx, key+suffix)
+	if err != nil || !exists {
+		return key + suffix, false, err
+	}
+	if policy == Skip {
+		return key + suffix, true, nil
+	}
+
+	// Version before the extension so the file still opens as its type
+	ext := path.Ext(key)
+	base := strings.TrimSuffix(key, ext)
+	for i := 1; i <= maxVersions; i++ {
+		candidate := fmt.Sprintf("%s_%d%s%s", base, i, ext, suffix)
+		exists, err := checker.Exists(ctx, candidate)
+		if err != nil {
+			return "", false, err
+		}
+		if !exists {
+			return candidate, false, nil
+		}
+	}
+	return "", false, fmt.Errorf("no free version of %s after %d attempts", key+suffix, maxVersions)
+}
+
+// compressedSuffix is the suffix content of fileType gets under opts
+func compressedSuffix(fileType string, opts SaveOptions) string {
+	if opts.Compress && !binaryFileTypes[fileType] {
+		return ".gz"
+	}
+	return ""
+}
+
+// storedLocation is what Save returns for key: a file path for a
+// LocalBackend, the key otherwise
+func storedLocation(backend StorageBackend, key string) string {
+	if local, ok := backend.(*LocalBackend); ok {
+		return local.Path(key)
+	}
+	return key
+}
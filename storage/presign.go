@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// maxPresignExpiry is the longest lifetime S3 accepts for a presigned URL
+const maxPresignExpiry = 7 * 24 * time.Hour
+
+// GeneratePresignedURL returns a time-limited download link for a private
+// object. It is the same as GeneratePresignedGetURL.
+func GeneratePresignedURL(client *s3.Client, bucket, key string, ttl time.Duration) (string, error) {
+	return GeneratePresignedGetURL(client, bucket, key, ttl)
+}
+
+// GeneratePresignedGetURL returns a URL that downloads key for the given
+// time, at most 7 days
+func GeneratePresignedGetURL(client *s3.Client, bucket, key string, expiry time.Duration) (string, error) {
+	if err := validatePresignExpiry(expiry); err != nil {
+		return "", err
+	}
+
+	req, err := s3.NewPresignClient(client).PresignGetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(expiry))
+	if err != nil {
+		return "", fmt.Errorf("failed to presign download of %s: %v", key, err)
+	}
+	return req.URL, nil
+}
+
+// GeneratePresignedPutURL returns a URL that lets a client upload key
+// directly with an HTTP PUT for the given time, at most 7 days
+func GeneratePresignedPutURL(client *s3.Client, bucket, key string, expiry time.Duration) (string, error) {
+	if err := validatePresignExpiry(expiry); err != nil {
+		return "", err
+	}
+
+	req, err := s3.NewPresignClient(client).PresignPutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(expiry))
+	if err != nil {
+		return "", fmt.Errorf("failed to presign upload of %s: %v", key, err)
+	}
+	return req.URL, nil
+}
+
+// validatePresignExpiry checks expiry is positive and within S3's limit
+func validatePresignExpiry(expiry time.Duration) error {
+	if expiry <= 0 {
+		return fmt.Errorf("presigned URL expiry must be positive")
+	}
+	if expiry > maxPresignExpiry {
+		return fmt.Errorf("presigned URL expiry %v exceeds the maximum of %v", expiry, maxPresignExpiry)
+	}
+	return nil
+}
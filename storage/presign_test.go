@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// testS3Client returns a client with static credentials that never needs
+// the network to presign
+func testS3Client(t *testing.T, cfg S3Config) *s3.Client {
+	t.Helper()
+	cfg.AccessKeyID, cfg.AccessKeySecret = "AKIDEXAMPLE", "secret"
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	client, err := CreateAWSS3Client(cfg)
+	if err != nil {
+		t.Fatalf("CreateAWSS3Client: %v", err)
+	}
+	return client
+}
+
+func TestGeneratePresignedURLs(t *testing.T) {
+	client := testS3Client(t, S3Config{BucketName: "pages"})
+	presigners := map[string]func(*s3.Client, string, string, time.Duration) (string, error){
+		"get": GeneratePresignedGetURL,
+		"put": GeneratePresignedPutURL,
+	}
+	for name, presign := range presigners {
+		t.Run(name, func(t *testing.T) {
+			raw, err := presign(client, "pages", "example.com/page.html", 15*time.Minute)
+			if err != nil {
+				t.Fatalf("presign: %v", err)
+			}
+			parsed, err := url.Parse(raw)
+			if err != nil {
+				t.Fatalf("presigned URL %q doesn't parse: %v", raw, err)
+			}
+			if !strings.HasSuffix(parsed.Path, "/example.com/page.html") {
+				t.Errorf("path %q doesn't name the object", parsed.Path)
+			}
+			query := parsed.Query()
+			if query.Get("X-Amz-Signature") == "" {
+				t.Errorf("presigned URL %q has no X-Amz-Signature", raw)
+			}
+			if got := query.Get("X-Amz-Expires"); got != "900" {
+				t.Errorf("X-Amz-Expires = %q, want 900", got)
+			}
+		})
+	}
+}
+
+func TestGeneratePresignedURLExpiry(t *testing.T) {
+	client := testS3Client(t, S3Config{BucketName: "pages"})
+	for _, expiry := range []time.Duration{0, -time.Minute, maxPresignExpiry + time.Second} {
+		if _, err := GeneratePresignedGetURL(client, "pages", "key", expiry); err == nil {
+			t.Errorf("GeneratePresignedGetURL with expiry %v succeeded, want an error", expiry)
+		}
+	}
+	if _, err := GeneratePresignedGetURL(client, "pages", "key", maxPresignExpiry); err != nil {
+		t.Errorf("GeneratePresignedGetURL with the maximum expiry: %v", err)
+	}
+}
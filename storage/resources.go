@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// maxResourceSegment caps the length of each part of a resource's key
+const maxResourceSegment = 100
+
+// unsafeKeyChars are replaced in the parts of resource keys
+var unsafeKeyChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// ResourceDir returns the directory the resources of the page at pageURL,
+// such as its stylesheets and images, are saved in: the name its HTML is
+// saved under with "_files" in place of the extension, like browsers use
+func ResourceDir(pageURL string, opts SaveOptions) (string, error) {
+	key, err := FileKeyWithTemplate(opts.FilenameTemplate, pageURL, "html")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(key, ".html") + "_files", nil
+}
+
+// ResourceKey returns the key the resource at resourceURL is saved under in
+// dir, mirroring its host and path, e.g. dir/cdn.example.com/css/site.css.
+// Resources with a query string get a hash of the URL added so they don't
+// overwrite each other.
+func ResourceKey(dir, resourceURL string) string {
+	parsed, err := url.Parse(resourceURL)
+	if err != nil {
+		return path.Join(dir, "resource_"+urlHash(resourceURL))
+	}
+
+	segments := []string{dir, safeKeySegment(parsed.Host)}
+	for _, segment := range strings.Split(parsed.Path, "/") {
+		if segment != "" && segment != "." && segment != ".." {
+			segments = append(segments, safeKeySegment(segment))
+		}
+	}
+	if len(segments) == 2 || strings.HasSuffix(parsed.Path, "/") {
+		segments = append(segments, "index")
+	}
+	if parsed.RawQuery != "" {
+		last := segments[len(segments)-1]
+		ext := path.Ext(last)
+		segments[len(segments)-1] = strings.TrimSuffix(last, ext) + "_" + urlHash(resourceURL) + ext
+	}
+	return path.Join(segments...)
+}
+
+// safeKeySegment makes one part of a resource key safe as a file name
+func safeKeySegment(segment string) string {
+	if unescaped, err := url.PathUnescape(segment); err == nil {
+		segment = unescaped
+	}
+	segment = unsafeKeyChars.ReplaceAllString(segment, "_")
+	if segment == "." || segment == ".." || segment == "" {
+		segment = "_"
+	}
+	if len(segment) > maxResourceSegment {
+		segment = segment[:maxResourceSegment]
+	}
+	return segment
+}
+
+// SaveResource stores a page resource under key, from ResourceKey, and
+// returns where it was stored like Save. Resources are kept as they are,
+// neither truncated nor compressed, and always overwrite an earlier copy.
+func SaveResource(ctx context.Context, backend StorageBackend, key string, data []byte, contentType string, opts SaveOptions) (string, error) {
+	if len(data) > maxBinarySize {
+		return "", fmt.Errorf("resource %s exceeds %d bytes", key, maxBinarySize)
+	}
+	if local, ok := backend.(*LocalBackend); ok {
+		return local.write(key, data, opts.logger())
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	if err := upload(ctx, backend, key, bytes.NewReader(data), contentType, "", opts.Upload); err != nil {
+		return "", err
+	}
+	return key, nil
+}
@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	_ "modernc.org/sqlite" // Registers the cgo-free "sqlite" driver
+)
+
+// sqliteSchema creates the pages table of a SQLiteSink
+const sqliteSchema = `CREATE TABLE IF NOT EXISTS pages (
+	url          TEXT PRIMARY KEY,
+	domain       TEXT NOT NULL,
+	html         TEXT NOT NULL DEFAULT '',
+	markdown     TEXT NOT NULL DEFAULT '',
+	status       TEXT NOT NULL,
+	crawled_at   TEXT NOT NULL,
+	content_hash TEXT
+);
+CREATE INDEX IF NOT EXISTS pages_domain ON pages (domain);`
+
+// sqliteUpsert stores a page, keeping the content stored before when the
+// new record has none
+const sqliteUpsert = `INSERT INTO pages (url, domain, html, markdown, status, crawled_at, content_hash)
+VALUES (?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (url) DO UPDATE SET
+	domain = excluded.domain,
+	status = excluded.status,
+	crawled_at = excluded.crawled_at,
+	html = CASE WHEN excluded.content_hash IS NULL THEN pages.html ELSE excluded.html END,
+	markdown = CASE WHEN excluded.content_hash IS NULL THEN pages.markdown ELSE excluded.markdown END,
+	content_hash = COALESCE(excluded.content_hash, pages.content_hash)`
+
+// PageRecord is a row of the pages table of a SQLiteSink
+type PageRecord struct {
+	URL       string
+	Domain    string // Host name of URL; derived from URL if empty
+	HTML      string
+	Markdown  string
+	Status    string    // e.g. "ok", "skipped" or "error"
+	CrawledAt time.Time // Zero means now
+	// ContentHash is the ContentHash of HTML, or of Markdown without HTML.
+	// It is computed on Put and empty for records without content.
+	ContentHash string
+}
+
+// SQLiteSink keeps crawled pages in a SQLite database, one row per URL in
+// its pages table, so they can be queried with SQL. It is a Streamer, and
+// safe for concurrent use.
+type SQLiteSink struct {
+	db *sql.DB
+}
+
+// OpenSQLiteSink opens the database at path, creating it and its pages
+// table if needed. Close it when the crawl is done.
+func OpenSQLiteSink(path string) (*SQLiteSink, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQLite database %s: %v", path, err)
+	}
+	// SQLite allows one writer at a time; a single connection queues
+	// concurrent crawls instead of failing them with SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(`PRAGMA journal_mode = WAL; PRAGMA busy_timeout = 5000;` + sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create pages table in %s: %v", path, err)
+	}
+	return &SQLiteSink{db: db}, nil
+}
+
+// DB returns the database, e.g. to run queries over the pages table
+func (s *SQLiteSink) DB() *sql.DB {
+	return s.db
+}
+
+// Put inserts record or replaces the row of its URL. A record without
+// content keeps the content stored before, so recording a failed recrawl
+// doesn't lose the last good copy.
+func (s *SQLiteSink) Put(ctx context.Context, record PageRecord) error {
+	if record.Domain == "" {
+		if parsed, err := url.Parse(record.URL); err == nil {
+			record.Domain = parsed.Hostname()
+		}
+	}
+	if record.CrawledAt.IsZero() {
+		record.CrawledAt = time.Now()
+	}
+	var hash sql.NullString
+	switch {
+	case record.HTML != "":
+		hash = sql.NullString{String: ContentHash([]byte(record.HTML)), Valid: true}
+	case record.Markdown != "":
+		hash = sql.NullString{String: ContentHash([]byte(record.Markdown)), Valid: true}
+	}
+
+	_, err := s.db.ExecContext(ctx, sqliteUpsert, record.URL, record.Domain, record.HTML, record.Markdown,
+		record.Status, record.CrawledAt.UTC().Format(time.RFC3339Nano), hash)
+	if err != nil {
+		return fmt.Errorf("failed to store %s: %v", record.URL, err)
+	}
+	return nil
+}
+
+// Get returns the row of url and whether there is one
+func (s *SQLiteSink) Get(ctx context.Context, url string) (PageRecord, bool, error) {
+	var record PageRecord
+	var crawledAt string
+	var hash sql.NullString
+	err := s.db.QueryRowContext(ctx,
+		`SELECT url, domain, html, markdown, status, crawled_at, content_hash FROM pages WHERE url = ?`, url,
+	).Scan(&record.URL, &record.Domain, &record.HTML, &record.Markdown, &record.Status, &crawledAt, &hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return PageRecord{}, false, nil
+	}
+	if err != nil {
+		return PageRecord{}, false, fmt.Errorf("failed to read %s: %v", url, err)
+	}
+	record.ContentHash = hash.String
+	record.CrawledAt, err = time.Parse(time.RFC3339Nano, crawledAt)
+	if err != nil {
+		return PageRecord{}, false, fmt.Errorf("invalid crawl time of %s: %v", url, err)
+	}
+	return record, true, nil
+}
+
+// Stream stores the content of url of each of types, HTML and Markdown if
+// none are given, with status "ok"
+func (s *SQLiteSink) Stream(url, htmlContent, markdownContent, sessionID string, types ...ContentType) error {
+	// If no content types specified, store both
+	if len(types) == 0 {
+		types = []ContentType{HTMLContent, MarkdownContent}
+	}
+	record := PageRecord{URL: url, Status: "ok"}
+	if containsContentType(types, HTMLContent) {
+		record.HTML = htmlContent
+	}
+	if containsContentType(types, MarkdownContent) {
+		record.Markdown = markdownContent
+	}
+	return s.Put(context.Background(), record)
+}
+
+// Close closes the database
+func (s *SQLiteSink) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestSQLiteSinkStoreAndQuery(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "pages.db")
+	sink, err := OpenSQLiteSink(path)
+	if err != nil {
+		t.Fatalf("OpenSQLiteSink: %v", err)
+	}
+
+	const pageURL = "https://example.com/docs"
+	if err := sink.Stream(pageURL, "<h1>Docs</h1>", "# Docs", ""); err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+	// A failed recrawl keeps the content stored before
+	if err := sink.Put(ctx, PageRecord{URL: pageURL, Status: "error"}); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	sink, err = OpenSQLiteSink(path)
+	if err != nil {
+		t.Fatalf("reopening: %v", err)
+	}
+	defer sink.Close()
+
+	var domain, html, markdown, status, hash string
+	err = sink.DB().QueryRowContext(ctx,
+		`SELECT domain, html, markdown, status, content_hash FROM pages WHERE url = ?`, pageURL,
+	).Scan(&domain, &html, &markdown, &status, &hash)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if domain != "example.com" || html != "<h1>Docs</h1>" || markdown != "# Docs" || status != "error" {
+		t.Errorf("row = %q, %q, %q, %q", domain, html, markdown, status)
+	}
+	if hash != ContentHash([]byte("<h1>Docs</h1>")) {
+		t.Errorf("content_hash = %q, want the hash of the HTML", hash)
+	}
+
+	record, ok, err := sink.Get(ctx, pageURL)
+	if err != nil || !ok {
+		t.Fatalf("Get = %v, %v", ok, err)
+	}
+	if record.HTML != html || record.CrawledAt.IsZero() {
+		t.Errorf("Get = %+v, want the stored row", record)
+	}
+	if _, ok, err := sink.Get(ctx, "https://example.com/missing"); ok || err != nil {
+		t.Errorf("Get of a missing URL = %v, %v; want false, nil", ok, err)
+	}
+}
@@ -4,10 +4,11 @@ import (
 	"context"
 	"fmt"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -25,6 +26,16 @@ type R2Config struct {
 	AccessKeySecret string
 	BucketName      string
 	Region          string
+	// PublicDomain is the bucket's public domain, e.g. a custom domain or
+	// its r2.dev subdomain. Uploads report public URLs when it is set.
+	PublicDomain string
+	// KeyPrefix is the UploadOptions.KeyPrefix for uploads to the bucket,
+	// e.g. "crawls/{{.Date}}/"
+	KeyPrefix string
+	// MaxRetries and RetryDelay control the retries of transient errors
+	// like those of S3Config
+	MaxRetries int
+	RetryDelay time.Duration
 }
 
 // LoadR2Config loads R2 configuration from environment variables
@@ -35,6 +46,8 @@ func LoadR2Config() (R2Config, error) {
 		AccessKeySecret: os.Getenv("R2_ACCESS_KEY_SECRET"),
 		BucketName:      os.Getenv("R2_BUCKET_NAME"),
 		Region:          os.Getenv("R2_REGION"),
+		PublicDomain:    os.Getenv("R2_PUBLIC_DOMAIN"),
+		KeyPrefix:       os.Getenv("R2_KEY_PREFIX"),
 	}
 
 	// Check if required values are set
@@ -43,6 +56,17 @@ func LoadR2Config() (R2Config, error) {
 		return config, fmt.Errorf("missing required R2 configuration in environment variables")
 	}
 
+	if err := ValidateKeyPrefix(config.KeyPrefix); err != nil {
+		return config, fmt.Errorf("invalid R2_KEY_PREFIX: %v", err)
+	}
+	if value := os.Getenv("R2_MAX_RETRIES"); value != "" {
+		maxRetries, err := strconv.Atoi(value)
+		if err != nil || maxRetries < 0 {
+			return config, fmt.Errorf("invalid R2_MAX_RETRIES %q", value)
+		}
+		config.MaxRetries = maxRetries
+	}
+
 	// Set default region if not specified
 	if config.Region == "" {
 		config.Region = "auto" // R2 typically uses "auto" as region
@@ -59,8 +83,14 @@ func CreateS3Client(cfg R2Config) (*s3.Client, error) {
 		}, nil
 	})
 
+	retryer, err := s3Retryer(cfg.MaxRetries, cfg.RetryDelay)
+	if err != nil {
+		return nil, err
+	}
+
 	awsCfg, err := config.LoadDefaultConfig(context.TODO(),
 		config.WithEndpointResolverWithOptions(r2Resolver),
+		retryer,
 		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
 			cfg.AccessKeyID,
 			cfg.AccessKeySecret,
@@ -75,8 +105,21 @@ func CreateS3Client(cfg R2Config) (*s3.Client, error) {
 	return s3.NewFromConfig(awsCfg), nil
 }
 
-// SanitizeURL converts a URL to a safe filename component
+// SanitizeURL converts a URL to a safe filename component. A hash of the
+// full URL is appended, since different URLs can sanitize to the same text.
 func SanitizeURL(urlStr string) string {
+	result := sanitizeURLText(urlStr)
+
+	// Truncate if too long (max 200 chars for filename safety)
+	if len(result) > 200 {
+		result = result[:200]
+	}
+
+	return result + "_" + urlHash(urlStr)
+}
+
+// sanitizeURLText is the readable part of SanitizeURL
+func sanitizeURLText(urlStr string) string {
 	// Parse the URL
 	parsedURL, err := url.Parse(urlStr)
 	if err != nil {
@@ -110,40 +153,87 @@ func SanitizeURL(urlStr string) string {
 	// Ensure no directory traversal is possible
 	result = strings.ReplaceAll(result, "..", "_")
 
-	// Truncate if too long (max 200 chars for filename safety)
-	if len(result) > 200 {
-		result = result[:200]
-	}
-
 	return result
 }
 
+// UploadResult describes an uploaded object
+type UploadResult struct {
+	Key string // Object key in the bucket
+	URL string // Public URL of the object, empty if the bucket has no public domain
+
+	Path  string // Local file that was uploaded
+	Error error  // Why the file wasn't uploaded, set by UploadDirectory
+}
+
 // UploadFileToR2 uploads a file to R2 bucket
-func UploadFileToR2(client *s3.Client, bucketName, filePath, uuid, originalURL, fileType string) error {
-	// Read file content
-	content, err := ioutil.ReadFile(filePath)
+func UploadFileToR2(client *s3.Client, bucketName, filePath, uuid, originalURL, fileType string) (UploadResult, error) {
+	return UploadFileToR2WithOptions(client, bucketName, filePath, uuid, originalURL, fileType, UploadOptions{})
+}
+
+// UploadFileToR2WithOptions is like UploadFileToR2 but applies opts to the
+// object
+func UploadFileToR2WithOptions(client *s3.Client, bucketName, filePath, uuid, originalURL, fileType string, opts UploadOptions) (UploadResult, error) {
+	return uploadFile(&S3Backend{Client: client, Bucket: bucketName}, "R2", filePath, uuid, originalURL, fileType, opts)
+}
+
+// uploadFile uploads a file to backend, keyed as
+// prefix/UUID+sanitizedURL.extension. The object's metadata records
+// originalURL and, as the crawl time, when the file was written.
+func uploadFile(backend StorageBackend, name, filePath, uuid, originalURL, fileType string, opts UploadOptions) (UploadResult, error) {
+	if err := opts.Validate(); err != nil {
+		return UploadResult{}, err
+	}
+
+	// Stream the file rather than reading it into memory
+	file, err := os.Open(filePath)
+	if err != nil {
+		return UploadResult{}, fmt.Errorf("failed to read file %s: %v", filePath, err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
 	if err != nil {
-		return fmt.Errorf("failed to read file %s: %v", filePath, err)
+		return UploadResult{}, fmt.Errorf("failed to read file %s: %v", filePath, err)
 	}
+	opts = opts.withCrawlMetadata(originalURL, info.ModTime())
 
-	// Create key in format UUID+sanitizedURL.extension
+	// Create key in format prefix/UUID+sanitizedURL.extension
+	prefix, err := ExpandKeyPrefix(opts.KeyPrefix, originalURL, fileType)
+	if err != nil {
+		return UploadResult{}, err
+	}
 	sanitizedURL := SanitizeURL(originalURL)
-	key := fmt.Sprintf("%s+%s.%s", uuid, sanitizedURL, fileType)
-
-	// Upload to R2
-	_, err = client.PutObject(context.TODO(), &s3.PutObjectInput{
-		Bucket:      aws.String(bucketName),
-		Key:         aws.String(key),
-		Body:        strings.NewReader(string(content)),
-		ContentType: aws.String(getContentType(fileType)),
-	})
+	key := fmt.Sprintf("%s%s+%s.%s", prefix, uuid, sanitizedURL, fileType)
 
+	// Files saved compressed keep their encoding so they are served decoded
+	contentEncoding := ""
+	if strings.HasSuffix(filePath, ".gz") {
+		key += ".gz"
+		contentEncoding = "gzip"
+	}
+
+	err = upload(context.TODO(), backend, key, file, getContentType(fileType), contentEncoding, opts)
 	if err != nil {
-		return fmt.Errorf("failed to upload %s to R2: %v", filePath, err)
+		return UploadResult{}, fmt.Errorf("failed to upload %s to %s: %v", filePath, name, err)
 	}
 
-	fmt.Printf("Successfully uploaded %s to R2 as %s\n", filePath, key)
-	return nil
+	result := UploadResult{Key: key, Path: filePath}
+	if public, ok := backend.(publicURLer); ok {
+		result.URL = public.PublicURL(key)
+	}
+
+	slog.Info("Uploaded file", "path", filePath, "backend", name, "key", key)
+	return result, nil
+}
+
+// UploadFile uploads a file to any backend under the same key scheme as
+// UploadFileToR2
+func UploadFile(backend StorageBackend, filePath, uuid, originalURL, fileType string) (UploadResult, error) {
+	return UploadFileWithOptions(backend, filePath, uuid, originalURL, fileType, UploadOptions{})
+}
+
+// UploadFileWithOptions is like UploadFile but applies opts to the object
+func UploadFileWithOptions(backend StorageBackend, filePath, uuid, originalURL, fileType string, opts UploadOptions) (UploadResult, error) {
+	return uploadFile(backend, "storage", filePath, uuid, originalURL, fileType, opts)
 }
 
 // getContentType returns the MIME type based on file extension
@@ -153,12 +243,28 @@ func getContentType(fileType string) string {
 		return "text/html"
 	case "md":
 		return "text/markdown"
+	case "txt":
+		return "text/plain"
+	case "json", "har":
+		return "application/json"
+	case "png":
+		return "image/png"
+	case "jpg":
+		return "image/jpeg"
+	case "pdf":
+		return "application/pdf"
+	case "mhtml":
+		return "multipart/related"
+	case "warc":
+		return "application/warc"
 	default:
 		return "application/octet-stream"
 	}
 }
 
-// FindFilesForURL finds HTML and MD files for a given URL
+// FindFilesForURL finds HTML and MD files for a given URL. Files named by
+// the default scheme are told apart by the URL's hash; files saved by older
+// versions, without it, are matched by domain and path alone.
 func FindFilesForURL(directory, urlStr string) (htmlFile, mdFile string, err error) {
 	domain := GetDomainNameForFile(urlStr)
 
@@ -167,15 +273,21 @@ func FindFilesForURL(directory, urlStr string) (htmlFile, mdFile string, err err
 		return "", "", fmt.Errorf("failed to read directory %s: %v", directory, err)
 	}
 
-	for _, file := range files {
-		if strings.HasPrefix(file.Name(), domain) {
-			ext := filepath.Ext(file.Name())
-			if ext == ".html" {
-				htmlFile = filepath.Join(directory, file.Name())
-			} else if ext == ".md" {
-				mdFile = filepath.Join(directory, file.Name())
+	for _, prefix := range []string{domain + "_" + urlHash(urlStr) + "_", domain} {
+		for _, file := range files {
+			if strings.HasPrefix(file.Name(), prefix) {
+				// Compressed files are matched by their inner extension
+				ext := filepath.Ext(strings.TrimSuffix(file.Name(), ".gz"))
+				if ext == ".html" {
+					htmlFile = filepath.Join(directory, file.Name())
+				} else if ext == ".md" {
+					mdFile = filepath.Join(directory, file.Name())
+				}
 			}
 		}
+		if htmlFile != "" || mdFile != "" {
+			break
+		}
 	}
 
 	if htmlFile == "" && mdFile == "" {
@@ -189,7 +301,7 @@ func FindFilesForURL(directory, urlStr string) (htmlFile, mdFile string, err err
 func GetDomainNameForFile(pageURL string) string {
 	parsedURL, err := url.Parse(pageURL)
 	if err != nil {
-		log.Printf("Error parsing URL %s: %v", pageURL, err)
+		slog.Warn("Could not parse URL", "url", pageURL, "error", err)
 		return "unknown"
 	}
 	domain := strings.ReplaceAll(parsedURL.Hostname(), ".", "_")
@@ -201,68 +313,45 @@ func GetDomainNameForFile(pageURL string) string {
 	return fmt.Sprintf("%s_%s", domain, path)
 }
 
-// SaveToLocalFile saves content to a file with the appropriate extension
-func SaveToLocalFile(content, url, fileType, outputDir string) (string, error) {
-	// Check for directory traversal attempts
-	if strings.Contains(outputDir, "..") {
-		return "", fmt.Errorf("directory traversal attempt detected")
-	}
-
-	// Limit content size to prevent denial of service
-	maxContentSize := 10 * 1024 * 1024 // 10 MB
-	if len(content) > maxContentSize {
-		content = content[:maxContentSize]
-		log.Printf("Warning: Content for URL %s truncated to %d bytes", url, maxContentSize)
-	}
-
-	domain := GetDomainNameForFile(url)
-	date := time.Now().Format("2006-01-02")
-
-	// Ensure safe file type
-	safeFileType := fileType
-	if fileType != "html" && fileType != "md" {
-		safeFileType = "txt" // Default to txt if type is unexpected
-	}
-
-	filename := fmt.Sprintf("%s_%s.%s", domain, date, safeFileType)
-
-	// Use the specified output directory or current directory
-	if outputDir != "" && outputDir != "." {
-		// Validate output directory path
-		absOutputDir, err := filepath.Abs(outputDir)
-		if err != nil {
-			return "", fmt.Errorf("invalid output directory path: %v", err)
-		}
-
-		// Create the directory if it doesn't exist
-		if err := os.MkdirAll(absOutputDir, 0755); err != nil {
-			return "", fmt.Errorf("failed to create directory %s: %v", absOutputDir, err)
-		}
-
-		filename = filepath.Join(absOutputDir, filename)
-	}
+// allowedFileTypes lists the extensions files are saved with as-is; any
+// other type is saved as .txt
+var allowedFileTypes = map[string]bool{
+	"html":  true,
+	"md":    true,
+	"json":  true,
+	"har":   true,
+	"txt":   true,
+	"png":   true,
+	"jpg":   true,
+	"pdf":   true,
+	"mhtml": true,
+}
 
-	// Ensure the final path doesn't go outside the intended directory
-	absFilename, err := filepath.Abs(filename)
-	if err != nil {
-		return "", fmt.Errorf("invalid file path: %v", err)
-	}
+// localFileMaxContentBytes is the size SaveToLocalFile truncates content to
+const localFileMaxContentBytes = 10 * 1024 * 1024 // 10 MB
 
-	absOutputDir, err := filepath.Abs(outputDir)
-	if err != nil {
-		return "", fmt.Errorf("invalid output directory path: %v", err)
-	}
+// SaveToLocalFile saves content to a file with the appropriate extension,
+// truncated to 10 MB
+func SaveToLocalFile(content, url, fileType, outputDir string) (string, error) {
+	opts := SaveOptions{MaxContentBytes: localFileMaxContentBytes}
+	return SaveWithOptions(context.TODO(), NewLocalBackend(outputDir), []byte(content), url, fileType, opts)
+}
 
-	if !strings.HasPrefix(absFilename, absOutputDir) {
-		return "", fmt.Errorf("path traversal attempt detected")
+// SaveScreenshot saves PNG or JPEG screenshot data next to the page's other
+// files. Unlike text content, images can't be truncated, so oversized
+// screenshots are rejected.
+func SaveScreenshot(data []byte, url, outputDir string) (string, error) {
+	fileType := "png"
+	if len(data) >= 2 && data[0] == 0xff && data[1] == 0xd8 {
+		fileType = "jpg"
 	}
+	return Save(context.TODO(), NewLocalBackend(outputDir), data, url, fileType)
+}
 
-	err = ioutil.WriteFile(filename, []byte(content), 0644)
-	if err != nil {
-		return "", fmt.Errorf("failed to save file %s: %v", filename, err)
-	}
-	fmt.Printf("✅ Saved to %s\n", filename)
-	return filename, nil
+// SavePDF saves a PDF rendering of the page next to its other files.
+// Oversized documents are rejected rather than truncated.
+func SavePDF(data []byte, url, outputDir string) (string, error) {
+	return Save(context.TODO(), NewLocalBackend(outputDir), data, url, "pdf")
 }
 
 // InitEnv loads environment variables from .env file
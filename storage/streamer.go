@@ -0,0 +1,31 @@
+package storage
+
+import "encoding/json"
+
+// Streamer sends crawled content to a message system such as Kafka or NATS
+type Streamer interface {
+	// Stream sends the content of url of each of types, HTML and Markdown if
+	// none are given. A non-empty sessionID is sent along with it.
+	Stream(url, htmlContent, markdownContent, sessionID string, types ...ContentType) error
+	// Close flushes pending messages and releases the connection
+	Close() error
+}
+
+// MetadataStreamer is implemented by Streamers that can also record a
+// page's metadata. Crawls extracting metadata call StreamWithMetadata
+// instead of Stream.
+type MetadataStreamer interface {
+	// StreamWithMetadata is like Stream but also sends metadata, the page's
+	// metadata as a JSON object
+	StreamWithMetadata(url, htmlContent, markdownContent, sessionID string, metadata json.RawMessage, types ...ContentType) error
+}
+
+var (
+	_ Streamer = (*KafkaWriter)(nil)
+	_ Streamer = (*NATSPublisher)(nil)
+	_ Streamer = (*WebhookSink)(nil)
+	_ Streamer = (*JSONLSink)(nil)
+	_ Streamer = (*SQLiteSink)(nil)
+
+	_ MetadataStreamer = (*JSONLSink)(nil)
+)
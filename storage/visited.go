@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// VisitedStore remembers which URLs a crawl has finished, so an interrupted
+// crawl can be resumed without fetching them again
+type VisitedStore interface {
+	// Has reports whether url was marked
+	Has(ctx context.Context, url string) (bool, error)
+	// Mark records url as visited
+	Mark(ctx context.Context, url string) error
+}
+
+// MemoryVisitedStore is a VisitedStore that lives as long as the process
+type MemoryVisitedStore struct {
+	mu   sync.Mutex
+	urls map[string]bool
+}
+
+// NewMemoryVisitedStore creates an empty in-memory store
+func NewMemoryVisitedStore() *MemoryVisitedStore {
+	return &MemoryVisitedStore{urls: make(map[string]bool)}
+}
+
+// Has reports whether url was marked
+func (s *MemoryVisitedStore) Has(ctx context.Context, url string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.urls[url], nil
+}
+
+// Mark records url as visited
+func (s *MemoryVisitedStore) Mark(ctx context.Context, url string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.urls[url] = true
+	return nil
+}
+
+// FileVisitedStore is a VisitedStore kept in a file listing one URL per
+// line. Marks are appended, so they survive the process being killed.
+type FileVisitedStore struct {
+	mu   sync.Mutex
+	file *os.File
+	urls map[string]bool
+}
+
+// NewFileVisitedStore opens the store kept at path, creating it if needed.
+// Close it when the crawl is done.
+func NewFileVisitedStore(path string) (*FileVisitedStore, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open visited store %s: %v", path, err)
+	}
+
+	s := &FileVisitedStore{file: file, urls: make(map[string]bool)}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if url := strings.TrimSpace(scanner.Text()); url != "" {
+			s.urls[url] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read visited store %s: %v", path, err)
+	}
+	return s, nil
+}
+
+// Has reports whether url was marked, in this run or an earlier one
+func (s *FileVisitedStore) Has(ctx context.Context, url string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.urls[url], nil
+}
+
+// Mark appends url to the file
+func (s *FileVisitedStore) Mark(ctx context.Context, url string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.urls[url] {
+		return nil
+	}
+	// URLs can't contain raw newlines, but a bad one mustn't corrupt the file
+	if strings.ContainsAny(url, "\r\n") {
+		return fmt.Errorf("invalid URL %q", url)
+	}
+	if _, err := s.file.WriteString(url + "\n"); err != nil {
+		return fmt.Errorf("failed to write visited store %s: %v", s.file.Name(), err)
+	}
+	s.urls[url] = true
+	return nil
+}
+
+// Close closes the file
+func (s *FileVisitedStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileVisitedStoreReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "visited.txt")
+
+	store, err := NewFileVisitedStore(path)
+	if err != nil {
+		t.Fatalf("NewFileVisitedStore: %v", err)
+	}
+	for _, url := range []string{"https://example.com/a", "https://example.com/b", "https://example.com/a"} {
+		if err := store.Mark(ctx, url); err != nil {
+			t.Fatalf("Mark(%s): %v", url, err)
+		}
+	}
+	if err := store.Mark(ctx, "https://example.com/\nbad"); err == nil {
+		t.Error("Mark accepted a URL with a newline")
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Marks are written once each
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "https://example.com/a\nhttps://example.com/b\n" {
+		t.Fatalf("store file = %q", data)
+	}
+
+	store, err = NewFileVisitedStore(path)
+	if err != nil {
+		t.Fatalf("reopening: %v", err)
+	}
+	defer store.Close()
+	for url, want := range map[string]bool{
+		"https://example.com/a": true,
+		"https://example.com/b": true,
+		"https://example.com/c": false,
+	} {
+		if got, err := store.Has(ctx, url); err != nil || got != want {
+			t.Errorf("Has(%s) after reopening = %v, %v; want %v", url, got, err, want)
+		}
+	}
+}
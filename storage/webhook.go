@@ -0,0 +1,199 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Webhook defaults
+const (
+	defaultWebhookTimeout    = 30 * time.Second
+	defaultWebhookMaxRetry   = 3
+	defaultWebhookRetryDelay = time.Second
+)
+
+// WebhookConfig holds configuration for a webhook
+type WebhookConfig struct {
+	URL string
+	// Headers are sent with every request, e.g. an Authorization header
+	Headers map[string]string
+	// Timeout bounds each request. Zero means 30s.
+	Timeout time.Duration
+	// MaxRetry is the total number of attempts per page. Zero means 3.
+	MaxRetry int
+	// RetryDelay is the pause before the first retry, doubled for each
+	// retry after it. Zero means 1s.
+	RetryDelay time.Duration
+}
+
+// LoadWebhookConfig loads webhook configuration from environment variables.
+// PATHIK_WEBHOOK_TOKEN, if set, is sent as a bearer token.
+func LoadWebhookConfig() (WebhookConfig, error) {
+	config := WebhookConfig{URL: os.Getenv("PATHIK_WEBHOOK_URL")}
+	if config.URL == "" {
+		return WebhookConfig{}, errors.New("PATHIK_WEBHOOK_URL is not set")
+	}
+
+	if token := os.Getenv("PATHIK_WEBHOOK_TOKEN"); token != "" {
+		config.Headers = map[string]string{"Authorization": "Bearer " + token}
+	}
+
+	if maxRetryStr := os.Getenv("PATHIK_WEBHOOK_MAX_RETRY"); maxRetryStr != "" {
+		var err error
+		config.MaxRetry, err = strconv.Atoi(maxRetryStr)
+		if err != nil {
+			return WebhookConfig{}, err
+		}
+	}
+
+	if timeoutStr := os.Getenv("PATHIK_WEBHOOK_TIMEOUT"); timeoutStr != "" {
+		var err error
+		config.Timeout, err = time.ParseDuration(timeoutStr)
+		if err != nil {
+			return WebhookConfig{}, err
+		}
+	}
+
+	return config, nil
+}
+
+// WebhookPayload is the JSON body POSTed for each page and content type
+type WebhookPayload struct {
+	URL         string      `json:"url"`
+	ContentType ContentType `json:"content_type"`
+	Content     string      `json:"content"`
+	SessionID   string      `json:"session_id,omitempty"`
+	Timestamp   time.Time   `json:"timestamp"`
+}
+
+// WebhookSink is a Streamer POSTing every page to an HTTP endpoint
+type WebhookSink struct {
+	config WebhookConfig
+	client *http.Client
+}
+
+// webhookStatusError reports a non-2xx response from the webhook
+type webhookStatusError struct {
+	StatusCode int
+}
+
+func (e *webhookStatusError) Error() string {
+	return fmt.Sprintf("webhook responded with status %d", e.StatusCode)
+}
+
+// NewWebhookSink creates a sink POSTing to config.URL
+func NewWebhookSink(config WebhookConfig) (*WebhookSink, error) {
+	parsedURL, err := url.Parse(config.URL)
+	if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+		return nil, fmt.Errorf("invalid webhook URL %q: must be an http or https URL", config.URL)
+	}
+	if config.Timeout < 0 || config.RetryDelay < 0 || config.MaxRetry < 0 {
+		return nil, errors.New("webhook timeout, retry delay and max retry must not be negative")
+	}
+
+	if config.Timeout == 0 {
+		config.Timeout = defaultWebhookTimeout
+	}
+	if config.MaxRetry == 0 {
+		config.MaxRetry = defaultWebhookMaxRetry
+	}
+	if config.RetryDelay == 0 {
+		config.RetryDelay = defaultWebhookRetryDelay
+	}
+	return &WebhookSink{config: config, client: &http.Client{Timeout: config.Timeout}}, nil
+}
+
+// Stream POSTs a WebhookPayload per content type of url, HTML and Markdown
+// if none are given. A non-2xx response is an error.
+func (s *WebhookSink) Stream(url, htmlContent, markdownContent, sessionID string, types ...ContentType) error {
+	// If no content types specified, stream both
+	if len(types) == 0 {
+		types = []ContentType{HTMLContent, MarkdownContent}
+	}
+
+	contents := []struct {
+		contentType ContentType
+		content     string
+	}{
+		{HTMLContent, htmlContent},
+		{MarkdownContent, markdownContent},
+	}
+	for _, c := range contents {
+		if !containsContentType(types, c.contentType) {
+			continue
+		}
+
+		body, err := json.Marshal(WebhookPayload{
+			URL:         url,
+			ContentType: c.contentType,
+			Content:     c.content,
+			SessionID:   sessionID,
+			Timestamp:   time.Now().UTC(),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to encode webhook payload for %s: %v", url, err)
+		}
+		if err := s.post(body); err != nil {
+			return fmt.Errorf("failed to send %s of %s to webhook: %w", c.contentType, url, err)
+		}
+	}
+	return nil
+}
+
+// post sends body, retrying connection errors, 5xx and 429 responses
+func (s *WebhookSink) post(body []byte) error {
+	var err error
+	delay := s.config.RetryDelay
+	for attempt := 1; attempt <= s.config.MaxRetry; attempt++ {
+		if attempt > 1 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+
+		err = s.postOnce(body)
+		var se *webhookStatusError
+		if err == nil || (errors.As(err, &se) && se.StatusCode < 500 && se.StatusCode != http.StatusTooManyRequests) {
+			return err
+		}
+	}
+	return err
+}
+
+// postOnce makes a single request
+func (s *WebhookSink) postOnce(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, s.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range s.config.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// Drain the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &webhookStatusError{StatusCode: resp.StatusCode}
+	}
+	return nil
+}
+
+// Close releases the sink's idle connections
+func (s *WebhookSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}